@@ -1,38 +1,89 @@
 package api
 
 import (
+	"archive/zip"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/geovannyAvelar/lukla/heightmap"
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	"github.com/gorilla/handlers"
+	"github.com/spatial-go/geoos/geoencoding/geojson"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// Seconds clients should wait before requesting again a tile rejected by a full render queue
+const renderRetryAfter = 1
+
 type HttpApi struct {
 	Router         *chi.Mux
 	HeightmapGen   HeightMapGenerator
 	BasePath       string
 	AllowedOrigins []string
+	// Downloads Progress of the SRTM downloads. Nil when SRTM files are not downloaded
+	Downloads DownloadMonitor
+	// Prefetcher Downloader of the DEM files of regions. Nil when SRTM files are not downloaded
+	Prefetcher DemPrefetcher
+	// DemReader Counters of the HGT files read by the API. Nil when the DEM is not a directory of uncompressed
+	// HGT files
+	DemReader DemReaderMonitor
+	// CacheMaxAge Cache-Control max-age of the responses of each route (CacheRouteTiles, CacheRouteTerrain,
+	// CacheRouteFlood and CacheRouteHeightmap), in seconds. Routes not defined use DefaultCacheMaxAge
+	CacheMaxAge map[string]int
+	// AdminToken Bearer token required by the admin endpoints, which are disabled when it is empty
+	AdminToken string
 }
 
 type HeightMapGenerator interface {
 	GetTileHeightmap(z, x, y, resolution int) ([]byte, error)
 	CreateHeightMapImage(lat, lon float64, side float64, conf heightmap.ResolutionConfig) ([]byte, error)
+	GetEncodedTileHeightmap(z, x, y, resolution int, encoding heightmap.HeightmapEncoding) ([]byte, error)
+	TileModTime(layer string, z, x, y, resolution int) (time.Time, error)
+	PruneTiles(filter heightmap.TileFilter) (*heightmap.PruneReport, error)
+	CreateEncodedHeightMapImage(lat, lon float64, side float64, conf heightmap.ResolutionConfig,
+		encoding heightmap.HeightmapEncoding) ([]byte, error)
 	GetPointsElevations(points []heightmap.Point) []heightmap.Point
 	GenerateAllTilesInZoomLevel(zoomLevel int)
+	CreateFloodMap(conf heightmap.FloodConfig) (*geojson.FeatureCollection, error)
+	GetFloodTile(z, x, y, resolution int, conf heightmap.FloodConfig) ([]byte, error)
+	CreateTerrainIndexImage(lat, lon float64, side float64, conf heightmap.ResolutionConfig,
+		index heightmap.TerrainIndexConfig) ([]byte, error)
+	CreateTerrainIndexGeoTiff(lat, lon float64, side float64, index heightmap.TerrainIndexConfig) ([]byte, error)
+	GetTerrainIndexTile(z, x, y, resolution int, index heightmap.TerrainIndexConfig) ([]byte, error)
+	CreateShadowMaskImage(conf heightmap.SolarConfig, res heightmap.ResolutionConfig) ([]byte, error)
+	CreateShadowMaskGeoTiff(conf heightmap.SolarConfig) ([]byte, error)
+	CreateInsolationImage(conf heightmap.SolarConfig, res heightmap.ResolutionConfig) ([]byte, error)
+	CreateInsolationGeoTiff(conf heightmap.SolarConfig) ([]byte, error)
+	CreateSolarDayFiles(conf heightmap.SolarConfig, res heightmap.ResolutionConfig) (map[string][]byte, error)
 }
 
 type coordinate struct {
 	Latitude  float64 `json:"longitude"`
 	Longitude float64 `json:"latitude"`
 	Elevation int16   `json:"elevation"`
+	Source    string  `json:"source,omitempty"`
+}
+
+type floodCoordinate struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type floodRequest struct {
+	Latitude   float64           `json:"latitude"`
+	Longitude  float64           `json:"longitude"`
+	Side       float64           `json:"side"`
+	WaterLevel float64           `json:"waterLevel"`
+	Seed       *floodCoordinate  `json:"seed"`
+	River      []floodCoordinate `json:"river"`
 }
 
 func (c coordinate) toPoint() heightmap.Point {
@@ -47,17 +98,34 @@ func (a HttpApi) Run(port int) error {
 		return errors.New("invalid HTTP port")
 	}
 
+	// HEAD requests are answered by the GET handlers, without the body
+	a.Router.Use(middleware.GetHead)
+
 	a.Router.Route(a.BasePath, func(r chi.Router) {
 		r.Get("/heightmap", a.handleSquare)
 		r.Post("/heightmap/points", a.handleHeightmapProfile)
 		r.Get("/{z}/{x}/{y}.png", a.handleTile)
 		r.Get("/{resolution}/{z}/{x}/{y}.png", a.handleTile)
 		r.Post("/processTiles/{z}", a.processAllTiles)
+		r.Delete("/tiles", a.handlePruneTiles)
+		r.Post("/flood", a.handleFlood)
+		r.Get("/flood/{z}/{x}/{y}.png", a.handleFloodTile)
+		r.Get("/flood/{resolution}/{z}/{x}/{y}.png", a.handleFloodTile)
+		r.Get("/terrain/{index}/{z}/{x}/{y}.png", a.handleTerrainIndexTile)
+		r.Get("/terrain/{index}/{resolution}/{z}/{x}/{y}.png", a.handleTerrainIndexTile)
+		r.Get("/solar/shadow", a.handleShadowMask)
+		r.Get("/solar/insolation", a.handleInsolation)
+		r.Get("/solar/day", a.handleSolarDay)
+		r.Get("/srtm/downloads", a.handleDownloads)
+		r.Post("/srtm/prefetch", a.handlePrefetch)
+		r.Get("/srtm/prefetch/{id}", a.handlePrefetchJob)
+		r.Get("/srtm/coverage", a.handleCoverage)
+		r.Get("/srtm/reader", a.handleDemReader)
 	})
 
-	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With"})
+	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Authorization"})
 	originsOk := handlers.AllowedOrigins(a.AllowedOrigins)
-	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS"})
+	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"})
 
 	handler := handlers.CORS(originsOk, headersOk, methodsOk)(a.Router)
 
@@ -76,19 +144,30 @@ func (a HttpApi) handleTile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bytes, err := a.HeightmapGen.GetTileHeightmap(tileCoords["z"], tileCoords["x"], tileCoords["y"],
-		resolution)
+	encoding, err := heightmap.ParseHeightmapEncoding(r.URL.Query().Get("encoding"))
 
 	if err != nil {
-		http.Error(w, "cannot generate heightmap. "+err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	contentDisposition := fmt.Sprintf("inline; filename=\"%d.png\"", tileCoords["y"])
+	var bytes []byte
 
-	w.Header().Add("Content-Type", "image/png")
-	w.Header().Add("Content-Disposition", contentDisposition)
-	w.Write(bytes)
+	if encoding == heightmap.Grayscale {
+		bytes, err = a.HeightmapGen.GetTileHeightmap(tileCoords["z"], tileCoords["x"], tileCoords["y"],
+			resolution)
+	} else {
+		bytes, err = a.HeightmapGen.GetEncodedTileHeightmap(tileCoords["z"], tileCoords["x"], tileCoords["y"],
+			resolution, encoding)
+	}
+
+	if err != nil {
+		a.writeTileError(w, "cannot generate heightmap. ", err)
+		return
+	}
+
+	a.writeCacheablePng(w, r, CacheRouteTiles, fmt.Sprintf("%d.png", tileCoords["y"]), bytes,
+		a.tileModTime(string(encoding), tileCoords, resolution))
 }
 
 func (a HttpApi) handleSquare(w http.ResponseWriter, r *http.Request) {
@@ -101,19 +180,103 @@ func (a HttpApi) handleSquare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b, err := a.HeightmapGen.CreateHeightMapImage(lat, lon, side,
-		heightmap.ResolutionConfig{Width: res, Height: res})
+	if r.URL.Query().Get("index") != "" {
+		a.handleTerrainIndexSquare(w, r, lat, lon, side, res)
+		return
+	}
+
+	encoding, err := heightmap.ParseHeightmapEncoding(r.URL.Query().Get("encoding"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var b []byte
+	resConf := heightmap.ResolutionConfig{Width: res, Height: res}
+
+	if encoding == heightmap.Grayscale {
+		b, err = a.HeightmapGen.CreateHeightMapImage(lat, lon, side, resConf)
+	} else {
+		b, err = a.HeightmapGen.CreateEncodedHeightMapImage(lat, lon, side, resConf, encoding)
+	}
 
 	if err != nil {
 		http.Error(w, "cannot generate heightmap. "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	a.writeCacheablePng(w, r, CacheRouteHeightmap, "heightmap.png", b, time.Time{})
+}
+
+func (a HttpApi) handleTerrainIndexSquare(w http.ResponseWriter, r *http.Request, lat, lon, side float64,
+	res int) {
+	index, err := a.parseTerrainIndex(r, r.URL.Query().Get("index"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if a.isGeoTiffRequested(r) {
+		b, err := a.HeightmapGen.CreateTerrainIndexGeoTiff(lat, lon, side, index)
+
+		if err != nil {
+			http.Error(w, "cannot generate terrain index. "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		contentDisposition := fmt.Sprintf("attachment; filename=\"%s.tif\"", index.Index)
+
+		w.Header().Add("Content-Type", "image/tiff")
+		w.Header().Add("Content-Disposition", contentDisposition)
+		w.Write(b)
+		return
+	}
+
+	b, err := a.HeightmapGen.CreateTerrainIndexImage(lat, lon, side,
+		heightmap.ResolutionConfig{Width: res, Height: res}, index)
+
+	if err != nil {
+		http.Error(w, "cannot generate terrain index. "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentDisposition := fmt.Sprintf("inline; filename=\"%s.png\"", index.Index)
+
 	w.Header().Add("Content-Type", "image/png")
-	w.Header().Add("Content-Disposition", "inline; filename=\"heightmap.png\"")
+	w.Header().Add("Content-Disposition", contentDisposition)
 	w.Write(b)
 }
 
+func (a HttpApi) handleTerrainIndexTile(w http.ResponseWriter, r *http.Request) {
+	tileCoords, err := a.parseTileCoordinates(r)
+	resolution := a.parseTileResolution(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	index, err := a.parseTerrainIndex(r, chi.URLParam(r, "index"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bytes, err := a.HeightmapGen.GetTerrainIndexTile(tileCoords["z"], tileCoords["x"], tileCoords["y"],
+		resolution, index)
+
+	if err != nil {
+		a.writeTileError(w, "cannot generate terrain index tile. ", err)
+		return
+	}
+
+	a.writeCacheablePng(w, r, CacheRouteTerrain, fmt.Sprintf("%d.png", tileCoords["y"]), bytes,
+		a.tileModTime(index.LayerName(), tileCoords, resolution))
+}
+
 func (a HttpApi) handleHeightmapProfile(w http.ResponseWriter, r *http.Request) {
 	bytes, err := io.ReadAll(r.Body)
 
@@ -141,6 +304,188 @@ func (a HttpApi) handleHeightmapProfile(w http.ResponseWriter, r *http.Request)
 	w.Write(bytes)
 }
 
+func (a HttpApi) handleFlood(w http.ResponseWriter, r *http.Request) {
+	bytes, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		http.Error(w, "cannot generate flood map. Cause: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req floodRequest
+	err = json.Unmarshal(bytes, &req)
+
+	if err != nil {
+		http.Error(w, "cannot generate flood map. Cause: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Side <= 0 || req.Side > 50000 {
+		req.Side = 10000
+	}
+
+	conf := heightmap.FloodConfig{
+		Lat:        req.Latitude,
+		Lon:        req.Longitude,
+		Side:       req.Side,
+		WaterLevel: req.WaterLevel,
+	}
+
+	if req.Seed != nil {
+		conf.Seed = &heightmap.Point{Lat: req.Seed.Latitude, Lon: req.Seed.Longitude}
+	}
+
+	for _, c := range req.River {
+		conf.River = append(conf.River, heightmap.Point{Lat: c.Latitude, Lon: c.Longitude})
+	}
+
+	collection, err := a.HeightmapGen.CreateFloodMap(conf)
+
+	if err != nil {
+		http.Error(w, "cannot generate flood map. Cause: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bytes, err = json.Marshal(collection)
+
+	if err != nil {
+		http.Error(w, "cannot generate flood map. Cause: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/geo+json")
+	w.Write(bytes)
+}
+
+func (a HttpApi) handleFloodTile(w http.ResponseWriter, r *http.Request) {
+	tileCoords, err := a.parseTileCoordinates(r)
+	resolution := a.parseTileResolution(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lat, lon, err := a.parseSquareCoordinates(r)
+
+	if err != nil {
+		http.Error(w, "invalid flood seed. "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	level, err := strconv.ParseFloat(r.URL.Query().Get("level"), 64)
+
+	if err != nil {
+		http.Error(w, "invalid water level", http.StatusBadRequest)
+		return
+	}
+
+	conf := heightmap.NewFloodConfigAroundSeed(lat, lon, a.parseSquareSide(r), level)
+
+	bytes, err := a.HeightmapGen.GetFloodTile(tileCoords["z"], tileCoords["x"], tileCoords["y"],
+		resolution, conf)
+
+	if err != nil {
+		a.writeTileError(w, "cannot generate flood tile. ", err)
+		return
+	}
+
+	a.writeCacheablePng(w, r, CacheRouteFlood, fmt.Sprintf("%d.png", tileCoords["y"]), bytes, time.Time{})
+}
+
+func (a HttpApi) handleShadowMask(w http.ResponseWriter, r *http.Request) {
+	conf, err := a.parseSolarConfig(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := a.parseSquareResolution(r)
+
+	if a.isGeoTiffRequested(r) {
+		b, err := a.HeightmapGen.CreateShadowMaskGeoTiff(conf)
+		a.writeRaster(w, b, err, "shadow.tif")
+		return
+	}
+
+	b, err := a.HeightmapGen.CreateShadowMaskImage(conf, heightmap.ResolutionConfig{Width: res, Height: res})
+	a.writeRaster(w, b, err, "shadow.png")
+}
+
+func (a HttpApi) handleInsolation(w http.ResponseWriter, r *http.Request) {
+	conf, err := a.parseSolarConfig(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := a.parseSquareResolution(r)
+
+	if a.isGeoTiffRequested(r) {
+		b, err := a.HeightmapGen.CreateInsolationGeoTiff(conf)
+		a.writeRaster(w, b, err, "insolation.tif")
+		return
+	}
+
+	b, err := a.HeightmapGen.CreateInsolationImage(conf, heightmap.ResolutionConfig{Width: res, Height: res})
+	a.writeRaster(w, b, err, "insolation.png")
+}
+
+func (a HttpApi) handleSolarDay(w http.ResponseWriter, r *http.Request) {
+	conf, err := a.parseSolarConfig(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := a.parseSquareResolution(r)
+
+	files, err := a.HeightmapGen.CreateSolarDayFiles(conf, heightmap.ResolutionConfig{Width: res, Height: res})
+
+	if err != nil {
+		http.Error(w, "cannot simulate solar day. "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/zip")
+	w.Header().Add("Content-Disposition", "attachment; filename=\"solar.zip\"")
+
+	archive := zip.NewWriter(w)
+
+	for name, b := range files {
+		f, err := archive.Create(name)
+
+		if err != nil {
+			log.Errorf("cannot add %s to solar archive. Cause: %s", name, err)
+			return
+		}
+
+		f.Write(b)
+	}
+
+	archive.Close()
+}
+
+func (a HttpApi) writeRaster(w http.ResponseWriter, b []byte, err error, filename string) {
+	if err != nil {
+		http.Error(w, "cannot generate raster. "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType := "image/png"
+
+	if strings.HasSuffix(filename, ".tif") {
+		contentType = "image/tiff"
+	}
+
+	w.Header().Add("Content-Type", contentType)
+	w.Header().Add("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filename))
+	w.Write(b)
+}
+
 func (a HttpApi) processAllTiles(w http.ResponseWriter, r *http.Request) {
 	zParam := chi.URLParam(r, "z")
 
@@ -165,11 +510,24 @@ func (a HttpApi) getElevations(coordinates []coordinate) []coordinate {
 
 	for i, p := range points {
 		coordinates[i].Elevation = p.Elevation
+		coordinates[i].Source = p.Source
 	}
 
 	return coordinates
 }
 
+// writeTileError Respond to a tile which cannot be rendered. Tiles rejected by a full render queue are answered
+// with 503 Service Unavailable and a Retry-After header
+func (a HttpApi) writeTileError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, heightmap.ErrRenderQueueFull) {
+		w.Header().Set("Retry-After", strconv.Itoa(renderRetryAfter))
+		http.Error(w, message+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	http.Error(w, message+err.Error(), http.StatusBadRequest)
+}
+
 func (a HttpApi) parseTileCoordinates(r *http.Request) (map[string]int, error) {
 	xParam := chi.URLParam(r, "x")
 	yParam := chi.URLParam(r, "y")
@@ -199,6 +557,75 @@ func (a HttpApi) parseTileResolution(r *http.Request) int {
 	return resolution
 }
 
+func (a HttpApi) parseTerrainIndex(r *http.Request, name string) (heightmap.TerrainIndexConfig, error) {
+	index, err := heightmap.ParseTerrainIndex(name)
+
+	if err != nil {
+		return heightmap.TerrainIndexConfig{}, err
+	}
+
+	radius, err := strconv.Atoi(r.URL.Query().Get("radius"))
+
+	if err != nil || radius < 1 || radius > 50 {
+		radius = 1
+	}
+
+	return heightmap.TerrainIndexConfig{Index: index, Radius: radius}, nil
+}
+
+func (a HttpApi) isGeoTiffRequested(r *http.Request) bool {
+	format := r.URL.Query().Get("format")
+	return format == "tiff" || format == "geotiff"
+}
+
+// parseSolarConfig Parse the simulated square and its instant, informed as a RFC 3339 time or as a date
+// (YYYY-MM-DD) in an IANA time zone (default is UTC). Intervals, in minutes, shorter than MinSolarInterval are
+// rejected
+func (a HttpApi) parseSolarConfig(r *http.Request) (heightmap.SolarConfig, error) {
+	lat, lon, err := a.parseSquareCoordinates(r)
+
+	if err != nil {
+		return heightmap.SolarConfig{}, err
+	}
+
+	conf := heightmap.SolarConfig{Lat: lat, Lon: lon, Side: a.parseSquareSide(r)}
+
+	if timeParam := r.URL.Query().Get("time"); timeParam != "" {
+		conf.Time, err = time.Parse(time.RFC3339, timeParam)
+
+		if err != nil {
+			return heightmap.SolarConfig{}, errors.New("invalid time. Use RFC 3339 format")
+		}
+	} else {
+		location := time.UTC
+
+		if tz := r.URL.Query().Get("timezone"); tz != "" {
+			location, err = time.LoadLocation(tz)
+
+			if err != nil {
+				return heightmap.SolarConfig{}, errors.New("invalid time zone")
+			}
+		}
+
+		conf.Time, err = time.ParseInLocation("2006-01-02", r.URL.Query().Get("date"), location)
+
+		if err != nil {
+			return heightmap.SolarConfig{}, errors.New("invalid date. Use YYYY-MM-DD format")
+		}
+	}
+
+	if interval, err := strconv.Atoi(r.URL.Query().Get("interval")); err == nil && interval > 0 {
+		conf.Interval = time.Duration(interval) * time.Minute
+
+		if conf.Interval < heightmap.MinSolarInterval {
+			return heightmap.SolarConfig{}, fmt.Errorf("invalid interval. Use at least %.0f minutes",
+				heightmap.MinSolarInterval.Minutes())
+		}
+	}
+
+	return conf, nil
+}
+
 func (a HttpApi) parseSquareCoordinates(r *http.Request) (float64, float64, error) {
 	latParam := r.URL.Query().Get("lat")
 	lonParam := r.URL.Query().Get("lon")
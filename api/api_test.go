@@ -4,10 +4,13 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/geovannyAvelar/lukla/heightmap"
 	"github.com/go-chi/chi"
+	"github.com/spatial-go/geoos/geoencoding/geojson"
 )
 
 type HeightmapGenTest struct {
@@ -17,10 +20,28 @@ func (h HeightmapGenTest) GetTileHeightmap(z, x, y, resolution int) ([]byte, err
 	return []byte{}, nil
 }
 
+func (h HeightmapGenTest) TileModTime(layer string, z, x, y, resolution int) (time.Time, error) {
+	return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+func (h HeightmapGenTest) PruneTiles(filter heightmap.TileFilter) (*heightmap.PruneReport, error) {
+	return &heightmap.PruneReport{Removed: filter.Resolution}, nil
+}
+
 func (h HeightmapGenTest) CreateHeightMapImage(lat, lon, side float64, conf heightmap.ResolutionConfig) ([]byte, error) {
 	return []byte{}, nil
 }
 
+func (h HeightmapGenTest) GetEncodedTileHeightmap(z, x, y, resolution int,
+	encoding heightmap.HeightmapEncoding) ([]byte, error) {
+	return []byte(encoding), nil
+}
+
+func (h HeightmapGenTest) CreateEncodedHeightMapImage(lat, lon, side float64, conf heightmap.ResolutionConfig,
+	encoding heightmap.HeightmapEncoding) ([]byte, error) {
+	return []byte(encoding), nil
+}
+
 func (h HeightmapGenTest) GetPointsElevations(points []heightmap.Point) []heightmap.Point {
 	return points
 }
@@ -29,6 +50,52 @@ func (h HeightmapGenTest) GenerateAllTilesInZoomLevel(zoomLevel int) {
 
 }
 
+func (h HeightmapGenTest) CreateFloodMap(conf heightmap.FloodConfig) (*geojson.FeatureCollection, error) {
+	return geojson.NewFeatureCollection(), nil
+}
+
+func (h HeightmapGenTest) GetFloodTile(z, x, y, resolution int, conf heightmap.FloodConfig) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (h HeightmapGenTest) CreateTerrainIndexImage(lat, lon, side float64, conf heightmap.ResolutionConfig,
+	index heightmap.TerrainIndexConfig) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (h HeightmapGenTest) CreateTerrainIndexGeoTiff(lat, lon, side float64,
+	index heightmap.TerrainIndexConfig) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (h HeightmapGenTest) GetTerrainIndexTile(z, x, y, resolution int,
+	index heightmap.TerrainIndexConfig) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (h HeightmapGenTest) CreateShadowMaskImage(conf heightmap.SolarConfig,
+	res heightmap.ResolutionConfig) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (h HeightmapGenTest) CreateShadowMaskGeoTiff(conf heightmap.SolarConfig) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (h HeightmapGenTest) CreateInsolationImage(conf heightmap.SolarConfig,
+	res heightmap.ResolutionConfig) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (h HeightmapGenTest) CreateInsolationGeoTiff(conf heightmap.SolarConfig) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (h HeightmapGenTest) CreateSolarDayFiles(conf heightmap.SolarConfig,
+	res heightmap.ResolutionConfig) (map[string][]byte, error) {
+	return map[string][]byte{"insolation.tif": {}}, nil
+}
+
 func TestHandleTile(t *testing.T) {
 	t.Parallel()
 
@@ -55,6 +122,36 @@ func TestHandleTile(t *testing.T) {
 	}
 }
 
+// overloadedHeightmapGenTest Generator whose render queue is full
+type overloadedHeightmapGenTest struct {
+	HeightmapGenTest
+}
+
+func (h overloadedHeightmapGenTest) GetTileHeightmap(z, x, y, resolution int) ([]byte, error) {
+	return nil, heightmap.ErrRenderQueueFull
+}
+
+func TestHandleTileOverloaded(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest("GET", "/0/0/0.png", nil)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("z", "0")
+	rctx.URLParams.Add("x", "0")
+	rctx.URLParams.Add("y", "0")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	api := HttpApi{HeightmapGen: overloadedHeightmapGenTest{}}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(api.handleTile).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected status %d with Retry-After, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
+
 func TestHandleSquare(t *testing.T) {
 	t.Parallel()
 
@@ -77,3 +174,195 @@ func TestHandleSquare(t *testing.T) {
 		t.Errorf("Handler returned wrong status code. Expected: %d. Got: %d.", http.StatusOK, status)
 	}
 }
+
+func TestHandleFlood(t *testing.T) {
+	t.Parallel()
+
+	body := strings.NewReader(`{"latitude": 0.1, "longitude": 0.0, "side": 1000, "waterLevel": 10, ` +
+		`"seed": {"latitude": 0.095, "longitude": 0.005}}`)
+	req, err := http.NewRequest("POST", "/flood", body)
+
+	if err != nil {
+		t.Errorf("Error creating a new request: %v", err)
+	}
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(api.handleFlood)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code. Expected: %d. Got: %d.", http.StatusOK, status)
+	}
+}
+
+func TestHandleFloodTileWithoutLevel(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest("GET", "/flood/0/0/0.png?lat=0.0&lon=0.0", nil)
+
+	if err != nil {
+		t.Errorf("Error creating a new request: %v", err)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("z", "0")
+	rctx.URLParams.Add("x", "0")
+	rctx.URLParams.Add("y", "0")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(api.handleFloodTile)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code. Expected: %d. Got: %d.", http.StatusBadRequest, status)
+	}
+}
+
+func TestHandleSquareTerrainIndexGeoTiff(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest("GET", "/heightmap?lat=0.0&lon=0.0&index=tpi&radius=3&format=tiff", nil)
+
+	if err != nil {
+		t.Errorf("Error creating a new request: %v", err)
+	}
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(api.handleSquare)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code. Expected: %d. Got: %d.", http.StatusOK, status)
+	}
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != "image/tiff" {
+		t.Errorf("Expected image/tiff content type. Got: %s.", contentType)
+	}
+}
+
+func TestHandleTerrainIndexTileUnknownIndex(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest("GET", "/terrain/slope/0/0/0.png", nil)
+
+	if err != nil {
+		t.Errorf("Error creating a new request: %v", err)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("index", "slope")
+	rctx.URLParams.Add("z", "0")
+	rctx.URLParams.Add("x", "0")
+	rctx.URLParams.Add("y", "0")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(api.handleTerrainIndexTile)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code. Expected: %d. Got: %d.", http.StatusBadRequest, status)
+	}
+}
+
+func TestHandleSolarDay(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest("GET", "/solar/day?lat=0.0&lon=0.0&date=2024-06-21&timezone=America/Sao_Paulo", nil)
+
+	if err != nil {
+		t.Errorf("Error creating a new request: %v", err)
+	}
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(api.handleSolarDay)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code. Expected: %d. Got: %d.", http.StatusOK, status)
+	}
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/zip" {
+		t.Errorf("Expected application/zip content type. Got: %s.", contentType)
+	}
+}
+
+func TestHandleShadowMaskInvalidTime(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest("GET", "/solar/shadow?lat=0.0&lon=0.0&time=noon", nil)
+
+	if err != nil {
+		t.Errorf("Error creating a new request: %v", err)
+	}
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(api.handleShadowMask)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code. Expected: %d. Got: %d.", http.StatusBadRequest, status)
+	}
+}
+
+func TestHandleInsolationIntervalTooShort(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest("GET", "/solar/insolation?lat=0.0&lon=0.0&date=2024-06-21&interval=1", nil)
+
+	if err != nil {
+		t.Errorf("Error creating a new request: %v", err)
+	}
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(api.handleInsolation)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code. Expected: %d. Got: %d.", http.StatusBadRequest, status)
+	}
+}
+
+func TestHandleEncodedTile(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]int{"terrain-rgb": http.StatusOK, "terrarium": http.StatusOK, "hillshade": http.StatusBadRequest}
+
+	for encoding, expected := range tests {
+		req, _ := http.NewRequest("GET", "/0/0/0.png?encoding="+encoding, nil)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("z", "0")
+		rctx.URLParams.Add("x", "0")
+		rctx.URLParams.Add("y", "0")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		api := HttpApi{HeightmapGen: HeightmapGenTest{}}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(api.handleTile).ServeHTTP(rr, req)
+
+		if rr.Code != expected {
+			t.Errorf("Encoding %s: expected status %d but received %d", encoding, expected, rr.Code)
+		}
+
+		if expected == http.StatusOK && rr.Body.String() != encoding {
+			t.Errorf("Expected a %s tile but received %s", encoding, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geovannyAvelar/lukla/heightmap"
+)
+
+// Routes whose responses are cached by clients, with their default Cache-Control max-age in seconds
+const (
+	CacheRouteTiles     = "tiles"
+	CacheRouteTerrain   = "terrain"
+	CacheRouteFlood     = "flood"
+	CacheRouteHeightmap = "heightmap"
+)
+
+// DefaultCacheMaxAge Cache-Control max-age of each route, in seconds, used when HttpApi.CacheMaxAge does not
+// define it. Tiles do not change unless the tile cache is cleared
+var DefaultCacheMaxAge = map[string]int{
+	CacheRouteTiles:     86400,
+	CacheRouteTerrain:   86400,
+	CacheRouteFlood:     3600,
+	CacheRouteHeightmap: 3600,
+}
+
+// writeCacheablePng Write a PNG image with an ETag of its content, its modification time and the Cache-Control
+// of its route. Conditional requests (If-None-Match and If-Modified-Since) are answered with 304 Not Modified and
+// HEAD requests without the image. A zero modTime omits the Last-Modified header
+func (a HttpApi) writeCacheablePng(w http.ResponseWriter, r *http.Request, route, filename string, b []byte,
+	modTime time.Time) {
+	sum := sha256.Sum256(b)
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sum[:16]))
+	w.Header().Set("Cache-Control", a.cacheControl(route))
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filename))
+
+	http.ServeContent(w, r, filename, modTime, bytes.NewReader(b))
+}
+
+// cacheControl Cache-Control header of a route. Routes without max-age must be revalidated with their ETag
+func (a HttpApi) cacheControl(route string) string {
+	maxAge, ok := a.CacheMaxAge[route]
+
+	if !ok {
+		maxAge = DefaultCacheMaxAge[route]
+	}
+
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+
+	return fmt.Sprintf("public, max-age=%d", maxAge)
+}
+
+// tileModTime Modification time of a cached tile. Tiles just rendered are saved in the background, so they are
+// as old as the request
+func (a HttpApi) tileModTime(layer string, tileCoords map[string]int, resolution int) time.Time {
+	modTime, err := a.HeightmapGen.TileModTime(layer, tileCoords["z"], tileCoords["x"], tileCoords["y"],
+		resolution)
+
+	if err != nil {
+		return time.Now()
+	}
+
+	return modTime
+}
+
+// handlePruneTiles Remove the cached tiles matching the query parameters: bbox (west,south,east,north),
+// minZoom, maxZoom, resolution, style, olderThan (e.g.: 720h), stale, dryRun and all, which removes every tile.
+// Requires the admin token as a bearer token
+func (a HttpApi) handlePruneTiles(w http.ResponseWriter, r *http.Request) {
+	if !a.isAdmin(w, r) {
+		return
+	}
+
+	filter, err := parseTileFilter(r)
+
+	if err != nil {
+		http.Error(w, "cannot prune tiles. Cause: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := a.HeightmapGen.PruneTiles(filter)
+
+	if err != nil {
+		http.Error(w, "cannot prune tiles. Cause: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// isAdmin Check if the request carries the admin token, responding with an error when it does not. Admin
+// endpoints are disabled without an admin token
+func (a HttpApi) isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if a.AdminToken == "" {
+		http.Error(w, "admin endpoints are disabled", http.StatusNotFound)
+		return false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "invalid admin token", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+// parseTileFilter Tile filter of the query parameters of a prune request
+func parseTileFilter(r *http.Request) (heightmap.TileFilter, error) {
+	query := r.URL.Query()
+	var filter heightmap.TileFilter
+
+	if param := query.Get("bbox"); param != "" {
+		var bbox []float64
+
+		for _, part := range strings.Split(param, ",") {
+			value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+
+			if err != nil {
+				return filter, fmt.Errorf("invalid bounding box %s", param)
+			}
+
+			bbox = append(bbox, value)
+		}
+
+		if len(bbox) != 4 || bbox[0] >= bbox[2] || bbox[1] >= bbox[3] {
+			return filter, fmt.Errorf("invalid bounding box %s. Use west,south,east,north", param)
+		}
+
+		filter.Bbox = &[4]float64{bbox[0], bbox[1], bbox[2], bbox[3]}
+	}
+
+	ints := map[string]*int{"minZoom": &filter.MinZoom, "resolution": &filter.Resolution}
+
+	if query.Get("maxZoom") != "" {
+		filter.MaxZoom = new(int)
+		ints["maxZoom"] = filter.MaxZoom
+	}
+
+	for name, value := range ints {
+		if param := query.Get(name); param != "" {
+			n, err := strconv.Atoi(param)
+
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("invalid %s %s", name, param)
+			}
+
+			*value = n
+		}
+	}
+
+	if param := query.Get("olderThan"); param != "" {
+		d, err := time.ParseDuration(param)
+
+		if err != nil {
+			return filter, fmt.Errorf("invalid olderThan %s. Use a duration (e.g.: 720h)", param)
+		}
+
+		filter.OlderThan = d
+	}
+
+	filter.Style = query.Get("style")
+	filter.Stale = query.Get("stale") == "true"
+	filter.DryRun = query.Get("dryRun") == "true"
+
+	// Requests without filters are rejected, so the whole cache is never removed by mistake
+	if !hasTileFilter(filter) && query.Get("all") != "true" {
+		return filter, errors.New("at least one filter is required. Use all=true to remove every tile")
+	}
+
+	return filter, nil
+}
+
+// hasTileFilter Check if a tile filter matches only some tiles. dryRun is not a filter
+func hasTileFilter(filter heightmap.TileFilter) bool {
+	return filter.Bbox != nil || filter.MinZoom > 0 || filter.MaxZoom != nil || filter.Resolution > 0 ||
+		filter.Style != "" || filter.OlderThan > 0 || filter.Stale
+}
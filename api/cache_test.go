@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/geovannyAvelar/lukla/heightmap"
+	"github.com/go-chi/chi"
+)
+
+// tileRequest Request of the tile (0, 0, 0) with the Terrarium encoding
+func tileRequest(method string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(method, "/0/0/0.png?encoding=terrarium", nil)
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("z", "0")
+	rctx.URLParams.Add("x", "0")
+	rctx.URLParams.Add("y", "0")
+
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestHandleTileCacheHeaders(t *testing.T) {
+	t.Parallel()
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(api.handleTile).ServeHTTP(rr, tileRequest("GET", nil))
+
+	etag := rr.Header().Get("ETag")
+	lastModified := rr.Header().Get("Last-Modified")
+
+	if rr.Code != http.StatusOK || etag == "" || rr.Body.String() != "terrarium" {
+		t.Fatalf("unexpected response %d with ETag %s", rr.Code, etag)
+	}
+
+	if lastModified != "Mon, 01 Jan 2024 00:00:00 GMT" {
+		t.Errorf("unexpected Last-Modified %s", lastModified)
+	}
+
+	if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != "public, max-age=86400" {
+		t.Errorf("unexpected Cache-Control %s", cacheControl)
+	}
+
+	tests := map[string]map[string]string{
+		"If-None-Match":          {"If-None-Match": etag},
+		"If-None-Match list":     {"If-None-Match": `"other", ` + etag},
+		"If-Modified-Since":      {"If-Modified-Since": lastModified},
+		"If-None-Match and date": {"If-None-Match": etag, "If-Modified-Since": "Sun, 01 Jan 2023 00:00:00 GMT"},
+	}
+
+	for name, headers := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(api.handleTile).ServeHTTP(rr, tileRequest("GET", headers))
+
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("expected status %d with %s, got %d", http.StatusNotModified, name, rr.Code)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(api.handleTile).ServeHTTP(rr, tileRequest("GET", map[string]string{"If-None-Match": `"other"`}))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d with a different ETag, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestHandleTileHead(t *testing.T) {
+	t.Parallel()
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}, CacheMaxAge: map[string]int{CacheRouteTiles: 0}}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(api.handleTile).ServeHTTP(rr, tileRequest("HEAD", nil))
+
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 || rr.Header().Get("ETag") == "" {
+		t.Errorf("unexpected HEAD response %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+
+	if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != "no-cache" {
+		t.Errorf("unexpected Cache-Control %s", cacheControl)
+	}
+}
+
+func TestHandlePruneTiles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		token, authorization, query string
+		status, removed             int
+	}{
+		{"", "Bearer secret", "?resolution=256", http.StatusNotFound, 0},
+		{"secret", "", "?resolution=256", http.StatusUnauthorized, 0},
+		{"secret", "Bearer other", "?resolution=256", http.StatusUnauthorized, 0},
+		{"secret", "Bearer secret", "", http.StatusBadRequest, 0},
+		{"secret", "Bearer secret", "?dryRun=false", http.StatusBadRequest, 0},
+		{"secret", "Bearer secret", "?stale=false", http.StatusBadRequest, 0},
+		{"secret", "Bearer secret", "?foo=1", http.StatusBadRequest, 0},
+		{"secret", "Bearer secret", "?all=true", http.StatusOK, 0},
+		{"secret", "Bearer secret", "?bbox=1,2,3", http.StatusBadRequest, 0},
+		{"secret", "Bearer secret", "?olderThan=tomorrow", http.StatusBadRequest, 0},
+		{"secret", "Bearer secret", "?resolution=256&maxZoom=12&stale=true", http.StatusOK, 256},
+	}
+
+	for _, test := range tests {
+		api := HttpApi{HeightmapGen: HeightmapGenTest{}, AdminToken: test.token}
+
+		req := httptest.NewRequest("DELETE", "/tiles"+test.query, nil)
+		req.Header.Set("Authorization", test.authorization)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(api.handlePruneTiles).ServeHTTP(rr, req)
+
+		if rr.Code != test.status {
+			t.Errorf("expected status %d for %+v, got %d", test.status, test, rr.Code)
+			continue
+		}
+
+		var report heightmap.PruneReport
+
+		if rr.Code == http.StatusOK && (json.Unmarshal(rr.Body.Bytes(), &report) != nil || report.Removed != test.removed) {
+			t.Errorf("unexpected report %s", rr.Body.String())
+		}
+	}
+}
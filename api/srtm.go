@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geovannyAvelar/lukla/srtm"
+	"github.com/go-chi/chi"
+	"github.com/spatial-go/geoos/geoencoding/geojson"
+)
+
+// Interval between the comments sent to keep idle event streams open through proxies
+const sseHeartbeatInterval = 15 * time.Second
+
+// DownloadMonitor Progress of the SRTM downloads. Implemented by srtm.Downloader
+type DownloadMonitor interface {
+	Progress() srtm.Progress
+	Subscribe() (<-chan srtm.ProgressEvent, func())
+}
+
+// DemPrefetcher Background downloads and coverage of the DEM files of regions. Implemented by srtm.Downloader
+type DemPrefetcher interface {
+	Prefetch(region srtm.Region) (srtm.PrefetchJob, error)
+	PrefetchJob(id string) (srtm.PrefetchJob, error)
+	Coverage(region srtm.Region) (*geojson.FeatureCollection, error)
+}
+
+// DemReaderMonitor Hit, miss and eviction counters of the HGT files read. Implemented by srtm.MappedDataDir
+type DemReaderMonitor interface {
+	Stats() srtm.ReaderStats
+}
+
+// prefetchRequest Region of a prefetch, either a west,south,east,north bounding box or a GeoJSON polygon
+type prefetchRequest struct {
+	Bbox    []float64       `json:"bbox"`
+	Polygon json.RawMessage `json:"polygon"`
+}
+
+// handleDemReader Counters of the memory mapped HGT files
+func (a HttpApi) handleDemReader(w http.ResponseWriter, r *http.Request) {
+	if a.DemReader == nil {
+		http.Error(w, "DEM reader statistics are not available", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.DemReader.Stats())
+}
+
+// handleDownloads Return the progress of the SRTM downloads. Clients accepting text/event-stream receive the
+// progress events as Server-Sent Events, starting with the current progress
+func (a HttpApi) handleDownloads(w http.ResponseWriter, r *http.Request) {
+	if a.Downloads == nil {
+		http.Error(w, "SRTM downloads are not enabled", http.StatusNotFound)
+		return
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.Downloads.Progress())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := a.Downloads.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	writeEvent(w, srtm.ProgressEvent{Type: "snapshot", Progress: a.Downloads.Progress()})
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			writeEvent(w, event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// writeEvent Write a progress event in the Server-Sent Events format
+func writeEvent(w http.ResponseWriter, event srtm.ProgressEvent) {
+	b, _ := json.Marshal(event)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, b)
+}
+
+// handlePrefetch Start downloading the DEM files of a region in the background. Responds with the job, whose
+// state is available at /srtm/prefetch/{id}. Requires the admin token as a bearer token, since downloads use the
+// Earthdata account and the disk of the server
+func (a HttpApi) handlePrefetch(w http.ResponseWriter, r *http.Request) {
+	if !a.isAdmin(w, r) {
+		return
+	}
+
+	if a.Prefetcher == nil {
+		http.Error(w, "SRTM downloads are not enabled", http.StatusNotFound)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		http.Error(w, "cannot prefetch region. Cause: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req prefetchRequest
+
+	if err := json.Unmarshal(b, &req); err != nil {
+		http.Error(w, "cannot prefetch region. Cause: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	region, err := req.region()
+
+	if err != nil {
+		http.Error(w, "cannot prefetch region. Cause: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := a.Prefetcher.Prefetch(region)
+
+	if errors.Is(err, srtm.ErrOffline) {
+		http.Error(w, "cannot prefetch region. Cause: "+err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "cannot prefetch region. Cause: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Location", path.Join("/", a.BasePath, "srtm/prefetch", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handlePrefetchJob Return the state of a prefetch job
+func (a HttpApi) handlePrefetchJob(w http.ResponseWriter, r *http.Request) {
+	if a.Prefetcher == nil {
+		http.Error(w, "SRTM downloads are not enabled", http.StatusNotFound)
+		return
+	}
+
+	job, err := a.Prefetcher.PrefetchJob(chi.URLParam(r, "id"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleCoverage Return the SRTM cells of the bbox parameter (west,south,east,north) as GeoJSON features whose
+// status property is available or missing in the DEM directory. Every cell is returned without a bbox
+func (a HttpApi) handleCoverage(w http.ResponseWriter, r *http.Request) {
+	if a.Prefetcher == nil {
+		http.Error(w, "SRTM downloads are not enabled", http.StatusNotFound)
+		return
+	}
+
+	region := srtm.BboxRegion(-180, -90, 180, 90)
+
+	if param := r.URL.Query().Get("bbox"); param != "" {
+		var bbox []float64
+
+		for _, part := range strings.Split(param, ",") {
+			value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+
+			if err != nil {
+				http.Error(w, "invalid bounding box "+param, http.StatusBadRequest)
+				return
+			}
+
+			bbox = append(bbox, value)
+		}
+
+		var err error
+
+		if region, err = bboxRegion(bbox); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	collection, err := a.Prefetcher.Coverage(region)
+
+	if err != nil {
+		http.Error(w, "cannot read SRTM coverage. Cause: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(collection)
+
+	if err != nil {
+		http.Error(w, "cannot read SRTM coverage. Cause: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/geo+json")
+	w.Write(b)
+}
+
+// region Region of the request. The polygon may be a GeoJSON geometry, feature or feature collection
+func (req prefetchRequest) region() (srtm.Region, error) {
+	switch {
+	case req.Bbox != nil && len(req.Polygon) > 0:
+		return nil, errors.New("use either bbox or polygon")
+	case req.Bbox != nil:
+		return bboxRegion(req.Bbox)
+	case len(req.Polygon) > 0:
+		return srtm.ParseGeoJSONRegion(req.Polygon)
+	default:
+		return nil, errors.New("bbox or polygon is required")
+	}
+}
+
+// bboxRegion Region of a west,south,east,north bounding box
+func bboxRegion(bbox []float64) (srtm.Region, error) {
+	if len(bbox) != 4 {
+		return nil, errors.New("invalid bounding box. Use west,south,east,north")
+	}
+
+	if bbox[0] >= bbox[2] || bbox[1] >= bbox[3] {
+		return nil, errors.New("invalid bounding box. West and south must be smaller than east and north")
+	}
+
+	return srtm.BboxRegion(bbox[0], bbox[1], bbox[2], bbox[3]), nil
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geovannyAvelar/lukla/srtm"
+	"github.com/go-chi/chi"
+	"github.com/spatial-go/geoos/geoencoding/geojson"
+)
+
+type downloadMonitorTest struct {
+	events chan srtm.ProgressEvent
+}
+
+func (d downloadMonitorTest) Progress() srtm.Progress {
+	return srtm.Progress{FilesTotal: 4, FilesDone: 1}
+}
+
+func (d downloadMonitorTest) Subscribe() (<-chan srtm.ProgressEvent, func()) {
+	return d.events, func() {}
+}
+
+type demPrefetcherTest struct{}
+
+func (p demPrefetcherTest) Prefetch(region srtm.Region) (srtm.PrefetchJob, error) {
+	return srtm.PrefetchJob{ID: "1", State: srtm.JobRunning, Files: len(region)}, nil
+}
+
+func (p demPrefetcherTest) PrefetchJob(id string) (srtm.PrefetchJob, error) {
+	if id != "1" {
+		return srtm.PrefetchJob{}, srtm.ErrPrefetchJobNotFound
+	}
+
+	return srtm.PrefetchJob{ID: id, State: srtm.JobFinished}, nil
+}
+
+func (p demPrefetcherTest) Coverage(region srtm.Region) (*geojson.FeatureCollection, error) {
+	feature := geojson.NewFeature(*geojson.NewGeometry(region[0]))
+	feature.Properties["status"] = "available"
+
+	return geojson.NewFeatureCollection().Append(feature), nil
+}
+
+func TestHandlePrefetch(t *testing.T) {
+	t.Parallel()
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}, BasePath: "/api", Prefetcher: demPrefetcherTest{},
+		AdminToken: "secret"}
+
+	tests := map[string]int{
+		`{"bbox":[86,27,87,28]}`: http.StatusAccepted,
+		`{"polygon":{"type":"Polygon","coordinates":[[[86,27],[87,27],[87,28],[86,27]]]}}`: http.StatusAccepted,
+		`{"bbox":[87,27,86,28]}`: http.StatusBadRequest,
+		`{"bbox":[86,27,87]}`:    http.StatusBadRequest,
+		`{}`:                     http.StatusBadRequest,
+		`{"polygon":{}}`:         http.StatusBadRequest,
+	}
+
+	for body, status := range tests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/srtm/prefetch", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		http.HandlerFunc(api.handlePrefetch).ServeHTTP(rr, req)
+
+		if rr.Code != status {
+			t.Errorf("expected status %d for %s, got %d", status, body, rr.Code)
+		}
+
+		if status == http.StatusAccepted && rr.Header().Get("Location") != "/api/srtm/prefetch/1" {
+			t.Errorf("unexpected location %s", rr.Header().Get("Location"))
+		}
+	}
+}
+
+func TestHandlePrefetchRequiresAdminToken(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		token, authorization string
+		status               int
+	}{
+		{"", "", http.StatusNotFound},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "Bearer other", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		api := HttpApi{HeightmapGen: HeightmapGenTest{}, Prefetcher: demPrefetcherTest{}, AdminToken: test.token}
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/srtm/prefetch", strings.NewReader(`{"bbox":[-180,-56,180,60]}`))
+		req.Header.Set("Authorization", test.authorization)
+		http.HandlerFunc(api.handlePrefetch).ServeHTTP(rr, req)
+
+		if rr.Code != test.status {
+			t.Errorf("expected status %d for %+v, got %d", test.status, test, rr.Code)
+		}
+	}
+}
+
+func TestHandlePrefetchJob(t *testing.T) {
+	t.Parallel()
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}, Prefetcher: demPrefetcherTest{}}
+
+	for id, status := range map[string]int{"1": http.StatusOK, "2": http.StatusNotFound} {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+
+		req := httptest.NewRequest("GET", "/srtm/prefetch/"+id, nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(api.handlePrefetchJob).ServeHTTP(rr, req)
+
+		if rr.Code != status {
+			t.Errorf("expected status %d for job %s, got %d", status, id, rr.Code)
+		}
+	}
+}
+
+func TestHandleCoverage(t *testing.T) {
+	t.Parallel()
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}, Prefetcher: demPrefetcherTest{}}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/srtm/coverage?bbox=86,27,87,28", nil)
+	http.HandlerFunc(api.handleCoverage).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/geo+json" {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+
+	collection, err := geojson.UnmarshalFeatureCollection(rr.Body.Bytes())
+
+	if err != nil || len(collection.Features) != 1 {
+		t.Errorf("unexpected coverage %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(api.handleCoverage).ServeHTTP(rr, httptest.NewRequest("GET", "/srtm/coverage?bbox=a,b", nil))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid bbox, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestHandleDownloads(t *testing.T) {
+	t.Parallel()
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}, Downloads: downloadMonitorTest{}}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(api.handleDownloads).ServeHTTP(rr, httptest.NewRequest("GET", "/srtm/downloads", nil))
+
+	var progress srtm.Progress
+
+	if err := json.Unmarshal(rr.Body.Bytes(), &progress); err != nil || progress.FilesTotal != 4 {
+		t.Errorf("unexpected progress %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(HttpApi{}.handleDownloads).ServeHTTP(rr, httptest.NewRequest("GET", "/srtm/downloads", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d without downloads, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+type demReaderTest struct{}
+
+func (d demReaderTest) Stats() srtm.ReaderStats {
+	return srtm.ReaderStats{Hits: 10, Misses: 2, OpenFiles: 2, MaxFiles: 64}
+}
+
+func TestHandleDemReader(t *testing.T) {
+	t.Parallel()
+
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}, DemReader: demReaderTest{}}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(api.handleDemReader).ServeHTTP(rr, httptest.NewRequest("GET", "/srtm/reader", nil))
+
+	var stats srtm.ReaderStats
+
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil || stats.Hits != 10 || stats.Misses != 2 {
+		t.Errorf("unexpected stats %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(HttpApi{}.handleDemReader).ServeHTTP(rr, httptest.NewRequest("GET", "/srtm/reader", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d without a DEM reader, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestHandleDownloadsEventStream(t *testing.T) {
+	t.Parallel()
+
+	events := make(chan srtm.ProgressEvent, 1)
+	api := HttpApi{HeightmapGen: HeightmapGenTest{}, Downloads: downloadMonitorTest{events: events}}
+
+	s := httptest.NewServer(http.HandlerFunc(api.handleDownloads))
+	defer s.Close()
+
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatalf("cannot request event stream. Cause: %s", err)
+	}
+
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("expected text/event-stream content type, got %s", contentType)
+	}
+
+	events <- srtm.ProgressEvent{Type: srtm.EventDownloaded, File: "N27E086.SRTMGL1.hgt.zip"}
+
+	var received []string
+	scanner := bufio.NewScanner(resp.Body)
+
+	for len(received) < 2 && scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "event: ") {
+			received = append(received, strings.TrimPrefix(scanner.Text(), "event: "))
+		}
+	}
+
+	if len(received) != 2 || received[0] != "snapshot" || received[1] != srtm.EventDownloaded {
+		t.Errorf("unexpected events %v", received)
+	}
+}
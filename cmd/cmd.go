@@ -1,37 +1,354 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	env "github.com/geovannyAvelar/lukla/env"
+	"github.com/geovannyAvelar/lukla/geotiff"
 	"github.com/geovannyAvelar/lukla/heightmap"
+	"github.com/geovannyAvelar/lukla/netcdf"
 	"github.com/geovannyAvelar/lukla/srtm"
 	"github.com/joho/godotenv"
-	"github.com/petoc/hgt"
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var dotenvPath string
 var tilesPath string
 var demPath string
+var demSource string
+var overviewsPath string
+var demChain string
+var demFeather float64
+var bathymetryPath string
 var httpClientTimeout int
 var earthdataUser string
 var earthdataPassword string
+var srtmMirror string
+var srtmOffline bool
+var demMaxSize string
+var demPinned string
+var demStorage string
 
-func createHgtDataDir() *hgt.DataDir {
+func createHgtDataDir() (heightmap.ElevationSource, *srtm.DiskQuota) {
 	if demPath == "" {
 		demPath = env.GetDigitalElevationModelPath()
 	}
 
-	h, err := hgt.OpenDataDir(demPath, nil)
+	return openHgtDataDir(demPath)
+}
+
+// openHgtDataDir Open a directory of HGT files. When --dem-max-size is defined, files are cached by a quota which
+// evicts the least recently used files
+func openHgtDataDir(path string) (heightmap.ElevationSource, *srtm.DiskQuota) {
+	quota := createDiskQuota(path)
+
+	h, err := openSrtmDataDir(path, quota)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	return h, quota
+}
+
+// openSrtmDataDir Open a directory of HGT files saved in the --dem-storage format. Compressed files are read by a
+// srtm.CompressedDataDir and uncompressed files are memory mapped by a srtm.MappedDataDir. Files are cached by the
+// quota, when it is defined
+func openSrtmDataDir(path string, quota *srtm.DiskQuota) (heightmap.ElevationSource, error) {
+	if demDownloadStorage() != srtm.Uncompressed {
+		c, err := srtm.OpenCompressedDataDir(path, 0)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if quota != nil {
+			c.Quota = quota
+			quota.Release = c.Release
+		}
+
+		return c, nil
+	}
+
+	m, err := srtm.OpenMappedDataDir(path, env.GetDemMaxOpenFiles())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if quota != nil {
+		m.Quota = quota
+		quota.Release = m.Release
+	}
+
+	return m, nil
+}
+
+// demDownloadStorage Format of the downloaded HGT files, defined by --dem-storage
+func demDownloadStorage() srtm.Storage {
+	if demStorage == "" {
+		demStorage = env.GetDemStorage()
+	}
+
+	storage, err := srtm.ParseStorage(demStorage)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	return storage
+}
+
+// createDiskQuota Quota of a DEM directory. Nil when --dem-max-size is not defined
+func createDiskQuota(path string) *srtm.DiskQuota {
+	if demMaxSize == "" {
+		demMaxSize = env.GetDemMaxSize()
+	}
+
+	if demMaxSize == "" {
+		return nil
+	}
+
+	maxSize, err := parseSize(demMaxSize)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	if demPinned == "" {
+		demPinned = env.GetDemPinnedRegions()
+	}
+
+	pinned, err := parsePinnedRegions(demPinned)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	return srtm.NewDiskQuota(path, maxSize, pinned)
+}
+
+// parseSize Parse a size in bytes, with an optional unit (e.g.: 500MB, 20GiB or 1T)
+func parseSize(size string) (int64, error) {
+	units := map[string]float64{
+		"": 1, "b": 1,
+		"k": 1 << 10, "kb": 1e3, "kib": 1 << 10,
+		"m": 1 << 20, "mb": 1e6, "mib": 1 << 20,
+		"g": 1 << 30, "gb": 1e9, "gib": 1 << 30,
+		"t": 1 << 40, "tb": 1e12, "tib": 1 << 40,
+	}
+
+	str := strings.TrimSpace(size)
+	i := strings.IndexFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	if i < 0 {
+		i = len(str)
+	}
+
+	v, err := strconv.ParseFloat(str[:i], 64)
+	unit, ok := units[strings.ToLower(strings.TrimSpace(str[i:]))]
+
+	if err != nil || !ok || v <= 0 {
+		return 0, fmt.Errorf("invalid size %s. Use a number of bytes with an optional unit (e.g.: 20GB)", size)
+	}
+
+	return int64(v * unit), nil
+}
+
+// parsePinnedRegions Parse a list of bounding boxes (west,south,east,north) and GeoJSON files separated by
+// semicolons (;)
+func parsePinnedRegions(regions string) (srtm.Region, error) {
+	var pinned srtm.Region
+
+	for _, entry := range strings.Split(regions, ";") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		if bbox, err := parseFloatBbox(entry); err == nil {
+			pinned = append(pinned, srtm.BboxRegion(bbox[0], bbox[1], bbox[2], bbox[3])...)
+			continue
+		}
+
+		region, err := srtm.LoadGeoJSONRegion(entry)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid pinned region %s. Use a bounding box or a GeoJSON file. Cause: %w",
+				entry, err)
+		}
+
+		pinned = append(pinned, region...)
+	}
+
+	return pinned, nil
+}
+
+// createElevationSource Open the digital elevation model (DEM) dataset selected by --dem-source or
+// --dem-chain, merged with the --bathymetry grid. GeoTIFF datasets cannot be downloaded, so the returned
+// downloader is nil when SRTM is not used
+func createElevationSource(client *http.Client) (heightmap.ElevationSource, *srtm.Downloader) {
+	source, downloader := openElevationSource(client)
+
+	if bathymetryPath == "" {
+		bathymetryPath = env.GetBathymetryPath()
+	}
+
+	if bathymetryPath == "" {
+		return source, downloader
+	}
+
+	sea, err := openGridSource(bathymetryPath)
 
 	if err != nil {
 		handleErr(err)
 	}
 
-	return h
+	log.Infof("Using bathymetry grid %s", bathymetryPath)
+
+	return &heightmap.Bathymetry{Land: source, Sea: sea}, downloader
+}
+
+// minElevation Elevation drawn as black by grayscale heightmaps
+func minElevation() float64 {
+	if bathymetryPath != "" {
+		return heightmap.MinBathymetryElevation
+	}
+
+	return 0
+}
+
+// openGridSource Open a global grid, such as GEBCO or ETOPO, stored as a netCDF file, a GeoTIFF file or a
+// directory of GeoTIFF files
+func openGridSource(path string) (heightmap.ElevationSource, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return geotiff.OpenDataDir(path)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".nc", ".grd":
+		return netcdf.OpenGrid(path)
+	case ".tif", ".tiff":
+		return geotiff.Open(path)
+	}
+
+	return nil, fmt.Errorf("unknown grid format %s. Use a netCDF or GeoTIFF file", path)
+}
+
+func openElevationSource(client *http.Client) (heightmap.ElevationSource, *srtm.Downloader) {
+	if demChain == "" {
+		demChain = env.GetDemChain()
+	}
+
+	if demChain != "" {
+		return createSourceChain(client)
+	}
+
+	if demSource == "" {
+		demSource = env.GetDemSource()
+	}
+
+	switch demSource {
+	case "srtm":
+		earthdataApi := createEarthdataApiClient(client)
+		h, quota := createHgtDataDir()
+		downloader := createSrtmDownloader(client, earthdataApi)
+		downloader.Quota = quota
+
+		return h, downloader
+	case "geotiff":
+		if demPath == "" {
+			demPath = env.GetDigitalElevationModelPath()
+		}
+
+		d, err := geotiff.OpenDataDir(demPath)
+
+		if err != nil {
+			handleErr(err)
+		}
+
+		return d, nil
+	}
+
+	handleErr(fmt.Sprintf("unknown DEM source %s. Use srtm or geotiff", demSource))
+
+	return nil, nil
+}
+
+// createSourceChain Open the elevation sources of a chain described as a list of [name=]type:path entries
+// separated by commas (e.g.: srtm1=srtm:data/dem,srtm3=srtm:data/dem3,etopo=netcdf:data/etopo.nc). Only the
+// first srtm source downloads missing files
+func createSourceChain(client *http.Client) (heightmap.ElevationSource, *srtm.Downloader) {
+	if demFeather <= 0 {
+		demFeather = env.GetDemFeather()
+	}
+
+	chain := &heightmap.SourceChain{Feather: demFeather}
+	var downloader *srtm.Downloader
+
+	for _, entry := range strings.Split(demChain, ",") {
+		name, source, _ := strings.Cut(strings.TrimSpace(entry), "=")
+
+		if source == "" {
+			source = name
+			name = ""
+		}
+
+		typ, path, ok := strings.Cut(source, ":")
+
+		if !ok || path == "" {
+			handleErr(fmt.Sprintf("invalid DEM chain entry %s. Use [name=]type:path", entry))
+		}
+
+		if name == "" {
+			name = typ
+		}
+
+		var s heightmap.ElevationSource
+		var err error
+
+		switch typ {
+		case "srtm":
+			if downloader == nil {
+				h, quota := openHgtDataDir(path)
+				s = h
+				demPath = path
+				downloader = createSrtmDownloader(client, createEarthdataApiClient(client))
+				downloader.Quota = quota
+			} else {
+				s, err = openSrtmDataDir(path, nil)
+			}
+		case "geotiff", "netcdf":
+			s, err = openGridSource(path)
+		default:
+			err = fmt.Errorf("unknown DEM source %s. Use srtm, geotiff or netcdf", typ)
+		}
+
+		if err != nil {
+			handleErr(err)
+		}
+
+		chain.Sources = append(chain.Sources, heightmap.ChainedSource{Name: name, Source: s})
+	}
+
+	log.Infof("Using DEM source chain %s", chain)
+
+	return chain, downloader
 }
 
 func createHttpClient() *http.Client {
@@ -47,6 +364,30 @@ func createHttpClient() *http.Client {
 }
 
 func createEarthdataApiClient(client *http.Client) *srtm.EarthdataApi {
+	loadSrtmNetworkConfig()
+
+	// Mirrors do not use EarthData authentication
+	if srtmOffline || srtmMirror != "" {
+		return nil
+	}
+
+	if token := env.GetEarthDataApiToken(); token != "" {
+		return &srtm.EarthdataApi{HttpClient: client, Token: token}
+	}
+
+	credentials := earthdataCredentials()
+
+	return &srtm.EarthdataApi{
+		HttpClient: client,
+		Username:   credentials.Username,
+		Password:   credentials.Password,
+		TokenFile:  env.GetEarthDataTokenFile(),
+	}
+}
+
+// earthdataCredentials Find EarthData credentials in flags, environment variables, a credential helper,
+// a credentials file or the .netrc file, in this order
+func earthdataCredentials() srtm.Credentials {
 	if earthdataUser == "" {
 		earthdataUser = env.GetEarthDataApiUsername()
 	}
@@ -55,11 +396,45 @@ func createEarthdataApiClient(client *http.Client) *srtm.EarthdataApi {
 		earthdataPassword = env.GetEarthDataApiPassword()
 	}
 
-	return &srtm.EarthdataApi{
-		HttpClient: client,
-		Username:   earthdataUser,
-		Password:   earthdataPassword,
+	if earthdataUser != "" && earthdataPassword != "" {
+		return srtm.Credentials{Username: earthdataUser, Password: earthdataPassword}
+	}
+
+	if helper := env.GetEarthDataCredentialHelper(); helper != "" {
+		credentials, err := srtm.RunCredentialHelper(helper)
+
+		if err == nil {
+			return credentials
+		}
+
+		log.Errorf("Cannot read EarthData credentials from credential helper. Cause: %s", err)
+	}
+
+	if path := env.GetEarthDataCredentialsFile(); path != "" {
+		credentials, err := srtm.ReadCredentialsFile(path)
+
+		if err == nil {
+			return credentials
+		}
+
+		log.Errorf("Cannot read EarthData credentials file. Cause: %s", err)
+	}
+
+	if path := srtm.DefaultNetrcPath(); path != "" {
+		credentials, err := srtm.ReadNetrc(path, srtm.EarthdataMachine)
+
+		if err == nil {
+			return credentials
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("Cannot read EarthData credentials from netrc file. Cause: %s", err)
+		}
 	}
+
+	log.Warn("EarthData credentials are not defined. Lukla cannot download elevation dataset data.")
+
+	return srtm.Credentials{Username: earthdataUser, Password: earthdataPassword}
 }
 
 func createSrtmDownloader(client *http.Client, earthdataApi *srtm.EarthdataApi) *srtm.Downloader {
@@ -67,14 +442,35 @@ func createSrtmDownloader(client *http.Client, earthdataApi *srtm.EarthdataApi)
 		demPath = env.GetDigitalElevationModelPath()
 	}
 
+	loadSrtmNetworkConfig()
+
 	return &srtm.Downloader{
-		HttpClient: client,
-		Dir:        demPath,
-		Api:        earthdataApi,
+		BasePath:      srtmMirror,
+		Offline:       srtmOffline,
+		HttpClient:    client,
+		Dir:           demPath,
+		Storage:       demDownloadStorage(),
+		Api:           earthdataApi,
+		ChecksumsFile: env.GetSrtmChecksumsFile(),
+		Retry: srtm.RetryPolicy{
+			MaxAttempts: env.GetSrtmMaxAttempts(),
+		},
+		RateLimit:      env.GetSrtmRateLimit(),
+		MaxConcurrency: env.GetSrtmMaxConcurrency(),
+	}
+}
+
+func loadSrtmNetworkConfig() {
+	if srtmMirror == "" {
+		srtmMirror = env.GetSrtmMirror()
+	}
+
+	if !srtmOffline {
+		srtmOffline = env.IsSrtmOffline()
 	}
 }
 
-func createHeightmapGenerator(h *hgt.DataDir, downloader *srtm.Downloader) *heightmap.Generator {
+func createHeightmapGenerator(h heightmap.ElevationSource, downloader *srtm.Downloader) *heightmap.Generator {
 	if tilesPath == "" {
 		tilesPath = env.GetTilesPath()
 	}
@@ -83,6 +479,63 @@ func createHeightmapGenerator(h *hgt.DataDir, downloader *srtm.Downloader) *heig
 		ElevationDataset: h,
 		SrtmDownloader:   downloader,
 		Dir:              tilesPath,
+		Overviews:        openOverviews(),
+		MinElevation:     minElevation(),
+		DemSource:        demSourceDescription(),
+		Renders:          heightmap.NewRenderQueue(env.GetRenderConcurrency(), env.GetRenderQueueSize()),
+		MetatileSize:     env.GetMetatileSize(),
+		MetatileBuffer:   env.GetMetatileBuffer(),
+		Floods:           heightmap.NewFloodCache(env.GetFloodCacheSize()),
+	}
+}
+
+// demSourceDescription Description of the DEM dataset recorded in the tile manifests (e.g.: srtm:data/dem or
+// chain:srtm:data/dem,netcdf:etopo.nc+bathymetry:gebco.nc), so tiles are rendered again when the dataset changes
+func demSourceDescription() string {
+	description := demSource + ":" + demPath
+
+	if demChain != "" {
+		description = "chain:" + demChain
+	}
+
+	if bathymetryPath != "" {
+		description += "+bathymetry:" + bathymetryPath
+	}
+
+	return description
+}
+
+// openOverviews Open the overview levels already generated. Missing levels are ignored
+func openOverviews() []heightmap.Overview {
+	if overviewsPath == "" {
+		overviewsPath = env.GetOverviewsPath()
+	}
+
+	var overviews []heightmap.Overview
+
+	for _, level := range heightmap.OverviewLevels {
+		dir := filepath.Join(overviewsPath, level.Name)
+
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+
+		d, err := geotiff.OpenDataDir(dir)
+
+		if err != nil {
+			log.Warnf("Cannot open %s overview level. Cause: %s", level.Name, err)
+			continue
+		}
+
+		overviews = append(overviews, heightmap.Overview{Level: level, Source: d})
+	}
+
+	return overviews
+}
+
+func closeOverviews(overviews []heightmap.Overview) {
+	for _, overview := range overviews {
+		overview.Source.Close()
 	}
 }
 
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/geovannyAvelar/lukla/heightmap"
@@ -28,13 +29,35 @@ func CreateHeightMapCommand() *cobra.Command {
 	heightmap.Flags().Float64("longitude", 0.0, "Square initial longitude")
 	heightmap.Flags().Float64("side", 1000, "Side of the square in meters")
 	heightmap.Flags().Int("resolution", 256, "PNG image resolution")
-	heightmap.Flags().Bool("interpolate", false, "Apply image resizing even when original image resolution is smaller than informed resolution")
+	heightmap.Flags().Bool("interpolate", false,
+		"Upsample the image with bilinear interpolation when the DEM resolution is smaller than the informed "+
+			"resolution. Without it, the image keeps the DEM resolution")
 	heightmap.Flags().StringP("output", "o", "heightmap.png", "PNG image output path")
+	heightmap.Flags().String("encoding", "grayscale", "Heightmap encoding (grayscale, terrain-rgb or terrarium)")
+	heightmap.Flags().String("index", "", "Terrain index to draw instead of elevations (tri, tpi or roughness)")
+	heightmap.Flags().Int("radius", 1, "Topographic Position Index (TPI) neighbourhood radius in cells")
+	heightmap.Flags().String("format", "png", "Terrain index output format (png or tiff). "+
+		"TIFF files are float32 GeoTIFF files with raw index values")
 	heightmap.Flags().StringVar(&dotenvPath, "env", "", "Dot env file path")
 	heightmap.Flags().StringVar(&demPath, "dem-path", "", "Digital Elevation Model (DEM) files path")
+	heightmap.Flags().StringVar(&demSource, "dem-source", "", "Digital Elevation Model (DEM) source (srtm or geotiff)")
+	heightmap.Flags().StringVar(&demChain, "dem-chain", "",
+		"Ordered chain of DEM sources ([name=]type:path), separated by commas (,)")
+	heightmap.Flags().StringVar(&bathymetryPath, "bathymetry", "",
+		"Bathymetry grid (GEBCO or ETOPO netCDF or GeoTIFF) merged with land heights")
+	heightmap.Flags().Float64Var(&demFeather, "dem-feather", 0, "Width in meters of the band where chained DEM sources are blended")
+	heightmap.Flags().StringVar(&demMaxSize, "dem-max-size", "",
+		"Maximum size of the DEM directory (e.g.: 20GB). Least recently used files are evicted")
+	heightmap.Flags().StringVar(&demPinned, "dem-pinned", "",
+		"Regions never evicted from the DEM directory: bounding boxes or GeoJSON files separated by semicolons (;)")
 	heightmap.Flags().IntVar(&httpClientTimeout, "http-client-timeout", 0, "HTTP client request timeout")
 	heightmap.Flags().StringVar(&earthdataUser, "earthdata-user", "", "Earthdata API username")
 	heightmap.Flags().StringVar(&earthdataPassword, "earthdata-password", "", "Earthdata API password")
+	heightmap.Flags().StringVar(&srtmMirror, "srtm-mirror", "",
+		"SRTM30m dataset mirror URL (http:// or file://), accessed without Earthdata authentication")
+	heightmap.Flags().BoolVar(&srtmOffline, "offline", false, "Never download SRTM files. Missing files are voids")
+	heightmap.Flags().StringVar(&demStorage, "dem-storage", "",
+		"Format of the downloaded HGT files: hgt (uncompressed), gz or zip. Compressed files use about 60% less disk")
 
 	return heightmap
 }
@@ -46,16 +69,15 @@ func createHeightmap(cmd *cobra.Command, args []string) {
 
 	coords := parseCoordinateAndResParams(cmd)
 
-	h := createHgtDataDir()
+	httpClient := createHttpClient()
+	h, srtmDownloader := createElevationSource(httpClient)
 	defer h.Close()
 
-	httpClient := createHttpClient()
-	earthdataApi := createEarthdataApiClient(httpClient)
-	srtmDownloader := createSrtmDownloader(httpClient, earthdataApi)
 	heightmapGen := &heightmap.Generator{
 		ElevationDataset: h,
 		SrtmDownloader:   srtmDownloader,
 		Dir:              "./",
+		MinElevation:     minElevation(),
 	}
 
 	interpolate, err := cmd.Flags().GetBool("interpolate")
@@ -64,11 +86,26 @@ func createHeightmap(cmd *cobra.Command, args []string) {
 		handleErr(err)
 	}
 
-	log.Infof("Generating heightmap for coordinates (%f, %f)", coords.Latitude, coords.Longitude)
+	resConf := heightmap.ResolutionConfig{Width: coords.Resolution, Height: coords.Resolution,
+		ForceInterpolation: interpolate, IgnoreWhenOriginalImageIsSmaller: !interpolate}
+
+	var b []byte
+	indexName, _ := cmd.Flags().GetString("index")
+
+	if indexName != "" {
+		b, err = createTerrainIndex(cmd, heightmapGen, coords, resConf, indexName)
+	} else {
+		log.Infof("Generating heightmap for coordinates (%f, %f)", coords.Latitude, coords.Longitude)
 
-	b, err := heightmapGen.CreateHeightMapImage(coords.Latitude, coords.Longitude, coords.Side,
-		heightmap.ResolutionConfig{Width: coords.Resolution, Height: coords.Resolution,
-			IgnoreWhenOriginalImageIsSmaller: !interpolate})
+		var encoding heightmap.HeightmapEncoding
+		encodingName, _ := cmd.Flags().GetString("encoding")
+		encoding, err = heightmap.ParseHeightmapEncoding(encodingName)
+
+		if err == nil {
+			b, err = heightmapGen.CreateEncodedHeightMapImage(coords.Latitude, coords.Longitude, coords.Side,
+				resConf, encoding)
+		}
+	}
 
 	if err != nil {
 		handleErr(err)
@@ -91,6 +128,30 @@ func createHeightmap(cmd *cobra.Command, args []string) {
 	log.Infof("Heightmap image %s saved successfully", output)
 }
 
+func createTerrainIndex(cmd *cobra.Command, heightmapGen *heightmap.Generator, coords heightmapCoords,
+	resConf heightmap.ResolutionConfig, indexName string) ([]byte, error) {
+	index, err := heightmap.ParseTerrainIndex(indexName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	radius, _ := cmd.Flags().GetInt("radius")
+	format, _ := cmd.Flags().GetString("format")
+	conf := heightmap.TerrainIndexConfig{Index: index, Radius: radius}
+
+	log.Infof("Generating %s terrain index for coordinates (%f, %f)", index, coords.Latitude, coords.Longitude)
+
+	switch format {
+	case "png":
+		return heightmapGen.CreateTerrainIndexImage(coords.Latitude, coords.Longitude, coords.Side, resConf, conf)
+	case "tiff", "geotiff":
+		return heightmapGen.CreateTerrainIndexGeoTiff(coords.Latitude, coords.Longitude, coords.Side, conf)
+	}
+
+	return nil, fmt.Errorf("unknown output format %s", format)
+}
+
 func parseCoordinateAndResParams(cmd *cobra.Command) heightmapCoords {
 	lat, err := cmd.Flags().GetFloat64("latitude")
 
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/geovannyAvelar/lukla/env"
+	"github.com/geovannyAvelar/lukla/heightmap"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func CreateOverviewsCommand() *cobra.Command {
+	overviews := &cobra.Command{
+		Use:   "overviews",
+		Short: "Generate downsampled Digital Elevation Model (DEM) levels",
+		Long: "Generate downsampled Digital Elevation Model (DEM) levels (90m, 250m and 1km). " +
+			"Tiles whose pixels are bigger than a level resolution are rendered from that level, " +
+			"avoiding reading and downloading hundreds of DEM files for low zoom tiles",
+		Run: generateOverviews,
+	}
+
+	overviews.Flags().String("bbox", "-180,-56,180,60",
+		"Bounding box (west,south,east,north) in degrees. Default is the SRTM coverage")
+	overviews.Flags().String("levels", "90m,250m,1km", "Overview levels, separated by commas (,)")
+	overviews.Flags().Bool("download", false, "Download missing SRTM files")
+	overviews.Flags().StringVar(&overviewsPath, "overviews-path", "", "Digital Elevation Model (DEM) overviews path")
+	overviews.Flags().StringVar(&dotenvPath, "env", "", "Dot env file path")
+	overviews.Flags().StringVar(&demPath, "dem-path", "", "Digital Elevation Model (DEM) files path")
+	overviews.Flags().StringVar(&demSource, "dem-source", "", "Digital Elevation Model (DEM) source (srtm or geotiff)")
+	overviews.Flags().StringVar(&demChain, "dem-chain", "",
+		"Ordered chain of DEM sources ([name=]type:path), separated by commas (,)")
+	overviews.Flags().StringVar(&bathymetryPath, "bathymetry", "",
+		"Bathymetry grid (GEBCO or ETOPO netCDF or GeoTIFF) merged with land heights")
+	overviews.Flags().Float64Var(&demFeather, "dem-feather", 0, "Width in meters of the band where chained DEM sources are blended")
+	overviews.Flags().IntVar(&httpClientTimeout, "http-client-timeout", 0, "HTTP client request timeout")
+	overviews.Flags().StringVar(&earthdataUser, "earthdata-user", "", "Earthdata API username")
+	overviews.Flags().StringVar(&earthdataPassword, "earthdata-password", "", "Earthdata API password")
+	overviews.Flags().StringVar(&srtmMirror, "srtm-mirror", "",
+		"SRTM30m dataset mirror URL (http:// or file://), accessed without Earthdata authentication")
+	overviews.Flags().BoolVar(&srtmOffline, "offline", false, "Never download SRTM files. Missing files are voids")
+	overviews.Flags().StringVar(&demStorage, "dem-storage", "",
+		"Format of the downloaded HGT files: hgt (uncompressed), gz or zip. Compressed files use about 60% less disk")
+
+	return overviews
+}
+
+func generateOverviews(cmd *cobra.Command, args []string) {
+	if dotenvPath != "" {
+		loadDotEnv(dotenvPath)
+	}
+
+	bboxStr, _ := cmd.Flags().GetString("bbox")
+	levelsStr, _ := cmd.Flags().GetString("levels")
+	download, _ := cmd.Flags().GetBool("download")
+
+	bbox, err := parseBbox(bboxStr)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	var levels []heightmap.OverviewLevel
+
+	for _, name := range strings.Split(levelsStr, ",") {
+		level, err := heightmap.ParseOverviewLevel(strings.TrimSpace(name))
+
+		if err != nil {
+			handleErr(err)
+		}
+
+		levels = append(levels, level)
+	}
+
+	httpClient := createHttpClient()
+	h, srtmDownloader := createElevationSource(httpClient)
+	defer h.Close()
+
+	if !download {
+		srtmDownloader = nil
+	}
+
+	if overviewsPath == "" {
+		overviewsPath = internal.GetOverviewsPath()
+	}
+
+	heightmapGen := &heightmap.Generator{
+		ElevationDataset: h,
+		SrtmDownloader:   srtmDownloader,
+	}
+
+	err = heightmapGen.GenerateOverviews(overviewsPath, levels, bbox[0], bbox[1], bbox[2], bbox[3])
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	log.Infof("Overviews saved to %s", overviewsPath)
+}
+
+// parseBbox Parse a west,south,east,north bounding box, expanding it to whole degrees
+func parseBbox(bbox string) ([4]int, error) {
+	var result [4]int
+	parts := strings.Split(bbox, ",")
+
+	if len(parts) != 4 {
+		return result, fmt.Errorf("invalid bounding box %s. Use west,south,east,north", bbox)
+	}
+
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+
+		if err != nil {
+			return result, fmt.Errorf("invalid bounding box %s. Cause: %w", bbox, err)
+		}
+
+		if i < 2 {
+			result[i] = int(math.Floor(v))
+		} else {
+			result[i] = int(math.Ceil(v))
+		}
+	}
+
+	if result[0] >= result[2] || result[1] >= result[3] {
+		return result, fmt.Errorf("invalid bounding box %s. West and south must be smaller than east and north", bbox)
+	}
+
+	return result, nil
+}
@@ -1,17 +1,21 @@
 package cmd
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/geovannyAvelar/lukla/api"
 	"github.com/geovannyAvelar/lukla/env"
 	"github.com/geovannyAvelar/lukla/heightmap"
 	"github.com/go-chi/chi"
 	"github.com/spf13/cobra"
-	"strings"
 )
 
 var allowedOrigins string
 var port int
 var basePath string
+var cacheMaxAge string
 
 func CreateRestCommand() *cobra.Command {
 	rest := &cobra.Command{
@@ -27,10 +31,29 @@ func CreateRestCommand() *cobra.Command {
 	rest.Flags().IntVar(&port, "port", 0, "API port")
 	rest.Flags().StringVar(&basePath, "base-path", "", "API base path")
 	rest.Flags().StringVar(&tilesPath, "tile-path", "", "Tiles path")
+	rest.Flags().StringVar(&cacheMaxAge, "cache-max-age", "",
+		"Cache-Control max-age in seconds of each route (tiles, terrain, flood or heightmap), as route=seconds "+
+			"pairs separated by commas (,)")
 	rest.Flags().StringVar(&demPath, "dem-path", "", "Digital Elevation Model (DEM) files path")
+	rest.Flags().StringVar(&overviewsPath, "overviews-path", "", "Digital Elevation Model (DEM) overviews path")
+	rest.Flags().StringVar(&demSource, "dem-source", "", "Digital Elevation Model (DEM) source (srtm or geotiff)")
+	rest.Flags().StringVar(&demChain, "dem-chain", "",
+		"Ordered chain of DEM sources ([name=]type:path), separated by commas (,)")
+	rest.Flags().StringVar(&bathymetryPath, "bathymetry", "",
+		"Bathymetry grid (GEBCO or ETOPO netCDF or GeoTIFF) merged with land heights")
+	rest.Flags().Float64Var(&demFeather, "dem-feather", 0, "Width in meters of the band where chained DEM sources are blended")
+	rest.Flags().StringVar(&demMaxSize, "dem-max-size", "",
+		"Maximum size of the DEM directory (e.g.: 20GB). Least recently used files are evicted")
+	rest.Flags().StringVar(&demPinned, "dem-pinned", "",
+		"Regions never evicted from the DEM directory: bounding boxes or GeoJSON files separated by semicolons (;)")
 	rest.Flags().IntVar(&httpClientTimeout, "http-client-timeout", 0, "HTTP client request timeout")
 	rest.Flags().StringVar(&earthdataUser, "earthdata-user", "", "Earthdata API username")
 	rest.Flags().StringVar(&earthdataPassword, "earthdata-password", "", "Earthdata API password")
+	rest.Flags().StringVar(&srtmMirror, "srtm-mirror", "",
+		"SRTM30m dataset mirror URL (http:// or file://), accessed without Earthdata authentication")
+	rest.Flags().BoolVar(&srtmOffline, "offline", false, "Never download SRTM files. Missing files are voids")
+	rest.Flags().StringVar(&demStorage, "dem-storage", "",
+		"Format of the downloaded HGT files: hgt (uncompressed), gz or zip. Compressed files use about 60% less disk")
 
 	return rest
 }
@@ -40,15 +63,24 @@ func startRestApi(cmd *cobra.Command, args []string) {
 		loadDotEnv(dotenvPath)
 	}
 
-	h := createHgtDataDir()
+	httpClient := createHttpClient()
+	h, srtmDownloader := createElevationSource(httpClient)
 	defer h.Close()
 
-	httpClient := createHttpClient()
-	earthdataApi := createEarthdataApiClient(httpClient)
-	srtmDownloader := createSrtmDownloader(httpClient, earthdataApi)
 	heightmapGen := createHeightmapGenerator(h, srtmDownloader)
+	defer closeOverviews(heightmapGen.Overviews)
+
 	rest := createHttpApi(heightmapGen)
 
+	if srtmDownloader != nil {
+		rest.Downloads = srtmDownloader
+		rest.Prefetcher = srtmDownloader
+	}
+
+	if reader, ok := h.(api.DemReaderMonitor); ok {
+		rest.DemReader = reader
+	}
+
 	if port == 0 {
 		port = internal.GetApiPort()
 	}
@@ -68,10 +100,51 @@ func createHttpApi(heightmapGen *heightmap.Generator) *api.HttpApi {
 		allowedOriginsSlice = strings.Split(allowedOrigins, ",")
 	}
 
+	if cacheMaxAge == "" {
+		cacheMaxAge = internal.GetCacheMaxAge()
+	}
+
+	maxAge, err := parseCacheMaxAge(cacheMaxAge)
+
+	if err != nil {
+		handleErr(err)
+	}
+
 	return &api.HttpApi{
 		Router:         chi.NewRouter(),
 		HeightmapGen:   heightmapGen,
 		BasePath:       basePath,
 		AllowedOrigins: allowedOriginsSlice,
+		CacheMaxAge:    maxAge,
+		AdminToken:     internal.GetAdminToken(),
+	}
+}
+
+// parseCacheMaxAge Parse the Cache-Control max-age of routes, as route=seconds pairs separated by commas (,)
+func parseCacheMaxAge(str string) (map[string]int, error) {
+	maxAge := map[string]int{}
+
+	for _, pair := range strings.Split(str, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		route, secondsStr, found := strings.Cut(pair, "=")
+		route = strings.TrimSpace(route)
+
+		if _, ok := api.DefaultCacheMaxAge[route]; !ok || !found {
+			return nil, fmt.Errorf("invalid cache max-age %s. Use route=seconds, where route is tiles, terrain, "+
+				"flood or heightmap", pair)
+		}
+
+		seconds, err := strconv.Atoi(strings.TrimSpace(secondsStr))
+
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("invalid cache max-age %s. Seconds must be a non negative integer", pair)
+		}
+
+		maxAge[route] = seconds
 	}
+
+	return maxAge, nil
 }
@@ -26,4 +26,7 @@ func init() {
 	rootCmd.AddCommand(CreateRestCommand())
 	rootCmd.AddCommand(CreateHeightMapCommand())
 	rootCmd.AddCommand(CreateSrtmCommand())
+	rootCmd.AddCommand(CreateSolarCommand())
+	rootCmd.AddCommand(CreateOverviewsCommand())
+	rootCmd.AddCommand(CreateTilesCommand())
 }
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/geovannyAvelar/lukla/heightmap"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func CreateSolarCommand() *cobra.Command {
+	solar := &cobra.Command{
+		Use:   "solar",
+		Short: "Terrain shadow and insolation simulation",
+		Long: "Terrain shadow and insolation simulation. Receives a coordinate in WGS84 and a date, draws a " +
+			"square based on this coordinate and on side parameter and writes an hourly shadow mask for each " +
+			"hour of daylight and the daily clear sky insolation in Wh/m²",
+		Run: simulateSolarDay,
+	}
+
+	solar.Flags().Float64("latitude", 0.0, "Square initial latitude")
+	solar.Flags().Float64("longitude", 0.0, "Square initial longitude")
+	solar.Flags().Float64("side", 1000, "Side of the square in meters")
+	solar.Flags().Int("resolution", 256, "PNG image resolution")
+	solar.Flags().String("date", time.Now().Format("2006-01-02"), "Simulated day (YYYY-MM-DD)")
+	solar.Flags().String("timezone", "UTC", "IANA time zone of the simulated day (e.g.: America/Sao_Paulo)")
+	solar.Flags().Float64("buffer", 2000, "Distance in meters around the square where terrain also casts shadows")
+	solar.Flags().StringP("output", "o", "solar", "Output directory")
+	solar.Flags().StringVar(&dotenvPath, "env", "", "Dot env file path")
+	solar.Flags().StringVar(&demPath, "dem-path", "", "Digital Elevation Model (DEM) files path")
+	solar.Flags().StringVar(&demSource, "dem-source", "", "Digital Elevation Model (DEM) source (srtm or geotiff)")
+	solar.Flags().StringVar(&demChain, "dem-chain", "",
+		"Ordered chain of DEM sources ([name=]type:path), separated by commas (,)")
+	solar.Flags().StringVar(&bathymetryPath, "bathymetry", "",
+		"Bathymetry grid (GEBCO or ETOPO netCDF or GeoTIFF) merged with land heights")
+	solar.Flags().Float64Var(&demFeather, "dem-feather", 0, "Width in meters of the band where chained DEM sources are blended")
+	solar.Flags().StringVar(&demMaxSize, "dem-max-size", "",
+		"Maximum size of the DEM directory (e.g.: 20GB). Least recently used files are evicted")
+	solar.Flags().StringVar(&demPinned, "dem-pinned", "",
+		"Regions never evicted from the DEM directory: bounding boxes or GeoJSON files separated by semicolons (;)")
+	solar.Flags().IntVar(&httpClientTimeout, "http-client-timeout", 0, "HTTP client request timeout")
+	solar.Flags().StringVar(&earthdataUser, "earthdata-user", "", "Earthdata API username")
+	solar.Flags().StringVar(&earthdataPassword, "earthdata-password", "", "Earthdata API password")
+	solar.Flags().StringVar(&srtmMirror, "srtm-mirror", "",
+		"SRTM30m dataset mirror URL (http:// or file://), accessed without Earthdata authentication")
+	solar.Flags().BoolVar(&srtmOffline, "offline", false, "Never download SRTM files. Missing files are voids")
+	solar.Flags().StringVar(&demStorage, "dem-storage", "",
+		"Format of the downloaded HGT files: hgt (uncompressed), gz or zip. Compressed files use about 60% less disk")
+
+	return solar
+}
+
+func simulateSolarDay(cmd *cobra.Command, args []string) {
+	if dotenvPath != "" {
+		loadDotEnv(dotenvPath)
+	}
+
+	coords := parseCoordinateAndResParams(cmd)
+
+	date, _ := cmd.Flags().GetString("date")
+	timezone, _ := cmd.Flags().GetString("timezone")
+	buffer, _ := cmd.Flags().GetFloat64("buffer")
+	output, _ := cmd.Flags().GetString("output")
+
+	location, err := time.LoadLocation(timezone)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", date, location)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	httpClient := createHttpClient()
+	h, srtmDownloader := createElevationSource(httpClient)
+	defer h.Close()
+
+	heightmapGen := &heightmap.Generator{
+		ElevationDataset: h,
+		SrtmDownloader:   srtmDownloader,
+		Dir:              "./",
+		MinElevation:     minElevation(),
+	}
+
+	log.Infof("Simulating solar day %s for coordinates (%f, %f)", date, coords.Latitude, coords.Longitude)
+
+	files, err := heightmapGen.CreateSolarDayFiles(heightmap.SolarConfig{
+		Lat:    coords.Latitude,
+		Lon:    coords.Longitude,
+		Side:   coords.Side,
+		Time:   day,
+		Buffer: buffer,
+	}, heightmap.ResolutionConfig{Width: coords.Resolution, Height: coords.Resolution})
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	err = os.MkdirAll(output, os.ModePerm)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	for name, b := range files {
+		path := filepath.Join(output, name)
+
+		err = os.WriteFile(path, b, 0644)
+
+		if err != nil {
+			handleErr(err)
+		}
+
+		log.Infof("File %s saved successfully", path)
+	}
+}
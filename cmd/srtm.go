@@ -1,10 +1,16 @@
 package cmd
 
 import (
-	"github.com/petoc/hgt"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	env "github.com/geovannyAvelar/lukla/env"
+	"github.com/geovannyAvelar/lukla/srtm"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"os"
 )
 
 func CreateSrtmCommand() *cobra.Command {
@@ -15,6 +21,9 @@ func CreateSrtmCommand() *cobra.Command {
 	}
 
 	srtm.AddCommand(CreateSrtmDownloadCommand())
+	srtm.AddCommand(CreateSrtmStatusCommand())
+	srtm.AddCommand(CreateSrtmVerifyCommand())
+	srtm.AddCommand(CreateSrtmRepairCommand())
 
 	return srtm
 }
@@ -23,40 +32,426 @@ func CreateSrtmDownloadCommand() *cobra.Command {
 	download := &cobra.Command{
 		Use:   "download",
 		Short: "Download SRTM30m dataset",
-		Long:  "Download SRTM30m dataset",
-		Run:   downloadAllSrtmFiles,
+		Long: "Download SRTM30m dataset. Use --bbox, --geojson or --country to download only the files " +
+			"intersecting a region, and --dry-run to list them without downloading",
+		Run: downloadSrtmFiles,
 	}
 
+	addRegionFlags(download)
+	download.Flags().Bool("dry-run", false, "List the files to be downloaded and their estimated size")
+
 	download.Flags().StringVar(&dotenvPath, "env", "", "Dot env file path")
 	download.Flags().StringVar(&demPath, "dem-path", "", "Digital Elevation Model (DEM) files path")
 	download.Flags().IntVar(&httpClientTimeout, "http-client-timeout", 0, "HTTP client request timeout")
 	download.Flags().StringVar(&earthdataUser, "earthdata-user", "", "Earthdata API username")
 	download.Flags().StringVar(&earthdataPassword, "earthdata-password", "", "Earthdata API password")
+	download.Flags().StringVar(&srtmMirror, "srtm-mirror", "",
+		"SRTM30m dataset mirror URL (http:// or file://), accessed without Earthdata authentication")
+	download.Flags().BoolVar(&srtmOffline, "offline", false, "Never download SRTM files. Missing files are voids")
+	download.Flags().StringVar(&demStorage, "dem-storage", "",
+		"Format of the downloaded HGT files: hgt (uncompressed), gz or zip. Compressed files use about 60% less disk")
 
 	return download
 }
 
-func downloadAllSrtmFiles(cmd *cobra.Command, args []string) {
+func CreateSrtmStatusCommand() *cobra.Command {
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "Show the content of the DEM directory",
+		Long: "Show the number of SRTM30m files present in the DEM directory and expected from the SRTM " +
+			"bounding boxes collection (or from a region), the disk usage and orphan zip files",
+		Run: showSrtmStatus,
+	}
+
+	addRegionFlags(status)
+	status.Flags().Bool("list-missing", false, "List the missing files")
+	status.Flags().StringVar(&dotenvPath, "env", "", "Dot env file path")
+	status.Flags().StringVar(&demPath, "dem-path", "", "Digital Elevation Model (DEM) files path")
+
+	return status
+}
+
+func CreateSrtmVerifyCommand() *cobra.Command {
+	verify := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the HGT files of the DEM directory",
+		Long: "Check if the size of each HGT file of the DEM directory matches the 1 or 3 arc seconds layout " +
+			"and if it can be read to the end",
+		Run: verifySrtmFiles,
+	}
+
+	verify.Flags().StringVar(&dotenvPath, "env", "", "Dot env file path")
+	verify.Flags().StringVar(&demPath, "dem-path", "", "Digital Elevation Model (DEM) files path")
+
+	return verify
+}
+
+func CreateSrtmRepairCommand() *cobra.Command {
+	repair := &cobra.Command{
+		Use:   "repair",
+		Short: "Download corrupted and missing HGT files again",
+		Long: "Delete corrupted HGT files and download them again, extract orphan zip files and, when a region " +
+			"is defined with --bbox, --geojson or --country, download its missing files",
+		Run: repairSrtmFiles,
+	}
+
+	addRegionFlags(repair)
+	repair.Flags().StringVar(&dotenvPath, "env", "", "Dot env file path")
+	repair.Flags().StringVar(&demPath, "dem-path", "", "Digital Elevation Model (DEM) files path")
+	repair.Flags().IntVar(&httpClientTimeout, "http-client-timeout", 0, "HTTP client request timeout")
+	repair.Flags().StringVar(&earthdataUser, "earthdata-user", "", "Earthdata API username")
+	repair.Flags().StringVar(&earthdataPassword, "earthdata-password", "", "Earthdata API password")
+	repair.Flags().StringVar(&srtmMirror, "srtm-mirror", "",
+		"SRTM30m dataset mirror URL (http:// or file://), accessed without Earthdata authentication")
+	repair.Flags().BoolVar(&srtmOffline, "offline", false, "Never download SRTM files. Missing files are voids")
+	repair.Flags().StringVar(&demStorage, "dem-storage", "",
+		"Format of the downloaded HGT files: hgt (uncompressed), gz or zip. Compressed files use about 60% less disk")
+
+	return repair
+}
+
+// addRegionFlags Add the flags parsed by parseRegion
+func addRegionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("bbox", "", "Bounding box (west,south,east,north) in degrees")
+	cmd.Flags().String("geojson", "", "GeoJSON file with the polygons of the region")
+	cmd.Flags().StringSlice("country", nil, "Country names or ISO codes, separated by commas (,)")
+	cmd.Flags().String("countries-file", "", "GeoJSON file of country boundaries used by --country")
+}
+
+func downloadSrtmFiles(cmd *cobra.Command, args []string) {
 	if dotenvPath != "" {
 		loadDotEnv(dotenvPath)
 	}
 
-	h := createHgtDataDir()
-	defer func(h *hgt.DataDir) {
-		err := h.Close()
-		if err != nil {
-			log.Errorf("Error closing hgt data dir. Cause: %s", err)
-		}
-	}(h)
+	region, err := parseRegion(cmd)
+
+	if err != nil {
+		handleErr(err)
+	}
 
 	httpClient := createHttpClient()
 	earthdataApi := createEarthdataApiClient(httpClient)
 	srtmDownloader := createSrtmDownloader(httpClient, earthdataApi)
 
-	err := srtmDownloader.DownloadAllDemFiles()
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		if region == nil {
+			region = srtm.BboxRegion(-180, -90, 180, 90)
+		}
+
+		plan, err := srtmDownloader.PlanDownload(region)
+
+		if err != nil {
+			handleErr(err)
+		}
+
+		printDownloadPlan(plan)
+		return
+	}
+
+	var report *srtm.DownloadReport
+
+	stopProgress := watchDownloadProgress(srtmDownloader)
+
+	if region == nil {
+		report, err = srtmDownloader.DownloadAllDemFiles()
+	} else {
+		report, err = srtmDownloader.DownloadRegion(region)
+	}
+
+	stopProgress()
 
 	if err != nil {
 		log.Errorf("Cannot download SRTM30m dataset. Cause: %s", err)
 		os.Exit(1)
 	}
+
+	printDownloadReport(report)
+
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func showSrtmStatus(cmd *cobra.Command, args []string) {
+	if dotenvPath != "" {
+		loadDotEnv(dotenvPath)
+	}
+
+	region, err := parseRegion(cmd)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	status, err := createSrtmDownloader(createHttpClient(), nil).Status(region)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	fmt.Printf("Files: %d / %d (%.1f%%)\n", len(status.Present), status.Expected, status.Coverage()*100)
+	fmt.Printf("Missing: %d\n", len(status.Missing))
+
+	if listMissing, _ := cmd.Flags().GetBool("list-missing"); listMissing {
+		for _, name := range status.Missing {
+			fmt.Println("  ", name)
+		}
+	}
+
+	fmt.Printf("Disk usage: %s\n", formatBytes(status.DiskUsage))
+	fmt.Printf("Orphan zip files: %d\n", len(status.Orphans))
+
+	for _, name := range status.Orphans {
+		fmt.Println("  ", name)
+	}
+
+	fmt.Printf("Interrupted downloads: %d\n", len(status.PartFiles))
+
+	for _, name := range status.PartFiles {
+		fmt.Println("  ", name)
+	}
+}
+
+func verifySrtmFiles(cmd *cobra.Command, args []string) {
+	if dotenvPath != "" {
+		loadDotEnv(dotenvPath)
+	}
+
+	report, err := createSrtmDownloader(createHttpClient(), nil).Verify()
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	for _, corrupt := range report.Corrupted {
+		fmt.Printf("%s: %s\n", corrupt.Name, corrupt.Err)
+	}
+
+	fmt.Printf("%d file(s) checked, %d corrupted\n", report.Checked, len(report.Corrupted))
+
+	if len(report.Corrupted) > 0 {
+		fmt.Println("Run lukla srtm repair to download them again")
+		os.Exit(1)
+	}
+}
+
+func repairSrtmFiles(cmd *cobra.Command, args []string) {
+	if dotenvPath != "" {
+		loadDotEnv(dotenvPath)
+	}
+
+	region, err := parseRegion(cmd)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	httpClient := createHttpClient()
+	srtmDownloader := createSrtmDownloader(httpClient, createEarthdataApiClient(httpClient))
+
+	stopProgress := watchDownloadProgress(srtmDownloader)
+	report, err := srtmDownloader.Repair(region)
+	stopProgress()
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	printDownloadReport(report)
+
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseRegion Region of the --bbox, --geojson and --country flags. Nil when none is used
+func parseRegion(cmd *cobra.Command) (srtm.Region, error) {
+	bboxStr, _ := cmd.Flags().GetString("bbox")
+	geojsonPath, _ := cmd.Flags().GetString("geojson")
+	countries, _ := cmd.Flags().GetStringSlice("country")
+	countriesFile, _ := cmd.Flags().GetString("countries-file")
+
+	var region srtm.Region
+
+	if bboxStr != "" {
+		bbox, err := parseFloatBbox(bboxStr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		region = append(region, srtm.BboxRegion(bbox[0], bbox[1], bbox[2], bbox[3])...)
+	}
+
+	if geojsonPath != "" {
+		r, err := srtm.LoadGeoJSONRegion(geojsonPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		region = append(region, r...)
+	}
+
+	if len(countries) > 0 {
+		if countriesFile == "" {
+			countriesFile = env.GetCountriesFilePath()
+		}
+
+		if countriesFile == "" {
+			return nil, fmt.Errorf("--country requires a country boundaries file. " +
+				"Use --countries-file or LUKLA_COUNTRIES_FILE")
+		}
+
+		r, err := srtm.LoadCountryRegion(countriesFile, countries)
+
+		if err != nil {
+			return nil, err
+		}
+
+		region = append(region, r...)
+	}
+
+	return region, nil
+}
+
+// parseFloatBbox Parse a west,south,east,north bounding box
+func parseFloatBbox(bbox string) ([4]float64, error) {
+	var result [4]float64
+	parts := strings.Split(bbox, ",")
+
+	if len(parts) != 4 {
+		return result, fmt.Errorf("invalid bounding box %s. Use west,south,east,north", bbox)
+	}
+
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+
+		if err != nil {
+			return result, fmt.Errorf("invalid bounding box %s. Cause: %w", bbox, err)
+		}
+
+		result[i] = v
+	}
+
+	if result[0] >= result[2] || result[1] >= result[3] {
+		return result, fmt.Errorf("invalid bounding box %s. West and south must be smaller than east and north", bbox)
+	}
+
+	return result, nil
+}
+
+func printDownloadPlan(plan *srtm.DownloadPlan) {
+	existing := map[string]bool{}
+
+	for _, filename := range plan.Existing {
+		existing[filename] = true
+	}
+
+	for _, filename := range plan.Files {
+		if existing[filename] {
+			fmt.Println(filename, "(already downloaded)")
+		} else {
+			fmt.Println(filename)
+		}
+	}
+
+	fmt.Printf("\n%d file(s), %d already downloaded\n", len(plan.Files), len(plan.Existing))
+	fmt.Printf("Estimated download size: %s\n", formatBytes(plan.EstimatedDownloadSize()))
+	fmt.Printf("Estimated disk size: %s\n", formatBytes(plan.EstimatedDiskSize()))
+}
+
+func printDownloadReport(report *srtm.DownloadReport) {
+	fmt.Printf("Downloaded: %d\n", len(report.Downloaded))
+	fmt.Printf("Skipped (already downloaded): %d\n", len(report.Skipped))
+	fmt.Printf("Missing on server: %d\n", len(report.Missing))
+
+	for _, filename := range report.Missing {
+		fmt.Println("  ", filename)
+	}
+
+	fmt.Printf("Failed: %d\n", len(report.Failed))
+
+	for _, filename := range report.Failed {
+		fmt.Println("  ", filename)
+	}
+}
+
+// formatBytes Format a size using binary units (e.g.: 1.5 GiB)
+// watchDownloadProgress Draw a progress bar of the downloads while stderr is a terminal. The returned function
+// stops drawing it
+func watchDownloadProgress(downloader *srtm.Downloader) func() {
+	if info, err := os.Stderr.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return func() {}
+	}
+
+	events, cancel := downloader.Subscribe()
+	done := make(chan struct{})
+
+	go func() {
+		for event := range events {
+			drawProgressBar(event.Progress)
+		}
+
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+
+		if p := downloader.Progress(); p.FilesTotal > 0 {
+			drawProgressBar(p)
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+// drawProgressBar Redraw the progress bar in the current line of stderr
+// (e.g.: [=========>          ]  12/40 files  120.3 MiB  4.2 MiB/s  ETA 1m30s)
+func drawProgressBar(p srtm.Progress) {
+	const width = 30
+
+	filled := 0
+
+	if p.FilesTotal > 0 {
+		filled = width * p.FilesDone / p.FilesTotal
+	}
+
+	bar := strings.Repeat("=", filled)
+
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+
+	line := fmt.Sprintf("[%s] %d/%d files  %s  %s/s", bar, p.FilesDone, p.FilesTotal,
+		formatBytes(p.BytesDownloaded), formatBytes(int64(p.Rate)))
+
+	if p.Active() && p.ETA > 0 {
+		line += fmt.Sprintf("  ETA %s", (time.Duration(p.ETA) * time.Second).Round(time.Second))
+	}
+
+	if p.FilesFailed > 0 {
+		line += fmt.Sprintf("  %d failed", p.FilesFailed)
+	}
+
+	// Clear the rest of the line, which may contain a longer previous bar
+	fmt.Fprintf(os.Stderr, "\r%s\033[K", line)
+}
+
+func formatBytes(b int64) string {
+	const unit = 1024
+
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+
+	div, exp := int64(unit), 0
+
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
 }
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+
+	env "github.com/geovannyAvelar/lukla/env"
+	"github.com/geovannyAvelar/lukla/heightmap"
+	"github.com/spf13/cobra"
+)
+
+func CreateTilesCommand() *cobra.Command {
+	tiles := &cobra.Command{
+		Use:   "tiles",
+		Short: "Tile cache operations",
+		Long:  "Tile cache operations",
+	}
+
+	tiles.AddCommand(CreateTilesPruneCommand())
+
+	return tiles
+}
+
+func CreateTilesPruneCommand() *cobra.Command {
+	prune := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove tiles from the tile cache",
+		Long: "Remove the cached tiles matching every filter. Without filters, the whole cache is removed. Use " +
+			"--stale to remove only the tiles rendered by another renderer version or DEM source",
+		Run: pruneTiles,
+	}
+
+	prune.Flags().String("bbox", "", "Bounding box (west,south,east,north) in degrees")
+	prune.Flags().Int("min-zoom", 0, "Lowest zoom level")
+	prune.Flags().Int("max-zoom", -1, "Highest zoom level. Negative matches every zoom level")
+	prune.Flags().Int("resolution", 0, "Tile resolution in pixels (e.g.: 256). Zero matches every resolution")
+	prune.Flags().String("style", "",
+		"Tile layer: grayscale, terrain-rgb, terrarium or a terrain index (e.g.: tri or tpi-3)")
+	prune.Flags().Duration("older-than", 0, "Minimum age of the tiles (e.g.: 720h)")
+	prune.Flags().Bool("stale", false, "Remove only tiles rendered by another renderer version or DEM source")
+	prune.Flags().Bool("dry-run", false, "Count the tiles to be removed without removing them")
+
+	prune.Flags().StringVar(&dotenvPath, "env", "", "Dot env file path")
+	prune.Flags().StringVar(&tilesPath, "tile-path", "", "Tiles path")
+	prune.Flags().StringVar(&demPath, "dem-path", "", "Digital Elevation Model (DEM) files path")
+	prune.Flags().StringVar(&demSource, "dem-source", "", "Digital Elevation Model (DEM) source (srtm or geotiff)")
+	prune.Flags().StringVar(&demChain, "dem-chain", "",
+		"Ordered chain of DEM sources ([name=]type:path), separated by commas (,)")
+	prune.Flags().StringVar(&bathymetryPath, "bathymetry", "",
+		"Bathymetry grid (GEBCO or ETOPO netCDF or GeoTIFF) merged with land heights")
+
+	return prune
+}
+
+func pruneTiles(cmd *cobra.Command, args []string) {
+	if dotenvPath != "" {
+		loadDotEnv(dotenvPath)
+	}
+
+	filter, err := parseTileFilter(cmd)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	if tilesPath == "" {
+		tilesPath = env.GetTilesPath()
+	}
+
+	loadDemSourceConfig()
+
+	heightmapGen := &heightmap.Generator{Dir: tilesPath, DemSource: demSourceDescription()}
+	report, err := heightmapGen.PruneTiles(filter)
+
+	if err != nil {
+		handleErr(err)
+	}
+
+	if filter.DryRun {
+		fmt.Printf("%d tile(s) would be removed (%s)\n", report.Removed, formatBytes(report.Bytes))
+		return
+	}
+
+	fmt.Printf("%d tile(s) removed (%s)\n", report.Removed, formatBytes(report.Bytes))
+}
+
+// parseTileFilter Tile filter of the prune flags
+func parseTileFilter(cmd *cobra.Command) (heightmap.TileFilter, error) {
+	var filter heightmap.TileFilter
+
+	if bboxStr, _ := cmd.Flags().GetString("bbox"); bboxStr != "" {
+		bbox, err := parseFloatBbox(bboxStr)
+
+		if err != nil {
+			return filter, err
+		}
+
+		filter.Bbox = &bbox
+	}
+
+	filter.MinZoom, _ = cmd.Flags().GetInt("min-zoom")
+
+	if maxZoom, _ := cmd.Flags().GetInt("max-zoom"); maxZoom >= 0 {
+		filter.MaxZoom = &maxZoom
+	}
+
+	filter.Resolution, _ = cmd.Flags().GetInt("resolution")
+	filter.Style, _ = cmd.Flags().GetString("style")
+	filter.OlderThan, _ = cmd.Flags().GetDuration("older-than")
+	filter.Stale, _ = cmd.Flags().GetBool("stale")
+	filter.DryRun, _ = cmd.Flags().GetBool("dry-run")
+
+	return filter, nil
+}
+
+// loadDemSourceConfig Read the DEM source configuration from the environment without opening the sources, so
+// the DEM source description matches the one of the API
+func loadDemSourceConfig() {
+	if demChain == "" {
+		demChain = env.GetDemChain()
+	}
+
+	if demSource == "" {
+		demSource = env.GetDemSource()
+	}
+
+	if demPath == "" {
+		demPath = env.GetDigitalElevationModelPath()
+	}
+
+	if bathymetryPath == "" {
+		bathymetryPath = env.GetBathymetryPath()
+	}
+}
@@ -3,6 +3,8 @@ package internal
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -99,6 +101,213 @@ func GetDigitalElevationModelPath() string {
 	return "data/dem"
 }
 
+// GetDemSource Returns the digital elevation model (DEM) dataset format, srtm (.hgt files) or geotiff.
+// Default is srtm
+func GetDemSource() string {
+	source := os.Getenv("LUKLA_DEM_SOURCE")
+
+	if source != "" {
+		return strings.ToLower(source)
+	}
+
+	return "srtm"
+}
+
+// GetDemMaxSize Returns the maximum size of the DEM directory (e.g.: 20GB). Empty when it grows without limit
+func GetDemMaxSize() string {
+	return os.Getenv("LUKLA_DEM_MAX_SIZE")
+}
+
+// GetDemStorage Returns the format of the downloaded HGT files: hgt (uncompressed), gz or zip. Default is hgt
+func GetDemStorage() string {
+	return os.Getenv("LUKLA_DEM_STORAGE")
+}
+
+// GetDemMaxOpenFiles Returns the maximum number of uncompressed HGT files memory mapped at once. Default is 64
+func GetDemMaxOpenFiles() int {
+	return getPositiveInt("LUKLA_DEM_MAX_OPEN_FILES", 64)
+}
+
+// GetDemPinnedRegions Returns the regions whose DEM files are never evicted, as bounding boxes or GeoJSON files
+// separated by semicolons (;)
+func GetDemPinnedRegions() string {
+	return os.Getenv("LUKLA_DEM_PINNED_REGIONS")
+}
+
+// GetOverviewsPath Returns the directory of the downsampled digital elevation model (DEM) levels.
+// Default is 'data/overviews'
+func GetOverviewsPath() string {
+	path := os.Getenv("LUKLA_OVERVIEWS_PATH")
+
+	if path != "" {
+		return path
+	}
+
+	return "data/overviews"
+}
+
+// GetDemChain Returns the ordered chain of elevation sources, as a list of [name=]type:path entries separated
+// by commas. Empty when a single source is used
+func GetDemChain() string {
+	return os.Getenv("LUKLA_DEM_CHAIN")
+}
+
+// GetDemFeather Returns the width in meters of the band where chained elevation sources are blended.
+// Default is 300 meters
+func GetDemFeather() float64 {
+	featherStr := os.Getenv("LUKLA_DEM_FEATHER")
+
+	if featherStr != "" {
+		feather, err := strconv.ParseFloat(featherStr, 64)
+
+		if err == nil {
+			return feather
+		}
+
+		log.Warn("Cannot parse LUKLA_DEM_FEATHER enviroment variable. Feather must be a number.")
+	}
+
+	return 300
+}
+
+// GetBathymetryPath Returns the path of the bathymetry grid merged with land heights. Empty when the seafloor
+// is not drawn
+func GetBathymetryPath() string {
+	return os.Getenv("LUKLA_BATHYMETRY_PATH")
+}
+
+// GetSrtmChecksumsFile Returns the path of a md5sum or sha256sum file with the checksums of the SRTM zip files.
+// Empty when downloads are only verified by their zip CRCs
+func GetSrtmChecksumsFile() string {
+	return os.Getenv("LUKLA_SRTM_CHECKSUMS_FILE")
+}
+
+// GetSrtmMaxAttempts Returns the maximum number of attempts of each SRTM download. Default is 4
+func GetSrtmMaxAttempts() int {
+	return getPositiveInt("LUKLA_SRTM_MAX_ATTEMPTS", 4)
+}
+
+// GetSrtmMaxConcurrency Returns the maximum number of simultaneous SRTM downloads. Default is 4
+func GetSrtmMaxConcurrency() int {
+	return getPositiveInt("LUKLA_SRTM_MAX_CONCURRENCY", 4)
+}
+
+// GetSrtmRateLimit Returns the maximum average number of SRTM download requests per second.
+// Default is 0 (unlimited)
+func GetSrtmRateLimit() float64 {
+	rateStr := os.Getenv("LUKLA_SRTM_RATE_LIMIT")
+
+	if rateStr != "" {
+		rate, err := strconv.ParseFloat(rateStr, 64)
+
+		if err == nil && rate >= 0 {
+			return rate
+		}
+
+		log.Warn("Cannot parse LUKLA_SRTM_RATE_LIMIT enviroment variable. Rate limit must be a number.")
+	}
+
+	return 0
+}
+
+// GetSrtmMirror Returns the URL of a SRTM30m dataset mirror (http://, https:// or file://). Mirrors are
+// accessed without EarthData authentication. Empty when files are downloaded from the EarthData server
+func GetSrtmMirror() string {
+	return os.Getenv("LUKLA_SRTM_MIRROR")
+}
+
+// IsSrtmOffline Returns true when SRTM files must never be downloaded. Missing files are treated as voids
+func IsSrtmOffline() bool {
+	offlineStr := os.Getenv("LUKLA_SRTM_OFFLINE")
+
+	if offlineStr == "" {
+		return false
+	}
+
+	offline, err := strconv.ParseBool(offlineStr)
+
+	if err != nil {
+		log.Warn("Cannot parse LUKLA_SRTM_OFFLINE enviroment variable. It must be true or false.")
+		return false
+	}
+
+	return offline
+}
+
+// GetAdminToken Returns the bearer token required by the admin API endpoints (e.g.: DELETE /tiles). Empty
+// disables them
+func GetAdminToken() string {
+	return os.Getenv("LUKLA_ADMIN_TOKEN")
+}
+
+// GetCacheMaxAge Returns the Cache-Control max-age of the API routes, in seconds, as route=seconds pairs separated
+// by commas (,) (e.g.: tiles=86400,heightmap=0). Empty when every route uses its default
+func GetCacheMaxAge() string {
+	return os.Getenv("LUKLA_CACHE_MAX_AGE")
+}
+
+// GetRenderConcurrency Returns the maximum number of tiles rendered simultaneously by the API. Default is the
+// number of CPUs
+func GetRenderConcurrency() int {
+	return getPositiveInt("LUKLA_RENDER_CONCURRENCY", runtime.NumCPU())
+}
+
+// GetRenderQueueSize Returns the maximum number of tile renders waiting for a free slot. Requests beyond it are
+// rejected with 503 Service Unavailable. Zero does not limit the waiting renders. Default is 64
+func GetRenderQueueSize() int {
+	return getNonNegativeInt("LUKLA_RENDER_QUEUE_SIZE", 64)
+}
+
+// GetMetatileSize Returns the side, in tiles, of the metatiles rendered as a single raster and sliced into tiles.
+// One renders each tile independently. Default is 4
+func GetMetatileSize() int {
+	return getPositiveInt("LUKLA_METATILE_SIZE", 4)
+}
+
+// GetMetatileBuffer Returns the pixels rendered around each metatile and discarded after resampling. Zero renders
+// metatiles without buffer. Default is 16
+func GetMetatileBuffer() int {
+	return getNonNegativeInt("LUKLA_METATILE_BUFFER", 16)
+}
+
+// GetFloodCacheSize Returns the number of flood simulations kept in memory and shared by the tiles of each flood.
+// Default is 8
+func GetFloodCacheSize() int {
+	return getPositiveInt("LUKLA_FLOOD_CACHE_SIZE", 8)
+}
+
+func getPositiveInt(name string, def int) int {
+	str := os.Getenv(name)
+
+	if str != "" {
+		v, err := strconv.Atoi(str)
+
+		if err == nil && v > 0 {
+			return v
+		}
+
+		log.Warnf("Cannot parse %s enviroment variable. It must be a positive integer.", name)
+	}
+
+	return def
+}
+
+func getNonNegativeInt(name string, def int) int {
+	str := os.Getenv(name)
+
+	if str != "" {
+		v, err := strconv.Atoi(str)
+
+		if err == nil && v >= 0 {
+			return v
+		}
+
+		log.Warnf("Cannot parse %s enviroment variable. It must be a non-negative integer.", name)
+	}
+
+	return def
+}
+
 func GetBboxFilePath() string {
 	path := os.Getenv("LUKLA_SRTM30M_BBOX_FILE")
 
@@ -112,32 +321,58 @@ func GetBboxFilePath() string {
 	return "data/srtm30m_bounding_boxes.json"
 }
 
+// GetCountriesFilePath Returns the path of a GeoJSON file of country boundaries, used to download the SRTM
+// files of countries. Empty when no file is available
+func GetCountriesFilePath() string {
+	return os.Getenv("LUKLA_COUNTRIES_FILE")
+}
+
 // GetEarthDataApiUsername Returns the username to authenticate on EarthData API
 func GetEarthDataApiUsername() string {
-	username := os.Getenv("LUKLA_EARTHDATA_USERNAME")
+	return os.Getenv("LUKLA_EARTHDATA_USERNAME")
+}
 
-	if username != "" {
-		return username
-	}
+// GetEarthDataApiPassword Returns the password to authenticate on EarthData API
+func GetEarthDataApiPassword() string {
+	return os.Getenv("LUKLA_EARTHDATA_PASSWORD")
+}
 
-	log.Warn("LUKLA_EARTHDATA_USERNAME environment variable is not defined." +
-		" Lukla cannot download elevation dataset data.")
+// GetEarthDataCredentialsFile Returns the path of a file containing EarthData credentials (username:password)
+func GetEarthDataCredentialsFile() string {
+	return os.Getenv("LUKLA_EARTHDATA_CREDENTIALS_FILE")
+}
 
-	return ""
+// GetEarthDataCredentialHelper Returns a command printing EarthData credentials in the git credential helper
+// format (username=<username> and password=<password> lines)
+func GetEarthDataCredentialHelper() string {
+	return os.Getenv("LUKLA_EARTHDATA_CREDENTIAL_HELPER")
 }
 
-// GetEarthDataApiPassword Returns the password to authenticate on EarthData API
-func GetEarthDataApiPassword() string {
-	password := os.Getenv("LUKLA_EARTHDATA_PASSWORD")
+// GetEarthDataApiToken Returns a pre-issued EarthData bearer token, used instead of username and password
+func GetEarthDataApiToken() string {
+	return os.Getenv("LUKLA_EARTHDATA_TOKEN")
+}
+
+// GetEarthDataTokenFile Returns the file where EarthData tokens are persisted between runs. Default is
+// lukla/earthdata_token.json in the user cache directory. "none" disables the persistence
+func GetEarthDataTokenFile() string {
+	path := os.Getenv("LUKLA_EARTHDATA_TOKEN_FILE")
 
-	if password != "" {
-		return password
+	if path == "none" {
+		return ""
 	}
 
-	log.Warn("LUKLA_EARTHDATA_PASSWORD environment variable is not defined." +
-		" Lukla cannot download elevation dataset data.")
+	if path != "" {
+		return path
+	}
+
+	cacheDir, err := os.UserCacheDir()
+
+	if err != nil {
+		return ""
+	}
 
-	return ""
+	return filepath.Join(cacheDir, "lukla", "earthdata_token.json")
 }
 
 // GetHttpClientTimeout Returns a time.Duration representing the timeout to HTTP Client requests.
@@ -18,3 +18,17 @@ func TestGetHttpClientTimeout(t *testing.T) {
 		t.Errorf("Expected %s but received %s", timeout, expected)
 	}
 }
+
+func TestGetNonNegativeInt(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]int{"0": 0, "12": 12, "-1": 5, "abc": 5}
+
+	for value, expected := range tests {
+		os.Setenv("LUKLA_TEST_NON_NEGATIVE_INT", value)
+
+		if v := getNonNegativeInt("LUKLA_TEST_NON_NEGATIVE_INT", 5); v != expected {
+			t.Errorf("%s: expected %d but received %d", value, expected, v)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package geotiff
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrNotCovered = errors.New("no GeoTIFF file covers the coordinate")
+
+// DataDir Directory of GeoTIFF digital elevation model (DEM) tiles, such as Copernicus GLO-30 Cloud-Optimized
+// GeoTIFF files. Subdirectories are also scanned. Only the file headers are read when the directory is
+// opened and files are kept open after their first read
+type DataDir struct {
+	dir   string
+	files []*dataDirFile
+	index map[[2]int][]*dataDirFile
+}
+
+type dataDirFile struct {
+	path                     string
+	west, south, east, north float64
+	file                     *File
+	mutex                    sync.Mutex
+}
+
+// OpenDataDir Index the GeoTIFF files of a directory by their bounds
+func OpenDataDir(dir string) (*DataDir, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	d := &DataDir{dir: dir, index: map[[2]int][]*dataDirFile{}}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+
+		if entry.IsDir() || (ext != ".tif" && ext != ".tiff") {
+			return nil
+		}
+
+		f, err := Open(path)
+
+		if err != nil {
+			log.Warnf("Ignoring GeoTIFF file %s. Cause: %s", path, err)
+			return nil
+		}
+
+		west, south, east, north := f.Bounds()
+		f.Close()
+
+		d.add(&dataDirFile{path: path, west: west, south: south, east: east, north: north})
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan GeoTIFF directory %s. Cause: %w", dir, err)
+	}
+
+	log.Infof("%d GeoTIFF file(s) found in %s", len(d.files), dir)
+
+	return d, nil
+}
+
+// add Register a file on every one degree cell its bounds touch. Cells starting on the north and east edges are
+// included, since a coordinate on an integer north edge belongs to the cell above it
+func (d *DataDir) add(f *dataDirFile) {
+	d.files = append(d.files, f)
+
+	for lat := int(math.Floor(f.south)); lat <= int(math.Floor(f.north)); lat++ {
+		for lon := int(math.Floor(f.west)); lon <= int(math.Floor(f.east)); lon++ {
+			key := [2]int{lat, lon}
+			d.index[key] = append(d.index[key], f)
+		}
+	}
+}
+
+// ElevationAt Return the elevation of a coordinate and the resolution, in arc seconds, of the file containing it
+func (d *DataDir) ElevationAt(lat, lon float64) (int16, int, error) {
+	key := [2]int{int(math.Floor(lat)), int(math.Floor(lon))}
+
+	for _, f := range d.index[key] {
+		if lon < f.west || lon >= f.east || lat <= f.south || lat > f.north {
+			continue
+		}
+
+		file, err := f.open()
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return file.ElevationAt(lat, lon)
+	}
+
+	return 0, 0, ErrNotCovered
+}
+
+// Close Close every opened file
+func (d *DataDir) Close() error {
+	var closeErr error
+
+	for _, f := range d.files {
+		f.mutex.Lock()
+
+		if f.file != nil {
+			if err := f.file.Close(); err != nil {
+				closeErr = err
+			}
+
+			f.file = nil
+		}
+
+		f.mutex.Unlock()
+	}
+
+	return closeErr
+}
+
+func (f *dataDirFile) open() (*File, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file != nil {
+		return f.file, nil
+	}
+
+	file, err := Open(f.path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.file = file
+
+	return file, nil
+}
@@ -0,0 +1,56 @@
+package geotiff
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataDirElevationAt(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	writeRaster(t, filepath.Join(dir, "N45_E010.tif"), &Raster{
+		Width: 2, Height: 2, Data: []float32{1, 2, 3, 4},
+		Lon: 10, Lat: 46, PixelWidth: 0.5, PixelHeight: 0.5,
+	})
+	writeRaster(t, filepath.Join(dir, "N45_E011.TIF"), &Raster{
+		Width: 2, Height: 2, Data: []float32{5, 6, 7, 8},
+		Lon: 11, Lat: 46, PixelWidth: 0.5, PixelHeight: 0.5,
+	})
+
+	d, err := OpenDataDir(dir)
+
+	if err != nil {
+		t.Fatalf("cannot open data dir. Cause: %s", err)
+	}
+
+	defer d.Close()
+
+	tests := []struct {
+		lat, lon float64
+		expected int16
+	}{
+		{45.9, 10.1, 1},
+		{45.1, 10.9, 4},
+		{45.9, 11.6, 6},
+		{45.4, 11.2, 7},
+		// Coordinates on the north edge of the files, whose one degree cell is the one above them
+		{46, 10.1, 1},
+		{46, 11.6, 6},
+	}
+
+	for _, test := range tests {
+		elevation, _, err := d.ElevationAt(test.lat, test.lon)
+
+		if err != nil || elevation != test.expected {
+			t.Errorf("(%f, %f): expected %d but received %d, %v", test.lat, test.lon, test.expected,
+				elevation, err)
+		}
+	}
+
+	if _, _, err := d.ElevationAt(47.5, 10.5); !errors.Is(err, ErrNotCovered) {
+		t.Errorf("expected not covered error but received %v", err)
+	}
+}
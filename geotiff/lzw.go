@@ -0,0 +1,78 @@
+package geotiff
+
+import "errors"
+
+const (
+	lzwClearCode = 256
+	lzwEndCode   = 257
+	lzwMaxWidth  = 12
+)
+
+// lzwDecode Decompress TIFF LZW data. TIFF LZW codes are packed most significant bit first and the code
+// width grows one code earlier than in GIF LZW, so compress/lzw cannot read it
+func lzwDecode(src []byte) ([]byte, error) {
+	var out []byte
+	var prev []byte
+	var bits uint32
+	var nBits uint
+
+	table := make([][]byte, 1<<lzwMaxWidth)
+
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+
+	next := lzwEndCode + 1
+	width := uint(9)
+	pos := 0
+
+	for {
+		for nBits < width && pos < len(src) {
+			bits = bits<<8 | uint32(src[pos])
+			nBits += 8
+			pos++
+		}
+
+		if nBits < width {
+			return out, nil
+		}
+
+		code := int(bits>>(nBits-width)) & (1<<width - 1)
+		nBits -= width
+
+		if code == lzwClearCode {
+			next = lzwEndCode + 1
+			width = 9
+			prev = nil
+			continue
+		}
+
+		if code == lzwEndCode {
+			return out, nil
+		}
+
+		var entry []byte
+
+		switch {
+		case code < next:
+			entry = table[code]
+		case code == next && prev != nil:
+			entry = append(append([]byte{}, prev...), prev[0])
+		default:
+			return nil, errors.New("invalid LZW code")
+		}
+
+		out = append(out, entry...)
+
+		if prev != nil && next < len(table) {
+			table[next] = append(append([]byte{}, prev...), entry[0])
+			next++
+		}
+
+		prev = entry
+
+		if next >= 1<<width-1 && width < lzwMaxWidth {
+			width++
+		}
+	}
+}
@@ -0,0 +1,563 @@
+package geotiff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TIFF tags read by lukla, besides the ones written by Encode
+const (
+	tagPredictor   = 317
+	tagTileWidth   = 322
+	tagTileLength  = 323
+	tagTileOffsets = 324
+	tagTileCounts  = 325
+)
+
+// Compression schemes supported by the reader
+const (
+	compressionNone       = 1
+	compressionLzw        = 5
+	compressionDeflate    = 8
+	compressionOldDeflate = 32946
+)
+
+// Predictor values
+const (
+	predictorNone          = 1
+	predictorHorizontal    = 2
+	predictorFloatingPoint = 3
+)
+
+// GTRasterTypeGeoKey value of rasters whose tie points refer to the pixel centers
+const rasterPixelIsPoint = 2
+
+// Maximum number of decoded tiles kept in memory by each file
+var maxCachedTiles = 16
+
+var ErrUnsupportedFile = errors.New("unsupported GeoTIFF file")
+
+var ErrOutOfBounds = errors.New("coordinate is outside the GeoTIFF file")
+
+var ErrNoData = errors.New("no data")
+
+// File Single band GeoTIFF file opened for random access reads. Tiled files, such as Cloud-Optimized GeoTIFF
+// (COG), only decode the tiles that are read
+type File struct {
+	Width, Height           int
+	Lon, Lat                float64
+	PixelWidth, PixelHeight float64
+	NoData                  *float64
+
+	file          *os.File
+	order         binary.ByteOrder
+	tileWidth     int
+	tileHeight    int
+	offsets       []uint64
+	byteCounts    []uint64
+	bitsPerSample int
+	sampleFormat  int
+	compression   int
+	predictor     int
+	tiles         map[int][]float32
+	tileOrder     []int
+	mutex         sync.Mutex
+}
+
+type tiffField struct {
+	typ    uint16
+	count  uint64
+	values []byte
+}
+
+// Open Open a GeoTIFF file and read its georeferencing
+func Open(path string) (*File, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := newFile(file)
+
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot read GeoTIFF file %s. Cause: %w", path, err)
+	}
+
+	return f, nil
+}
+
+func newFile(file *os.File) (*File, error) {
+	header := make([]byte, 8)
+
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+
+	f := &File{file: file, tiles: map[int][]float32{}}
+
+	switch string(header[:2]) {
+	case "II":
+		f.order = binary.LittleEndian
+	case "MM":
+		f.order = binary.BigEndian
+	default:
+		return nil, ErrUnsupportedFile
+	}
+
+	if magic := f.order.Uint16(header[2:]); magic != 42 {
+		return nil, fmt.Errorf("%w. Only classic TIFF files are supported", ErrUnsupportedFile)
+	}
+
+	fields, err := f.readIfd(int64(f.order.Uint32(header[4:])))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f, f.parseFields(fields)
+}
+
+func (f *File) readIfd(offset int64) (map[uint16]tiffField, error) {
+	countBytes := make([]byte, 2)
+
+	if _, err := f.file.ReadAt(countBytes, offset); err != nil {
+		return nil, err
+	}
+
+	count := int(f.order.Uint16(countBytes))
+	entries := make([]byte, count*12)
+
+	if _, err := f.file.ReadAt(entries, offset+2); err != nil {
+		return nil, err
+	}
+
+	fields := map[uint16]tiffField{}
+
+	for i := 0; i < count; i++ {
+		e := entries[i*12 : (i+1)*12]
+		field := tiffField{typ: f.order.Uint16(e[2:]), count: uint64(f.order.Uint32(e[4:]))}
+
+		size := typeSize(field.typ) * field.count
+
+		if size <= 4 {
+			field.values = e[8 : 8+size]
+		} else {
+			field.values = make([]byte, size)
+
+			if _, err := f.file.ReadAt(field.values, int64(f.order.Uint32(e[8:]))); err != nil {
+				return nil, err
+			}
+		}
+
+		fields[f.order.Uint16(e)] = field
+	}
+
+	return fields, nil
+}
+
+func (f *File) parseFields(fields map[uint16]tiffField) error {
+	f.Width = int(f.firstInt(fields, tagImageWidth, 0))
+	f.Height = int(f.firstInt(fields, tagImageLength, 0))
+	f.bitsPerSample = int(f.firstInt(fields, tagBitsPerSample, 1))
+	f.sampleFormat = int(f.firstInt(fields, tagSampleFormat, sampleFormatUint))
+	f.compression = int(f.firstInt(fields, tagCompression, compressionNone))
+	f.predictor = int(f.firstInt(fields, tagPredictor, predictorNone))
+
+	if samples := f.firstInt(fields, tagSamplesPerPixel, 1); samples != 1 {
+		return fmt.Errorf("%w. Files with %d bands are not supported", ErrUnsupportedFile, samples)
+	}
+
+	if !isSupportedSample(f.sampleFormat, f.bitsPerSample) {
+		return fmt.Errorf("%w. Samples of %d bits with format %d are not supported", ErrUnsupportedFile,
+			f.bitsPerSample, f.sampleFormat)
+	}
+
+	switch f.compression {
+	case compressionNone, compressionLzw, compressionDeflate, compressionOldDeflate:
+	default:
+		return fmt.Errorf("%w. Compression %d is not supported", ErrUnsupportedFile, f.compression)
+	}
+
+	if _, ok := fields[tagTileOffsets]; ok {
+		f.tileWidth = int(f.firstInt(fields, tagTileWidth, 0))
+		f.tileHeight = int(f.firstInt(fields, tagTileLength, 0))
+		f.offsets = f.ints(fields[tagTileOffsets])
+		f.byteCounts = f.ints(fields[tagTileCounts])
+	} else {
+		f.tileWidth = f.Width
+		f.tileHeight = int(f.firstInt(fields, tagRowsPerStrip, uint64(f.Height)))
+		f.offsets = f.ints(fields[tagStripOffsets])
+		f.byteCounts = f.ints(fields[tagStripByteCounts])
+	}
+
+	if f.Width <= 0 || f.Height <= 0 || f.tileWidth <= 0 || f.tileHeight <= 0 || len(f.offsets) == 0 ||
+		len(f.offsets) != len(f.byteCounts) {
+		return fmt.Errorf("%w. Invalid image layout", ErrUnsupportedFile)
+	}
+
+	scale := f.floats(fields[tagModelPixelScale])
+	tiepoint := f.floats(fields[tagModelTiepoint])
+
+	if len(scale) < 2 || len(tiepoint) < 6 {
+		return fmt.Errorf("%w. Missing georeferencing tags", ErrUnsupportedFile)
+	}
+
+	f.PixelWidth, f.PixelHeight = scale[0], scale[1]
+	f.Lon = tiepoint[3] - tiepoint[0]*f.PixelWidth
+	f.Lat = tiepoint[4] + tiepoint[1]*f.PixelHeight
+
+	if f.rasterType(fields) == rasterPixelIsPoint {
+		f.Lon -= f.PixelWidth / 2
+		f.Lat += f.PixelHeight / 2
+	}
+
+	if noData, ok := fields[tagGdalNoData]; ok {
+		str := strings.TrimRight(string(noData.values), "\x00 ")
+		value, err := strconv.ParseFloat(str, 64)
+
+		if err == nil {
+			f.NoData = &value
+		}
+	}
+
+	return nil
+}
+
+// rasterType Read GTRasterTypeGeoKey from the GeoKey directory. Default is PixelIsArea
+func (f *File) rasterType(fields map[uint16]tiffField) uint64 {
+	keys := f.ints(fields[tagGeoKeyDirectory])
+
+	for i := 4; i+3 < len(keys); i += 4 {
+		if keys[i] == 1025 && keys[i+1] == 0 {
+			return keys[i+3]
+		}
+	}
+
+	return 1
+}
+
+// Close Close the file
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// Bounds Return the west, south, east and north limits of the file
+func (f *File) Bounds() (float64, float64, float64, float64) {
+	return f.Lon, f.Lat - float64(f.Height)*f.PixelHeight, f.Lon + float64(f.Width)*f.PixelWidth, f.Lat
+}
+
+// Contains Check if a coordinate is inside the file
+func (f *File) Contains(lat, lon float64) bool {
+	west, south, east, north := f.Bounds()
+	return lon >= west && lon < east && lat > south && lat <= north
+}
+
+// ValueAt Return the value of the pixel containing a coordinate
+func (f *File) ValueAt(lat, lon float64) (float64, error) {
+	if !f.Contains(lat, lon) {
+		return 0, ErrOutOfBounds
+	}
+
+	x := int(math.Floor((lon - f.Lon) / f.PixelWidth))
+	y := int(math.Floor((f.Lat - lat) / f.PixelHeight))
+
+	if x >= f.Width {
+		x = f.Width - 1
+	}
+
+	if y >= f.Height {
+		y = f.Height - 1
+	}
+
+	return f.value(x, y)
+}
+
+// ElevationAt Return the elevation of a coordinate rounded to meters and the file resolution in arc seconds
+func (f *File) ElevationAt(lat, lon float64) (int16, int, error) {
+	v, err := f.ValueAt(lat, lon)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int16(math.Round(v)), int(math.Round(f.PixelHeight * 3600)), nil
+}
+
+// ReadRaster Read the whole file as a raster
+func (f *File) ReadRaster() (*Raster, error) {
+	data := make([]float32, f.Width*f.Height)
+
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			v, err := f.value(x, y)
+
+			if err != nil && !errors.Is(err, ErrNoData) {
+				return nil, err
+			}
+
+			data[y*f.Width+x] = float32(v)
+		}
+	}
+
+	return &Raster{
+		Width:       f.Width,
+		Height:      f.Height,
+		Data:        data,
+		Lon:         f.Lon,
+		Lat:         f.Lat,
+		PixelWidth:  f.PixelWidth,
+		PixelHeight: f.PixelHeight,
+		NoData:      f.NoData,
+	}, nil
+}
+
+func (f *File) value(x, y int) (float64, error) {
+	tilesAcross := (f.Width + f.tileWidth - 1) / f.tileWidth
+	tileIndex := (y/f.tileHeight)*tilesAcross + x/f.tileWidth
+
+	tile, err := f.tile(tileIndex)
+
+	if err != nil {
+		return 0, err
+	}
+
+	v := float64(tile[(y%f.tileHeight)*f.tileWidth+x%f.tileWidth])
+
+	if f.NoData != nil && v == *f.NoData || math.IsNaN(v) {
+		return v, ErrNoData
+	}
+
+	return v, nil
+}
+
+// tile Decode a tile (or strip) keeping the most recently used ones in memory
+func (f *File) tile(index int) ([]float32, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if tile, ok := f.tiles[index]; ok {
+		return tile, nil
+	}
+
+	if index >= len(f.offsets) {
+		return nil, ErrOutOfBounds
+	}
+
+	tile, err := f.decodeTile(index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(f.tileOrder) >= maxCachedTiles {
+		delete(f.tiles, f.tileOrder[0])
+		f.tileOrder = f.tileOrder[1:]
+	}
+
+	f.tiles[index] = tile
+	f.tileOrder = append(f.tileOrder, index)
+
+	return tile, nil
+}
+
+func (f *File) decodeTile(index int) ([]float32, error) {
+	compressed := make([]byte, f.byteCounts[index])
+
+	if _, err := f.file.ReadAt(compressed, int64(f.offsets[index])); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var raw []byte
+	var err error
+
+	switch f.compression {
+	case compressionNone:
+		raw = compressed
+	case compressionLzw:
+		raw, err = lzwDecode(compressed)
+	case compressionDeflate, compressionOldDeflate:
+		var r io.ReadCloser
+		r, err = zlib.NewReader(bytes.NewReader(compressed))
+
+		if err == nil {
+			raw, err = io.ReadAll(r)
+			r.Close()
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress tile %d. Cause: %w", index, err)
+	}
+
+	bytesPerSample := f.bitsPerSample / 8
+	rowSize := f.tileWidth * bytesPerSample
+	size := f.tileWidth * f.tileHeight
+
+	// The last strip of a file can be shorter than the others
+	if len(raw) < size*bytesPerSample {
+		padded := make([]byte, size*bytesPerSample)
+		copy(padded, raw)
+		raw = padded
+	}
+
+	order := f.order
+
+	switch f.predictor {
+	case predictorHorizontal:
+		undoHorizontalPredictor(raw, rowSize, bytesPerSample, order)
+	case predictorFloatingPoint:
+		raw = undoFloatingPointPredictor(raw, rowSize, bytesPerSample)
+		order = binary.BigEndian
+	}
+
+	samples := make([]float32, size)
+
+	for i := range samples {
+		samples[i] = f.sample(raw[i*bytesPerSample:], order)
+	}
+
+	return samples, nil
+}
+
+// isSupportedSample Check if samples of a format and bit depth are decoded by sample: 8, 16 and 32 bits integers
+// and 32 and 64 bits floats
+func isSupportedSample(format, bits int) bool {
+	switch format {
+	case sampleFormatUint, sampleFormatInt:
+		return bits == 8 || bits == 16 || bits == 32
+	case sampleFormatFloat:
+		return bits == 32 || bits == 64
+	}
+
+	return false
+}
+
+// sample Decode a sample of a format and bit depth accepted by isSupportedSample
+func (f *File) sample(b []byte, order binary.ByteOrder) float32 {
+	switch {
+	case f.sampleFormat == sampleFormatFloat && f.bitsPerSample == 32:
+		return math.Float32frombits(order.Uint32(b))
+	case f.sampleFormat == sampleFormatFloat && f.bitsPerSample == 64:
+		return float32(math.Float64frombits(order.Uint64(b)))
+	case f.sampleFormat == sampleFormatInt && f.bitsPerSample == 16:
+		return float32(int16(order.Uint16(b)))
+	case f.sampleFormat == sampleFormatInt && f.bitsPerSample == 32:
+		return float32(int32(order.Uint32(b)))
+	case f.sampleFormat == sampleFormatInt && f.bitsPerSample == 8:
+		return float32(int8(b[0]))
+	case f.bitsPerSample == 16:
+		return float32(order.Uint16(b))
+	case f.bitsPerSample == 32:
+		return float32(order.Uint32(b))
+	}
+
+	return float32(b[0])
+}
+
+func undoHorizontalPredictor(raw []byte, rowSize, bytesPerSample int, order binary.ByteOrder) {
+	for row := 0; row+rowSize <= len(raw); row += rowSize {
+		for i := row + bytesPerSample; i < row+rowSize; i += bytesPerSample {
+			switch bytesPerSample {
+			case 1:
+				raw[i] += raw[i-1]
+			case 2:
+				order.PutUint16(raw[i:], order.Uint16(raw[i:])+order.Uint16(raw[i-2:]))
+			case 4:
+				order.PutUint32(raw[i:], order.Uint32(raw[i:])+order.Uint32(raw[i-4:]))
+			}
+		}
+	}
+}
+
+// undoFloatingPointPredictor Reverse the byte differencing of each row and merge the byte planes back into
+// big endian samples, as described in Adobe Photoshop TIFF Technical Note 3
+func undoFloatingPointPredictor(raw []byte, rowSize, bytesPerSample int) []byte {
+	out := make([]byte, len(raw))
+	width := rowSize / bytesPerSample
+
+	for row := 0; row+rowSize <= len(raw); row += rowSize {
+		r := raw[row : row+rowSize]
+
+		for i := 1; i < rowSize; i++ {
+			r[i] += r[i-1]
+		}
+
+		for sample := 0; sample < width; sample++ {
+			for b := 0; b < bytesPerSample; b++ {
+				out[row+sample*bytesPerSample+b] = r[b*width+sample]
+			}
+		}
+	}
+
+	return out
+}
+
+func (f *File) firstInt(fields map[uint16]tiffField, tag uint16, def uint64) uint64 {
+	values := f.ints(fields[tag])
+
+	if len(values) == 0 {
+		return def
+	}
+
+	return values[0]
+}
+
+func (f *File) ints(field tiffField) []uint64 {
+	values := make([]uint64, 0, field.count)
+	size := typeSize(field.typ)
+
+	for i := uint64(0); i < field.count && (i+1)*size <= uint64(len(field.values)); i++ {
+		b := field.values[i*size:]
+
+		switch field.typ {
+		case typeShort:
+			values = append(values, uint64(f.order.Uint16(b)))
+		case typeLong:
+			values = append(values, uint64(f.order.Uint32(b)))
+		case typeLong8:
+			values = append(values, f.order.Uint64(b))
+		case typeByte:
+			values = append(values, uint64(b[0]))
+		}
+	}
+
+	return values
+}
+
+func (f *File) floats(field tiffField) []float64 {
+	if field.typ != typeDouble {
+		return nil
+	}
+
+	values := make([]float64, field.count)
+
+	for i := range values {
+		values[i] = math.Float64frombits(f.order.Uint64(field.values[i*8:]))
+	}
+
+	return values
+}
+
+func typeSize(typ uint16) uint64 {
+	switch typ {
+	case typeShort, typeSShort:
+		return 2
+	case typeLong, typeSLong, typeFloat:
+		return 4
+	case typeRational, typeSRational, typeDouble, typeLong8:
+		return 8
+	}
+
+	return 1
+}
@@ -0,0 +1,335 @@
+package geotiff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenEncodedFile(t *testing.T) {
+	t.Parallel()
+
+	noData := -9999.0
+	r := &Raster{
+		Width:       3,
+		Height:      2,
+		Data:        []float32{100, 200, 300, 400, -9999, 600},
+		Lon:         10,
+		Lat:         46,
+		PixelWidth:  0.5,
+		PixelHeight: 0.5,
+		NoData:      &noData,
+	}
+
+	path := filepath.Join(t.TempDir(), "raster.tif")
+	writeRaster(t, path, r)
+
+	f, err := Open(path)
+
+	if err != nil {
+		t.Fatalf("cannot open GeoTIFF. Cause: %s", err)
+	}
+
+	defer f.Close()
+
+	west, south, east, north := f.Bounds()
+
+	if west != 10 || south != 45 || east != 11.5 || north != 46 {
+		t.Errorf("unexpected bounds (%f, %f, %f, %f)", west, south, east, north)
+	}
+
+	elevation, res, err := f.ElevationAt(45.9, 10.6)
+
+	if err != nil || elevation != 200 || res != 1800 {
+		t.Errorf("expected elevation 200 at 1800 arc seconds but received %d, %d, %v", elevation, res, err)
+	}
+
+	if _, _, err := f.ElevationAt(45.2, 10.7); !errors.Is(err, ErrNoData) {
+		t.Errorf("expected no data error but received %v", err)
+	}
+
+	if _, _, err := f.ElevationAt(44.9, 10.7); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("expected out of bounds error but received %v", err)
+	}
+
+	raster, err := f.ReadRaster()
+
+	if err != nil {
+		t.Fatalf("cannot read raster. Cause: %s", err)
+	}
+
+	for i, v := range r.Data {
+		if raster.Data[i] != v {
+			t.Errorf("pixel %d: expected %f but received %f", i, v, raster.Data[i])
+		}
+	}
+}
+
+func TestOpenTiledDeflateFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "tiled.tif")
+	values := []int16{-5, 10, 7, 1000, 1001, 1003}
+
+	err := os.WriteFile(path, tiledTiff(t, 3, 2, 2, values), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path)
+
+	if err != nil {
+		t.Fatalf("cannot open GeoTIFF. Cause: %s", err)
+	}
+
+	defer f.Close()
+
+	// Tie point refers to the center of the upper left pixel
+	if math.Abs(f.Lon-(-0.5)) > 1e-9 || math.Abs(f.Lat-2.5) > 1e-9 {
+		t.Errorf("expected origin (-0.5, 2.5) but received (%f, %f)", f.Lon, f.Lat)
+	}
+
+	for i, expected := range values {
+		x, y := i%3, i/3
+		elevation, _, err := f.ElevationAt(2.5-float64(y)-0.5, -0.5+float64(x)+0.5)
+
+		if err != nil || elevation != expected {
+			t.Errorf("pixel (%d, %d): expected %d but received %d, %v", x, y, expected, elevation, err)
+		}
+	}
+}
+
+func TestLzwDecode(t *testing.T) {
+	t.Parallel()
+
+	// Clear, 'A', 'B', "AB" (first table entry), end of information
+	src := packCodes([]int{lzwClearCode, 'A', 'B', 258, lzwEndCode}, 9)
+
+	out, err := lzwDecode(src)
+
+	if err != nil {
+		t.Fatalf("cannot decode LZW data. Cause: %s", err)
+	}
+
+	if string(out) != "ABAB" {
+		t.Errorf("expected ABAB but received %q", out)
+	}
+}
+
+func TestParseFieldsRejectsUnsupportedSamples(t *testing.T) {
+	t.Parallel()
+
+	be := binary.BigEndian
+
+	short := func(v uint16) tiffField {
+		b := make([]byte, 2)
+		be.PutUint16(b, v)
+		return tiffField{typ: typeShort, count: 1, values: b}
+	}
+
+	doubles := func(values ...float64) tiffField {
+		b := make([]byte, 8*len(values))
+		for i, v := range values {
+			be.PutUint64(b[i*8:], math.Float64bits(v))
+		}
+		return tiffField{typ: typeDouble, count: uint64(len(values)), values: b}
+	}
+
+	tests := []struct {
+		bits, format uint16
+		supported    bool
+	}{
+		{1, sampleFormatUint, false},
+		{4, sampleFormatInt, false},
+		{16, sampleFormatFloat, false},
+		{64, sampleFormatInt, false},
+		{16, 4, false},
+		{8, sampleFormatUint, true},
+		{16, sampleFormatInt, true},
+		{64, sampleFormatFloat, true},
+	}
+
+	for _, test := range tests {
+		fields := map[uint16]tiffField{
+			tagImageWidth:      short(1),
+			tagImageLength:     short(1),
+			tagBitsPerSample:   short(test.bits),
+			tagSampleFormat:    short(test.format),
+			tagStripOffsets:    short(8),
+			tagStripByteCounts: short(8),
+			tagModelPixelScale: doubles(1, 1, 0),
+			tagModelTiepoint:   doubles(0, 0, 0, 0, 1, 0),
+		}
+
+		err := (&File{order: be}).parseFields(fields)
+
+		if test.supported && err != nil {
+			t.Errorf("expected %d bits samples of format %d to be supported. Cause: %s", test.bits, test.format,
+				err)
+		}
+
+		if !test.supported && !errors.Is(err, ErrUnsupportedFile) {
+			t.Errorf("expected %d bits samples of format %d to be unsupported, got %v", test.bits, test.format,
+				err)
+		}
+	}
+}
+
+func writeRaster(t *testing.T, path string, r *Raster) {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	if err := Encode(&b, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tiledTiff Build a big endian int16 GeoTIFF split in tiles of tileSide x tileSide pixels, compressed with
+// deflate and horizontal differencing. The tie point refers to pixel centers (PixelIsPoint)
+func tiledTiff(t *testing.T, width, height, tileSide int, values []int16) []byte {
+	t.Helper()
+
+	be := binary.BigEndian
+	tilesAcross := (width + tileSide - 1) / tileSide
+	tilesDown := (height + tileSide - 1) / tileSide
+
+	var data bytes.Buffer
+	data.Write([]byte{'M', 'M', 0, 42, 0, 0, 0, 0})
+
+	var offsets, counts []uint32
+
+	for ty := 0; ty < tilesDown; ty++ {
+		for tx := 0; tx < tilesAcross; tx++ {
+			raw := make([]byte, tileSide*tileSide*2)
+
+			for y := 0; y < tileSide; y++ {
+				var prev int16
+
+				for x := 0; x < tileSide; x++ {
+					var v int16
+					px, py := tx*tileSide+x, ty*tileSide+y
+
+					if px < width && py < height {
+						v = values[py*width+px]
+					}
+
+					be.PutUint16(raw[(y*tileSide+x)*2:], uint16(v-prev))
+					prev = v
+				}
+			}
+
+			var compressed bytes.Buffer
+			w := zlib.NewWriter(&compressed)
+			w.Write(raw)
+			w.Close()
+
+			offsets = append(offsets, uint32(data.Len()))
+			counts = append(counts, uint32(compressed.Len()))
+			data.Write(compressed.Bytes())
+		}
+	}
+
+	u32 := func(values ...uint32) []byte {
+		b := make([]byte, 4*len(values))
+		for i, v := range values {
+			be.PutUint32(b[i*4:], v)
+		}
+		return b
+	}
+
+	u16 := func(values ...uint16) []byte {
+		b := make([]byte, 2*len(values))
+		for i, v := range values {
+			be.PutUint16(b[i*2:], v)
+		}
+		return b
+	}
+
+	f64 := func(values ...float64) []byte {
+		b := make([]byte, 8*len(values))
+		for i, v := range values {
+			be.PutUint64(b[i*8:], math.Float64bits(v))
+		}
+		return b
+	}
+
+	entries := []struct {
+		tag, typ uint16
+		count    int
+		value    []byte
+	}{
+		{tagImageWidth, typeShort, 1, u16(uint16(width))},
+		{tagImageLength, typeShort, 1, u16(uint16(height))},
+		{tagBitsPerSample, typeShort, 1, u16(16)},
+		{tagCompression, typeShort, 1, u16(compressionDeflate)},
+		{tagSamplesPerPixel, typeShort, 1, u16(1)},
+		{tagPredictor, typeShort, 1, u16(predictorHorizontal)},
+		{tagTileWidth, typeShort, 1, u16(uint16(tileSide))},
+		{tagTileLength, typeShort, 1, u16(uint16(tileSide))},
+		{tagTileOffsets, typeLong, len(offsets), u32(offsets...)},
+		{tagTileCounts, typeLong, len(counts), u32(counts...)},
+		{tagSampleFormat, typeShort, 1, u16(sampleFormatInt)},
+		{tagModelPixelScale, typeDouble, 3, f64(1, 1, 0)},
+		{tagModelTiepoint, typeDouble, 6, f64(0, 0, 0, 0, 2, 0)},
+		{tagGeoKeyDirectory, typeShort, 8, u16(1, 1, 0, 1, 1025, 0, 1, rasterPixelIsPoint)},
+	}
+
+	ifdOffset := data.Len()
+	extraOffset := ifdOffset + 2 + len(entries)*12 + 4
+
+	var ifd, extra bytes.Buffer
+	ifd.Write(u16(uint16(len(entries))))
+
+	for _, e := range entries {
+		ifd.Write(u16(e.tag, e.typ))
+		ifd.Write(u32(uint32(e.count)))
+
+		if len(e.value) <= 4 {
+			ifd.Write(append(e.value, make([]byte, 4-len(e.value))...))
+		} else {
+			ifd.Write(u32(uint32(extraOffset + extra.Len())))
+			extra.Write(e.value)
+		}
+	}
+
+	ifd.Write(u32(0))
+
+	file := data.Bytes()
+	be.PutUint32(file[4:], uint32(ifdOffset))
+
+	return append(append(file, ifd.Bytes()...), extra.Bytes()...)
+}
+
+// packCodes Pack LZW codes most significant bit first
+func packCodes(codes []int, width uint) []byte {
+	var out []byte
+	var bits uint32
+	var nBits uint
+
+	for _, code := range codes {
+		bits = bits<<width | uint32(code)
+		nBits += width
+
+		for nBits >= 8 {
+			out = append(out, byte(bits>>(nBits-8)))
+			nBits -= 8
+		}
+	}
+
+	if nBits > 0 {
+		out = append(out, byte(bits<<(8-nBits)))
+	}
+
+	return out
+}
@@ -0,0 +1,206 @@
+package geotiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// TIFF tags used by lukla GeoTIFF files
+const (
+	tagImageWidth          = 256
+	tagImageLength         = 257
+	tagBitsPerSample       = 258
+	tagCompression         = 259
+	tagPhotometric         = 262
+	tagStripOffsets        = 273
+	tagSamplesPerPixel     = 277
+	tagRowsPerStrip        = 278
+	tagStripByteCounts     = 279
+	tagPlanarConfiguration = 284
+	tagSampleFormat        = 339
+	tagModelPixelScale     = 33550
+	tagModelTiepoint       = 33922
+	tagGeoKeyDirectory     = 34735
+	tagGdalNoData          = 42113
+)
+
+// TIFF field types
+const (
+	typeByte      = 1
+	typeAscii     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeSShort    = 8
+	typeSLong     = 9
+	typeSRational = 10
+	typeFloat     = 11
+	typeDouble    = 12
+	typeLong8     = 16
+)
+
+// SampleFormat values
+const (
+	sampleFormatUint  = 1
+	sampleFormatInt   = 2
+	sampleFormatFloat = 3
+)
+
+// Raster Single band raster georeferenced in WGS84 (EPSG:4326). Lon and Lat are the coordinates of the
+// upper left corner of the upper left pixel and the pixel size is expressed in degrees
+type Raster struct {
+	Width, Height           int
+	Data                    []float32
+	Lon, Lat                float64
+	PixelWidth, PixelHeight float64
+	NoData                  *float64
+}
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// At Value of the pixel at column x and row y
+func (r *Raster) At(x, y int) float32 {
+	return r.Data[y*r.Width+x]
+}
+
+// Encode Write a raster as an uncompressed float32 GeoTIFF
+func Encode(w io.Writer, r *Raster) error {
+	if r.Width <= 0 || r.Height <= 0 || len(r.Data) != r.Width*r.Height {
+		return errors.New("raster dimensions do not match its data")
+	}
+
+	le := binary.LittleEndian
+	stripSize := uint32(r.Width * r.Height * 4)
+
+	entries := []ifdEntry{
+		longEntry(tagImageWidth, uint32(r.Width)),
+		longEntry(tagImageLength, uint32(r.Height)),
+		shortEntry(tagBitsPerSample, 32),
+		shortEntry(tagCompression, 1),
+		shortEntry(tagPhotometric, 1),
+		longEntry(tagStripOffsets, 0),
+		shortEntry(tagSamplesPerPixel, 1),
+		longEntry(tagRowsPerStrip, uint32(r.Height)),
+		longEntry(tagStripByteCounts, stripSize),
+		shortEntry(tagPlanarConfiguration, 1),
+		shortEntry(tagSampleFormat, sampleFormatFloat),
+		doubleEntry(tagModelPixelScale, r.PixelWidth, r.PixelHeight, 0),
+		doubleEntry(tagModelTiepoint, 0, 0, 0, r.Lon, r.Lat, 0),
+		// GeoKey directory header followed by GTModelTypeGeoKey = Geographic,
+		// GTRasterTypeGeoKey = PixelIsArea and GeographicTypeGeoKey = WGS84
+		shortEntry(tagGeoKeyDirectory, 1, 1, 0, 3, 1024, 0, 1, 2, 1025, 0, 1, 1, 2048, 0, 1, 4326),
+	}
+
+	if r.NoData != nil {
+		entries = append(entries, asciiEntry(tagGdalNoData, strconv.FormatFloat(*r.NoData, 'g', -1, 64)))
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	const headerSize = 8
+	ifdSize := 2 + 12*len(entries) + 4
+	offset := uint32(headerSize + ifdSize)
+
+	// Values bigger than 4 bytes are stored after the IFD
+	var extra bytes.Buffer
+
+	for _, e := range entries {
+		if len(e.data) > 4 {
+			extra.Write(e.data)
+
+			if extra.Len()%2 == 1 {
+				extra.WriteByte(0)
+			}
+		}
+	}
+
+	stripOffset := offset + uint32(extra.Len())
+
+	var b bytes.Buffer
+	b.Write([]byte{'I', 'I', 42, 0})
+	binary.Write(&b, le, uint32(headerSize))
+	binary.Write(&b, le, uint16(len(entries)))
+
+	extraOffset := offset
+
+	for _, e := range entries {
+		if e.tag == tagStripOffsets {
+			e.data = le.AppendUint32(nil, stripOffset)
+		}
+
+		binary.Write(&b, le, e.tag)
+		binary.Write(&b, le, e.typ)
+		binary.Write(&b, le, e.count)
+
+		if len(e.data) > 4 {
+			binary.Write(&b, le, extraOffset)
+			extraOffset += uint32(len(e.data) + len(e.data)%2)
+		} else {
+			value := make([]byte, 4)
+			copy(value, e.data)
+			b.Write(value)
+		}
+	}
+
+	binary.Write(&b, le, uint32(0))
+	b.Write(extra.Bytes())
+
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return err
+	}
+
+	data := make([]byte, 0, stripSize)
+
+	for _, v := range r.Data {
+		data = le.AppendUint32(data, math.Float32bits(v))
+	}
+
+	_, err := w.Write(data)
+
+	return err
+}
+
+func shortEntry(tag uint16, values ...uint16) ifdEntry {
+	var data []byte
+
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint16(data, v)
+	}
+
+	return ifdEntry{tag: tag, typ: typeShort, count: uint32(len(values)), data: data}
+}
+
+func longEntry(tag uint16, values ...uint32) ifdEntry {
+	var data []byte
+
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint32(data, v)
+	}
+
+	return ifdEntry{tag: tag, typ: typeLong, count: uint32(len(values)), data: data}
+}
+
+func doubleEntry(tag uint16, values ...float64) ifdEntry {
+	var data []byte
+
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+	}
+
+	return ifdEntry{tag: tag, typ: typeDouble, count: uint32(len(values)), data: data}
+}
+
+func asciiEntry(tag uint16, value string) ifdEntry {
+	data := append([]byte(value), 0)
+	return ifdEntry{tag: tag, typ: typeAscii, count: uint32(len(data)), data: data}
+}
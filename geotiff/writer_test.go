@@ -0,0 +1,70 @@
+package geotiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+
+	noData := -9999.0
+	r := &Raster{
+		Width:       2,
+		Height:      2,
+		Data:        []float32{1, 2.5, -3, 4},
+		Lon:         86.7,
+		Lat:         27.7,
+		PixelWidth:  0.0003,
+		PixelHeight: 0.0003,
+		NoData:      &noData,
+	}
+
+	var b bytes.Buffer
+	err := Encode(&b, r)
+
+	if err != nil {
+		t.Fatalf("cannot encode GeoTIFF. Cause: %s", err)
+	}
+
+	data := b.Bytes()
+
+	if !bytes.Equal(data[:4], []byte{'I', 'I', 42, 0}) {
+		t.Fatalf("invalid TIFF header %v", data[:4])
+	}
+
+	le := binary.LittleEndian
+	ifdOffset := le.Uint32(data[4:8])
+	count := le.Uint16(data[ifdOffset:])
+
+	if count != 15 {
+		t.Errorf("expected 15 IFD entries but received %d", count)
+	}
+
+	firstTag := le.Uint16(data[ifdOffset+2:])
+	width := le.Uint32(data[ifdOffset+2+8:])
+
+	if firstTag != tagImageWidth || width != 2 {
+		t.Errorf("expected image width 2 but received tag %d with value %d", firstTag, width)
+	}
+
+	pixels := data[len(data)-16:]
+
+	for i, v := range r.Data {
+		if math.Float32frombits(le.Uint32(pixels[i*4:])) != v {
+			t.Errorf("pixel %d does not match", i)
+		}
+	}
+}
+
+func TestEncodeInvalidRaster(t *testing.T) {
+	t.Parallel()
+
+	err := Encode(&bytes.Buffer{}, &Raster{Width: 2, Height: 2, Data: []float32{1}})
+
+	if err == nil {
+		t.Error("expected an error, but received success")
+	}
+}
@@ -0,0 +1,57 @@
+package heightmap
+
+// Deepest elevation drawn by grayscale heightmaps when bathymetry is loaded (Challenger Deep)
+const MinBathymetryElevation = -11000.0
+
+// Name reported by GetPointsElevations for depths read from the bathymetry grid
+const bathymetrySourceName = "bathymetry"
+
+// Bathymetry Merge land heights with a seafloor depth grid (e.g.: GEBCO or ETOPO). Land is read first and the
+// depth is used where land has no data or lies at (or below) sea level and the grid is below sea level
+type Bathymetry struct {
+	Land ElevationSource
+	Sea  ElevationSource
+}
+
+// ElevationAt Return the elevation of a coordinate and the resolution of the source which provided it
+func (b *Bathymetry) ElevationAt(lat, lon float64) (int16, int, error) {
+	e, res, _, err := b.SourceAt(lat, lon)
+	return e, res, err
+}
+
+// SourceAt Return the elevation of a coordinate, the source resolution and the source name
+func (b *Bathymetry) SourceAt(lat, lon float64) (int16, int, string, error) {
+	land, landRes, name, landErr := sourceAt(b.Land, lat, lon)
+
+	if landErr == nil && land > 0 {
+		return land, landRes, name, nil
+	}
+
+	depth, depthRes, err := b.Sea.ElevationAt(lat, lon)
+
+	if err == nil && depth < 0 {
+		return depth, depthRes, bathymetrySourceName, nil
+	}
+
+	if landErr == nil {
+		return land, landRes, name, nil
+	}
+
+	if err == nil {
+		return depth, depthRes, bathymetrySourceName, nil
+	}
+
+	return 0, 0, "", landErr
+}
+
+// Close Close land and sea sources
+func (b *Bathymetry) Close() error {
+	landErr := b.Land.Close()
+	seaErr := b.Sea.Close()
+
+	if landErr != nil {
+		return landErr
+	}
+
+	return seaErr
+}
@@ -0,0 +1,98 @@
+package heightmap
+
+import (
+	"bytes"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func newTestBathymetry() *Bathymetry {
+	// Land at longitudes below 10, sea level coast between 10 and 11 and missing land data after 11
+	land := fakeElevationSource(func(lat, lon float64) (int16, bool) {
+		if lon < 10 {
+			return 500, true
+		}
+
+		return 0, lon < 11
+	})
+	sea := fakeElevationSource(func(lat, lon float64) (int16, bool) { return -3000, true })
+
+	return &Bathymetry{Land: land, Sea: sea}
+}
+
+func TestBathymetrySourceAt(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBathymetry()
+
+	tests := []struct {
+		lon       float64
+		elevation int16
+		source    string
+	}{
+		{9, 500, ""},
+		{10.5, -3000, bathymetrySourceName},
+		{12, -3000, bathymetrySourceName},
+	}
+
+	for _, test := range tests {
+		e, _, source, err := b.SourceAt(0, test.lon)
+
+		if err != nil || e != test.elevation || source != test.source {
+			t.Errorf("longitude %f: expected %d from %q but received %d from %q (%v)", test.lon,
+				test.elevation, test.source, e, source, err)
+		}
+	}
+}
+
+func TestEncodeTerrainRGB(t *testing.T) {
+	t.Parallel()
+
+	for _, elevation := range []float64{-10000, -3000.5, 0, 8848.1} {
+		c := encodeTerrainRGB(elevation)
+		decoded := -10000 + float64(int(c.R)*256*256+int(c.G)*256+int(c.B))*0.1
+
+		if math.Abs(decoded-elevation) > 0.05 {
+			t.Errorf("expected %f but decoded %f", elevation, decoded)
+		}
+	}
+}
+
+func TestEncodeTerrarium(t *testing.T) {
+	t.Parallel()
+
+	for _, elevation := range []float64{-10994, -3000.5, 0, 8848.25} {
+		c := encodeTerrarium(elevation)
+		decoded := float64(c.R)*256 + float64(c.G) + float64(c.B)/256 - 32768
+
+		if math.Abs(decoded-elevation) > 1.0/256 {
+			t.Errorf("expected %f but decoded %f", elevation, decoded)
+		}
+	}
+}
+
+func TestCreateEncodedHeightMapImage(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{ElevationDataset: newTestBathymetry()}
+
+	b, err := heightmapGen.CreateEncodedHeightMapImage(0, 10.5, 2000,
+		ResolutionConfig{Width: 50, Height: 50}, Terrarium)
+
+	if err != nil {
+		t.Fatalf("cannot create encoded heightmap. Cause: %s", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(b))
+
+	if err != nil {
+		t.Fatalf("invalid PNG image. Cause: %s", err)
+	}
+
+	r, g, _, _ := img.At(0, 0).RGBA()
+
+	if decoded := float64(r>>8)*256 + float64(g>>8) - 32768; decoded != -3000 {
+		t.Errorf("expected -3000 but decoded %f", decoded)
+	}
+}
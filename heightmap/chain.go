@@ -0,0 +1,137 @@
+package heightmap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Meters per degree of latitude
+const metersPerDegree = 111320.0
+
+// Number of distances probed, in each direction, to find how far a point is from the edge of its source
+const featherSteps = 4
+
+var ErrNoElevationSource = errors.New("no elevation source covers the coordinate")
+
+// ChainedSource Elevation source identified by a name reported with the elevations it provides
+type ChainedSource struct {
+	Name   string
+	Source ElevationSource
+}
+
+// SourceChain Ordered chain of elevation sources. Each point is read from the first source with data and
+// falls back to the next ones (e.g. SRTM 1", SRTM 3" and a global grid). Points closer than Feather meters
+// to the edge of their source coverage are blended with the next source to hide seams
+type SourceChain struct {
+	Sources []ChainedSource
+	Feather float64
+}
+
+// ElevationAt Return the elevation of a coordinate and the resolution of the source which provided it
+func (c *SourceChain) ElevationAt(lat, lon float64) (int16, int, error) {
+	e, res, _, err := c.SourceAt(lat, lon)
+	return e, res, err
+}
+
+// SourceAt Return the elevation of a coordinate, the source resolution and the source name
+func (c *SourceChain) SourceAt(lat, lon float64) (int16, int, string, error) {
+	for i, s := range c.Sources {
+		e, res, err := s.Source.ElevationAt(lat, lon)
+
+		if err != nil {
+			continue
+		}
+
+		if c.Feather <= 0 {
+			return e, res, s.Name, nil
+		}
+
+		w := c.coverageWeight(s.Source, lat, lon)
+
+		if w >= 1 {
+			return e, res, s.Name, nil
+		}
+
+		next, ok := c.fallbackAt(i+1, lat, lon)
+
+		if !ok {
+			return e, res, s.Name, nil
+		}
+
+		blended := w*float64(e) + (1-w)*float64(next)
+
+		return int16(math.Round(blended)), res, s.Name, nil
+	}
+
+	return 0, 0, "", ErrNoElevationSource
+}
+
+// Close Close every source of the chain
+func (c *SourceChain) Close() error {
+	var closeErr error
+
+	for _, s := range c.Sources {
+		if err := s.Source.Close(); err != nil {
+			closeErr = err
+		}
+	}
+
+	return closeErr
+}
+
+// fallbackAt Elevation of a coordinate read from the first source with data, starting at index start
+func (c *SourceChain) fallbackAt(start int, lat, lon float64) (int16, bool) {
+	for _, s := range c.Sources[start:] {
+		e, _, err := s.Source.ElevationAt(lat, lon)
+
+		if err == nil {
+			return e, true
+		}
+	}
+
+	return 0, false
+}
+
+// coverageWeight Weight, from 0 to 1, of a source at a coordinate. It grows linearly with the distance to
+// the nearest point without data, probed in 8 directions, and is 1 farther than Feather meters
+func (c *SourceChain) coverageWeight(source ElevationSource, lat, lon float64) float64 {
+	if c.coveredAround(source, lat, lon, c.Feather) {
+		return 1
+	}
+
+	for step := 1; step < featherSteps; step++ {
+		distance := c.Feather * float64(step) / featherSteps
+
+		if !c.coveredAround(source, lat, lon, distance) {
+			return float64(step-1) / featherSteps
+		}
+	}
+
+	return float64(featherSteps-1) / featherSteps
+}
+
+func (c *SourceChain) coveredAround(source ElevationSource, lat, lon, distance float64) bool {
+	dLat := distance / metersPerDegree
+	dLon := distance / (metersPerDegree * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+
+	for _, d := range [8][2]float64{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}} {
+		if _, _, err := source.ElevationAt(lat+d[0]*dLat, lon+d[1]*dLon); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String Describe the chain as a list of source names
+func (c *SourceChain) String() string {
+	names := make([]string, len(c.Sources))
+
+	for i, s := range c.Sources {
+		names[i] = s.Name
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(names, " > "))
+}
@@ -0,0 +1,85 @@
+package heightmap
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestChain(feather float64) *SourceChain {
+	// Land source covering longitudes below 10 and a global source
+	land := fakeElevationSource(func(lat, lon float64) (int16, bool) { return 1000, lon < 10 })
+	global := fakeElevationSource(func(lat, lon float64) (int16, bool) { return -200, true })
+
+	return &SourceChain{
+		Sources: []ChainedSource{{Name: "srtm", Source: land}, {Name: "etopo", Source: global}},
+		Feather: feather,
+	}
+}
+
+func TestSourceChainFallback(t *testing.T) {
+	t.Parallel()
+
+	chain := newTestChain(0)
+
+	e, _, name, err := chain.SourceAt(0, 9.9999)
+
+	if err != nil || e != 1000 || name != "srtm" {
+		t.Errorf("expected 1000 from srtm but received %d from %s (%v)", e, name, err)
+	}
+
+	e, _, name, err = chain.SourceAt(0, 10.5)
+
+	if err != nil || e != -200 || name != "etopo" {
+		t.Errorf("expected -200 from etopo but received %d from %s (%v)", e, name, err)
+	}
+}
+
+func TestSourceChainFeather(t *testing.T) {
+	t.Parallel()
+
+	chain := newTestChain(400)
+
+	// About 1 km from the edge, outside the feather band
+	e, _, _, _ := chain.SourceAt(0, 9.99)
+
+	if e != 1000 {
+		t.Errorf("expected 1000 far from the edge but received %d", e)
+	}
+
+	// About 250 m from the edge, inside the feather band
+	e, _, name, _ := chain.SourceAt(0, 9.99775)
+
+	if e <= -200 || e >= 1000 || name != "srtm" {
+		t.Errorf("expected a blended elevation from srtm but received %d from %s", e, name)
+	}
+
+	// About 50 m from the edge, where the next source dominates
+	closer, _, _, _ := chain.SourceAt(0, 9.99955)
+
+	if closer >= e {
+		t.Errorf("expected elevation closer to the edge (%d) to be lower than %d", closer, e)
+	}
+}
+
+func TestSourceChainWithoutData(t *testing.T) {
+	t.Parallel()
+
+	chain := &SourceChain{Sources: []ChainedSource{{Name: "void", Source: fakeElevationSource(
+		func(lat, lon float64) (int16, bool) { return 0, false })}}}
+
+	if _, _, err := chain.ElevationAt(0, 0); !errors.Is(err, ErrNoElevationSource) {
+		t.Errorf("expected no elevation source error but received %v", err)
+	}
+}
+
+func TestGetPointsElevationsReportsSource(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{ElevationDataset: newTestChain(0)}
+
+	points := heightmapGen.GetPointsElevations([]Point{{Lat: 0, Lon: 5}, {Lat: 0, Lon: 15}})
+
+	if points[0].Source != "srtm" || points[1].Source != "etopo" {
+		t.Errorf("expected srtm and etopo sources but received %s and %s", points[0].Source, points[1].Source)
+	}
+}
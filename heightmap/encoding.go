@@ -0,0 +1,102 @@
+package heightmap
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// HeightmapEncoding How elevations are stored in heightmap PNG images
+type HeightmapEncoding string
+
+const (
+	// Grayscale Elevations from Generator.MinElevation to Mount Everest height mapped from black to white
+	Grayscale HeightmapEncoding = "grayscale"
+	// TerrainRGB Mapbox Terrain-RGB encoding. elevation = -10000 + (R * 256 * 256 + G * 256 + B) * 0.1
+	TerrainRGB HeightmapEncoding = "terrain-rgb"
+	// Terrarium Mapzen Terrarium encoding. elevation = (R * 256 + G + B / 256) - 32768
+	Terrarium HeightmapEncoding = "terrarium"
+)
+
+// ParseHeightmapEncoding Parse a heightmap encoding name (grayscale, terrain-rgb or terrarium). Empty names
+// are grayscale
+func ParseHeightmapEncoding(name string) (HeightmapEncoding, error) {
+	switch encoding := HeightmapEncoding(name); encoding {
+	case "":
+		return Grayscale, nil
+	case Grayscale, TerrainRGB, Terrarium:
+		return encoding, nil
+	}
+
+	return "", fmt.Errorf("unknown heightmap encoding %s", name)
+}
+
+// GetEncodedTileHeightmap Generate a heightmap with the same size of an OpenStreetMap (OSM) tile using an
+// encoding. Tiles of each encoding are cached in their own directory
+func (t Generator) GetEncodedTileHeightmap(z, x, y, resolution int, encoding HeightmapEncoding) ([]byte, error) {
+	if encoding == Grayscale || encoding == "" {
+		return t.GetTileHeightmap(z, x, y, resolution)
+	}
+
+	return t.getCachedTile(string(encoding), z, x, y, resolution, func(extent rasterExtent,
+		conf ResolutionConfig) ([]byte, error) {
+		return t.forPixelSize(extent.side/float64(resolution)).createEncodedImage(extent, conf, encoding)
+	})
+}
+
+// CreateEncodedHeightMapImage Create a heightmap of a square using an encoding. Terrain-RGB and Terrarium
+// images store negative elevations, so they can carry bathymetry
+func (t Generator) CreateEncodedHeightMapImage(lat, lon float64, side float64, conf ResolutionConfig,
+	encoding HeightmapEncoding) ([]byte, error) {
+	if encoding == Grayscale || encoding == "" {
+		return t.CreateHeightMapImage(lat, lon, side, conf)
+	}
+
+	return t.createEncodedImage(squareExtent(lat, lon, side), conf, encoding)
+}
+
+// createEncodedImage Create a Terrain-RGB or Terrarium heightmap of an area
+func (t Generator) createEncodedImage(extent rasterExtent, conf ResolutionConfig,
+	encoding HeightmapEncoding) ([]byte, error) {
+	var encode func(elevation float64) color.NRGBA
+
+	switch encoding {
+	case TerrainRGB:
+		encode = encodeTerrainRGB
+	case Terrarium:
+		encode = encodeTerrarium
+	default:
+		return []byte{}, fmt.Errorf("unknown heightmap encoding %s", encoding)
+	}
+
+	// Elevations are resampled before being encoded, since resampling encoded channels mixes their bits
+	raster, err := t.sampleExtent(extent, conf)
+
+	if err != nil {
+		return []byte{}, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, raster.Width, raster.Height))
+
+	for y := 0; y < raster.Height; y++ {
+		for x := 0; x < raster.Width; x++ {
+			img.SetNRGBA(x, y, encode(raster.at(x, y)))
+		}
+	}
+
+	return encodeImage(img)
+}
+
+func encodeTerrainRGB(elevation float64) color.NRGBA {
+	v := uint32(math.Max(math.Round((elevation+10000)*10), 0))
+
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}
+}
+
+func encodeTerrarium(elevation float64) color.NRGBA {
+	v := elevation + 32768
+	whole := math.Floor(v)
+
+	return color.NRGBA{R: uint8(int(whole) >> 8), G: uint8(int(whole)), B: uint8((v - whole) * 256), A: 255}
+}
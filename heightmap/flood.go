@@ -0,0 +1,613 @@
+package heightmap
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sync"
+
+	"github.com/spatial-go/geoos/geoencoding/geojson"
+	"github.com/spatial-go/geoos/space"
+	"github.com/tidwall/geodesic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Maximum water depth, in meters, represented in flood tiles. Deeper water has the same colour
+var maxRenderedFloodDepth = 20.0
+
+var ErrFloodSeedOutsideArea = errors.New("flood seed is outside the simulated area")
+
+// FloodConfig Flood simulation parameters. The simulated area is a square whose upper left corner is
+// (Lat, Lon), like the squares created by CreateHeightMapImage. Water spreads from the seed point, or
+// from every point of the river polyline, to all connected cells below the water level
+type FloodConfig struct {
+	Lat, Lon   float64
+	Side       float64
+	WaterLevel float64
+	Seed       *Point
+	River      []Point
+}
+
+// FloodStats Depth statistics of an inundated area. Area in square meters and volume in cubic meters
+type FloodStats struct {
+	WaterLevel float64 `json:"waterLevel"`
+	Cells      int     `json:"cells"`
+	Area       float64 `json:"area"`
+	Volume     float64 `json:"volume"`
+	MaxDepth   float64 `json:"maxDepth"`
+	MeanDepth  float64 `json:"meanDepth"`
+}
+
+type floodMap struct {
+	grid    *elevationGrid
+	level   float64
+	flooded []bool
+}
+
+// FloodCache Least recently used flood simulations, shared by the tiles of each flood. Concurrent requests of a
+// flood wait for a single simulation. A nil cache simulates the flood on every request. Safe for concurrent use
+type FloodCache struct {
+	size    int
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// floodEntry Simulation of a flood, done when the done channel is closed
+type floodEntry struct {
+	key   string
+	done  chan struct{}
+	flood *floodMap
+	err   error
+}
+
+// NewFloodCache Create a cache keeping at most size flood simulations
+func NewFloodCache(size int) *FloodCache {
+	if size < 1 {
+		size = 1
+	}
+
+	return &FloodCache{size: size, entries: map[string]*list.Element{}, lru: list.New()}
+}
+
+// get Return the simulation of a flood, or simulate it when it is not cached. Failed simulations are not cached
+func (c *FloodCache) get(key string, simulate func() (*floodMap, error)) (*floodMap, error) {
+	if c == nil {
+		return simulate()
+	}
+
+	c.mutex.Lock()
+
+	if element, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(element)
+		c.mutex.Unlock()
+
+		entry := element.Value.(*floodEntry)
+		<-entry.done
+
+		return entry.flood, entry.err
+	}
+
+	entry := &floodEntry{key: key, done: make(chan struct{})}
+	element := c.lru.PushFront(entry)
+	c.entries[key] = element
+
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*floodEntry).key)
+	}
+
+	c.mutex.Unlock()
+
+	entry.flood, entry.err = simulate()
+	close(entry.done)
+
+	if entry.err != nil {
+		c.mutex.Lock()
+
+		if c.entries[key] == element {
+			c.lru.Remove(element)
+			delete(c.entries, key)
+		}
+
+		c.mutex.Unlock()
+	}
+
+	return entry.flood, entry.err
+}
+
+// NewFloodConfigAroundSeed Create a flood configuration whose simulated area is a square centered on
+// the seed point
+func NewFloodConfigAroundSeed(seedLat, seedLon, side, waterLevel float64) FloodConfig {
+	var northLat, northLon, lat, lon float64
+
+	geodesic.WGS84.Direct(seedLat, seedLon, 0, side/2, &northLat, &northLon, nil)
+	geodesic.WGS84.Direct(northLat, northLon, 270, side/2, &lat, &lon, nil)
+
+	return FloodConfig{
+		Lat:        lat,
+		Lon:        lon,
+		Side:       side,
+		WaterLevel: waterLevel,
+		Seed:       &Point{Lat: seedLat, Lon: seedLon},
+	}
+}
+
+// CreateFloodMap Simulate a flood and return a GeoJSON feature collection with the inundated area as a
+// MultiPolygon. Feature properties contain the depth statistics
+func (t Generator) CreateFloodMap(conf FloodConfig) (*geojson.FeatureCollection, error) {
+	flood, err := t.simulateFlood(conf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats := flood.stats()
+
+	feature := geojson.NewFeature(*geojson.NewGeometry(flood.polygons()))
+	feature.Properties["waterLevel"] = stats.WaterLevel
+	feature.Properties["cells"] = stats.Cells
+	feature.Properties["area"] = stats.Area
+	feature.Properties["volume"] = stats.Volume
+	feature.Properties["maxDepth"] = stats.MaxDepth
+	feature.Properties["meanDepth"] = stats.MeanDepth
+
+	log.Infof("Flood map created for coordinates (%f, %f). %d cell(s) inundated", conf.Lat, conf.Lon,
+		stats.Cells)
+
+	return geojson.NewFeatureCollection().Append(feature), nil
+}
+
+// GetFloodTile Render the inundated area of a flood as a transparent OpenStreetMap (OSM) tile covering its Web
+// Mercator extent, where the water opacity grows with depth. The flood is simulated once for all of its tiles
+// when the generator has a flood cache
+func (t Generator) GetFloodTile(z, x, y, resolution int, conf FloodConfig) ([]byte, error) {
+	key := fmt.Sprintf("flood/%s/%d/%d/%d/%d", conf.key(), resolution, z, x, y)
+
+	return t.renderTile(key, func() ([]byte, error) {
+		flood, err := t.Floods.get(conf.key(), func() (*floodMap, error) {
+			return t.simulateFlood(conf)
+		})
+
+		if err != nil {
+			return []byte{}, err
+		}
+
+		return flood.drawTile(z, x, y, resolution)
+	}, nil)
+}
+
+// drawTile Color each pixel of a tile by the water depth of its center
+func (f *floodMap) drawTile(z, x, y, resolution int) ([]byte, error) {
+	lats, lons := mercatorExtent(z, float64(x), float64(y), float64(x+1), float64(y+1)).grid(resolution,
+		resolution)
+
+	img := image.NewNRGBA(image.Rect(0, 0, resolution, resolution))
+
+	for row, lat := range lats {
+		for col, lon := range lons {
+			depth, ok := f.depthAt(lat, lon)
+
+			if !ok {
+				continue
+			}
+
+			alpha := 96 + 159*math.Min(depth, maxRenderedFloodDepth)/maxRenderedFloodDepth
+			img.SetNRGBA(col, row, color.NRGBA{R: 30, G: 110, B: 230, A: uint8(alpha)})
+		}
+	}
+
+	return encodeImage(img)
+}
+
+// key Identifier of the flood, which includes every parameter of the simulation
+func (c FloodConfig) key() string {
+	key := fmt.Sprintf("%g,%g,%g,%g", c.Lat, c.Lon, c.Side, c.WaterLevel)
+
+	if c.Seed != nil {
+		key += fmt.Sprintf(";%g,%g", c.Seed.Lat, c.Seed.Lon)
+	}
+
+	for _, p := range c.River {
+		key += fmt.Sprintf(";%g,%g", p.Lat, p.Lon)
+	}
+
+	return key
+}
+
+func (t Generator) simulateFlood(conf FloodConfig) (*floodMap, error) {
+	if conf.Seed == nil && len(conf.River) == 0 {
+		return nil, errors.New("a seed point or a river polyline is required")
+	}
+
+	grid, err := t.createElevationGrid(conf.Lat, conf.Lon, conf.Side)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var seeds [][2]int
+
+	if conf.Seed != nil {
+		row, col, ok := grid.cellAt(conf.Seed.Lat, conf.Seed.Lon)
+
+		if !ok {
+			return nil, ErrFloodSeedOutsideArea
+		}
+
+		seeds = append(seeds, [2]int{row, col})
+	}
+
+	seeds = append(seeds, rasterizePolyline(grid, conf.River)...)
+
+	if len(seeds) == 0 {
+		return nil, ErrFloodSeedOutsideArea
+	}
+
+	return &floodMap{
+		grid:    grid,
+		level:   conf.WaterLevel,
+		flooded: floodFill(grid, conf.WaterLevel, seeds),
+	}, nil
+}
+
+// floodFill Mark every cell connected to the seeds (4-neighbourhood) with an elevation below the level
+func floodFill(grid *elevationGrid, level float64, seeds [][2]int) []bool {
+	flooded := make([]bool, len(grid.Elevations))
+	queue := make([]int, 0, len(seeds))
+
+	for _, s := range seeds {
+		if !grid.contains(s[0], s[1]) {
+			continue
+		}
+
+		i := grid.index(s[0], s[1])
+
+		if !flooded[i] && float64(grid.Elevations[i]) < level {
+			flooded[i] = true
+			queue = append(queue, i)
+		}
+	}
+
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+
+		row, col := i/grid.Cols, i%grid.Cols
+
+		for _, n := range [][2]int{{row - 1, col}, {row + 1, col}, {row, col - 1}, {row, col + 1}} {
+			if !grid.contains(n[0], n[1]) {
+				continue
+			}
+
+			j := grid.index(n[0], n[1])
+
+			if !flooded[j] && float64(grid.Elevations[j]) < level {
+				flooded[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	return flooded
+}
+
+// rasterizePolyline List the grid cells crossed by a polyline, sampling each segment at half cell steps
+func rasterizePolyline(grid *elevationGrid, polyline []Point) [][2]int {
+	var cells [][2]int
+
+	for i, p := range polyline {
+		if i == 0 {
+			if row, col, ok := grid.cellAt(p.Lat, p.Lon); ok {
+				cells = append(cells, [2]int{row, col})
+			}
+
+			continue
+		}
+
+		prev := polyline[i-1]
+
+		var distance float64
+		geodesic.WGS84.Inverse(prev.Lat, prev.Lon, p.Lat, p.Lon, &distance, nil, nil)
+
+		steps := int(math.Ceil(distance / (grid.spacing() / 2)))
+
+		for s := 1; s <= steps; s++ {
+			f := float64(s) / float64(steps)
+			lat := prev.Lat + (p.Lat-prev.Lat)*f
+			lon := prev.Lon + (p.Lon-prev.Lon)*f
+
+			if row, col, ok := grid.cellAt(lat, lon); ok {
+				cells = append(cells, [2]int{row, col})
+			}
+		}
+	}
+
+	return cells
+}
+
+func (f *floodMap) depthAt(lat, lon float64) (float64, bool) {
+	row, col, ok := f.grid.cellAt(lat, lon)
+
+	if !ok {
+		return 0, false
+	}
+
+	i := f.grid.index(row, col)
+
+	if !f.flooded[i] {
+		return 0, false
+	}
+
+	return f.level - float64(f.grid.Elevations[i]), true
+}
+
+func (f *floodMap) stats() FloodStats {
+	stats := FloodStats{WaterLevel: f.level}
+	cellArea := f.grid.spacing() * f.grid.spacing()
+
+	for i, flooded := range f.flooded {
+		if !flooded {
+			continue
+		}
+
+		depth := f.level - float64(f.grid.Elevations[i])
+
+		stats.Cells++
+		stats.Volume += depth * cellArea
+		stats.MaxDepth = math.Max(stats.MaxDepth, depth)
+	}
+
+	stats.Area = float64(stats.Cells) * cellArea
+
+	if stats.Cells > 0 {
+		stats.MeanDepth = stats.Volume / stats.Area
+	}
+
+	return stats
+}
+
+// polygons Convert the flooded cells to a MultiPolygon in WGS84 coordinates
+func (f *floodMap) polygons() space.MultiPolygon {
+	rings := traceRings(f.flooded, f.grid.Rows, f.grid.Cols)
+	multiPolygon := space.MultiPolygon{}
+	corners := map[[2]int][]float64{}
+
+	toCoordinates := func(ring [][2]int) [][]float64 {
+		coords := make([][]float64, len(ring))
+
+		for i, c := range ring {
+			coord, ok := corners[c]
+
+			if !ok {
+				lat, lon := f.grid.corner(c[0], c[1])
+				coord = []float64{lon, lat}
+				corners[c] = coord
+			}
+
+			coords[i] = coord
+		}
+
+		return coords
+	}
+
+	for _, p := range groupRings(rings) {
+		polygon := make(space.Polygon, len(p))
+
+		for i, ring := range p {
+			polygon[i] = toCoordinates(ring)
+		}
+
+		multiPolygon = append(multiPolygon, polygon)
+	}
+
+	return multiPolygon
+}
+
+// traceRings Extract the closed boundaries of a cell mask as rings of cell corners (row, col). Outer
+// rings are counterclockwise and holes clockwise, in a north up orientation
+func traceRings(mask []bool, rows, cols int) [][][2]int {
+	type edge struct {
+		from, to [2]int
+	}
+
+	filled := func(row, col int) bool {
+		return row >= 0 && col >= 0 && row < rows && col < cols && mask[row*cols+col]
+	}
+
+	edges := map[[2]int][]edge{}
+
+	addEdge := func(from, to [2]int) {
+		edges[from] = append(edges[from], edge{from, to})
+	}
+
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			if !filled(row, col) {
+				continue
+			}
+
+			if !filled(row+1, col) {
+				addEdge([2]int{row + 1, col}, [2]int{row + 1, col + 1})
+			}
+
+			if !filled(row, col+1) {
+				addEdge([2]int{row + 1, col + 1}, [2]int{row, col + 1})
+			}
+
+			if !filled(row-1, col) {
+				addEdge([2]int{row, col + 1}, [2]int{row, col})
+			}
+
+			if !filled(row, col-1) {
+				addEdge([2]int{row, col}, [2]int{row + 1, col})
+			}
+		}
+	}
+
+	// Picks the next edge. On corners touched by two diagonal cells, turns left to keep
+	// following the same cell, since cells are only connected through their sides
+	next := func(current edge) (edge, bool) {
+		candidates := edges[current.to]
+
+		if len(candidates) == 0 {
+			return edge{}, false
+		}
+
+		chosen := 0
+
+		if len(candidates) > 1 {
+			dRow, dCol := current.to[0]-current.from[0], current.to[1]-current.from[1]
+
+			for i, c := range candidates {
+				cRow, cCol := c.to[0]-c.from[0], c.to[1]-c.from[1]
+
+				// Left turn in a north up orientation (rows grow southwards)
+				if cRow == -dCol && cCol == dRow {
+					chosen = i
+				}
+			}
+		}
+
+		e := candidates[chosen]
+		edges[current.to] = append(candidates[:chosen], candidates[chosen+1:]...)
+
+		return e, true
+	}
+
+	var rings [][][2]int
+
+	for row := 0; row <= rows; row++ {
+		for col := 0; col <= cols; col++ {
+			for len(edges[[2]int{row, col}]) > 0 {
+				start := edges[[2]int{row, col}][0]
+				edges[start.from] = edges[start.from][1:]
+
+				ring := [][2]int{start.from}
+				current := start
+
+				for current.to != start.from {
+					ring = append(ring, current.to)
+
+					e, ok := next(current)
+
+					if !ok {
+						break
+					}
+
+					current = e
+				}
+
+				rings = append(rings, simplifyRing(append(ring, start.from)))
+			}
+		}
+	}
+
+	return rings
+}
+
+// simplifyRing Remove collinear corners of a closed ring
+func simplifyRing(ring [][2]int) [][2]int {
+	if len(ring) < 4 {
+		return ring
+	}
+
+	simplified := [][2]int{ring[0]}
+
+	for i := 1; i < len(ring)-1; i++ {
+		prev, cur, next := simplified[len(simplified)-1], ring[i], ring[i+1]
+
+		if (cur[0]-prev[0])*(next[1]-cur[1]) == (cur[1]-prev[1])*(next[0]-cur[0]) {
+			continue
+		}
+
+		simplified = append(simplified, cur)
+	}
+
+	return append(simplified, ring[len(ring)-1])
+}
+
+// groupRings Group holes with the smallest outer ring containing them. The first ring of each group
+// is the outer ring
+func groupRings(rings [][][2]int) [][][][2]int {
+	var groups [][][][2]int
+	var holes [][][2]int
+
+	for _, r := range rings {
+		if ringArea(r) > 0 {
+			groups = append(groups, [][][2]int{r})
+		} else {
+			holes = append(holes, r)
+		}
+	}
+
+	for _, h := range holes {
+		// Center of the unfilled cell at the right side of the first hole edge
+		dRow, dCol := sign(h[1][0]-h[0][0]), sign(h[1][1]-h[0][1])
+		row := float64(h[0][0]) + 0.5*float64(dRow) + 0.5*float64(dCol)
+		col := float64(h[0][1]) + 0.5*float64(dCol) - 0.5*float64(dRow)
+
+		best := -1
+
+		for i, g := range groups {
+			if !ringContains(g[0], row, col) {
+				continue
+			}
+
+			if best < 0 || ringArea(g[0]) < ringArea(groups[best][0]) {
+				best = i
+			}
+		}
+
+		if best >= 0 {
+			groups[best] = append(groups[best], h)
+		}
+	}
+
+	return groups
+}
+
+// ringArea Signed area of a ring, positive when counterclockwise in a north up orientation
+func ringArea(ring [][2]int) float64 {
+	area := 0.0
+
+	for i := 0; i < len(ring)-1; i++ {
+		x1, y1 := float64(ring[i][1]), -float64(ring[i][0])
+		x2, y2 := float64(ring[i+1][1]), -float64(ring[i+1][0])
+		area += x1*y2 - x2*y1
+	}
+
+	return area / 2
+}
+
+func sign(v int) int {
+	if v < 0 {
+		return -1
+	}
+
+	if v > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func ringContains(ring [][2]int, row, col float64) bool {
+	inside := false
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		ri, ci := float64(ring[i][0]), float64(ring[i][1])
+		rj, cj := float64(ring[j][0]), float64(ring[j][1])
+
+		if (ri > row) != (rj > row) && col < (cj-ci)*(row-ri)/(rj-ri)+ci {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
@@ -0,0 +1,199 @@
+package heightmap
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/petoc/hgt"
+)
+
+func TestFloodFill(t *testing.T) {
+	t.Parallel()
+
+	// A valley in the first two columns separated from a pit in the last column by a ridge
+	grid := &elevationGrid{
+		Rows: 3,
+		Cols: 4,
+		Elevations: []int16{
+			1, 2, 9, 1,
+			1, 2, 9, 1,
+			5, 5, 9, 1,
+		},
+	}
+
+	flooded := floodFill(grid, 3, [][2]int{{0, 0}})
+	expected := []bool{
+		true, true, false, false,
+		true, true, false, false,
+		false, false, false, false,
+	}
+
+	for i := range expected {
+		if flooded[i] != expected[i] {
+			t.Errorf("cell %d: expected flooded=%t but received %t", i, expected[i], flooded[i])
+		}
+	}
+}
+
+func TestFloodFillSeedAboveWaterLevel(t *testing.T) {
+	t.Parallel()
+
+	grid := &elevationGrid{Rows: 1, Cols: 2, Elevations: []int16{10, 1}}
+
+	for i, flooded := range floodFill(grid, 5, [][2]int{{0, 0}}) {
+		if flooded {
+			t.Errorf("cell %d should not be flooded", i)
+		}
+	}
+}
+
+func TestTraceRingsWithHole(t *testing.T) {
+	t.Parallel()
+
+	mask := []bool{
+		true, true, true,
+		true, false, true,
+		true, true, true,
+	}
+
+	groups := groupRings(traceRings(mask, 3, 3))
+
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 polygon but received %d", len(groups))
+	}
+
+	if len(groups[0]) != 2 {
+		t.Fatalf("expected an outer ring and a hole but received %d ring(s)", len(groups[0]))
+	}
+
+	if area := ringArea(groups[0][0]); area != 9 {
+		t.Errorf("expected outer ring area 9 but received %f", area)
+	}
+
+	if area := ringArea(groups[0][1]); area != -1 {
+		t.Errorf("expected hole area -1 but received %f", area)
+	}
+}
+
+func TestTraceRingsDiagonalCells(t *testing.T) {
+	t.Parallel()
+
+	mask := []bool{
+		true, false,
+		false, true,
+	}
+
+	groups := groupRings(traceRings(mask, 2, 2))
+
+	if len(groups) != 2 {
+		t.Errorf("expected 2 polygons but received %d", len(groups))
+	}
+}
+
+func TestCreateFloodMap(t *testing.T) {
+	t.Parallel()
+
+	h, err := hgt.OpenDataDir(demDatasetDir, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer h.Close()
+
+	heightmapGen := Generator{
+		ElevationDataset: h,
+	}
+
+	conf := NewFloodConfigAroundSeed(27.687397, 86.731814, 300, 10)
+
+	collection, err := heightmapGen.CreateFloodMap(conf)
+
+	if err != nil {
+		t.Fatalf("cannot create flood map. Cause: %s", err)
+	}
+
+	if len(collection.Features) != 1 {
+		t.Fatalf("expected 1 feature but received %d", len(collection.Features))
+	}
+
+	if cells := collection.Features[0].Properties.MustInt("cells"); cells != 100 {
+		t.Errorf("expected 100 flooded cells but received %d", cells)
+	}
+}
+
+func TestGetFloodTileSimulatesOnce(t *testing.T) {
+	t.Parallel()
+
+	var reads int32
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			atomic.AddInt32(&reads, 1)
+			return 0, true
+		}),
+		Floods: NewFloodCache(2),
+	}
+
+	conf := NewFloodConfigAroundSeed(tileLat(14, 6000.5), tileLon(14, 8000.5), 3000, 10)
+
+	b, err := heightmapGen.GetFloodTile(14, 8000, 6000, 64, conf)
+
+	if err != nil {
+		t.Fatalf("cannot render flood tile. Cause: %s", err)
+	}
+
+	simulated := atomic.LoadInt32(&reads)
+
+	if _, _, _, a := decodeTestTile(t, b).At(32, 32).RGBA(); a == 0 {
+		t.Error("expected the seed of the flood to be inundated")
+	}
+
+	for _, tile := range [][2]int{{8001, 6000}, {8000, 6001}, {7999, 5999}} {
+		if _, err := heightmapGen.GetFloodTile(14, tile[0], tile[1], 64, conf); err != nil {
+			t.Fatalf("cannot render flood tile %v. Cause: %s", tile, err)
+		}
+	}
+
+	if reads != simulated {
+		t.Errorf("expected the flood to be simulated once, got %d reads after %d", reads, simulated)
+	}
+}
+
+func TestFloodCache(t *testing.T) {
+	t.Parallel()
+
+	cache := NewFloodCache(1)
+	simulations := 0
+
+	simulate := func() (*floodMap, error) {
+		simulations++
+		return &floodMap{}, nil
+	}
+
+	cache.get("a", simulate)
+	cache.get("a", simulate)
+
+	if simulations != 1 {
+		t.Errorf("expected a cached flood, got %d simulations", simulations)
+	}
+
+	cache.get("b", simulate)
+	cache.get("a", simulate)
+
+	if simulations != 3 {
+		t.Errorf("expected the least recently used flood to be evicted, got %d simulations", simulations)
+	}
+
+	failures := 0
+
+	for i := 0; i < 2; i++ {
+		cache.get("c", func() (*floodMap, error) {
+			failures++
+			return nil, ErrFloodSeedOutsideArea
+		})
+	}
+
+	if failures != 2 {
+		t.Errorf("expected failed simulations not to be cached, got %d simulations", failures)
+	}
+}
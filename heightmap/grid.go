@@ -0,0 +1,200 @@
+package heightmap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/geovannyAvelar/lukla/geotiff"
+	"github.com/tidwall/geodesic"
+)
+
+// ErrGridTooBig Returned when a square has more cells than an elevation grid can hold
+var ErrGridTooBig = errors.New("too many cells in the elevation grid")
+
+// Maximum cells of an elevation grid, bounding the memory of a grid and of the values computed for its cells
+const maxElevationGridCells = 4096 * 4096
+
+// elevationGrid Elevations of a square sampled every Spacing meters (heightDataResolution when zero). Rows go
+// from north to south and columns from west to east, starting at the upper left corner (Lat, Lon). Lats and Lons
+// are the latitudes of the rows and the longitudes of the columns of the samples (see profileGrid), which are the
+// upper left corners of the cells
+type elevationGrid struct {
+	Lat, Lon   float64
+	Rows, Cols int
+	Spacing    float64
+	Lats, Lons []float64
+	Elevations []int16
+}
+
+// createElevationGrid Sample the elevations of a square on the grid of createHeightProfile, spaced by the
+// spacing of the generator
+func (t Generator) createElevationGrid(lat, lon, side float64) (*elevationGrid, error) {
+	n := t.gridSize(side)
+
+	if n*n > maxElevationGridCells {
+		return nil, fmt.Errorf("cannot sample %.0f meters every %.0f meters. Cause: %w", side, t.spacing(),
+			ErrGridTooBig)
+	}
+
+	lats, lons := profileGrid(lat, lon, t.spacing(), n)
+	grid, err := t.sampleElevationGrid(lats, lons)
+
+	if err != nil {
+		return nil, err
+	}
+
+	grid.Lat, grid.Lon = lat, lon
+
+	return grid, nil
+}
+
+// sampleElevationGrid Sample the elevations of a grid whose rows are at the latitudes lats and columns at the
+// longitudes lons, leaving Lat and Lon to the caller. Grids bigger than maxElevationGridCells are rejected
+func (t Generator) sampleElevationGrid(lats, lons []float64) (*elevationGrid, error) {
+	rows, cols := len(lats), len(lons)
+
+	if rows*cols > maxElevationGridCells {
+		return nil, fmt.Errorf("cannot sample %dx%d elevations. Cause: %w", rows, cols, ErrGridTooBig)
+	}
+
+	grid := &elevationGrid{
+		Rows:       rows,
+		Cols:       cols,
+		Spacing:    t.spacing(),
+		Lats:       lats,
+		Lons:       lons,
+		Elevations: make([]int16, rows*cols),
+	}
+
+	if err := t.downloadProfileFiles(lats, lons); err != nil {
+		return nil, err
+	}
+
+	t.sampleRows(lats, lons, func(x int, elevations []int16) {
+		copy(grid.Elevations[x*cols:(x+1)*cols], elevations)
+	})
+
+	return grid, nil
+}
+
+// createBufferedElevationGrid Sample the elevations of a square extended by buffer cells on each side.
+// Cell (buffer, buffer) of the returned grid is the upper left cell of the square
+func (t Generator) createBufferedElevationGrid(lat, lon, side float64, buffer int) (*elevationGrid, error) {
+	bufferSide := float64(buffer) * t.spacing()
+
+	var northLat, northLon, bufferLat, bufferLon float64
+	geodesic.WGS84.Direct(lat, lon, 0, bufferSide, &northLat, &northLon, nil)
+	geodesic.WGS84.Direct(northLat, northLon, 270, bufferSide, &bufferLat, &bufferLon, nil)
+
+	return t.createElevationGrid(bufferLat, bufferLon, side+2*bufferSide)
+}
+
+// gridSize Cells along each side of the elevation grid of a square
+func (t Generator) gridSize(side float64) int {
+	return int(math.Ceil(math.Ceil(side) / t.spacing()))
+}
+
+// spacing Distance in meters between two cells of the grid
+func (g *elevationGrid) spacing() float64 {
+	if g.Spacing > 0 {
+		return g.Spacing
+	}
+
+	return heightDataResolution
+}
+
+func (g *elevationGrid) index(row, col int) int {
+	return row*g.Cols + col
+}
+
+func (g *elevationGrid) contains(row, col int) bool {
+	return row >= 0 && col >= 0 && row < g.Rows && col < g.Cols
+}
+
+// at Elevation of a cell. Cells outside the grid repeat the nearest edge cell
+func (g *elevationGrid) at(row, col int) int16 {
+	row = clampInt(row, 0, g.Rows-1)
+	col = clampInt(col, 0, g.Cols-1)
+
+	return g.Elevations[g.index(row, col)]
+}
+
+// corner Coordinates of the upper left corner of a cell. Cells past the last row or column are extrapolated
+func (g *elevationGrid) corner(row, col int) (float64, float64) {
+	return gridEdge(g.Lats, row), gridEdge(g.Lons, col)
+}
+
+// gridEdge Coordinate of a row or column of a grid, extrapolated past its last row or column
+func gridEdge(coordinates []float64, i int) float64 {
+	n := len(coordinates)
+
+	if i < n {
+		return coordinates[i]
+	}
+
+	if n < 2 {
+		return coordinates[n-1]
+	}
+
+	return coordinates[n-1] + float64(i-n+1)*(coordinates[n-1]-coordinates[n-2])
+}
+
+// raster Georeference n x n values computed for the cells starting at (buffer, buffer)
+func (g *elevationGrid) raster(buffer, n int, data []float32) *geotiff.Raster {
+	originLat, originLon := g.corner(buffer, buffer)
+	_, rightLon := g.corner(buffer, buffer+n)
+	bottomLat, _ := g.corner(buffer+n, buffer)
+
+	return &geotiff.Raster{
+		Width:       n,
+		Height:      n,
+		Data:        data,
+		Lon:         originLon,
+		Lat:         originLat,
+		PixelWidth:  (rightLon - originLon) / float64(n),
+		PixelHeight: (originLat - bottomLat) / float64(n),
+	}
+}
+
+// encodeGeoTiff Encode a raster as a GeoTIFF file
+func encodeGeoTiff(raster *geotiff.Raster) ([]byte, error) {
+	var b bytes.Buffer
+
+	err := geotiff.Encode(&b, raster)
+
+	if err != nil {
+		return []byte{}, fmt.Errorf("cannot encode GeoTIFF file. Cause: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+// cellAt Locate the cell containing a coordinate. The second return value is false when the
+// coordinate is outside the grid
+func (g *elevationGrid) cellAt(lat, lon float64) (int, int, bool) {
+	// Latitudes decrease from north to south and longitudes increase from west to east
+	row := sort.Search(g.Rows+1, func(i int) bool {
+		return gridEdge(g.Lats, i) < lat
+	}) - 1
+
+	col := sort.Search(g.Cols+1, func(i int) bool {
+		return gridEdge(g.Lons, i) > lon
+	}) - 1
+
+	return row, col, g.contains(row, col)
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+
+	if v > max {
+		return max
+	}
+
+	return v
+}
@@ -0,0 +1,62 @@
+package heightmap
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/tidwall/geodesic"
+)
+
+func TestElevationGridCellAt(t *testing.T) {
+	t.Parallel()
+
+	grid := &elevationGrid{Lat: 27.687397, Lon: 86.731814, Rows: 10, Cols: 10}
+	grid.Lats, grid.Lons = profileGrid(grid.Lat, grid.Lon, heightDataResolution, 10)
+
+	lat, lon := grid.corner(3, 7)
+	row, col, ok := grid.cellAt(lat-0.0001, lon+0.0001)
+
+	if !ok || row != 3 || col != 7 {
+		t.Errorf("expected cell (3, 7) but received (%d, %d)", row, col)
+	}
+
+	if _, _, ok := grid.cellAt(grid.Lat+0.01, grid.Lon); ok {
+		t.Errorf("coordinate north of the grid should be outside it")
+	}
+}
+
+func TestCreateElevationGridSpacing(t *testing.T) {
+	t.Parallel()
+
+	flat := fakeElevationSource(func(lat, lon float64) (int16, bool) {
+		return 100, true
+	})
+
+	// Generators reading an overview sample every overview cell, as createHeightProfile
+	heightmapGen := Generator{ElevationDataset: flat, sampleSpacing: 90}
+	grid, err := heightmapGen.createElevationGrid(27.9, 86.9, 900)
+
+	if err != nil {
+		t.Fatalf("cannot create elevation grid. Cause: %s", err)
+	}
+
+	if grid.Rows != 10 || grid.Cols != 10 || grid.Spacing != 90 {
+		t.Fatalf("expected 10x10 cells of 90 meters, got %dx%d cells of %f meters", grid.Rows, grid.Cols,
+			grid.Spacing)
+	}
+
+	lat, lon := grid.corner(10, 0)
+
+	var distance float64
+	geodesic.WGS84.Inverse(grid.Lat, grid.Lon, lat, lon, &distance, nil, nil)
+
+	if math.Abs(distance-900) > 1 {
+		t.Errorf("expected the grid to cover 900 meters, got %f meters", distance)
+	}
+
+	if _, err := (Generator{ElevationDataset: flat}).createElevationGrid(27.9, 86.9, 200000); !errors.Is(err,
+		ErrGridTooBig) {
+		t.Errorf("expected a grid too big, got %v", err)
+	}
+}
@@ -1,14 +1,13 @@
 package heightmap
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
 	"image"
-	"image/png"
+	"image/color"
 	"math"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -18,9 +17,6 @@ import (
 
 	"github.com/apeyroux/gosm"
 	"github.com/geovannyAvelar/lukla/srtm"
-	"github.com/nfnt/resize"
-	"github.com/petoc/hgt"
-	"github.com/tidwall/geodesic"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -28,6 +24,9 @@ import (
 // Digital Elevation Model (DEM) resolution in meters
 const heightDataResolution = 30.0
 
+// Highest elevation drawn by grayscale heightmaps (Mount Everest)
+const maxElevation = 8865.0
+
 // Azimuth angle pointing to the south
 const southAzimuth = 180
 
@@ -45,122 +44,235 @@ type Point struct {
 	X, Y      int
 	Lat, Lon  float64
 	Elevation int16
+	// Source Name of the elevation source which provided the elevation, when the dataset combines sources
+	Source string
+}
+
+// ElevationSource Digital elevation model (DEM) dataset. Implemented by SRTM .hgt directories (srtm.MappedDataDir
+// and srtm.CompressedDataDir) and GeoTIFF directories (geotiff.DataDir)
+type ElevationSource interface {
+	// ElevationAt Return the elevation of a coordinate and the dataset resolution in arc seconds
+	ElevationAt(lat, lon float64) (int16, int, error)
+	Close() error
+}
+
+// RowSource Elevation source able to read a row of coordinates sharing a latitude at once, used instead of
+// ElevationAt to sample rasters. Implemented by srtm.CompressedDataDir
+type RowSource interface {
+	// ElevationsAt Fill the elevations of the coordinates of a latitude. Coordinates without data are zero
+	ElevationsAt(lat float64, lons []float64, elevations []int16)
+}
+
+// namedElevationSource Elevation source able to report which dataset provided each elevation
+type namedElevationSource interface {
+	SourceAt(lat, lon float64) (int16, int, string, error)
+}
+
+// sourceAt Read an elevation and the name of its dataset, which is empty for single dataset sources
+func sourceAt(source ElevationSource, lat, lon float64) (int16, int, string, error) {
+	if named, ok := source.(namedElevationSource); ok {
+		return named.SourceAt(lat, lon)
+	}
+
+	e, res, err := source.ElevationAt(lat, lon)
+
+	return e, res, "", err
 }
 
 // Generator HeightmapGenerator Generate heightmaps based on a digital elevation model (DEM) dataset
 type Generator struct {
-	ElevationDataset *hgt.DataDir
+	ElevationDataset ElevationSource
 	SrtmDownloader   *srtm.Downloader
 	Dir              string
+	// Overviews Downsampled levels of the dataset used to render tiles whose pixels are bigger than the
+	// dataset resolution
+	Overviews []Overview
+	// MinElevation Elevation drawn as black by grayscale heightmaps. Zero clips every depth to black, use
+	// MinBathymetryElevation to draw the seafloor
+	MinElevation float64
+	// DemSource Description of the DEM dataset (e.g.: srtm:data/dem), recorded in the manifest of each cached tile.
+	// Tiles rendered from another source are rendered again
+	DemSource string
+	// Renders Queue coalescing concurrent renders of the same tile and bounding the number of renders. Nil
+	// renders every request directly
+	Renders *RenderQueue
+	// Floods Flood simulations shared by the tiles of each flood. Nil simulates the flood for every tile
+	Floods *FloodCache
+	// MetatileSize Side, in tiles, of the metatiles rendered by GetTileHeightmap and GenerateAllTilesInZoomLevel.
+	// The tiles of a metatile are rendered as a single raster and sliced, so they have no seams and the DEM is
+	// read once for all of them. One or less renders each tile independently
+	MetatileSize int
+	// MetatileBuffer Pixels rendered around each metatile and discarded, so the tiles at its edges are resampled
+	// with their neighbouring pixels
+	MetatileBuffer int
+
+	sampleSpacing float64
 }
 
+// ResolutionConfig Size of a rendered image, in pixels. Images always have this size, except for zero dimensions
+// and IgnoreWhenOriginalImageIsSmaller, which use the resolution of the dataset
 type ResolutionConfig struct {
-	Width                            int
-	Height                           int
-	ForceInterpolation               bool
+	Width  int
+	Height int
+	// ForceInterpolation Upsample images bigger than the dataset resolution with bilinear interpolation. Without
+	// it, each pixel has the elevation of the nearest post of the dataset
+	ForceInterpolation bool
+	// IgnoreWhenOriginalImageIsSmaller Never upsample images, keeping the dataset resolution when it is smaller
+	// than the requested size
 	IgnoreWhenOriginalImageIsSmaller bool
 }
 
-// GetTileHeightmap Generate a heightmap with the same size of an OpenStreetMap (OSM) tile
+// GetTileHeightmap Generate a heightmap with the same size of an OpenStreetMap (OSM) tile, covering its Web
+// Mercator extent. Tiles are rendered with the other tiles of their metatile when MetatileSize is bigger than one
 func (t Generator) GetTileHeightmap(z, x, y, resolution int) ([]byte, error) {
-	byteArray, err := t.getTileFromDisk(x, y, z, resolution)
+	return t.getCachedMetatile(string(Grayscale), z, x, y, resolution, t.grayscaleColor())
+}
 
-	if err == nil {
-		return byteArray, nil
+// TileModTime Modification time of a cached tile. The layer is a heightmap encoding or the LayerName of a
+// terrain index
+func (t Generator) TileModTime(layer string, z, x, y, resolution int) (time.Time, error) {
+	info, err := os.Stat(formatTilePath(t.layerDir(layer), x, y, z, resolution))
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return info.ModTime(), nil
+}
+
+// layerDir Directory of the tiles of a layer
+func (t Generator) layerDir(layer string) string {
+	if layer == string(Grayscale) || layer == "" {
+		return t.Dir
 	}
 
-	osmTile := gosm.NewTileWithXY(x, y, z)
-	lat, lon := osmTile.Num2deg()
+	return t.Dir + filePathSep + layer
+}
 
-	tileSide := calculateTileSizeKm(z) * 1000
+// getCachedTile Read a tile of a layer from the tile cache, or render it over its Web Mercator extent and save it
+// to the cache in the background. Grayscale tiles are cached in the tile directory and other layers in their own
+// subdirectory
+func (t Generator) getCachedTile(layerName string, z, x, y, resolution int,
+	render func(extent rasterExtent, conf ResolutionConfig) ([]byte, error)) ([]byte, error) {
+	layer := t
+	layer.Dir = t.layerDir(layerName)
 
-	byteArray, err = t.CreateHeightMapImage(lat, lon, tileSide,
-		ResolutionConfig{Width: resolution, Height: resolution, ForceInterpolation: true,
-			IgnoreWhenOriginalImageIsSmaller: false})
+	byteArray, err := layer.getTileFromDisk(x, y, z, resolution)
 
-	if err != nil {
-		return []byte{}, err
+	if err == nil {
+		return byteArray, nil
 	}
 
-	go func() {
-		_, err := t.saveTile(x, y, z, resolution, byteArray)
-		if err != nil {
-			log.Errorf("cannot save tile (%d, %d, %d) to disk. Cause: %s", x, y, z, err)
+	return t.renderTile(tileKey(layerName, z, x, y, resolution), func() ([]byte, error) {
+		// The tile may have been saved since the cache was read
+		if byteArray, err := layer.getTileFromDisk(x, y, z, resolution); err == nil {
+			return byteArray, nil
 		}
-	}()
 
-	return byteArray, nil
+		extent := mercatorExtent(z, float64(x), float64(y), float64(x+1), float64(y+1))
+
+		return render(extent, ResolutionConfig{Width: resolution, Height: resolution,
+			ForceInterpolation: true, IgnoreWhenOriginalImageIsSmaller: false})
+	}, func(byteArray []byte) {
+		_, err := layer.saveTile(x, y, z, resolution, byteArray)
+		if err != nil {
+			log.Errorf("cannot save %s tile (%d, %d, %d) to disk. Cause: %s", layerName, x, y, z, err)
+		}
+	})
 }
 
 func (t Generator) CreateHeightMapImage(lat, lon float64, side float64,
 	conf ResolutionConfig) ([]byte, error) {
-	step := int(side) / heightDataResolution
-
-	if step >= 100 {
-		step -= 100
-	}
-
-	upLeft := image.Point{}
-	lowRight := image.Point{X: step, Y: step}
+	return t.createImage(lat, lon, side, conf, t.grayscaleColor())
+}
 
-	imgRgba := image.NewRGBA(image.Rectangle{Min: upLeft, Max: lowRight})
-	gradient, _ := colorgrad.NewGradient().Domain(0, 8865).Build()
+// grayscaleColor Color of a point in grayscale heightmaps
+func (t Generator) grayscaleColor() func(*Point) color.Color {
+	gradient, _ := colorgrad.NewGradient().Domain(t.MinElevation, maxElevation).Build()
 
-	err := t.createHeightProfile(lat, lon, side, imgRgba, func(point *Point, i interface{}, index int) error {
-		imgRgba.Set(point.Y, point.X, gradient.At(float64(point.Elevation)))
-		return nil
-	})
+	return func(point *Point) color.Color {
+		return gradient.At(float64(point.Elevation))
+	}
+}
 
-	log.Infof("Height profile created for coordinates (%f, %f)", lat, lon)
+// createImage Draw a square PNG image coloring each pixel with colorFunc. The image has the size of the resolution
+// config (see sampleRaster)
+func (t Generator) createImage(lat, lon float64, side float64, conf ResolutionConfig,
+	colorFunc func(*Point) color.Color) ([]byte, error) {
+	raster, err := t.sampleRaster(lat, lon, side, conf)
 
 	if err != nil {
 		return []byte{}, err
 	}
 
-	var b bytes.Buffer
-	writer := bufio.NewWriter(&b)
-
-	if !conf.IgnoreWhenOriginalImageIsSmaller {
-		if conf.Height < step && conf.Width < step {
+	log.Infof("Height profile created for coordinates (%f, %f)", lat, lon)
 
-			log.Infof("Heightmap image for coordinates (%f, %f) is smaller than the desired resolution. Resizing image...", lat, lon)
+	return encodeImage(colorRaster(raster, colorFunc))
+}
 
-			resizedImg := resize.Resize(uint(conf.Width), uint(conf.Height), imgRgba, resize.Lanczos3)
-			err := png.Encode(writer, resizedImg)
+// colorRaster Color each pixel of an elevation raster
+func colorRaster(raster *elevationRaster, colorFunc func(*Point) color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, raster.Width, raster.Height))
 
-			if err != nil {
-				return []byte{}, errors.New("cannot resize heightmap image")
-			}
+	for y := 0; y < raster.Height; y++ {
+		for x := 0; x < raster.Width; x++ {
+			img.Set(x, y, colorFunc(raster.point(x, y)))
 		}
 	}
 
-	err = png.Encode(writer, imgRgba)
-
-	if err != nil {
-		return []byte{}, errors.New("cannot encode PNG image")
-	}
-
-	return b.Bytes(), nil
+	return img
 }
 
+// GetPointsElevations Fill the elevation of each point. When the dataset combines several sources (a
+// SourceChain or Bathymetry), the name of the source which provided each elevation is also filled
 func (t Generator) GetPointsElevations(points []Point) []Point {
 	for i, p := range points {
-		if t.SrtmDownloader != nil {
-			_, err := t.SrtmDownloader.DownloadDemFile(p.Lat, p.Lon)
+		err := t.downloadDemFile(p.Lat, p.Lon)
 
-			if err != nil {
-				msg := "cannot download digital elevation model file for coordinate %f, %f. Cause: %s"
-				log.Warnf(msg, p.Lat, p.Lon, err)
-			}
+		if err != nil {
+			msg := "cannot download digital elevation model file for coordinate %f, %f. Cause: %s"
+			log.Warnf(msg, p.Lat, p.Lon, err)
 		}
 
-		points[i].Elevation, _, _ = t.ElevationDataset.ElevationAt(p.Lat, p.Lon)
+		points[i].Elevation, _, points[i].Source, _ = sourceAt(t.ElevationDataset, p.Lat, p.Lon)
 	}
 
 	return points
 }
 
+// downloadDemFile Download the SRTM file containing a coordinate. Coordinates without SRTM data are not an
+// error, since they are read from the next sources of a SourceChain (or as sea level). Cells covered by the
+// overview being read are not downloaded
+func (t Generator) downloadDemFile(lat, lon float64) error {
+	if t.SrtmDownloader == nil {
+		return nil
+	}
+
+	if overview, ok := t.ElevationDataset.(overviewSource); ok && overview.covers(lat, lon) {
+		return nil
+	}
+
+	_, err := t.SrtmDownloader.DownloadDemFile(lat, lon)
+
+	if errors.Is(err, srtm.ErrTileNotInsideSrtmCoverage) || errors.Is(err, srtm.ErrNonExistentDemFile) ||
+		errors.Is(err, srtm.ErrOffline) {
+		return nil
+	}
+
+	return err
+}
+
+// GenerateAllTilesInZoomLevel Render and save every tile of a zoom level. Tiles are rendered by metatile when
+// MetatileSize is bigger than one, skipping the metatiles already cached
 func (t Generator) GenerateAllTilesInZoomLevel(zoomLevel int) {
+	// The pool bounds the renders, which must wait instead of being rejected by the render queue
+	t.Renders = nil
+
+	if t.metatileSize(zoomLevel) > 1 {
+		t.generateAllMetatilesInZoomLevel(zoomLevel)
+		return
+	}
+
 	tiles := listTilesFromZoomLevel(zoomLevel)
 
 	pool := tunny.NewFunc(100, func(payload interface{}) interface{} {
@@ -191,46 +303,66 @@ func (t Generator) GenerateAllTilesInZoomLevel(zoomLevel int) {
 	pool.Close()
 }
 
-func (t Generator) createHeightProfile(lat, lon float64, side float64, processFuncParam interface{},
-	processFunc heightProfileProcessFunc) error {
-	i := 0
+// generateAllMetatilesInZoomLevel Render and save every metatile of a zoom level. Metatiles hold many tiles in
+// memory, so one is rendered per CPU
+func (t Generator) generateAllMetatilesInZoomLevel(zoomLevel int) {
+	const resolution = 256
+	colorFunc := t.grayscaleColor()
+
+	pool := tunny.NewFunc(runtime.NumCPU(), func(payload interface{}) interface{} {
+		start := time.Now()
+
+		m := payload.(metatile)
+
+		if t.isMetatileCached(m, resolution) {
+			return nil
+		}
+
+		tiles, err := t.renderMetatile(string(Grayscale), m, resolution, colorFunc)
 
-	side = math.Ceil(side)
+		if err != nil {
+			log.Warnf("cannot generate heightmap for metatile (%d, %d, %d). Cause: %s", m.X, m.Y, m.Z, err)
+			return nil
+		}
 
-	for x := 0; x < int(side); x = x + heightDataResolution {
-		var newLat, newLon float64
-		geodesic.WGS84.Direct(lat, lon, southAzimuth, float64(x), &newLat, &newLon, nil)
+		t.saveMetatile(string(Grayscale), m, resolution, tiles)
 
-		for y := 0; y < int(side); y = y + heightDataResolution {
-			var pLat, pLon float64
-			geodesic.WGS84.Direct(newLat, newLon, eastAzimuth, float64(y), &pLat, &pLon, nil)
+		log.Infof("Heightmap for metatile (%d, %d, %d) generated. Took %s", m.X, m.Y, m.Z, time.Since(start))
 
-			if t.SrtmDownloader != nil {
-				_, err := t.SrtmDownloader.DownloadDemFile(pLat, pLon)
+		return nil
+	})
 
-				if err != nil {
-					if errors.Is(err, srtm.ErrTileNotInsideSrtmCoverage) {
-						continue
-					}
+	for _, m := range t.listMetatilesFromZoomLevel(zoomLevel) {
+		pool.Process(m)
+	}
 
-					msg := "cannot download digital elevation model file for coordinate %f, %f. Cause: %s"
-					log.Debugf(msg, pLat, pLon, err)
-					return err
-				}
-			}
+	pool.Close()
+}
 
-			e, _, _ := t.ElevationDataset.ElevationAt(pLat, pLon)
+// createHeightProfile Sample the elevations of a square whose upper left corner is a coordinate, calling
+// processFunc with each point. Rows are sampled in parallel, so processFunc must be safe for concurrent calls on
+// different points
+func (t Generator) createHeightProfile(lat, lon float64, side float64, processFuncParam interface{},
+	processFunc heightProfileProcessFunc) error {
+	spacing := int(t.spacing())
+	n := (int(math.Ceil(side)) + spacing - 1) / spacing
+
+	lats, lons := profileGrid(lat, lon, float64(spacing), n)
 
-			point := &Point{x / heightDataResolution, y / heightDataResolution, pLat, pLon, e}
-			err := processFunc(point, processFuncParam, i)
+	if err := t.downloadProfileFiles(lats, lons); err != nil {
+		return err
+	}
+
+	t.sampleRows(lats, lons, func(x int, elevations []int16) {
+		for y, e := range elevations {
+			point := &Point{X: x, Y: y, Lat: lats[x], Lon: lons[y], Elevation: e}
+			err := processFunc(point, processFuncParam, x*n+y)
 
 			if err != nil {
 				log.Errorf("cannot process point (%d, %d). Cause: %s", point.X, point.Y, err)
 			}
-
-			i++
 		}
-	}
+	})
 
 	return nil
 }
@@ -245,7 +377,7 @@ func (t Generator) saveTile(x int, y int, z, resolution int, bytes []byte) (stri
 
 	filepath := fmt.Sprintf("%s/%d.png", dir, y)
 
-	if _, err := os.Stat(filepath); err == nil {
+	if _, err := os.Stat(filepath); err == nil && t.isTileCurrent(filepath) {
 		return filepath, nil
 	}
 
@@ -257,9 +389,15 @@ func (t Generator) saveTile(x int, y int, z, resolution int, bytes []byte) (stri
 		return "", fmt.Errorf("cannot create tile file. Cause: %w", err)
 	}
 
+	if err := t.writeTileManifest(filepath); err != nil {
+		return "", fmt.Errorf("cannot create tile manifest. Cause: %w", err)
+	}
+
 	return filepath, nil
 }
 
+// getTileFromDisk Read a cached tile. Tiles whose manifest records another renderer version or DEM source are
+// not cached
 func (t Generator) getTileFromDisk(x, y, z, resolution int) ([]byte, error) {
 	path := formatTilePath(t.Dir, x, y, z, resolution)
 
@@ -267,6 +405,10 @@ func (t Generator) getTileFromDisk(x, y, z, resolution int) ([]byte, error) {
 		return nil, errors.New("tile is not cached")
 	}
 
+	if !t.isTileCurrent(path) {
+		return nil, errors.New("tile is stale")
+	}
+
 	bytes, err := os.ReadFile(path)
 
 	if err != nil {
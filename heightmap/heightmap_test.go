@@ -57,6 +57,7 @@ func TestSaveTile(t *testing.T) {
 	}
 
 	os.Remove(path)
+	os.Remove(tileManifestPath(path))
 }
 
 func TestGetTileFromDisk(t *testing.T) {
@@ -74,6 +75,10 @@ func TestGetTileFromDisk(t *testing.T) {
 		Dir: tilesDir,
 	}
 
+	if err := heightmapGen.writeTileManifest(tilePath); err != nil {
+		t.Errorf("cannot create manifest of %s. cause: %s", tilePath, err)
+	}
+
 	b, err := heightmapGen.getTileFromDisk(0, 0, 0, 256)
 
 	if err != nil {
@@ -85,6 +90,7 @@ func TestGetTileFromDisk(t *testing.T) {
 	}
 
 	os.Remove(tilePath)
+	os.Remove(tileManifestPath(tilePath))
 }
 
 func TestFormatTilePath(t *testing.T) {
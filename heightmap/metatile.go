@@ -0,0 +1,171 @@
+package heightmap
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// metatile Block of size x size tiles rendered as a single raster. X and Y are the coordinates of its upper
+// left tile
+type metatile struct {
+	Z, X, Y, Size int
+}
+
+// metatileOf Metatile containing a tile
+func (t Generator) metatileOf(z, x, y int) metatile {
+	size := t.metatileSize(z)
+
+	return metatile{Z: z, X: x - x%size, Y: y - y%size, Size: size}
+}
+
+// metatileSize Side of the metatiles of a zoom level, in tiles. Metatiles never exceed the tiles of the zoom
+// level
+func (t Generator) metatileSize(z int) int {
+	size := t.MetatileSize
+	n := 1 << z
+
+	if size > n {
+		size = n
+	}
+
+	if size < 1 {
+		size = 1
+	}
+
+	return size
+}
+
+// tiles Tiles of the metatile. Metatiles crossing the edge of the map only contain the tiles inside it
+func (m metatile) tiles() [][2]int {
+	n := 1 << m.Z
+	var tiles [][2]int
+
+	for x := m.X; x < m.X+m.Size && x < n; x++ {
+		for y := m.Y; y < m.Y+m.Size && y < n; y++ {
+			tiles = append(tiles, [2]int{x, y})
+		}
+	}
+
+	return tiles
+}
+
+// getCachedMetatile Read a tile of a layer from the tile cache, or render its whole metatile and save every
+// tile of it to the cache in the background. Concurrent requests of tiles of the same metatile share its render
+func (t Generator) getCachedMetatile(layerName string, z, x, y, resolution int,
+	colorFunc func(*Point) color.Color) ([]byte, error) {
+	layer := t
+	layer.Dir = t.layerDir(layerName)
+
+	byteArray, err := layer.getTileFromDisk(x, y, z, resolution)
+
+	if err == nil {
+		return byteArray, nil
+	}
+
+	m := t.metatileOf(z, x, y)
+	key := fmt.Sprintf("%s/%d/%d/meta/%d/%d/%d", layerName, resolution, z, m.Size, m.X, m.Y)
+
+	return t.renderTiles(key, tileKey(layerName, z, x, y, resolution), func() (map[string][]byte, error) {
+		return t.renderMetatile(layerName, m, resolution, colorFunc)
+	}, func(tiles map[string][]byte) {
+		layer.saveMetatile(layerName, m, resolution, tiles)
+	})
+}
+
+// renderMetatile Draw a metatile as a single raster over its Web Mercator extent, with MetatileBuffer pixels
+// around it, and slice it into PNG tiles keyed by tileKey. Each DEM post is read once for the whole metatile, its
+// tiles have no seams and each tile has the pixels it would have if rendered alone
+func (t Generator) renderMetatile(layerName string, m metatile, resolution int,
+	colorFunc func(*Point) color.Color) (map[string][]byte, error) {
+	buffer := t.MetatileBuffer
+
+	if buffer < 0 {
+		buffer = 0
+	}
+
+	// Buffer in tile coordinates
+	margin := float64(buffer) / float64(resolution)
+	extent := mercatorExtent(m.Z, float64(m.X)-margin, float64(m.Y)-margin, float64(m.X+m.Size)+margin,
+		float64(m.Y+m.Size)+margin)
+
+	pixels := m.Size*resolution + 2*buffer
+	pixelSize := calculateTileSizeKm(m.Z) * 1000 / float64(resolution)
+
+	raster, err := t.forPixelSize(pixelSize).sampleExtent(extent,
+		ResolutionConfig{Width: pixels, Height: pixels, ForceInterpolation: true})
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Metatile (%d, %d, %d) of %dx%d tiles created", m.X, m.Y, m.Z, m.Size, m.Size)
+
+	img := colorRaster(raster, colorFunc)
+
+	tiles := map[string][]byte{}
+
+	for _, tile := range m.tiles() {
+		minX := buffer + (tile[0]-m.X)*resolution
+		minY := buffer + (tile[1]-m.Y)*resolution
+
+		b, err := encodeImage(img.SubImage(image.Rect(minX, minY, minX+resolution, minY+resolution)))
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode tile (%d, %d, %d). Cause: %w", tile[0], tile[1], m.Z, err)
+		}
+
+		tiles[tileKey(layerName, m.Z, tile[0], tile[1], resolution)] = b
+	}
+
+	return tiles, nil
+}
+
+// saveMetatile Save the rendered tiles of a metatile to the tile directory of the generator
+func (t Generator) saveMetatile(layerName string, m metatile, resolution int, tiles map[string][]byte) {
+	for _, tile := range m.tiles() {
+		b, ok := tiles[tileKey(layerName, m.Z, tile[0], tile[1], resolution)]
+
+		if !ok {
+			continue
+		}
+
+		if _, err := t.saveTile(tile[0], tile[1], m.Z, resolution, b); err != nil {
+			log.Errorf("cannot save %s tile (%d, %d, %d) to disk. Cause: %s", layerName, tile[0], tile[1], m.Z,
+				err)
+		}
+	}
+}
+
+// isMetatileCached Check if every tile of a metatile is cached
+func (t Generator) isMetatileCached(m metatile, resolution int) bool {
+	for _, tile := range m.tiles() {
+		if _, err := t.getTileFromDisk(tile[0], tile[1], m.Z, resolution); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// listMetatilesFromZoomLevel Metatiles covering every tile of a zoom level
+func (t Generator) listMetatilesFromZoomLevel(zoomLevel int) []metatile {
+	n := 1 << zoomLevel
+	size := t.metatileSize(zoomLevel)
+	var metatiles []metatile
+
+	for x := 0; x < n; x += size {
+		for y := 0; y < n; y += size {
+			metatiles = append(metatiles, metatile{Z: zoomLevel, X: x, Y: y, Size: size})
+		}
+	}
+
+	return metatiles
+}
+
+// tileKey Key of a tile of a layer in the render queue
+func tileKey(layerName string, z, x, y, resolution int) string {
+	return fmt.Sprintf("%s/%d/%d/%d/%d", layerName, resolution, z, x, y)
+}
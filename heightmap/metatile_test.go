@@ -0,0 +1,187 @@
+package heightmap
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apeyroux/gosm"
+)
+
+// metatileTestSource Elevation source rising to the east, counting its reads
+func metatileTestSource(reads *int32) fakeElevationSource {
+	_, lon0 := gosm.NewTileWithXY(8000, 6000, 14).Num2deg()
+
+	return fakeElevationSource(func(lat, lon float64) (int16, bool) {
+		atomic.AddInt32(reads, 1)
+		return int16(1000 + (lon-lon0)*20000), true
+	})
+}
+
+func TestRenderMetatile(t *testing.T) {
+	t.Parallel()
+
+	var reads int32
+	heightmapGen := Generator{ElevationDataset: metatileTestSource(&reads), MetatileSize: 2, MetatileBuffer: 4}
+
+	m := heightmapGen.metatileOf(14, 8001, 6001)
+
+	if m.X != 8000 || m.Y != 6000 || m.Size != 2 {
+		t.Fatalf("unexpected metatile %+v", m)
+	}
+
+	tiles, err := heightmapGen.renderMetatile(string(Grayscale), m, 32, heightmapGen.grayscaleColor())
+
+	if err != nil {
+		t.Fatalf("cannot render metatile. Cause: %s", err)
+	}
+
+	if len(tiles) != 4 {
+		t.Fatalf("expected 4 tiles, got %d", len(tiles))
+	}
+
+	west := decodeTestTile(t, tiles[tileKey(string(Grayscale), 14, 8000, 6000, 32)])
+	east := decodeTestTile(t, tiles[tileKey(string(Grayscale), 14, 8001, 6000, 32)])
+
+	if west.Bounds().Dx() != 32 || west.Bounds().Dy() != 32 {
+		t.Fatalf("expected 32x32 tiles, got %s", west.Bounds())
+	}
+
+	// The edges of neighbouring tiles are sliced from the same raster, so they have no seams
+	for y := 0; y < 32; y++ {
+		w, _, _, _ := west.At(31, y).RGBA()
+		e, _, _, _ := east.At(0, y).RGBA()
+
+		if diff := int(e>>8) - int(w>>8); diff < 0 || diff > 2 {
+			t.Fatalf("seam between tiles at row %d: %d and %d", y, w>>8, e>>8)
+		}
+	}
+}
+
+func TestRenderMetatileMatchesSingleTiles(t *testing.T) {
+	t.Parallel()
+
+	var reads int32
+	metatileGen := Generator{ElevationDataset: metatileTestSource(&reads), MetatileSize: 4, MetatileBuffer: 16}
+	tileGen := Generator{ElevationDataset: metatileTestSource(&reads), MetatileSize: 1, MetatileBuffer: 16}
+
+	// About 57 degrees north, where tiles are much narrower than at the equator
+	m := metatileGen.metatileOf(14, 8000, 5000)
+	tiles, err := metatileGen.renderMetatile(string(Grayscale), m, 64, metatileGen.grayscaleColor())
+
+	if err != nil {
+		t.Fatalf("cannot render metatile. Cause: %s", err)
+	}
+
+	for _, tile := range m.tiles() {
+		key := tileKey(string(Grayscale), 14, tile[0], tile[1], 64)
+		alone, err := tileGen.renderMetatile(string(Grayscale), tileGen.metatileOf(14, tile[0], tile[1]), 64,
+			tileGen.grayscaleColor())
+
+		if err != nil {
+			t.Fatalf("cannot render tile %v. Cause: %s", tile, err)
+		}
+
+		cut, single := decodeTestTile(t, tiles[key]), decodeTestTile(t, alone[key])
+
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				c, _, _, _ := cut.At(x, y).RGBA()
+				s, _, _, _ := single.At(x, y).RGBA()
+
+				if diff := int(c>>8) - int(s>>8); diff < -1 || diff > 1 {
+					t.Fatalf("tile %v cut from its metatile differs from the tile rendered alone at (%d, %d): %d "+
+						"and %d", tile, x, y, c>>8, s>>8)
+				}
+			}
+		}
+	}
+}
+
+func TestGetTileHeightmapRendersMetatile(t *testing.T) {
+	t.Parallel()
+
+	var reads int32
+	heightmapGen := Generator{
+		ElevationDataset: metatileTestSource(&reads),
+		Dir:              t.TempDir(),
+		Renders:          NewRenderQueue(1, 4),
+		MetatileSize:     2,
+		MetatileBuffer:   4,
+	}
+
+	if _, err := heightmapGen.GetTileHeightmap(14, 8000, 6000, 32); err != nil {
+		t.Fatalf("cannot render tile. Cause: %s", err)
+	}
+
+	rendered := atomic.LoadInt32(&reads)
+
+	for _, tile := range [][2]int{{8001, 6000}, {8000, 6001}, {8001, 6001}} {
+		b, err := heightmapGen.GetTileHeightmap(14, tile[0], tile[1], 32)
+
+		if err != nil {
+			t.Fatalf("cannot render tile %v. Cause: %s", tile, err)
+		}
+
+		if img := decodeTestTile(t, b); img.Bounds().Dx() != 32 {
+			t.Errorf("expected a 32x32 tile, got %s", img.Bounds())
+		}
+	}
+
+	if reads != rendered {
+		t.Errorf("expected the tiles of a metatile to be rendered once, got %d reads after %d", reads, rendered)
+	}
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if heightmapGen.isMetatileCached(heightmapGen.metatileOf(14, 8000, 6000), 32) {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Error("tiles of the metatile were not saved")
+}
+
+func TestListMetatilesFromZoomLevel(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{MetatileSize: 8}
+
+	if metatiles := heightmapGen.listMetatilesFromZoomLevel(1); len(metatiles) != 1 || metatiles[0].Size != 2 {
+		t.Errorf("expected a single 2x2 metatile at zoom level 1, got %+v", metatiles)
+	}
+
+	if metatiles := heightmapGen.listMetatilesFromZoomLevel(4); len(metatiles) != 4 {
+		t.Errorf("expected 4 metatiles at zoom level 4, got %d", len(metatiles))
+	}
+}
+
+func decodeTestTile(t *testing.T, b []byte) image.Image {
+	img, err := png.Decode(bytes.NewReader(b))
+
+	if err != nil {
+		t.Fatalf("cannot decode tile. Cause: %s", err)
+	}
+
+	return img
+}
+
+// waitForTileManifest Wait for a tile saved in the background, before its temporary directory is removed
+func waitForTileManifest(t *testing.T, tilePath string) {
+	manifest := tileManifestPath(tilePath)
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if _, err := os.Stat(manifest); err == nil {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Errorf("tile %s was not saved", tilePath)
+}
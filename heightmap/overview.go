@@ -0,0 +1,297 @@
+package heightmap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/geovannyAvelar/lukla/geotiff"
+	"github.com/geovannyAvelar/lukla/srtm"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Value of overview pixels without data
+const overviewNoData = -32768.0
+
+// Maximum number of samples, per axis, averaged to compute an overview pixel
+const maxOverviewSamples = 6
+
+var ErrNoOverviewData = errors.New("no elevation data inside the overview cell")
+
+// OverviewLevel Downsampled level of the digital elevation model (DEM) pyramid. Resolution is the nominal
+// pixel size in meters and ArcSeconds the pixel size of the stored files
+type OverviewLevel struct {
+	Name       string
+	Resolution float64
+	ArcSeconds float64
+}
+
+// OverviewLevels Levels of the overview pyramid, from the finest to the coarsest
+var OverviewLevels = []OverviewLevel{
+	{Name: "90m", Resolution: 90, ArcSeconds: 3},
+	{Name: "250m", Resolution: 250, ArcSeconds: 7.5},
+	{Name: "1km", Resolution: 1000, ArcSeconds: 30},
+}
+
+// Overview Opened overview level
+type Overview struct {
+	Level  OverviewLevel
+	Source ElevationSource
+}
+
+// ParseOverviewLevel Find an overview level by its name (90m, 250m or 1km)
+func ParseOverviewLevel(name string) (OverviewLevel, error) {
+	for _, level := range OverviewLevels {
+		if level.Name == name {
+			return level, nil
+		}
+	}
+
+	return OverviewLevel{}, fmt.Errorf("unknown overview level %s", name)
+}
+
+// GenerateOverviews Downsample every one degree cell inside a bounding box into GeoTIFF files stored in
+// dir/<level name>. Existing files are kept, so an interrupted generation can be resumed
+func (t Generator) GenerateOverviews(dir string, levels []OverviewLevel, west, south, east, north int) error {
+	for _, level := range levels {
+		levelDir := filepath.Join(dir, level.Name)
+
+		if err := os.MkdirAll(levelDir, os.ModePerm); err != nil {
+			return fmt.Errorf("cannot create overview directory. Cause: %w", err)
+		}
+
+		log.Infof("Generating %s overview level", level.Name)
+
+		cells := make(chan [2]int)
+		var wg sync.WaitGroup
+
+		for i := 0; i < runtime.NumCPU(); i++ {
+			wg.Add(1)
+
+			go func(level OverviewLevel) {
+				defer wg.Done()
+
+				for cell := range cells {
+					t.generateOverviewFile(levelDir, level, cell[0], cell[1])
+				}
+			}(level)
+		}
+
+		for lat := south; lat < north; lat++ {
+			for lon := west; lon < east; lon++ {
+				cells <- [2]int{lat, lon}
+			}
+		}
+
+		close(cells)
+		wg.Wait()
+	}
+
+	return nil
+}
+
+func (t Generator) generateOverviewFile(dir string, level OverviewLevel, lat, lon int) {
+	path := filepath.Join(dir, overviewFileName(lat, lon))
+
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+
+	raster, err := t.createOverviewCell(level, lat, lon)
+
+	if err != nil {
+		if !errors.Is(err, ErrNoOverviewData) {
+			log.Warnf("cannot generate %s overview of cell (%d, %d). Cause: %s", level.Name, lat, lon, err)
+		}
+
+		return
+	}
+
+	b, err := encodeGeoTiff(raster)
+
+	if err == nil {
+		err = os.WriteFile(path, b, 0644)
+	}
+
+	if err != nil {
+		log.Errorf("cannot save overview file %s. Cause: %s", path, err)
+		return
+	}
+
+	log.Infof("Overview file %s saved", path)
+}
+
+// createOverviewCell Downsample the one degree cell whose south west corner is (lat, lon). Each pixel is the
+// mean of a grid of samples spread over the pixel area
+func (t Generator) createOverviewCell(level OverviewLevel, lat, lon int) (*geotiff.Raster, error) {
+	if t.SrtmDownloader != nil {
+		_, err := t.SrtmDownloader.DownloadDemFile(float64(lat)+0.5, float64(lon)+0.5)
+
+		if err != nil {
+			if errors.Is(err, srtm.ErrTileNotInsideSrtmCoverage) || errors.Is(err, srtm.ErrNonExistentDemFile) ||
+				errors.Is(err, srtm.ErrOffline) {
+				return nil, ErrNoOverviewData
+			}
+
+			return nil, err
+		}
+	}
+
+	n := int(math.Round(3600 / level.ArcSeconds))
+	pixel := 1 / float64(n)
+	samples := int(math.Min(math.Round(level.Resolution/heightDataResolution), maxOverviewSamples))
+
+	noData := overviewNoData
+	raster := &geotiff.Raster{
+		Width:       n,
+		Height:      n,
+		Data:        make([]float32, n*n),
+		Lon:         float64(lon),
+		Lat:         float64(lat + 1),
+		PixelWidth:  pixel,
+		PixelHeight: pixel,
+		NoData:      &noData,
+	}
+
+	valid := 0
+
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			var sum float64
+			var count int
+
+			for i := 0; i < samples; i++ {
+				for j := 0; j < samples; j++ {
+					pLat := raster.Lat - (float64(row)+(float64(i)+0.5)/float64(samples))*pixel
+					pLon := raster.Lon + (float64(col)+(float64(j)+0.5)/float64(samples))*pixel
+
+					e, _, err := t.ElevationDataset.ElevationAt(pLat, pLon)
+
+					if err == nil {
+						sum += float64(e)
+						count++
+					}
+				}
+			}
+
+			if count == 0 {
+				raster.Data[row*n+col] = overviewNoData
+				continue
+			}
+
+			raster.Data[row*n+col] = float32(math.Round(sum / float64(count)))
+			valid++
+		}
+	}
+
+	if valid == 0 {
+		return nil, ErrNoOverviewData
+	}
+
+	return raster, nil
+}
+
+// forPixelSize Return a generator reading from the coarsest overview whose resolution is not bigger than
+// the pixel size, in meters, of the image being rendered. Coordinates without overview file, outside the area
+// the overviews were generated for, are read from the source dataset, whose files are downloaded
+func (t Generator) forPixelSize(pixelSize float64) Generator {
+	var selected *Overview
+
+	for i, overview := range t.Overviews {
+		if overview.Level.Resolution <= pixelSize &&
+			(selected == nil || overview.Level.Resolution > selected.Level.Resolution) {
+			selected = &t.Overviews[i]
+		}
+	}
+
+	if selected == nil {
+		return t
+	}
+
+	log.Debugf("Using %s overview for pixel size %f", selected.Level.Name, pixelSize)
+
+	g := t
+	g.ElevationDataset = overviewSource{overview: selected.Source, source: t.ElevationDataset}
+	g.sampleSpacing = selected.Level.Resolution
+
+	return g
+}
+
+// overviewSource Overview level falling back to the source dataset where no overview file covers a coordinate
+type overviewSource struct {
+	overview ElevationSource
+	source   ElevationSource
+}
+
+// ElevationAt Return the elevation of a coordinate from the overview, or from the source dataset when no
+// overview file covers it. Voids inside overview files are kept
+func (s overviewSource) ElevationAt(lat, lon float64) (int16, int, error) {
+	e, res, err := s.overview.ElevationAt(lat, lon)
+
+	if errors.Is(err, geotiff.ErrNotCovered) {
+		return s.source.ElevationAt(lat, lon)
+	}
+
+	return e, res, err
+}
+
+// covers Check if an overview file covers a coordinate, so the source file of its cell is not needed
+func (s overviewSource) covers(lat, lon float64) bool {
+	_, _, err := s.overview.ElevationAt(lat, lon)
+
+	return !errors.Is(err, geotiff.ErrNotCovered)
+}
+
+// Close Do nothing, since the overview and the source dataset are closed by their owners
+func (s overviewSource) Close() error {
+	return nil
+}
+
+// atPixelSize Generator reading the best overview for a pixel size (see forPixelSize) and sampling every
+// pixelSize meters when pixels are bigger than the resolution of the dataset, so elevation grids have about one
+// cell per pixel instead of one per dataset post
+func (t Generator) atPixelSize(pixelSize float64) Generator {
+	g := t.forPixelSize(pixelSize)
+
+	if pixelSize > g.spacing() {
+		g.sampleSpacing = pixelSize
+	}
+
+	return g
+}
+
+// spacing Distance in meters between two height profile samples
+func (t Generator) spacing() float64 {
+	if t.sampleSpacing > 0 {
+		return t.sampleSpacing
+	}
+
+	return heightDataResolution
+}
+
+func overviewFileName(lat, lon int) string {
+	ns, ew := "N", "E"
+
+	if lat < 0 {
+		ns = "S"
+	}
+
+	if lon < 0 {
+		ew = "W"
+	}
+
+	return fmt.Sprintf("%s%02d%s%03d.tif", ns, abs(lat), ew, abs(lon))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
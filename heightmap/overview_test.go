@@ -0,0 +1,197 @@
+package heightmap
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/geovannyAvelar/lukla/geotiff"
+	"github.com/geovannyAvelar/lukla/srtm"
+)
+
+// fakeElevationSource Elevation source computing elevations with a function. Coordinates where the function
+// returns false have no data
+type fakeElevationSource func(lat, lon float64) (int16, bool)
+
+func (f fakeElevationSource) ElevationAt(lat, lon float64) (int16, int, error) {
+	e, ok := f(lat, lon)
+
+	if !ok {
+		return 0, 0, errors.New("void")
+	}
+
+	return e, 1, nil
+}
+
+func (f fakeElevationSource) Close() error {
+	return nil
+}
+
+func TestCreateOverviewCell(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			if lon >= 10.5 {
+				return 0, false
+			}
+
+			return 100, true
+		}),
+	}
+
+	level, _ := ParseOverviewLevel("1km")
+	raster, err := heightmapGen.createOverviewCell(level, 45, 10)
+
+	if err != nil {
+		t.Fatalf("cannot create overview cell. Cause: %s", err)
+	}
+
+	if raster.Width != 120 || raster.Height != 120 || raster.Lat != 46 || raster.Lon != 10 {
+		t.Errorf("unexpected overview raster %dx%d at (%f, %f)", raster.Width, raster.Height, raster.Lat,
+			raster.Lon)
+	}
+
+	if raster.At(0, 0) != 100 || raster.At(119, 119) != overviewNoData {
+		t.Errorf("expected 100 and no data but received %f and %f", raster.At(0, 0), raster.At(119, 119))
+	}
+}
+
+func TestCreateOverviewCellWithoutData(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			return 0, false
+		}),
+	}
+
+	level, _ := ParseOverviewLevel("1km")
+
+	if _, err := heightmapGen.createOverviewCell(level, 0, 0); !errors.Is(err, ErrNoOverviewData) {
+		t.Errorf("expected no overview data error but received %v", err)
+	}
+}
+
+func TestGenerateOverviews(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			return int16(lat), lat >= 0
+		}),
+	}
+
+	level, _ := ParseOverviewLevel("1km")
+	err := heightmapGen.GenerateOverviews(dir, []OverviewLevel{level}, -1, -1, 1, 1)
+
+	if err != nil {
+		t.Fatalf("cannot generate overviews. Cause: %s", err)
+	}
+
+	for _, name := range []string{"N00E000.tif", "N00W001.tif"} {
+		if _, err := os.Stat(filepath.Join(dir, "1km", name)); err != nil {
+			t.Errorf("overview file %s not created", name)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "1km", "S01E000.tif")); err == nil {
+		t.Error("overview file without data created")
+	}
+}
+
+func TestForPixelSize(t *testing.T) {
+	t.Parallel()
+
+	base := fakeElevationSource(func(lat, lon float64) (int16, bool) { return 1, true })
+	var overviews []Overview
+
+	for i, level := range OverviewLevels {
+		e := int16(i + 2)
+		overviews = append(overviews, Overview{Level: level, Source: fakeElevationSource(
+			func(lat, lon float64) (int16, bool) { return e, true })})
+	}
+
+	heightmapGen := Generator{ElevationDataset: base, Overviews: overviews}
+
+	tests := []struct {
+		pixelSize float64
+		elevation int16
+		spacing   float64
+	}{
+		{38, 1, heightDataResolution},
+		{153, 2, 90},
+		{611, 3, 250},
+		{4891, 4, 1000},
+	}
+
+	for _, test := range tests {
+		g := heightmapGen.forPixelSize(test.pixelSize)
+		e, _, _ := g.ElevationDataset.ElevationAt(0, 0)
+
+		if e != test.elevation || g.spacing() != test.spacing {
+			t.Errorf("pixel size %f: expected source %d with spacing %f but received %d with %f",
+				test.pixelSize, test.elevation, test.spacing, e, g.spacing())
+		}
+	}
+}
+
+func TestCreateOverviewCellOffline(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			return 100, true
+		}),
+		SrtmDownloader: &srtm.Downloader{Dir: t.TempDir(), HttpClient: http.DefaultClient, Offline: true},
+	}
+
+	level, _ := ParseOverviewLevel("1km")
+
+	if _, err := heightmapGen.createOverviewCell(level, 27, 86); !errors.Is(err, ErrNoOverviewData) {
+		t.Errorf("expected no overview data error but received %v", err)
+	}
+}
+
+func TestForPixelSizeOutsideOverview(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			return int16(lat), lat >= 0
+		}),
+	}
+
+	level, _ := ParseOverviewLevel("1km")
+
+	if err := heightmapGen.GenerateOverviews(dir, []OverviewLevel{level}, 0, 0, 1, 1); err != nil {
+		t.Fatalf("cannot generate overviews. Cause: %s", err)
+	}
+
+	overview, err := geotiff.OpenDataDir(filepath.Join(dir, level.Name))
+
+	if err != nil {
+		t.Fatalf("cannot open overview. Cause: %s", err)
+	}
+
+	defer overview.Close()
+
+	heightmapGen.ElevationDataset = fakeElevationSource(func(lat, lon float64) (int16, bool) {
+		return 500, true
+	})
+	heightmapGen.Overviews = []Overview{{Level: level, Source: overview}}
+
+	g := heightmapGen.forPixelSize(level.Resolution)
+
+	if e, _, err := g.ElevationDataset.ElevationAt(0.5, 0.5); err != nil || e != 0 {
+		t.Errorf("expected the overview elevation 0 inside the overview but received %d (%v)", e, err)
+	}
+
+	if e, _, err := g.ElevationDataset.ElevationAt(10.5, 10.5); err != nil || e != 500 {
+		t.Errorf("expected the source elevation 500 outside the overview but received %d (%v)", e, err)
+	}
+}
@@ -0,0 +1,153 @@
+package heightmap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrRenderQueueFull = errors.New("render queue is full")
+
+// RenderQueue Renders tiles with a bounded concurrency. Concurrent requests of the same tile wait for a single
+// render, and renders are rejected with ErrRenderQueueFull when too many renders are waiting
+type RenderQueue struct {
+	mutex sync.Mutex
+	calls map[string]*renderCall
+	slots chan struct{}
+	// pending Renders running or waiting for a slot
+	pending int
+	// maxPending Maximum renders running or waiting. Zero is unlimited
+	maxPending int
+}
+
+// renderCall Render shared by the concurrent requests of a tile, or of the tiles of a metatile
+type renderCall struct {
+	done  chan struct{}
+	tiles map[string][]byte
+	err   error
+}
+
+// NewRenderQueue Create a queue running at most concurrency renders, with at most queueSize renders waiting. Zero
+// or less does not limit the waiting renders
+func NewRenderQueue(concurrency, queueSize int) *RenderQueue {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	q := &RenderQueue{calls: map[string]*renderCall{}, slots: make(chan struct{}, concurrency)}
+
+	if queueSize > 0 {
+		q.maxPending = concurrency + queueSize
+	}
+
+	return q
+}
+
+// Do Render the tiles of a key (a tile or a metatile), or wait for the render of the key already in progress,
+// and return the tile of tileKey. The optional save function stores the rendered tiles in the background.
+// Requests of the key are answered with the rendered tiles until it returns, so they are never rendered again
+// before they are cached
+func (q *RenderQueue) Do(key, tileKey string, render func() (map[string][]byte, error),
+	save func(map[string][]byte)) ([]byte, error) {
+	q.mutex.Lock()
+
+	if call, ok := q.calls[key]; ok {
+		q.mutex.Unlock()
+		<-call.done
+
+		return call.tile(tileKey)
+	}
+
+	if q.maxPending > 0 && q.pending >= q.maxPending {
+		q.mutex.Unlock()
+		return nil, ErrRenderQueueFull
+	}
+
+	call := &renderCall{done: make(chan struct{})}
+	q.calls[key] = call
+	q.pending++
+	q.mutex.Unlock()
+
+	q.slots <- struct{}{}
+	call.tiles, call.err = render()
+	<-q.slots
+
+	q.mutex.Lock()
+	q.pending--
+	q.mutex.Unlock()
+
+	close(call.done)
+
+	if call.err != nil || save == nil {
+		q.forget(key)
+		return call.tile(tileKey)
+	}
+
+	go func() {
+		defer q.forget(key)
+		save(call.tiles)
+	}()
+
+	return call.tile(tileKey)
+}
+
+func (q *RenderQueue) forget(key string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	delete(q.calls, key)
+}
+
+// tile Rendered tile of a key
+func (c *renderCall) tile(tileKey string) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	b, ok := c.tiles[tileKey]
+
+	if !ok {
+		return nil, fmt.Errorf("tile %s was not rendered", tileKey)
+	}
+
+	return b, nil
+}
+
+// renderTiles Render the tiles of a key through the render queue of the generator, saving them in the
+// background, and return the tile of tileKey. Tiles are rendered directly when the generator has no queue
+func (t Generator) renderTiles(key, tileKey string, render func() (map[string][]byte, error),
+	save func(map[string][]byte)) ([]byte, error) {
+	if t.Renders == nil {
+		call := &renderCall{}
+		call.tiles, call.err = render()
+
+		if call.err == nil && save != nil {
+			go save(call.tiles)
+		}
+
+		return call.tile(tileKey)
+	}
+
+	return t.Renders.Do(key, tileKey, render, save)
+}
+
+// renderTile Render a single tile through the render queue of the generator, saving it in the background
+func (t Generator) renderTile(key string, render func() ([]byte, error), save func([]byte)) ([]byte, error) {
+	var saveTiles func(map[string][]byte)
+
+	if save != nil {
+		saveTiles = func(tiles map[string][]byte) {
+			save(tiles[key])
+		}
+	}
+
+	return t.renderTiles(key, key, func() (map[string][]byte, error) {
+		b, err := render()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string][]byte{key: b}, nil
+	}, saveTiles)
+}
@@ -0,0 +1,207 @@
+package heightmap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRenderQueueCoalescesRenders(t *testing.T) {
+	t.Parallel()
+
+	q := NewRenderQueue(4, 4)
+	release := make(chan struct{})
+	var renders int32
+
+	render := func() ([]byte, error) {
+		atomic.AddInt32(&renders, 1)
+		<-release
+		return []byte{1}, nil
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if b, err := q.Do("tile", "tile", singleTile("tile", render), nil); err != nil || len(b) != 1 {
+				t.Errorf("unexpected render %v. Cause: %v", b, err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if renders != 1 {
+		t.Errorf("expected a single render, got %d", renders)
+	}
+}
+
+func TestRenderQueueFull(t *testing.T) {
+	t.Parallel()
+
+	q := NewRenderQueue(1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+
+	render := func() ([]byte, error) {
+		started <- struct{}{}
+		<-release
+		return []byte{1}, nil
+	}
+
+	go q.Do("a", "a", singleTile("a", render), nil)
+	<-started
+
+	go q.Do("b", "b", singleTile("b", render), nil)
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		q.mutex.Lock()
+		pending := q.pending
+		q.mutex.Unlock()
+
+		if pending == 2 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := q.Do("c", "c", singleTile("c", render), nil); !errors.Is(err, ErrRenderQueueFull) {
+		t.Errorf("expected ErrRenderQueueFull, got %v", err)
+	}
+
+	close(release)
+
+	// Requests of a tile being rendered wait for it instead of being rejected
+	if b, err := q.Do("a", "a", singleTile("a", render), nil); err != nil || len(b) != 1 {
+		t.Errorf("unexpected render %v. Cause: %v", b, err)
+	}
+}
+
+func TestRenderQueueWithoutLimit(t *testing.T) {
+	t.Parallel()
+
+	q := NewRenderQueue(1, 0)
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+
+	go q.Do("a", "a", singleTile("a", func() ([]byte, error) {
+		started <- struct{}{}
+		<-release
+		return []byte{1}, nil
+	}), nil)
+	<-started
+
+	errs := make(chan error, 8)
+
+	for i := 0; i < 8; i++ {
+		key := fmt.Sprintf("b%d", i)
+
+		go func() {
+			_, err := q.Do(key, key, singleTile(key, func() ([]byte, error) { return []byte{1}, nil }), nil)
+			errs <- err
+		}()
+	}
+
+	close(release)
+
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("expected waiting renders not to be limited, got %v", err)
+		}
+	}
+}
+
+func TestRenderQueueWaitsForSave(t *testing.T) {
+	t.Parallel()
+
+	q := NewRenderQueue(1, 1)
+	saved := make(chan struct{})
+	var renders int32
+
+	render := func() ([]byte, error) {
+		atomic.AddInt32(&renders, 1)
+		return []byte{1}, nil
+	}
+
+	save := func(map[string][]byte) {
+		<-saved
+	}
+
+	q.Do("tile", "tile", singleTile("tile", render), save)
+	q.Do("tile", "tile", singleTile("tile", render), save)
+
+	if renders != 1 {
+		t.Errorf("expected the tile to be served from memory until it is saved, got %d renders", renders)
+	}
+
+	close(saved)
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		q.mutex.Lock()
+		n := len(q.calls)
+		q.mutex.Unlock()
+
+		if n == 0 {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Error("render was not forgotten after the tile was saved")
+}
+
+func TestRenderQueueSharesMetatiles(t *testing.T) {
+	t.Parallel()
+
+	q := NewRenderQueue(1, 1)
+	var renders int32
+
+	render := func() (map[string][]byte, error) {
+		atomic.AddInt32(&renders, 1)
+		time.Sleep(20 * time.Millisecond)
+		return map[string][]byte{"a": {1}, "b": {2}}, nil
+	}
+
+	var wg sync.WaitGroup
+
+	for tile, expected := range map[string]byte{"a": 1, "b": 2} {
+		wg.Add(1)
+
+		go func(tile string, expected byte) {
+			defer wg.Done()
+
+			if b, err := q.Do("meta", tile, render, nil); err != nil || len(b) != 1 || b[0] != expected {
+				t.Errorf("unexpected tile %s %v. Cause: %v", tile, b, err)
+			}
+		}(tile, expected)
+	}
+
+	wg.Wait()
+
+	if _, err := q.Do("meta", "c", render, nil); err == nil {
+		t.Error("expected an error for a tile missing from the metatile")
+	}
+
+	if renders > 2 {
+		t.Errorf("expected the tiles of a metatile to share its render, got %d renders", renders)
+	}
+}
+
+// singleTile Render function of a single tile
+func singleTile(key string, render func() ([]byte, error)) func() (map[string][]byte, error) {
+	return func() (map[string][]byte, error) {
+		b, err := render()
+		return map[string][]byte{key: b}, err
+	}
+}
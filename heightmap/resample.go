@@ -0,0 +1,266 @@
+package heightmap
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"math"
+
+	"github.com/nfnt/resize"
+	"github.com/tidwall/geodesic"
+)
+
+// Maximum elevations averaged along each side of a pixel bigger than the DEM resolution
+const maxAreaSamples = 4
+
+// elevationRaster Elevations of the pixels of an image, row by row, with the coordinates of the centers of its
+// rows and columns
+type elevationRaster struct {
+	Width, Height int
+	Lats          []float64
+	Lons          []float64
+	Elevations    []float64
+}
+
+func (r *elevationRaster) at(x, y int) float64 {
+	return r.Elevations[y*r.Width+x]
+}
+
+// point Point of a pixel, with its elevation rounded to meters
+func (r *elevationRaster) point(x, y int) *Point {
+	return &Point{X: y, Y: x, Lat: r.Lats[y], Lon: r.Lons[x], Elevation: int16(math.Round(r.at(x, y)))}
+}
+
+// rasterExtent Area sampled by a raster. grid returns the latitudes of the rows and longitudes of the columns of
+// the centers of the cells of the area divided in rows x cols cells and side is the side of the area in meters
+type rasterExtent struct {
+	side float64
+	grid func(rows, cols int) ([]float64, []float64)
+}
+
+// squareExtent Square whose upper left corner is a coordinate (see rasterGrid)
+func squareExtent(lat, lon, side float64) rasterExtent {
+	return rasterExtent{side: side, grid: func(rows, cols int) ([]float64, []float64) {
+		return rasterGrid(lat, lon, side, rows, cols)
+	}}
+}
+
+// mercatorExtent Area of a zoom level between two corners in tile coordinates, which may be fractional. Its
+// rows and columns are evenly spaced in Web Mercator, as the pixels of OSM tiles, so the pixels of a tile are
+// the same whether it is sampled alone or inside a bigger extent
+func mercatorExtent(z int, minX, minY, maxX, maxY float64) rasterExtent {
+	lon := tileLon(z, (minX+maxX)/2)
+
+	var side float64
+	geodesic.WGS84.Inverse(tileLat(z, minY), lon, tileLat(z, maxY), lon, &side, nil, nil)
+
+	return rasterExtent{side: side, grid: func(rows, cols int) ([]float64, []float64) {
+		lats := make([]float64, rows)
+		lons := make([]float64, cols)
+
+		for x := range lats {
+			lats[x] = tileLat(z, minY+(float64(x)+0.5)*(maxY-minY)/float64(rows))
+		}
+
+		for y := range lons {
+			lons[y] = tileLon(z, minX+(float64(y)+0.5)*(maxX-minX)/float64(cols))
+		}
+
+		return lats, lons
+	}}
+}
+
+// tileLat Latitude of a tile coordinate of a zoom level
+func tileLat(z int, y float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/float64(int(1)<<z)))) * 180 / math.Pi
+}
+
+// tileLon Longitude of a tile coordinate of a zoom level, wrapped around the antimeridian
+func tileLon(z int, x float64) float64 {
+	lon := x/float64(int(1)<<z)*360 - 180
+
+	return math.Mod(math.Mod(lon+180, 360)+360, 360) - 180
+}
+
+// nativeSize Side in pixels of a square sampled at the resolution of the dataset
+func (t Generator) nativeSize(side float64) int {
+	return int(math.Max(1, math.Floor(side/t.spacing())))
+}
+
+// outputSize Width and height of the image of a square, which are always the ones of the resolution config.
+// Zero dimensions use the resolution of the dataset. With IgnoreWhenOriginalImageIsSmaller, dimensions bigger
+// than the resolution of the dataset use it too, so images are never upsampled
+func (t Generator) outputSize(side float64, conf ResolutionConfig) (int, int) {
+	native := t.nativeSize(side)
+	width, height := conf.Width, conf.Height
+
+	if width <= 0 || (conf.IgnoreWhenOriginalImageIsSmaller && width > native) {
+		width = native
+	}
+
+	if height <= 0 || (conf.IgnoreWhenOriginalImageIsSmaller && height > native) {
+		height = native
+	}
+
+	return width, height
+}
+
+// sampleRaster Sample the elevations of a square whose upper left corner is a coordinate (see sampleExtent)
+func (t Generator) sampleRaster(lat, lon, side float64, conf ResolutionConfig) (*elevationRaster, error) {
+	return t.sampleExtent(squareExtent(lat, lon, side), conf)
+}
+
+// sampleExtent Sample the elevations of an area at the pixel grid of its image (see outputSize). Pixels bigger
+// than the dataset resolution average the elevations inside them, up to maxAreaSamples x maxAreaSamples. Smaller
+// pixels are upsampled from the dataset posts, interpolated bilinearly with ForceInterpolation or copied from the
+// nearest post otherwise
+func (t Generator) sampleExtent(extent rasterExtent, conf ResolutionConfig) (*elevationRaster, error) {
+	width, height := t.outputSize(extent.side, conf)
+	native := t.nativeSize(extent.side)
+
+	raster := &elevationRaster{Width: width, Height: height, Elevations: make([]float64, width*height)}
+	raster.Lats, raster.Lons = extent.grid(height, width)
+
+	var err error
+
+	if width <= native && height <= native {
+		err = t.sampleArea(extent, raster)
+	} else {
+		err = t.sampleUpsampled(extent, native, raster, conf.ForceInterpolation)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return raster, nil
+}
+
+// sampleArea Fill each pixel of a raster with the mean of kx x ky elevations evenly spread inside it
+func (t Generator) sampleArea(extent rasterExtent, raster *elevationRaster) error {
+	kx := areaSamples(extent.side/float64(raster.Width), t.spacing())
+	ky := areaSamples(extent.side/float64(raster.Height), t.spacing())
+
+	lats, lons := extent.grid(raster.Height*ky, raster.Width*kx)
+
+	if err := t.downloadProfileFiles(lats, lons); err != nil {
+		return err
+	}
+
+	parallelRows(raster.Height, func() func(y int) {
+		elevations := make([]int16, len(lons))
+
+		return func(y int) {
+			row := raster.Elevations[y*raster.Width : (y+1)*raster.Width]
+
+			for i := 0; i < ky; i++ {
+				readRow(t.ElevationDataset, lats[y*ky+i], lons, elevations)
+
+				for c, e := range elevations {
+					row[c/kx] += float64(e)
+				}
+			}
+
+			for x := range row {
+				row[x] /= float64(kx * ky)
+			}
+		}
+	})
+
+	return nil
+}
+
+// sampleUpsampled Fill a raster bigger than the native x native posts of the dataset covering an area
+func (t Generator) sampleUpsampled(extent rasterExtent, native int, raster *elevationRaster,
+	interpolate bool) error {
+	lats, lons := extent.grid(native, native)
+
+	if err := t.downloadProfileFiles(lats, lons); err != nil {
+		return err
+	}
+
+	posts := make([]float64, native*native)
+
+	t.sampleRows(lats, lons, func(x int, elevations []int16) {
+		for y, e := range elevations {
+			posts[x*native+y] = float64(e)
+		}
+	})
+
+	post := func(row, col int) float64 {
+		return posts[clampInt(row, 0, native-1)*native+clampInt(col, 0, native-1)]
+	}
+
+	for y := 0; y < raster.Height; y++ {
+		// Position of the pixel center in the posts grid, whose posts are at the centers of their cells
+		fy := (float64(y)+0.5)*float64(native)/float64(raster.Height) - 0.5
+
+		for x := 0; x < raster.Width; x++ {
+			fx := (float64(x)+0.5)*float64(native)/float64(raster.Width) - 0.5
+
+			if !interpolate {
+				raster.Elevations[y*raster.Width+x] = post(int(math.Round(fy)), int(math.Round(fx)))
+				continue
+			}
+
+			row, col := int(math.Floor(fy)), int(math.Floor(fx))
+			dy, dx := fy-float64(row), fx-float64(col)
+
+			top := post(row, col)*(1-dx) + post(row, col+1)*dx
+			bottom := post(row+1, col)*(1-dx) + post(row+1, col+1)*dx
+
+			raster.Elevations[y*raster.Width+x] = top*(1-dy) + bottom*dy
+		}
+	}
+
+	return nil
+}
+
+// areaSamples Elevations averaged along a side of a pixel
+func areaSamples(pixelSize, spacing float64) int {
+	k := int(math.Ceil(pixelSize/spacing - 1e-9))
+
+	return clampInt(k, 1, maxAreaSamples)
+}
+
+// encodePNG Encode an image as PNG with the size of the resolution config (see outputSize, where the image size
+// is the resolution of the dataset). Images bigger than the resolution are downsampled averaging the pixels
+// inside each output pixel. Smaller images are upsampled bilinearly with ForceInterpolation or from the nearest
+// pixel otherwise
+func encodePNG(img image.Image, conf ResolutionConfig) ([]byte, error) {
+	size := img.Bounds().Size()
+	width, height := conf.Width, conf.Height
+
+	if width <= 0 || (conf.IgnoreWhenOriginalImageIsSmaller && width > size.X) {
+		width = size.X
+	}
+
+	if height <= 0 || (conf.IgnoreWhenOriginalImageIsSmaller && height > size.Y) {
+		height = size.Y
+	}
+
+	if width != size.X || height != size.Y {
+		// Downsampling with the nearest neighbour filter averages every pixel under its footprint
+		filter := resize.NearestNeighbor
+
+		if conf.ForceInterpolation && (width > size.X || height > size.Y) {
+			filter = resize.Bilinear
+		}
+
+		img = resize.Resize(uint(width), uint(height), img, filter)
+	}
+
+	return encodeImage(img)
+}
+
+// encodeImage Encode an image as PNG without resizing it
+func encodeImage(img image.Image) ([]byte, error) {
+	var b bytes.Buffer
+
+	if err := png.Encode(&b, img); err != nil {
+		return []byte{}, errors.New("cannot encode PNG image")
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,204 @@
+package heightmap
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// Side of the squares of the resampling tests, 100 posts of the dataset
+const resampleSide = 3000.0
+
+func TestCreateHeightMapImageSize(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+		return int16(lon * 10), true
+	})}
+
+	tests := map[string]struct {
+		conf          ResolutionConfig
+		width, height int
+	}{
+		"upsampled":    {ResolutionConfig{Width: 512, Height: 512}, 512, 512},
+		"interpolated": {ResolutionConfig{Width: 512, Height: 512, ForceInterpolation: true}, 512, 512},
+		"downsampled":  {ResolutionConfig{Width: 64, Height: 64}, 64, 64},
+		"rectangular":  {ResolutionConfig{Width: 200, Height: 50}, 200, 50},
+		"native":       {ResolutionConfig{}, 100, 100},
+		"not upsampled": {ResolutionConfig{Width: 512, Height: 512, IgnoreWhenOriginalImageIsSmaller: true},
+			100, 100},
+		"downsampled anyway": {ResolutionConfig{Width: 64, Height: 64, IgnoreWhenOriginalImageIsSmaller: true},
+			64, 64},
+		"same as the dataset": {ResolutionConfig{Width: 100, Height: 100}, 100, 100},
+	}
+
+	for name, test := range tests {
+		b, err := heightmapGen.CreateHeightMapImage(27.9, 86.9, resampleSide, test.conf)
+
+		if err != nil {
+			t.Fatalf("%s: cannot create heightmap. Cause: %s", name, err)
+		}
+
+		// A single image is encoded, with nothing after its end
+		if bytes.Count(b, []byte("IHDR")) != 1 || !bytes.HasSuffix(b, []byte("IEND\xaeB`\x82")) {
+			t.Errorf("%s: expected a single PNG image", name)
+		}
+
+		img, err := png.Decode(bytes.NewReader(b))
+
+		if err != nil {
+			t.Fatalf("%s: cannot decode heightmap. Cause: %s", name, err)
+		}
+
+		if size := img.Bounds().Size(); size.X != test.width || size.Y != test.height {
+			t.Errorf("%s: expected a %dx%d image, got %dx%d", name, test.width, test.height, size.X, size.Y)
+		}
+	}
+}
+
+func TestCreateEncodedHeightMapImageSize(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+		return 1000, true
+	})}
+
+	b, err := heightmapGen.CreateEncodedHeightMapImage(27.9, 86.9, resampleSide,
+		ResolutionConfig{Width: 256, Height: 256}, TerrainRGB)
+
+	if err != nil {
+		t.Fatalf("cannot create heightmap. Cause: %s", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(b))
+
+	if err != nil || img.Bounds().Dx() != 256 || img.Bounds().Dy() != 256 {
+		t.Fatalf("expected a 256x256 image. Cause: %v", err)
+	}
+
+	r, g, bl, _ := img.At(128, 128).RGBA()
+
+	if e := -10000 + float64((r>>8)*65536+(g>>8)*256+(bl>>8))*0.1; math.Abs(e-1000) > 0.1 {
+		t.Errorf("expected elevation 1000, got %f", e)
+	}
+}
+
+func TestGetEncodedTileHeightmapMercatorExtent(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			return int16(math.Round((lat - 59) * 1000)), true
+		}),
+		Dir: t.TempDir(),
+	}
+
+	// Tiles at 60° cover half the ground of a tile at the equator
+	b, err := heightmapGen.GetEncodedTileHeightmap(10, 500, 300, 16, Terrarium)
+
+	if err != nil {
+		t.Fatalf("cannot create encoded tile. Cause: %s", err)
+	}
+
+	img := decodeTestTile(t, b)
+
+	for _, row := range []int{0, 8, 15} {
+		r, g, bl, _ := img.At(8, row).RGBA()
+		e := float64((r>>8)*256+(g>>8)) + float64(bl>>8)/256 - 32768
+		expected := (tileLat(10, 300+(float64(row)+0.5)/16) - 59) * 1000
+
+		if math.Abs(e-expected) > 3 {
+			t.Errorf("row %d: expected elevation %f, got %f", row, expected, e)
+		}
+	}
+
+	waitForTileManifest(t, formatTilePath(heightmapGen.layerDir(string(Terrarium)), 500, 300, 10, 16))
+}
+
+func TestSampleRasterAreaAveraging(t *testing.T) {
+	t.Parallel()
+
+	// Stripes of 0 and 100 meters of about 40 meters, narrower than the pixels
+	heightmapGen := Generator{ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+		if int(math.Floor(lon*1e5/41))%2 == 0 {
+			return 0, true
+		}
+
+		return 100, true
+	})}
+
+	raster, err := heightmapGen.sampleRaster(27.9, 86.9, resampleSide, ResolutionConfig{Width: 25, Height: 25})
+
+	if err != nil {
+		t.Fatalf("cannot sample raster. Cause: %s", err)
+	}
+
+	for i, e := range raster.Elevations {
+		if e < 25 || e > 75 {
+			t.Fatalf("expected pixel %d to average the stripes, got %f", i, e)
+		}
+	}
+}
+
+func TestSampleRasterUpsampling(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+		return int16((lon - 86.9) * 1e5), true
+	})}
+
+	nearest, err := heightmapGen.sampleRaster(27.9, 86.9, resampleSide, ResolutionConfig{Width: 400, Height: 400})
+
+	if err != nil {
+		t.Fatalf("cannot sample raster. Cause: %s", err)
+	}
+
+	interpolated, err := heightmapGen.sampleRaster(27.9, 86.9, resampleSide,
+		ResolutionConfig{Width: 400, Height: 400, ForceInterpolation: true})
+
+	if err != nil {
+		t.Fatalf("cannot sample raster. Cause: %s", err)
+	}
+
+	// Each post is copied to 4x4 pixels without interpolation
+	if nearest.at(0, 0) != nearest.at(3, 0) || nearest.at(3, 0) == nearest.at(4, 0) {
+		t.Errorf("expected blocks of 4 pixels, got %v", nearest.Elevations[:8])
+	}
+
+	if interpolated.at(5, 0) <= interpolated.at(4, 0) || interpolated.at(6, 0) <= interpolated.at(5, 0) {
+		t.Errorf("expected interpolated pixels to grow eastwards, got %v", interpolated.Elevations[:8])
+	}
+}
+
+func TestEncodePNG(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+
+	tests := map[string]struct {
+		conf ResolutionConfig
+		size int
+	}{
+		"upsampled":     {ResolutionConfig{Width: 20, Height: 20}, 20},
+		"interpolated":  {ResolutionConfig{Width: 20, Height: 20, ForceInterpolation: true}, 20},
+		"downsampled":   {ResolutionConfig{Width: 5, Height: 5}, 5},
+		"not upsampled": {ResolutionConfig{Width: 20, Height: 20, IgnoreWhenOriginalImageIsSmaller: true}, 10},
+		"original":      {ResolutionConfig{}, 10},
+	}
+
+	for name, test := range tests {
+		b, err := encodePNG(img, test.conf)
+
+		if err != nil {
+			t.Fatalf("%s: cannot encode image. Cause: %s", name, err)
+		}
+
+		decoded, err := png.Decode(bytes.NewReader(b))
+
+		if err != nil || decoded.Bounds().Dx() != test.size || decoded.Bounds().Dy() != test.size {
+			t.Errorf("%s: expected a %dx%d image. Cause: %v", name, test.size, test.size, err)
+		}
+	}
+}
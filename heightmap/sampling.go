@@ -0,0 +1,152 @@
+package heightmap
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/tidwall/geodesic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// profileGrid Latitudes of the rows and longitudes of the columns of a height profile with n x n points spaced
+// by spacing meters, starting at its corner
+func profileGrid(lat, lon, spacing float64, n int) ([]float64, []float64) {
+	return gridCoordinates(lat, lon, gridOffsets(n, spacing, 0), gridOffsets(n, spacing, 0))
+}
+
+// rasterGrid Latitudes of the rows and longitudes of the columns of the centers of the cells of a square divided
+// in rows x cols cells
+func rasterGrid(lat, lon, side float64, rows, cols int) ([]float64, []float64) {
+	return gridCoordinates(lat, lon, gridOffsets(rows, side/float64(rows), 0.5),
+		gridOffsets(cols, side/float64(cols), 0.5))
+}
+
+// gridOffsets Distances in meters of n points spaced by spacing meters, shifted by a fraction of the spacing
+func gridOffsets(n int, spacing, shift float64) []float64 {
+	offsets := make([]float64, n)
+
+	for i := range offsets {
+		offsets[i] = (float64(i) + shift) * spacing
+	}
+
+	return offsets
+}
+
+// gridCoordinates Latitudes of the rows and longitudes of the columns of a grid whose points are offset from a
+// corner. Rows are walked southwards from the corner and columns eastwards along the middle row, so every row
+// shares the same longitudes and each point costs no geodesic computation
+func gridCoordinates(lat, lon float64, rowOffsets, colOffsets []float64) ([]float64, []float64) {
+	lats := make([]float64, len(rowOffsets))
+	lons := make([]float64, len(colOffsets))
+
+	for x, offset := range rowOffsets {
+		geodesic.WGS84.Direct(lat, lon, southAzimuth, offset, &lats[x], nil, nil)
+	}
+
+	if len(lats) == 0 {
+		return lats, lons
+	}
+
+	midLat := lats[len(lats)/2]
+
+	for y, offset := range colOffsets {
+		geodesic.WGS84.Direct(midLat, lon, eastAzimuth, offset, nil, &lons[y], nil)
+	}
+
+	return lats, lons
+}
+
+// downloadProfileFiles Download the DEM files of every cell of one degree covered by a height profile
+func (t Generator) downloadProfileFiles(lats, lons []float64) error {
+	if t.SrtmDownloader == nil {
+		return nil
+	}
+
+	for _, lat := range distinctCells(lats) {
+		for _, lon := range distinctCells(lons) {
+			if err := t.downloadDemFile(lat, lon); err != nil {
+				msg := "cannot download digital elevation model file for coordinate %f, %f. Cause: %s"
+				log.Debugf(msg, lat, lon, err)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// distinctCells First coordinate of each cell of one degree, in order of appearance
+func distinctCells(coordinates []float64) []float64 {
+	seen := map[float64]bool{}
+	var cells []float64
+
+	for _, c := range coordinates {
+		if cell := math.Floor(c); !seen[cell] {
+			seen[cell] = true
+			cells = append(cells, c)
+		}
+	}
+
+	return cells
+}
+
+// sampleRows Read the elevations of each row of a grid, calling processRow with the row index and its
+// elevations. Rows are read in parallel and the elevations slice is reused between rows of a goroutine
+func (t Generator) sampleRows(lats, lons []float64, processRow func(x int, elevations []int16)) {
+	parallelRows(len(lats), func() func(x int) {
+		elevations := make([]int16, len(lons))
+
+		return func(x int) {
+			readRow(t.ElevationDataset, lats[x], lons, elevations)
+			processRow(x, elevations)
+		}
+	})
+}
+
+// parallelRows Process rows in parallel, one goroutine per CPU. newWorker is called once per goroutine and
+// returns the function processing its rows, so state can be reused between rows of a goroutine
+func parallelRows(rows int, newWorker func() func(x int)) {
+	workers := runtime.NumCPU()
+
+	if workers > rows {
+		workers = rows
+	}
+
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			processRow := newWorker()
+
+			for x := range tasks {
+				processRow(x)
+			}
+		}()
+	}
+
+	for x := 0; x < rows; x++ {
+		tasks <- x
+	}
+
+	close(tasks)
+	wg.Wait()
+}
+
+// readRow Read the elevations of a row, in bulk when the source is a RowSource
+func readRow(source ElevationSource, lat float64, lons []float64, elevations []int16) {
+	if rowSource, ok := source.(RowSource); ok {
+		rowSource.ElevationsAt(lat, lons, elevations)
+		return
+	}
+
+	for y, lon := range lons {
+		elevations[y], _, _ = source.ElevationAt(lat, lon)
+	}
+}
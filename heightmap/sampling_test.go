@@ -0,0 +1,141 @@
+package heightmap
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/geovannyAvelar/lukla/srtm"
+	"github.com/petoc/hgt"
+	"github.com/tidwall/geodesic"
+)
+
+// Side of the squares sampled by the benchmarks, in meters (300x300 points)
+const benchmarkSide = 9000.0
+
+func TestProfileGrid(t *testing.T) {
+	t.Parallel()
+
+	lats, lons := profileGrid(27.9, 86.9, 30, 100)
+
+	if math.Abs(lats[0]-27.9) > 1e-9 || math.Abs(lons[0]-86.9) > 1e-9 {
+		t.Errorf("expected the grid to start at its corner, got (%f, %f)", lats[0], lons[0])
+	}
+
+	var rows, cols float64
+	geodesic.WGS84.Inverse(lats[0], lons[0], lats[99], lons[0], &rows, nil, nil)
+	geodesic.WGS84.Inverse(lats[50], lons[0], lats[50], lons[99], &cols, nil, nil)
+
+	if math.Abs(rows-99*30) > 1 || math.Abs(cols-99*30) > 1 {
+		t.Errorf("expected rows and columns spaced by 30 meters, got %f and %f meters", rows/99, cols/99)
+	}
+}
+
+func TestCreateHeightProfileVisitsEveryPoint(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+		return 100, true
+	})}
+
+	n := 50
+	visits := make([]int32, n*n)
+
+	err := heightmapGen.createHeightProfile(27.9, 86.9, float64(n*30), nil, func(p *Point, i interface{},
+		index int) error {
+		if index != p.X*n+p.Y || p.Elevation != 100 {
+			t.Errorf("unexpected point %+v with index %d", p, index)
+		}
+
+		atomic.AddInt32(&visits[index], 1)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("cannot create height profile. Cause: %s", err)
+	}
+
+	for i, v := range visits {
+		if v != 1 {
+			t.Fatalf("expected point %d to be visited once, got %d visits", i, v)
+		}
+	}
+}
+
+func BenchmarkHeightProfile(b *testing.B) {
+	dir := writeBenchmarkHgt(b)
+
+	compressed, err := srtm.OpenCompressedDataDir(dir, 0)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer compressed.Close()
+
+	dataDir, err := hgt.OpenDataDir(dir, nil)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer dataDir.Close()
+
+	sources := map[string]ElevationSource{"rows": compressed, "points": dataDir}
+
+	for name, source := range sources {
+		heightmapGen := Generator{ElevationDataset: source}
+
+		b.Run("legacy/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				legacyHeightProfile(heightmapGen, 27.9, 86.1, benchmarkSide)
+			}
+		})
+
+		b.Run("grid/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				heightmapGen.createHeightProfile(27.9, 86.1, benchmarkSide, nil,
+					func(p *Point, i interface{}, index int) error {
+						return nil
+					})
+			}
+		})
+	}
+}
+
+// legacyHeightProfile Serial walk computing each point with geodesic.WGS84.Direct and reading it with
+// ElevationAt, as height profiles were sampled before grids. Baseline of the benchmarks
+func legacyHeightProfile(t Generator, lat, lon, side float64) {
+	spacing := int(t.spacing())
+
+	for x := 0; x < int(side); x += spacing {
+		var rowLat, rowLon float64
+		geodesic.WGS84.Direct(lat, lon, southAzimuth, float64(x), &rowLat, &rowLon, nil)
+
+		for y := 0; y < int(side); y += spacing {
+			var pLat, pLon float64
+			geodesic.WGS84.Direct(rowLat, rowLon, eastAzimuth, float64(y), &pLat, &pLon, nil)
+			t.ElevationDataset.ElevationAt(pLat, pLon)
+		}
+	}
+}
+
+// writeBenchmarkHgt Write a synthetic 3 arc seconds HGT file of N27E086 to a temporary directory
+func writeBenchmarkHgt(b *testing.B) string {
+	dir := b.TempDir()
+	data := make([]byte, 1201*1201*2)
+
+	for i := 0; i < len(data); i += 2 {
+		row, col := i/2/1201, i/2%1201
+		binary.BigEndian.PutUint16(data[i:], uint16(row+col))
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "N27E086.hgt"), data, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	return dir
+}
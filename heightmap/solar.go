@@ -0,0 +1,420 @@
+package heightmap
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"time"
+
+	"github.com/geovannyAvelar/lukla/geotiff"
+	"github.com/mazznoer/colorgrad"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Solar constant in W/m²
+const solarConstant = 1361.0
+
+// MinSolarInterval Shortest interval between the sun positions of a simulated day, bounding its shadow passes
+const MinSolarInterval = 15 * time.Minute
+
+// ErrSolarIntervalTooShort Returned when the interval of a solar simulation is shorter than MinSolarInterval
+var ErrSolarIntervalTooShort = errors.New("solar interval is too short")
+
+// Maximum daily insolation, in Wh/m², represented in insolation images
+var maxRenderedInsolation = 12000.0
+
+// SolarConfig Solar simulation parameters. The simulated area is a square whose upper left corner is
+// (Lat, Lon). Shadows are cast at Time and insolation is integrated over the day of Time, in its location,
+// every Interval (default one hour, at least MinSolarInterval). Terrain up to Buffer meters (default 2000) around the square also
+// casts shadows
+type SolarConfig struct {
+	Lat, Lon float64
+	Side     float64
+	Time     time.Time
+	Interval time.Duration
+	Buffer   float64
+}
+
+// SunPosition Compute the sun azimuth (degrees clockwise from north) and elevation above the horizon (degrees)
+// for an instant and a coordinate, using the NOAA solar calculator equations. Atmospheric refraction
+// is ignored
+func SunPosition(t time.Time, lat, lon float64) (float64, float64) {
+	julianDay := float64(t.UnixNano())/float64(24*time.Hour) + 2440587.5
+	jc := (julianDay - 2451545) / 36525
+
+	meanLong := math.Mod(280.46646+jc*(36000.76983+jc*0.0003032), 360)
+	meanAnom := 357.52911 + jc*(35999.05029-0.0001537*jc)
+	eccent := 0.016708634 - jc*(0.000042037+0.0000001267*jc)
+
+	center := sinDeg(meanAnom)*(1.914602-jc*(0.004817+0.000014*jc)) +
+		sinDeg(2*meanAnom)*(0.019993-0.000101*jc) + sinDeg(3*meanAnom)*0.000289
+
+	omega := 125.04 - 1934.136*jc
+	appLong := meanLong + center - 0.00569 - 0.00478*sinDeg(omega)
+
+	meanObliq := 23 + (26+(21.448-jc*(46.815+jc*(0.00059-jc*0.001813)))/60)/60
+	obliq := meanObliq + 0.00256*cosDeg(omega)
+
+	declination := asinDeg(sinDeg(obliq) * sinDeg(appLong))
+
+	y := math.Pow(math.Tan(obliq/2*math.Pi/180), 2)
+	eqTime := 4 * (180 / math.Pi) * (y*sinDeg(2*meanLong) - 2*eccent*sinDeg(meanAnom) +
+		4*eccent*y*sinDeg(meanAnom)*cosDeg(2*meanLong) - 0.5*y*y*sinDeg(4*meanLong) -
+		1.25*eccent*eccent*sinDeg(2*meanAnom))
+
+	utc := t.UTC()
+	minutes := float64(utc.Hour()*60+utc.Minute()) + float64(utc.Second())/60
+	trueSolarTime := math.Mod(minutes+eqTime+4*lon, 1440)
+
+	if trueSolarTime < 0 {
+		trueSolarTime += 1440
+	}
+
+	hourAngle := trueSolarTime/4 - 180
+
+	cosZenith := sinDeg(lat)*sinDeg(declination) + cosDeg(lat)*cosDeg(declination)*cosDeg(hourAngle)
+	zenith := acosDeg(math.Max(-1, math.Min(1, cosZenith)))
+
+	cosAzimuth := (sinDeg(lat)*cosDeg(zenith) - sinDeg(declination)) / (cosDeg(lat) * sinDeg(zenith))
+	azimuth := acosDeg(math.Max(-1, math.Min(1, cosAzimuth)))
+
+	if hourAngle > 0 {
+		azimuth = math.Mod(azimuth+180, 360)
+	} else {
+		azimuth = math.Mod(540-azimuth, 360)
+	}
+
+	return azimuth, 90 - zenith
+}
+
+// CreateShadowMaskImage Create a PNG image where terrain in shadow at conf.Time is dark and sunlit terrain
+// is transparent
+func (t Generator) CreateShadowMaskImage(conf SolarConfig, res ResolutionConfig) ([]byte, error) {
+	raster, err := t.createShadowMaskRaster(conf)
+
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return encodePNG(shadowMaskImage(raster), res)
+}
+
+// CreateShadowMaskGeoTiff Create a GeoTIFF file where shadowed cells at conf.Time are 1 and sunlit cells are 0
+func (t Generator) CreateShadowMaskGeoTiff(conf SolarConfig) ([]byte, error) {
+	raster, err := t.createShadowMaskRaster(conf)
+
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return encodeGeoTiff(raster)
+}
+
+// CreateInsolationImage Create a PNG image with the clear sky direct insolation of a day
+func (t Generator) CreateInsolationImage(conf SolarConfig, res ResolutionConfig) ([]byte, error) {
+	raster, _, err := t.simulateSolarDay(conf, false)
+
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return encodePNG(insolationImage(raster), res)
+}
+
+// CreateInsolationGeoTiff Create a GeoTIFF file with the clear sky direct insolation of a day, in Wh/m²
+func (t Generator) CreateInsolationGeoTiff(conf SolarConfig) ([]byte, error) {
+	raster, _, err := t.simulateSolarDay(conf, false)
+
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return encodeGeoTiff(raster)
+}
+
+// CreateSolarDayFiles Simulate a whole day and return its files by name: an hourly shadow mask for each hour
+// of daylight (shadow-HHMM.png) and the daily insolation (insolation.tif and insolation.png)
+func (t Generator) CreateSolarDayFiles(conf SolarConfig, res ResolutionConfig) (map[string][]byte, error) {
+	conf.Interval = time.Hour
+
+	insolation, shadows, err := t.simulateSolarDay(conf, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+
+	for name, mask := range shadows {
+		b, err := encodePNG(shadowMaskImage(mask), res)
+
+		if err != nil {
+			return nil, err
+		}
+
+		files[name] = b
+	}
+
+	files["insolation.tif"], err = encodeGeoTiff(insolation)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files["insolation.png"], err = encodePNG(insolationImage(insolation), res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func (t Generator) createShadowMaskRaster(conf SolarConfig) (*geotiff.Raster, error) {
+	grid, buffer, n, err := t.createSolarGrid(conf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	centerLat, centerLon := grid.corner(buffer+n/2, buffer+n/2)
+	azimuth, elevation := SunPosition(conf.Time, centerLat, centerLon)
+
+	log.Infof("Casting shadows for coordinates (%f, %f). Sun azimuth %f, elevation %f", conf.Lat, conf.Lon,
+		azimuth, elevation)
+
+	shadows := castShadows(grid, buffer, n, azimuth, elevation)
+	data := make([]float32, n*n)
+
+	for i, shadowed := range shadows {
+		if shadowed {
+			data[i] = 1
+		}
+	}
+
+	return grid.raster(buffer, n, data), nil
+}
+
+// simulateSolarDay Integrate the insolation of the day of conf.Time. When withShadows is true, also returns
+// the shadow masks of each interval with the sun above the horizon
+func (t Generator) simulateSolarDay(conf SolarConfig,
+	withShadows bool) (*geotiff.Raster, map[string]*geotiff.Raster, error) {
+	interval := conf.Interval
+
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	if interval < MinSolarInterval {
+		return nil, nil, fmt.Errorf("cannot simulate solar day every %s. Cause: %w", interval,
+			ErrSolarIntervalTooShort)
+	}
+
+	grid, buffer, n, err := t.createSolarGrid(conf)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	centerLat, centerLon := grid.corner(buffer+n/2, buffer+n/2)
+	normals := surfaceNormals(grid, buffer, n)
+
+	insolation := make([]float32, n*n)
+	shadows := map[string]*geotiff.Raster{}
+
+	day := time.Date(conf.Time.Year(), conf.Time.Month(), conf.Time.Day(), 0, 0, 0, 0, conf.Time.Location())
+
+	for start := day; start.Before(day.AddDate(0, 0, 1)); start = start.Add(interval) {
+		if withShadows {
+			azimuth, elevation := SunPosition(start, centerLat, centerLon)
+
+			if elevation > 0 {
+				mask := make([]float32, n*n)
+
+				for i, s := range castShadows(grid, buffer, n, azimuth, elevation) {
+					if s {
+						mask[i] = 1
+					}
+				}
+
+				shadows[fmt.Sprintf("shadow-%s.png", start.Format("1504"))] = grid.raster(buffer, n, mask)
+			}
+		}
+
+		azimuth, elevation := SunPosition(start.Add(interval/2), centerLat, centerLon)
+
+		if elevation <= 0 {
+			continue
+		}
+
+		irradiance := directNormalIrradiance(elevation)
+		sun := [3]float64{
+			sinDeg(azimuth) * cosDeg(elevation),
+			cosDeg(azimuth) * cosDeg(elevation),
+			sinDeg(elevation),
+		}
+
+		shadowed := castShadows(grid, buffer, n, azimuth, elevation)
+
+		for i := range insolation {
+			if shadowed[i] {
+				continue
+			}
+
+			incidence := normals[i][0]*sun[0] + normals[i][1]*sun[1] + normals[i][2]*sun[2]
+
+			if incidence > 0 {
+				insolation[i] += float32(irradiance * incidence * interval.Hours())
+			}
+		}
+
+	}
+
+	log.Infof("Daily insolation computed for coordinates (%f, %f)", conf.Lat, conf.Lon)
+
+	return grid.raster(buffer, n, insolation), shadows, nil
+}
+
+func (t Generator) createSolarGrid(conf SolarConfig) (*elevationGrid, int, int, error) {
+	if conf.Time.IsZero() {
+		return nil, 0, 0, errors.New("a date and time is required")
+	}
+
+	bufferSide := conf.Buffer
+
+	if bufferSide <= 0 {
+		bufferSide = 2000
+	}
+
+	buffer := int(math.Ceil(bufferSide / t.spacing()))
+	grid, err := t.createBufferedElevationGrid(conf.Lat, conf.Lon, conf.Side, buffer)
+
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	return grid, buffer, t.gridSize(conf.Side), nil
+}
+
+// castShadows Mark the cells of the n x n square starting at (buffer, buffer) hidden from the sun. Walks from
+// each cell towards the sun until the ray is higher than the highest cell of the grid
+func castShadows(grid *elevationGrid, buffer, n int, azimuth, elevation float64) []bool {
+	shadowed := make([]bool, n*n)
+
+	if elevation <= 0 {
+		for i := range shadowed {
+			shadowed[i] = true
+		}
+
+		return shadowed
+	}
+
+	highest := math.Inf(-1)
+
+	for _, e := range grid.Elevations {
+		highest = math.Max(highest, float64(e))
+	}
+
+	dCol := sinDeg(azimuth)
+	dRow := -cosDeg(azimuth)
+	rise := math.Tan(elevation*math.Pi/180) * grid.spacing()
+
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			height := float64(grid.at(row+buffer, col+buffer))
+
+			for k := 1; ; k++ {
+				rayHeight := height + float64(k)*rise
+
+				if rayHeight > highest {
+					break
+				}
+
+				r := int(math.Round(float64(row+buffer) + float64(k)*dRow))
+				c := int(math.Round(float64(col+buffer) + float64(k)*dCol))
+
+				if !grid.contains(r, c) {
+					break
+				}
+
+				if float64(grid.Elevations[grid.index(r, c)]) > rayHeight {
+					shadowed[row*n+col] = true
+					break
+				}
+			}
+		}
+	}
+
+	return shadowed
+}
+
+// surfaceNormals Unit normal vectors (east, north, up) of the n x n square starting at (buffer, buffer)
+func surfaceNormals(grid *elevationGrid, buffer, n int) [][3]float64 {
+	normals := make([][3]float64, n*n)
+
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			r, c := row+buffer, col+buffer
+
+			dzEast := float64(grid.at(r, c+1)-grid.at(r, c-1)) / (2 * grid.spacing())
+			dzNorth := float64(grid.at(r-1, c)-grid.at(r+1, c)) / (2 * grid.spacing())
+			length := math.Sqrt(dzEast*dzEast + dzNorth*dzNorth + 1)
+
+			normals[row*n+col] = [3]float64{-dzEast / length, -dzNorth / length, 1 / length}
+		}
+	}
+
+	return normals
+}
+
+// directNormalIrradiance Clear sky direct normal irradiance, in W/m², using the Meinel air mass model
+func directNormalIrradiance(elevation float64) float64 {
+	airMass := 1 / math.Max(sinDeg(elevation), 0.01)
+	return solarConstant * math.Pow(0.7, math.Pow(airMass, 0.678))
+}
+
+func shadowMaskImage(raster *geotiff.Raster) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, raster.Width, raster.Height))
+
+	for y := 0; y < raster.Height; y++ {
+		for x := 0; x < raster.Width; x++ {
+			if raster.At(x, y) > 0 {
+				img.Set(x, y, color.NRGBA{A: 160})
+			}
+		}
+	}
+
+	return img
+}
+
+func insolationImage(raster *geotiff.Raster) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, raster.Width, raster.Height))
+	gradient := colorgrad.Inferno()
+
+	for y := 0; y < raster.Height; y++ {
+		for x := 0; x < raster.Width; x++ {
+			img.Set(x, y, gradient.At(float64(raster.At(x, y))/maxRenderedInsolation))
+		}
+	}
+
+	return img
+}
+
+func sinDeg(angle float64) float64 {
+	return math.Sin(angle * math.Pi / 180)
+}
+
+func cosDeg(angle float64) float64 {
+	return math.Cos(angle * math.Pi / 180)
+}
+
+func asinDeg(v float64) float64 {
+	return math.Asin(v) * 180 / math.Pi
+}
+
+func acosDeg(v float64) float64 {
+	return math.Acos(v) * 180 / math.Pi
+}
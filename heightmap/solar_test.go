@@ -0,0 +1,118 @@
+package heightmap
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/petoc/hgt"
+)
+
+func TestSunPosition(t *testing.T) {
+	t.Parallel()
+
+	// March equinox of 2024, near solar noon on the equator at the prime meridian
+	_, elevation := SunPosition(time.Date(2024, 3, 20, 12, 7, 0, 0, time.UTC), 0, 0)
+
+	if elevation < 88 {
+		t.Errorf("expected the sun near the zenith but elevation is %f", elevation)
+	}
+
+	azimuth, elevation := SunPosition(time.Date(2024, 3, 20, 8, 0, 0, 0, time.UTC), 0, 0)
+
+	if math.Abs(azimuth-90) > 2 || elevation < 25 || elevation > 35 {
+		t.Errorf("expected the morning sun to the east. Azimuth %f, elevation %f", azimuth, elevation)
+	}
+
+	_, elevation = SunPosition(time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC), 0, 0)
+
+	if elevation > 0 {
+		t.Errorf("expected the sun below the horizon at midnight but elevation is %f", elevation)
+	}
+}
+
+func TestCastShadows(t *testing.T) {
+	t.Parallel()
+
+	// A 200 m wall 120 m east of the first cell, with the sun 45 degrees high in the east
+	grid := &elevationGrid{
+		Rows: 1,
+		Cols: 5,
+		Elevations: []int16{
+			0, 0, 0, 0, 200,
+		},
+	}
+
+	shadowed := castShadows(grid, 0, 1, 90, 45)
+
+	if !shadowed[0] {
+		t.Error("expected cell 0 in the shadow of the wall")
+	}
+
+	grid.Elevations[4] = 10
+
+	if castShadows(grid, 0, 1, 90, 45)[0] {
+		t.Error("expected cell 0 to be sunlit")
+	}
+}
+
+func TestCreateSolarDayFiles(t *testing.T) {
+	t.Parallel()
+
+	h, err := hgt.OpenDataDir(demDatasetDir, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer h.Close()
+
+	heightmapGen := Generator{
+		ElevationDataset: h,
+	}
+
+	conf := SolarConfig{
+		Lat:    27.687397,
+		Lon:    86.731814,
+		Side:   300,
+		Time:   time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC),
+		Buffer: 60,
+	}
+
+	files, err := heightmapGen.CreateSolarDayFiles(conf, ResolutionConfig{Width: 10, Height: 10})
+
+	if err != nil {
+		t.Fatalf("cannot simulate solar day. Cause: %s", err)
+	}
+
+	if _, ok := files["insolation.tif"]; !ok {
+		t.Error("insolation GeoTIFF file is missing")
+	}
+
+	if _, ok := files["shadow-0600.png"]; !ok {
+		t.Error("shadow mask of 06:00 UTC is missing")
+	}
+}
+
+func TestCreateInsolationGeoTiffIntervalTooShort(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			return 0, true
+		}),
+	}
+
+	conf := SolarConfig{
+		Lat:      27.687397,
+		Lon:      86.731814,
+		Side:     300,
+		Time:     time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC),
+		Interval: time.Minute,
+	}
+
+	if _, err := heightmapGen.CreateInsolationGeoTiff(conf); !errors.Is(err, ErrSolarIntervalTooShort) {
+		t.Errorf("expected solar interval too short error but received %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package heightmap
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+
+	"github.com/geovannyAvelar/lukla/geotiff"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TerrainIndex Terrain index derived from the digital elevation model (DEM)
+type TerrainIndex string
+
+const (
+	// TerrainRuggednessIndex Terrain Ruggedness Index (TRI) of Riley et al. Square root of the sum of the
+	// squared elevation differences between a cell and its 8 neighbours
+	TerrainRuggednessIndex TerrainIndex = "tri"
+	// TopographicPositionIndex Topographic Position Index (TPI). Difference between the elevation of a cell
+	// and the mean elevation of its neighbourhood. Positive values are ridges and negative values are valleys
+	TopographicPositionIndex TerrainIndex = "tpi"
+	// Roughness Difference between the highest and the lowest elevation of a cell and its 8 neighbours
+	Roughness TerrainIndex = "roughness"
+)
+
+// Value of cells without data in terrain index GeoTIFF files
+var terrainIndexNoData = -9999.0
+
+// TerrainIndexConfig Terrain index to compute. Radius is the TPI neighbourhood radius in cells, where each
+// cell has heightDataResolution meters, or the pixel size in tiles whose pixels are bigger. TRI and roughness
+// always use the 8 adjacent cells
+type TerrainIndexConfig struct {
+	Index  TerrainIndex
+	Radius int
+}
+
+type terrainClass struct {
+	Max   float64
+	Color color.NRGBA
+}
+
+var terrainClasses = map[TerrainIndex][]terrainClass{
+	TerrainRuggednessIndex: {
+		{2, color.NRGBA{R: 26, G: 152, B: 80, A: 255}},          // Level
+		{5, color.NRGBA{R: 145, G: 207, B: 96, A: 255}},         // Nearly level
+		{10, color.NRGBA{R: 217, G: 239, B: 139, A: 255}},       // Slightly rugged
+		{20, color.NRGBA{R: 254, G: 224, B: 139, A: 255}},       // Intermediately rugged
+		{40, color.NRGBA{R: 252, G: 141, B: 89, A: 255}},        // Moderately rugged
+		{80, color.NRGBA{R: 215, G: 48, B: 39, A: 255}},         // Highly rugged
+		{math.Inf(1), color.NRGBA{R: 165, G: 0, B: 38, A: 255}}, // Extremely rugged
+	},
+	TopographicPositionIndex: {
+		{-12, color.NRGBA{R: 33, G: 102, B: 172, A: 255}},        // Valley
+		{-4, color.NRGBA{R: 146, G: 197, B: 222, A: 255}},        // Lower slope
+		{4, color.NRGBA{R: 247, G: 247, B: 247, A: 255}},         // Flat area or middle slope
+		{12, color.NRGBA{R: 244, G: 165, B: 130, A: 255}},        // Upper slope
+		{math.Inf(1), color.NRGBA{R: 178, G: 24, B: 43, A: 255}}, // Ridge
+	},
+	Roughness: {
+		{5, color.NRGBA{R: 255, G: 255, B: 204, A: 255}},
+		{15, color.NRGBA{R: 199, G: 233, B: 180, A: 255}},
+		{30, color.NRGBA{R: 127, G: 205, B: 187, A: 255}},
+		{60, color.NRGBA{R: 65, G: 182, B: 196, A: 255}},
+		{120, color.NRGBA{R: 44, G: 127, B: 184, A: 255}},
+		{math.Inf(1), color.NRGBA{R: 37, G: 52, B: 148, A: 255}},
+	},
+}
+
+// ParseTerrainIndex Parse a terrain index name (tri, tpi or roughness)
+func ParseTerrainIndex(name string) (TerrainIndex, error) {
+	index := TerrainIndex(name)
+
+	if _, ok := terrainClasses[index]; !ok {
+		return "", fmt.Errorf("unknown terrain index %s", name)
+	}
+
+	return index, nil
+}
+
+// CreateTerrainIndexImage Create a PNG image of a terrain index over a square, colored by class
+func (t Generator) CreateTerrainIndexImage(lat, lon float64, side float64, conf ResolutionConfig,
+	index TerrainIndexConfig) ([]byte, error) {
+	raster, err := t.createTerrainIndexRaster(lat, lon, side, index)
+
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return encodePNG(terrainIndexImage(index.Index, raster.Width, raster.Data), conf)
+}
+
+// CreateTerrainIndexGeoTiff Create a float32 GeoTIFF file with the raw values of a terrain index over a square
+func (t Generator) CreateTerrainIndexGeoTiff(lat, lon float64, side float64,
+	index TerrainIndexConfig) ([]byte, error) {
+	raster, err := t.createTerrainIndexRaster(lat, lon, side, index)
+
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return encodeGeoTiff(raster)
+}
+
+// GetTerrainIndexTile Create a terrain index image with the same size of an OpenStreetMap (OSM) tile. The
+// index is computed on a grid evenly spaced in Web Mercator over the tile, with cells of the size of the pixels
+// of the tile when they are bigger than the dataset resolution, so tiles of low zoom levels have about one cell
+// per pixel
+func (t Generator) GetTerrainIndexTile(z, x, y, resolution int, index TerrainIndexConfig) ([]byte, error) {
+	if _, ok := terrainClasses[index.Index]; !ok {
+		return []byte{}, fmt.Errorf("unknown terrain index %s", index.Index)
+	}
+
+	return t.getCachedTile(index.LayerName(), z, x, y, resolution, func(extent rasterExtent,
+		conf ResolutionConfig) ([]byte, error) {
+		g := t.atPixelSize(extent.side / float64(resolution))
+		// Cells are never smaller than the pixels, so cells of the size of the pixels match them one to one
+		n := clampInt(g.gridSize(extent.side), 1, resolution)
+		radius := index.radius()
+
+		// The neighbourhood buffer of radius cells, in tile coordinates
+		margin := float64(radius) / float64(n)
+		buffered := mercatorExtent(z, float64(x)-margin, float64(y)-margin, float64(x+1)+margin,
+			float64(y+1)+margin)
+
+		grid, err := g.sampleElevationGrid(buffered.grid(n+2*radius, n+2*radius))
+
+		if err != nil {
+			return []byte{}, err
+		}
+
+		log.Infof("%s terrain index computed for tile (%d, %d, %d)", index.Index, x, y, z)
+
+		return encodePNG(terrainIndexImage(index.Index, n, index.computeGrid(grid, radius, n)), conf)
+	})
+}
+
+// createTerrainIndexRaster Compute a terrain index over a square. The elevation grid is buffered by the
+// neighbourhood radius, so cells at the borders have all their neighbours
+func (t Generator) createTerrainIndexRaster(lat, lon float64, side float64,
+	index TerrainIndexConfig) (*geotiff.Raster, error) {
+	if _, ok := terrainClasses[index.Index]; !ok {
+		return nil, fmt.Errorf("unknown terrain index %s", index.Index)
+	}
+
+	radius := index.radius()
+	grid, err := t.createBufferedElevationGrid(lat, lon, side, radius)
+
+	if err != nil {
+		return nil, err
+	}
+
+	n := t.gridSize(side)
+
+	log.Infof("%s terrain index computed for coordinates (%f, %f)", index.Index, lat, lon)
+
+	raster := grid.raster(radius, n, index.computeGrid(grid, radius, n))
+	raster.NoData = &terrainIndexNoData
+
+	return raster, nil
+}
+
+// computeGrid Compute the index of the n x n cells of a grid starting at (buffer, buffer)
+func (c TerrainIndexConfig) computeGrid(grid *elevationGrid, buffer, n int) []float32 {
+	data := make([]float32, n*n)
+
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			data[row*n+col] = float32(c.compute(grid, row+buffer, col+buffer))
+		}
+	}
+
+	return data
+}
+
+// terrainIndexImage Color the n x n values of a terrain index by class
+func terrainIndexImage(index TerrainIndex, n int, data []float32) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, n, n))
+	classes := terrainClasses[index]
+
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			img.Set(x, y, classifyTerrainIndex(classes, float64(data[y*n+x])))
+		}
+	}
+
+	return img
+}
+
+func (c TerrainIndexConfig) radius() int {
+	if c.Index != TopographicPositionIndex || c.Radius < 1 {
+		return 1
+	}
+
+	return c.Radius
+}
+
+// LayerName Name of the tile layer of the index, whose tiles are cached in their own directory
+func (c TerrainIndexConfig) LayerName() string {
+	if c.Index == TopographicPositionIndex {
+		return string(c.Index) + "-" + strconv.Itoa(c.radius())
+	}
+
+	return string(c.Index)
+}
+
+func (c TerrainIndexConfig) compute(grid *elevationGrid, row, col int) float64 {
+	switch c.Index {
+	case TerrainRuggednessIndex:
+		return terrainRuggednessIndex(grid, row, col)
+	case TopographicPositionIndex:
+		return topographicPositionIndex(grid, row, col, c.radius())
+	case Roughness:
+		return roughness(grid, row, col)
+	}
+
+	return terrainIndexNoData
+}
+
+func terrainRuggednessIndex(grid *elevationGrid, row, col int) float64 {
+	center := float64(grid.at(row, col))
+	sum := 0.0
+
+	for r := row - 1; r <= row+1; r++ {
+		for c := col - 1; c <= col+1; c++ {
+			diff := float64(grid.at(r, c)) - center
+			sum += diff * diff
+		}
+	}
+
+	return math.Sqrt(sum)
+}
+
+// topographicPositionIndex Uses a circular neighbourhood, excluding the cell itself
+func topographicPositionIndex(grid *elevationGrid, row, col, radius int) float64 {
+	sum := 0.0
+	count := 0
+
+	for r := -radius; r <= radius; r++ {
+		for c := -radius; c <= radius; c++ {
+			if (r == 0 && c == 0) || r*r+c*c > radius*radius {
+				continue
+			}
+
+			sum += float64(grid.at(row+r, col+c))
+			count++
+		}
+	}
+
+	return float64(grid.at(row, col)) - sum/float64(count)
+}
+
+func roughness(grid *elevationGrid, row, col int) float64 {
+	min := math.Inf(1)
+	max := math.Inf(-1)
+
+	for r := row - 1; r <= row+1; r++ {
+		for c := col - 1; c <= col+1; c++ {
+			e := float64(grid.at(r, c))
+			min = math.Min(min, e)
+			max = math.Max(max, e)
+		}
+	}
+
+	return max - min
+}
+
+func classifyTerrainIndex(classes []terrainClass, value float64) color.Color {
+	for _, c := range classes {
+		if value <= c.Max {
+			return c.Color
+		}
+	}
+
+	return color.Transparent
+}
@@ -0,0 +1,154 @@
+package heightmap
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/petoc/hgt"
+)
+
+var slopeGrid = &elevationGrid{
+	Rows: 3,
+	Cols: 3,
+	Elevations: []int16{
+		10, 10, 10,
+		10, 20, 10,
+		10, 10, 40,
+	},
+}
+
+func TestTerrainRuggednessIndex(t *testing.T) {
+	t.Parallel()
+
+	// Seven neighbours 10 m lower and one neighbour 20 m higher
+	expected := math.Sqrt(7*100 + 400)
+
+	if tri := terrainRuggednessIndex(slopeGrid, 1, 1); tri != expected {
+		t.Errorf("expected TRI %f but received %f", expected, tri)
+	}
+}
+
+func TestTopographicPositionIndex(t *testing.T) {
+	t.Parallel()
+
+	// Radius 1 neighbourhood is a cross with the 4 adjacent cells
+	if tpi := topographicPositionIndex(slopeGrid, 1, 1, 1); tpi != 10 {
+		t.Errorf("expected TPI 10 but received %f", tpi)
+	}
+}
+
+func TestRoughness(t *testing.T) {
+	t.Parallel()
+
+	if r := roughness(slopeGrid, 1, 1); r != 30 {
+		t.Errorf("expected roughness 30 but received %f", r)
+	}
+}
+
+func TestParseTerrainIndex(t *testing.T) {
+	t.Parallel()
+
+	if _, err := ParseTerrainIndex("tpi"); err != nil {
+		t.Errorf("cannot parse tpi terrain index. Cause: %s", err)
+	}
+
+	if _, err := ParseTerrainIndex("slope"); err == nil {
+		t.Error("expected an error, but received success")
+	}
+}
+
+func TestCreateTerrainIndexGeoTiff(t *testing.T) {
+	t.Parallel()
+
+	h, err := hgt.OpenDataDir(demDatasetDir, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer h.Close()
+
+	heightmapGen := Generator{
+		ElevationDataset: h,
+	}
+
+	b, err := heightmapGen.CreateTerrainIndexGeoTiff(27.687397, 86.731814, 300,
+		TerrainIndexConfig{Index: TopographicPositionIndex, Radius: 3})
+
+	if err != nil {
+		t.Fatalf("cannot create terrain index GeoTIFF. Cause: %s", err)
+	}
+
+	if !bytes.HasPrefix(b, []byte{'I', 'I', 42, 0}) {
+		t.Errorf("terrain index output is not a TIFF file")
+	}
+}
+
+func TestGetTerrainIndexTileAtLowZoom(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			return int16(lat * 10), true
+		}),
+		Dir: t.TempDir(),
+	}
+
+	// A zoom level 5 tile is about 1250 km wide, far more cells than a grid holds at the dataset resolution
+	b, err := heightmapGen.GetTerrainIndexTile(5, 23, 13, 64, TerrainIndexConfig{Index: TerrainRuggednessIndex})
+
+	if err != nil {
+		t.Fatalf("cannot create terrain index tile. Cause: %s", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(b))
+
+	if err != nil || img.Bounds().Dx() != 64 || img.Bounds().Dy() != 64 {
+		t.Errorf("expected a 64x64 tile. Cause: %v", err)
+	}
+
+	layer := TerrainIndexConfig{Index: TerrainRuggednessIndex}.LayerName()
+	waitForTileManifest(t, formatTilePath(heightmapGen.layerDir(layer), 23, 13, 5, 64))
+}
+
+func TestGetTerrainIndexTileMercatorExtent(t *testing.T) {
+	t.Parallel()
+
+	// A cliff crossing the middle of tile (500, 300, 10), at about 60°
+	cliff := tileLat(10, 300.5)
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			if lat < cliff {
+				return 1000, true
+			}
+
+			return 0, true
+		}),
+		Dir: t.TempDir(),
+	}
+
+	index := TerrainIndexConfig{Index: TerrainRuggednessIndex}
+	b, err := heightmapGen.GetTerrainIndexTile(10, 500, 300, 16, index)
+
+	if err != nil {
+		t.Fatalf("cannot create terrain index tile. Cause: %s", err)
+	}
+
+	img := decodeTestTile(t, b)
+	level, rugged := terrainClasses[TerrainRuggednessIndex][0].Color, color.NRGBA{R: 165, B: 38, A: 255}
+
+	for _, row := range []int{0, 4, 11, 15} {
+		if c := color.NRGBAModel.Convert(img.At(8, row)); c != level {
+			t.Errorf("row %d: expected level terrain, got %v", row, c)
+		}
+	}
+
+	if c := color.NRGBAModel.Convert(img.At(8, 7)); c != rugged {
+		t.Errorf("expected the cliff at the middle of the tile, got %v", c)
+	}
+
+	waitForTileManifest(t, formatTilePath(heightmapGen.layerDir(index.LayerName()), 500, 300, 10, 16))
+}
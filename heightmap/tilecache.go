@@ -0,0 +1,225 @@
+package heightmap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apeyroux/gosm"
+	log "github.com/sirupsen/logrus"
+)
+
+// RendererVersion Version of the tile rendering code. Increment it when tiles are rendered differently, so
+// cached tiles rendered by previous versions are rendered again
+const RendererVersion = "8"
+
+// TileManifest Metadata of a cached tile, saved next to it as {y}.json. Tiles whose manifest does not match
+// the renderer version or the DEM source of the generator are rendered again
+type TileManifest struct {
+	Renderer  string    `json:"renderer"`
+	DemSource string    `json:"demSource"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TileFilter Tiles removed from the tile cache. Zero values match every tile
+type TileFilter struct {
+	// Bbox West, south, east and north bounds, in degrees, of the area whose tiles are removed
+	Bbox    *[4]float64
+	MinZoom int
+	// MaxZoom Highest zoom level removed. Nil matches every zoom level
+	MaxZoom    *int
+	Resolution int
+	// Style Layer of the tiles: grayscale, a heightmap encoding or a terrain index layer (e.g.: tri or tpi-3)
+	Style string
+	// OlderThan Minimum age of the tiles
+	OlderThan time.Duration
+	// Stale Match only tiles rendered by another renderer version or DEM source, or without manifest
+	Stale bool
+	// DryRun Count the matching tiles without removing them
+	DryRun bool
+}
+
+// PruneReport Tiles removed from the tile cache
+type PruneReport struct {
+	Removed int   `json:"removed"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// cachedTile Tile of the tile cache, identified by its path
+type cachedTile struct {
+	style      string
+	resolution int
+	x, y, z    int
+	path       string
+}
+
+// PruneTiles Remove the tiles of the tile cache matching a filter, with their manifests
+func (t Generator) PruneTiles(filter TileFilter) (*PruneReport, error) {
+	report := &PruneReport{}
+
+	err := filepath.WalkDir(t.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || !strings.HasSuffix(path, ".png") {
+			return nil
+		}
+
+		tile, ok := t.parseTilePath(path)
+
+		if !ok {
+			return nil
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			return err
+		}
+
+		if !t.matchesFilter(tile, info, filter) {
+			return nil
+		}
+
+		report.Removed++
+		report.Bytes += info.Size()
+
+		if filter.DryRun {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("cannot remove tile %s. Cause: %w", path, err)
+		}
+
+		if err := os.Remove(tileManifestPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("cannot remove tile manifest %s. Cause: %w", tileManifestPath(path), err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return report, fmt.Errorf("cannot prune tile cache %s. Cause: %w", t.Dir, err)
+	}
+
+	if !filter.DryRun {
+		log.Infof("%d tile(s) pruned from %s", report.Removed, t.Dir)
+	}
+
+	return report, nil
+}
+
+// matchesFilter Check if a cached tile matches every criterion of a filter
+func (t Generator) matchesFilter(tile cachedTile, info fs.FileInfo, filter TileFilter) bool {
+	if tile.z < filter.MinZoom || (filter.MaxZoom != nil && tile.z > *filter.MaxZoom) {
+		return false
+	}
+
+	if filter.Resolution > 0 && tile.resolution != filter.Resolution {
+		return false
+	}
+
+	if filter.Style != "" && tile.style != filter.Style {
+		return false
+	}
+
+	if filter.OlderThan > 0 && time.Since(info.ModTime()) < filter.OlderThan {
+		return false
+	}
+
+	if filter.Bbox != nil {
+		north, west := gosm.NewTileWithXY(tile.x, tile.y, tile.z).Num2deg()
+		south, east := gosm.NewTileWithXY(tile.x+1, tile.y+1, tile.z).Num2deg()
+		b := filter.Bbox
+
+		if west >= b[2] || east <= b[0] || south >= b[3] || north <= b[1] {
+			return false
+		}
+	}
+
+	if filter.Stale && t.isTileCurrent(tile.path) {
+		return false
+	}
+
+	return true
+}
+
+// parseTilePath Identify a tile of the tile cache from its path: {resolution}/{z}/{x}/{y}.png for grayscale
+// tiles and {style}/{resolution}/{z}/{x}/{y}.png for the other layers
+func (t Generator) parseTilePath(path string) (cachedTile, bool) {
+	rel, err := filepath.Rel(t.Dir, path)
+
+	if err != nil {
+		return cachedTile{}, false
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	tile := cachedTile{style: string(Grayscale), path: path}
+
+	if len(parts) == 5 {
+		tile.style = parts[0]
+		parts = parts[1:]
+	}
+
+	if len(parts) != 4 {
+		return cachedTile{}, false
+	}
+
+	var numbers [4]int
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSuffix(part, ".png"))
+
+		if err != nil || n < 0 {
+			return cachedTile{}, false
+		}
+
+		numbers[i] = n
+	}
+
+	tile.resolution, tile.z, tile.x, tile.y = numbers[0], numbers[1], numbers[2], numbers[3]
+
+	return tile, true
+}
+
+// isTileCurrent Check if a cached tile was rendered by the current renderer version from the current DEM source.
+// Tiles without manifest were saved by renderers older than the manifests, so they are never current
+func (t Generator) isTileCurrent(tilePath string) bool {
+	b, err := os.ReadFile(tileManifestPath(tilePath))
+
+	var manifest TileManifest
+
+	if err != nil || json.Unmarshal(b, &manifest) != nil {
+		return false
+	}
+
+	return manifest.Renderer == RendererVersion && manifest.DemSource == t.DemSource
+}
+
+// writeTileManifest Save the manifest of a tile rendered by the generator
+func (t Generator) writeTileManifest(tilePath string) error {
+	b, err := json.Marshal(TileManifest{Renderer: RendererVersion, DemSource: t.DemSource, CreatedAt: time.Now()})
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(tileManifestPath(tilePath), b, 0644)
+}
+
+// tileManifestPath Path of the manifest of a tile (e.g.: 256/10/700/400.json for 256/10/700/400.png)
+func tileManifestPath(tilePath string) string {
+	return strings.TrimSuffix(tilePath, ".png") + ".json"
+}
@@ -0,0 +1,143 @@
+package heightmap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// saveTestTiles Save the tile (x, y, z) of each layer and zoom level, at 256 pixels
+func saveTestTiles(t *testing.T, heightmapGen Generator, layers []string, tiles [][3]int) {
+	t.Helper()
+
+	for _, layer := range layers {
+		gen := heightmapGen
+		gen.Dir = heightmapGen.layerDir(layer)
+
+		for _, tile := range tiles {
+			if _, err := gen.saveTile(tile[0], tile[1], tile[2], 256, []byte{1}); err != nil {
+				t.Fatalf("cannot save tile. Cause: %s", err)
+			}
+		}
+	}
+}
+
+func TestPruneTiles(t *testing.T) {
+	t.Parallel()
+
+	// (0, 0, 1) covers the north west quarter of the world and (1, 0, 1) the north east quarter
+	tiles := [][3]int{{0, 0, 1}, {1, 0, 1}, {0, 0, 2}}
+	layers := []string{string(Grayscale), string(Terrarium), "slope"}
+	maxZoom := 1
+
+	tests := map[string]struct {
+		filter  TileFilter
+		removed int
+	}{
+		"style":     {TileFilter{Style: "slope"}, 3},
+		"zoom":      {TileFilter{MinZoom: 2}, 3},
+		"max zoom":  {TileFilter{MaxZoom: &maxZoom, Style: string(Grayscale)}, 2},
+		"bbox":      {TileFilter{Bbox: &[4]float64{10, 10, 20, 20}, MaxZoom: &maxZoom}, 3},
+		"age":       {TileFilter{OlderThan: time.Hour}, 0},
+		"stale":     {TileFilter{Stale: true}, 0},
+		"dry run":   {TileFilter{DryRun: true}, 9},
+		"all tiles": {TileFilter{}, 9},
+	}
+
+	for name, test := range tests {
+		heightmapGen := Generator{Dir: t.TempDir(), DemSource: "srtm:data/dem"}
+		saveTestTiles(t, heightmapGen, layers, tiles)
+
+		report, err := heightmapGen.PruneTiles(test.filter)
+
+		if err != nil {
+			t.Fatalf("cannot prune tiles with filter %s. Cause: %s", name, err)
+		}
+
+		if report.Removed != test.removed || report.Bytes != int64(test.removed) {
+			t.Errorf("expected %d tiles removed with filter %s, got %d", test.removed, name, report.Removed)
+		}
+
+		remaining, _ := filepath.Glob(filepath.Join(heightmapGen.Dir, "*", "*", "*", "*.png"))
+		layered, _ := filepath.Glob(filepath.Join(heightmapGen.Dir, "*", "*", "*", "*", "*.png"))
+		expected := 9 - test.removed
+
+		if test.filter.DryRun {
+			expected = 9
+		}
+
+		if len(remaining)+len(layered) != expected {
+			t.Errorf("expected %d tiles left with filter %s, got %d", expected, name, len(remaining)+len(layered))
+		}
+	}
+}
+
+func TestStaleTiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	saveTestTiles(t, Generator{Dir: dir, DemSource: "srtm:data/dem"}, []string{string(Grayscale)},
+		[][3]int{{0, 0, 1}, {1, 0, 1}})
+
+	// Tiles saved before manifests existed are rendered again
+	os.Remove(tileManifestPath(formatTilePath(dir, 1, 0, 1, 256)))
+
+	heightmapGen := Generator{Dir: dir, DemSource: "geotiff:data/dem"}
+
+	if _, err := heightmapGen.getTileFromDisk(0, 0, 1, 256); err == nil {
+		t.Error("expected a tile rendered from another DEM source to be stale")
+	}
+
+	if _, err := heightmapGen.getTileFromDisk(1, 0, 1, 256); err == nil {
+		t.Error("expected a tile without manifest to be stale")
+	}
+
+	if _, err := heightmapGen.saveTile(0, 0, 1, 256, []byte{2}); err != nil {
+		t.Fatalf("cannot save tile. Cause: %s", err)
+	}
+
+	if b, err := heightmapGen.getTileFromDisk(0, 0, 1, 256); err != nil || b[0] != 2 {
+		t.Errorf("expected the stale tile to be replaced. Cause: %v", err)
+	}
+
+	report, err := heightmapGen.PruneTiles(TileFilter{Stale: true})
+
+	if err != nil || report.Removed != 1 {
+		t.Errorf("expected the tile without manifest to be pruned as stale, got %+v. Cause: %v", report, err)
+	}
+}
+
+func TestTileWithoutManifestRenderedAgain(t *testing.T) {
+	t.Parallel()
+
+	heightmapGen := Generator{
+		ElevationDataset: fakeElevationSource(func(lat, lon float64) (int16, bool) {
+			return 100, true
+		}),
+		Dir: t.TempDir(),
+	}
+
+	// A tile cached before manifests existed
+	tilePath := formatTilePath(heightmapGen.layerDir(string(Terrarium)), 1, 1, 1, 16)
+
+	if err := os.MkdirAll(filepath.Dir(tilePath), os.ModePerm); err != nil {
+		t.Fatalf("cannot create tile directory. Cause: %s", err)
+	}
+
+	if err := os.WriteFile(tilePath, []byte{1}, 0644); err != nil {
+		t.Fatalf("cannot save tile. Cause: %s", err)
+	}
+
+	b, err := heightmapGen.GetEncodedTileHeightmap(1, 1, 1, 16, Terrarium)
+
+	if err != nil {
+		t.Fatalf("cannot create encoded tile. Cause: %s", err)
+	}
+
+	if len(b) == 1 {
+		t.Error("expected the tile without manifest to be rendered again")
+	}
+
+	waitForTileManifest(t, tilePath)
+}
@@ -0,0 +1,213 @@
+package netcdf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrOutOfBounds = errors.New("coordinate is outside the netCDF grid")
+
+var ErrNoData = errors.New("no data")
+
+// Names of latitude and longitude dimensions and of elevation variables, by order of preference
+var (
+	latitudeNames  = []string{"lat", "latitude", "y"}
+	longitudeNames = []string{"lon", "longitude", "x"}
+	elevationNames = []string{"elevation", "z", "Band1", "altitude", "height"}
+)
+
+// Grid Regular latitude/longitude elevation grid stored in a netCDF file, such as GEBCO and ETOPO global
+// relief grids. Values are read from the disk on demand
+type Grid struct {
+	file        *File
+	elevation   *Variable
+	lat0, lon0  float64
+	dLat, dLon  float64
+	rows, cols  int
+	latFirst    bool
+	scale       float64
+	offset      float64
+	fillValue   *float64
+	missingData *float64
+}
+
+// OpenGrid Open the elevation grid of a netCDF file. The grid must have latitude and longitude coordinate
+// variables with a constant spacing
+func OpenGrid(path string) (*Grid, error) {
+	f, err := Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := newGrid(f)
+
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot read netCDF grid %s. Cause: %w", path, err)
+	}
+
+	return g, nil
+}
+
+func newGrid(f *File) (*Grid, error) {
+	latDim, latVar := f.coordinate(latitudeNames)
+	lonDim, lonVar := f.coordinate(longitudeNames)
+
+	if latVar == nil || lonVar == nil {
+		return nil, fmt.Errorf("%w. Latitude and longitude coordinate variables not found", ErrUnsupportedFile)
+	}
+
+	g := &Grid{file: f, scale: 1}
+
+	for _, v := range f.gridVariables(latDim, lonDim) {
+		if g.elevation == nil {
+			g.elevation = v
+		}
+
+		for _, name := range elevationNames {
+			if v.Name == name {
+				g.elevation = v
+				break
+			}
+		}
+	}
+
+	if g.elevation == nil {
+		return nil, fmt.Errorf("%w. Elevation variable not found", ErrUnsupportedFile)
+	}
+
+	g.latFirst = g.elevation.Dimensions[0] == latDim
+
+	var err error
+
+	if g.lat0, g.dLat, g.rows, err = axis(latVar); err != nil {
+		return nil, err
+	}
+
+	if g.lon0, g.dLon, g.cols, err = axis(lonVar); err != nil {
+		return nil, err
+	}
+
+	if scale, ok := g.elevation.Number("scale_factor"); ok {
+		g.scale = scale
+	}
+
+	g.offset, _ = g.elevation.Number("add_offset")
+
+	if fill, ok := g.elevation.Number("_FillValue"); ok {
+		g.fillValue = &fill
+	}
+
+	if missing, ok := g.elevation.Number("missing_value"); ok {
+		g.missingData = &missing
+	}
+
+	return g, nil
+}
+
+// coordinate Find a dimension and its coordinate variable by name
+func (f *File) coordinate(names []string) (int, *Variable) {
+	for _, name := range names {
+		for i, d := range f.Dimensions {
+			if d.Name != name {
+				continue
+			}
+
+			if v := f.Variable(name); v != nil && len(v.Dimensions) == 1 && v.Dimensions[0] == i {
+				return i, v
+			}
+		}
+	}
+
+	return -1, nil
+}
+
+// gridVariables Variables with exactly the latitude and longitude dimensions
+func (f *File) gridVariables(latDim, lonDim int) []*Variable {
+	var variables []*Variable
+
+	for _, v := range f.Variables {
+		if len(v.Dimensions) != 2 || v.IsRecord() {
+			continue
+		}
+
+		d0, d1 := v.Dimensions[0], v.Dimensions[1]
+
+		if (d0 == latDim && d1 == lonDim) || (d0 == lonDim && d1 == latDim) {
+			variables = append(variables, v)
+		}
+	}
+
+	return variables
+}
+
+// axis Read the first value, the spacing and the length of a regular coordinate variable
+func axis(v *Variable) (float64, float64, int, error) {
+	values, err := v.ReadAll()
+
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if len(values) < 2 {
+		return 0, 0, 0, fmt.Errorf("%w. Coordinate %s has less than 2 values", ErrUnsupportedFile, v.Name)
+	}
+
+	step := (values[len(values)-1] - values[0]) / float64(len(values)-1)
+
+	if step == 0 || math.Abs(values[1]-values[0]-step) > math.Abs(step)*1e-3 {
+		return 0, 0, 0, fmt.Errorf("%w. Coordinate %s is not regular", ErrUnsupportedFile, v.Name)
+	}
+
+	return values[0], step, len(values), nil
+}
+
+// ElevationAt Return the elevation of the grid node nearest to a coordinate and the grid resolution in
+// arc seconds
+func (g *Grid) ElevationAt(lat, lon float64) (int16, int, error) {
+	row := int(math.Round((lat - g.lat0) / g.dLat))
+	col := int(math.Round((lon - g.lon0) / g.dLon))
+
+	// Global grids may start at 0° or at -180° of longitude
+	if col < 0 || col >= g.cols {
+		col = int(math.Round((lon + 360 - g.lon0) / g.dLon))
+
+		if col < 0 || col >= g.cols {
+			col = int(math.Round((lon - 360 - g.lon0) / g.dLon))
+		}
+	}
+
+	if row < 0 || row >= g.rows || col < 0 || col >= g.cols {
+		return 0, 0, ErrOutOfBounds
+	}
+
+	index := row*g.cols + col
+
+	if !g.latFirst {
+		index = col*g.rows + row
+	}
+
+	values, err := g.elevation.ReadAt(index, 1)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	v := values[0]
+
+	if math.IsNaN(v) || (g.fillValue != nil && v == *g.fillValue) || (g.missingData != nil && v == *g.missingData) {
+		return 0, 0, ErrNoData
+	}
+
+	v = v*g.scale + g.offset
+
+	return int16(math.Round(math.Max(math.Min(v, math.MaxInt16), math.MinInt16))),
+		int(math.Round(math.Abs(g.dLat) * 3600)), nil
+}
+
+// Close Close the file
+func (g *Grid) Close() error {
+	return g.file.Close()
+}
@@ -0,0 +1,381 @@
+package netcdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Header list tags
+const (
+	tagDimension = 0x0A
+	tagVariable  = 0x0B
+	tagAttribute = 0x0C
+)
+
+// netCDF external data types
+const (
+	typeByte   = 1
+	typeChar   = 2
+	typeShort  = 3
+	typeInt    = 4
+	typeFloat  = 5
+	typeDouble = 6
+	typeUByte  = 7
+	typeUShort = 8
+	typeUInt   = 9
+	typeInt64  = 10
+	typeUInt64 = 11
+)
+
+var ErrUnsupportedFile = errors.New("unsupported netCDF file")
+
+// File netCDF classic file (CDF-1, CDF-2 or CDF-5). netCDF-4 files are HDF5 files and must be converted to the
+// classic format first (e.g.: nccopy -k cdf5 input.nc output.nc)
+type File struct {
+	Dimensions []Dimension
+	Attributes map[string]interface{}
+	Variables  []*Variable
+
+	file    *os.File
+	version byte
+}
+
+// Dimension Named dimension. Length is zero for the unlimited (record) dimension
+type Dimension struct {
+	Name   string
+	Length int
+}
+
+// Variable Variable stored in a netCDF file
+type Variable struct {
+	Name       string
+	Dimensions []int
+	Attributes map[string]interface{}
+
+	typ   int
+	size  int64
+	begin int64
+	file  *File
+}
+
+// headerReader Sequential reader of the file header
+type headerReader struct {
+	r       io.Reader
+	version byte
+	err     error
+}
+
+// Open Open a netCDF classic file and read its header
+func Open(path string) (*File, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{file: file}
+
+	if err := f.readHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot read netCDF file %s. Cause: %w", path, err)
+	}
+
+	return f, nil
+}
+
+// Close Close the file
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// Variable Find a variable by its name
+func (f *File) Variable(name string) *Variable {
+	for _, v := range f.Variables {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func (f *File) readHeader() error {
+	magic := make([]byte, 4)
+
+	if _, err := io.ReadFull(f.file, magic); err != nil {
+		return err
+	}
+
+	if string(magic[:3]) != "CDF" {
+		if string(magic[1:4]) == "HDF" {
+			return fmt.Errorf("%w. netCDF-4 (HDF5) files are not supported", ErrUnsupportedFile)
+		}
+
+		return ErrUnsupportedFile
+	}
+
+	f.version = magic[3]
+
+	if f.version != 1 && f.version != 2 && f.version != 5 {
+		return fmt.Errorf("%w. Unknown version %d", ErrUnsupportedFile, f.version)
+	}
+
+	h := &headerReader{r: f.file, version: f.version}
+
+	h.count() // number of records
+
+	for _, list := range []int{tagDimension, tagAttribute, tagVariable} {
+		tag := h.uint32()
+		n := h.count()
+
+		if tag != 0 && tag != uint32(list) {
+			return fmt.Errorf("%w. Invalid header", ErrUnsupportedFile)
+		}
+
+		for i := 0; i < n && h.err == nil; i++ {
+			switch list {
+			case tagDimension:
+				f.Dimensions = append(f.Dimensions, Dimension{Name: h.name(), Length: h.count()})
+			case tagAttribute:
+				if f.Attributes == nil {
+					f.Attributes = map[string]interface{}{}
+				}
+
+				name, value := h.attribute()
+				f.Attributes[name] = value
+			case tagVariable:
+				f.Variables = append(f.Variables, h.variable(f))
+			}
+		}
+	}
+
+	return h.err
+}
+
+func (h *headerReader) uint32() uint32 {
+	b := h.read(4)
+
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+// count Read a non negative number, stored in 8 bytes by CDF-5 files
+func (h *headerReader) count() int {
+	if h.version == 5 {
+		b := h.read(8)
+
+		if b == nil {
+			return 0
+		}
+
+		return int(binary.BigEndian.Uint64(b))
+	}
+
+	return int(h.uint32())
+}
+
+// offset Read a file offset, stored in 8 bytes by CDF-2 and CDF-5 files
+func (h *headerReader) offset() int64 {
+	if h.version == 1 {
+		return int64(h.uint32())
+	}
+
+	b := h.read(8)
+
+	if b == nil {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (h *headerReader) name() string {
+	n := h.count()
+	b := h.read(padded(n))
+
+	if b == nil {
+		return ""
+	}
+
+	return string(b[:n])
+}
+
+func (h *headerReader) attribute() (string, interface{}) {
+	name := h.name()
+	typ := int(h.uint32())
+	n := h.count()
+	b := h.read(padded(n * typeSize(typ)))
+
+	if b == nil {
+		return name, nil
+	}
+
+	if typ == typeChar {
+		return name, string(b[:n])
+	}
+
+	values := make([]float64, n)
+
+	for i := range values {
+		values[i] = decode(b[i*typeSize(typ):], typ)
+	}
+
+	return name, values
+}
+
+func (h *headerReader) variable(f *File) *Variable {
+	v := &Variable{Name: h.name(), file: f, Attributes: map[string]interface{}{}}
+
+	n := h.count()
+
+	for i := 0; i < n; i++ {
+		v.Dimensions = append(v.Dimensions, h.count())
+	}
+
+	tag := h.uint32()
+	attributes := h.count()
+
+	if tag != 0 && tag != tagAttribute {
+		h.err = fmt.Errorf("%w. Invalid variable attributes", ErrUnsupportedFile)
+	}
+
+	for i := 0; i < attributes && h.err == nil; i++ {
+		name, value := h.attribute()
+		v.Attributes[name] = value
+	}
+
+	v.typ = int(h.uint32())
+	v.size = int64(h.count())
+	v.begin = h.offset()
+
+	return v
+}
+
+func (h *headerReader) read(n int) []byte {
+	if h.err != nil {
+		return nil
+	}
+
+	b := make([]byte, n)
+
+	if _, err := io.ReadFull(h.r, b); err != nil {
+		h.err = err
+		return nil
+	}
+
+	return b
+}
+
+// IsRecord Check if the variable grows along the unlimited dimension
+func (v *Variable) IsRecord() bool {
+	return len(v.Dimensions) > 0 && v.file.Dimensions[v.Dimensions[0]].Length == 0
+}
+
+// Shape Length of each dimension of the variable
+func (v *Variable) Shape() []int {
+	shape := make([]int, len(v.Dimensions))
+
+	for i, d := range v.Dimensions {
+		shape[i] = v.file.Dimensions[d].Length
+	}
+
+	return shape
+}
+
+// ReadAt Read count values starting at the flat index of a non record variable
+func (v *Variable) ReadAt(index, count int) ([]float64, error) {
+	if v.IsRecord() {
+		return nil, fmt.Errorf("%w. Record variables are not supported", ErrUnsupportedFile)
+	}
+
+	size := typeSize(v.typ)
+	b := make([]byte, count*size)
+
+	if _, err := v.file.file.ReadAt(b, v.begin+int64(index*size)); err != nil {
+		return nil, err
+	}
+
+	values := make([]float64, count)
+
+	for i := range values {
+		values[i] = decode(b[i*size:], v.typ)
+	}
+
+	return values, nil
+}
+
+// ReadAll Read every value of a non record variable
+func (v *Variable) ReadAll() ([]float64, error) {
+	count := 1
+
+	for _, length := range v.Shape() {
+		count *= length
+	}
+
+	return v.ReadAt(0, count)
+}
+
+// Number Return the first value of a numeric attribute
+func (v *Variable) Number(name string) (float64, bool) {
+	values, ok := v.Attributes[name].([]float64)
+
+	if !ok || len(values) == 0 {
+		return 0, false
+	}
+
+	return values[0], true
+}
+
+func decode(b []byte, typ int) float64 {
+	be := binary.BigEndian
+
+	switch typ {
+	case typeByte:
+		return float64(int8(b[0]))
+	case typeChar, typeUByte:
+		return float64(b[0])
+	case typeShort:
+		return float64(int16(be.Uint16(b)))
+	case typeUShort:
+		return float64(be.Uint16(b))
+	case typeInt:
+		return float64(int32(be.Uint32(b)))
+	case typeUInt:
+		return float64(be.Uint32(b))
+	case typeFloat:
+		return float64(math.Float32frombits(be.Uint32(b)))
+	case typeDouble:
+		return math.Float64frombits(be.Uint64(b))
+	case typeInt64:
+		return float64(int64(be.Uint64(b)))
+	case typeUInt64:
+		return float64(be.Uint64(b))
+	}
+
+	return math.NaN()
+}
+
+func typeSize(typ int) int {
+	switch typ {
+	case typeShort, typeUShort:
+		return 2
+	case typeInt, typeUInt, typeFloat:
+		return 4
+	case typeDouble, typeInt64, typeUInt64:
+		return 8
+	}
+
+	return 1
+}
+
+// padded Round a size up to a multiple of 4 bytes
+func padded(n int) int {
+	return (n + 3) &^ 3
+}
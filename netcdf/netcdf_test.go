@@ -0,0 +1,190 @@
+package netcdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGrid Write a CDF-1 file with lat and lon coordinate variables and a short elevation variable, like
+// the GEBCO grids, with a scale factor of 2 and a fill value
+func writeGrid(t *testing.T, lats, lons []float64, elevations []int16) string {
+	t.Helper()
+
+	var h bytes.Buffer
+	be := binary.BigEndian
+
+	u32 := func(v uint32) { binary.Write(&h, be, v) }
+	name := func(s string) {
+		u32(uint32(len(s)))
+		h.WriteString(s)
+		h.Write(make([]byte, padded(len(s))-len(s)))
+	}
+	shortAttr := func(n string, v int16) {
+		name(n)
+		u32(typeShort)
+		u32(1)
+		binary.Write(&h, be, v)
+		h.Write([]byte{0, 0})
+	}
+
+	type variable struct {
+		name string
+		dims []uint32
+		typ  uint32
+		size int
+		data []byte
+		elev bool
+	}
+
+	var latData, lonData, elevationData bytes.Buffer
+	binary.Write(&latData, be, lats)
+	binary.Write(&lonData, be, lons)
+	binary.Write(&elevationData, be, elevations)
+
+	variables := []variable{
+		{"lat", []uint32{0}, typeDouble, latData.Len(), latData.Bytes(), false},
+		{"lon", []uint32{1}, typeDouble, lonData.Len(), lonData.Bytes(), false},
+		{"elevation", []uint32{0, 1}, typeShort, padded(elevationData.Len()), elevationData.Bytes(), true},
+	}
+
+	// Header size is computed with placeholder offsets, which are rewritten below
+	offsets := make([]int, len(variables))
+	var header []byte
+
+	for pass := 0; pass < 2; pass++ {
+		h.Truncate(0)
+		h.WriteString("CDF\x01")
+		u32(0)
+		u32(tagDimension)
+		u32(2)
+		name("lat")
+		u32(uint32(len(lats)))
+		name("lon")
+		u32(uint32(len(lons)))
+		u32(tagAttribute)
+		u32(1)
+		name("title")
+		u32(typeChar)
+		u32(4)
+		h.WriteString("test")
+		u32(tagVariable)
+		u32(uint32(len(variables)))
+
+		for i, v := range variables {
+			name(v.name)
+			u32(uint32(len(v.dims)))
+
+			for _, d := range v.dims {
+				u32(d)
+			}
+
+			if v.elev {
+				u32(tagAttribute)
+				u32(2)
+				shortAttr("scale_factor", 2)
+				shortAttr("_FillValue", -32767)
+			} else {
+				u32(0)
+				u32(0)
+			}
+
+			u32(v.typ)
+			u32(uint32(v.size))
+			u32(uint32(offsets[i]))
+		}
+
+		offset := h.Len()
+
+		for i, v := range variables {
+			offsets[i] = offset
+			offset += v.size
+		}
+
+		header = append([]byte{}, h.Bytes()...)
+	}
+
+	for _, v := range variables {
+		header = append(header, v.data...)
+		header = append(header, make([]byte, v.size-len(v.data))...)
+	}
+
+	path := filepath.Join(t.TempDir(), "grid.nc")
+
+	if err := os.WriteFile(path, header, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	path := writeGrid(t, []float64{-1, 0}, []float64{10, 11, 12}, []int16{1, 2, 3, 4, 5, 6})
+
+	f, err := Open(path)
+
+	if err != nil {
+		t.Fatalf("cannot open netCDF file. Cause: %s", err)
+	}
+
+	defer f.Close()
+
+	if len(f.Dimensions) != 2 || f.Dimensions[1].Length != 3 || f.Attributes["title"] != "test" {
+		t.Errorf("unexpected header %+v", f)
+	}
+
+	values, err := f.Variable("elevation").ReadAll()
+
+	if err != nil || len(values) != 6 || values[5] != 6 {
+		t.Errorf("unexpected elevation values %v (%v)", values, err)
+	}
+}
+
+func TestGridElevationAt(t *testing.T) {
+	t.Parallel()
+
+	// Rows from south to north, like GEBCO grids
+	path := writeGrid(t, []float64{-1, 0}, []float64{10, 11, 12}, []int16{-100, -200, -32767, 50, 60, 70})
+
+	g, err := OpenGrid(path)
+
+	if err != nil {
+		t.Fatalf("cannot open netCDF grid. Cause: %s", err)
+	}
+
+	defer g.Close()
+
+	elevation, res, err := g.ElevationAt(-0.9, 11.2)
+
+	if err != nil || elevation != -400 || res != 3600 {
+		t.Errorf("expected -400 at 3600 arc seconds but received %d, %d (%v)", elevation, res, err)
+	}
+
+	if elevation, _, _ := g.ElevationAt(0.1, 11.9); elevation != 140 {
+		t.Errorf("expected 140 but received %d", elevation)
+	}
+
+	if _, _, err := g.ElevationAt(-1, 12); !errors.Is(err, ErrNoData) {
+		t.Errorf("expected no data error but received %v", err)
+	}
+
+	if _, _, err := g.ElevationAt(5, 11); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("expected out of bounds error but received %v", err)
+	}
+}
+
+func TestOpenHdf5File(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "netcdf4.nc")
+	os.WriteFile(path, []byte("\x89HDF\r\n\x1a\n"), 0644)
+
+	if _, err := Open(path); !errors.Is(err, ErrUnsupportedFile) {
+		t.Errorf("expected unsupported file error but received %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package srtm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Host of the EarthData login service, which is the machine of EarthData credentials in .netrc files
+const EarthdataMachine = "urs.earthdata.nasa.gov"
+
+var ErrCredentialsNotFound = errors.New("EarthData credentials not found")
+
+// Credentials EarthData username and password
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// ReadNetrc Read the credentials of a machine from a .netrc file, falling back to the default entry.
+// See https://urs.earthdata.nasa.gov/documentation/for_users/data_access/curl_and_wget
+func ReadNetrc(path, machine string) (Credentials, error) {
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return Credentials{}, fmt.Errorf("cannot read netrc file %s. Cause: %w", path, err)
+	}
+
+	var found, def *Credentials
+	var current *Credentials
+
+	fields := netrcFields(b)
+
+	for i := 0; i < len(fields); i++ {
+		next := func() string {
+			if i+1 < len(fields) {
+				i++
+				return fields[i]
+			}
+
+			return ""
+		}
+
+		switch fields[i] {
+		case "machine":
+			current = nil
+
+			if next() == machine && found == nil {
+				found = &Credentials{}
+				current = found
+			}
+		case "default":
+			current = nil
+
+			if def == nil {
+				def = &Credentials{}
+				current = def
+			}
+		case "login":
+			if v := next(); current != nil {
+				current.Username = v
+			}
+		case "password":
+			if v := next(); current != nil {
+				current.Password = v
+			}
+		case "account":
+			next()
+		}
+	}
+
+	if found == nil {
+		found = def
+	}
+
+	if found == nil || found.Username == "" {
+		return Credentials{}, fmt.Errorf("%w. No entry for %s in %s", ErrCredentialsNotFound, machine, path)
+	}
+
+	return *found, nil
+}
+
+// netrcFields Split a .netrc file in tokens, skipping macro definitions, which end at an empty line
+func netrcFields(b []byte) []string {
+	var fields []string
+	inMacro := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		lineFields := strings.Fields(line)
+
+		for _, field := range lineFields {
+			if strings.HasPrefix(field, "#") {
+				break
+			}
+
+			if field == "macdef" {
+				inMacro = true
+				break
+			}
+
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// DefaultNetrcPath Path of the user .netrc file. The NETRC environment variable overrides it, as in curl
+func DefaultNetrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return ""
+	}
+
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+
+	return filepath.Join(home, ".netrc")
+}
+
+// ReadCredentialsFile Read credentials from a file containing username and password separated by a colon
+// (username:password), such as a mounted secret
+func ReadCredentialsFile(path string) (Credentials, error) {
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return Credentials{}, fmt.Errorf("cannot read credentials file %s. Cause: %w", path, err)
+	}
+
+	username, password, ok := strings.Cut(strings.TrimSpace(string(b)), ":")
+
+	if !ok || username == "" {
+		return Credentials{}, fmt.Errorf("%w. Credentials file %s must contain username:password",
+			ErrCredentialsNotFound, path)
+	}
+
+	return Credentials{Username: username, Password: password}, nil
+}
+
+// RunCredentialHelper Run an external command and read the credentials it prints, using the git credential
+// helper format (username=<username> and password=<password> lines)
+func RunCredentialHelper(command string) (Credentials, error) {
+	var cmd *exec.Cmd
+
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=" + EarthdataMachine + "\n\n")
+
+	out, err := cmd.Output()
+
+	if err != nil {
+		return Credentials{}, fmt.Errorf("credential helper failed. Cause: %w", err)
+	}
+
+	var credentials Credentials
+
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, _ := strings.Cut(strings.TrimRight(line, "\r"), "=")
+
+		switch key {
+		case "username":
+			credentials.Username = value
+		case "password":
+			credentials.Password = value
+		}
+	}
+
+	if credentials.Username == "" {
+		return Credentials{}, fmt.Errorf("%w. Credential helper did not print an username", ErrCredentialsNotFound)
+	}
+
+	return credentials, nil
+}
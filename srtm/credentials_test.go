@@ -0,0 +1,85 @@
+package srtm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestReadNetrc(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ".netrc")
+
+	os.WriteFile(path, []byte(`# EarthData
+machine example.com login other password secret
+
+macdef init
+machine urs.earthdata.nasa.gov login macro password macro
+
+machine urs.earthdata.nasa.gov
+	login user
+	password p4ss
+default login anonymous password guest
+`), 0600)
+
+	credentials, err := ReadNetrc(path, EarthdataMachine)
+
+	if err != nil {
+		t.Fatalf("cannot read netrc. Cause: %s", err)
+	}
+
+	if credentials.Username != "user" || credentials.Password != "p4ss" {
+		t.Errorf("unexpected credentials %+v", credentials)
+	}
+
+	credentials, err = ReadNetrc(path, "unknown.org")
+
+	if err != nil || credentials.Username != "anonymous" {
+		t.Errorf("expected default credentials, got %+v (%v)", credentials, err)
+	}
+}
+
+func TestReadNetrcWithoutMachine(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ".netrc")
+	os.WriteFile(path, []byte("machine example.com login other password secret\n"), 0600)
+
+	if _, err := ReadNetrc(path, EarthdataMachine); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Errorf("expected ErrCredentialsNotFound, got %v", err)
+	}
+}
+
+func TestReadCredentialsFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	os.WriteFile(path, []byte("user:pa:ss\n"), 0600)
+
+	credentials, err := ReadCredentialsFile(path)
+
+	if err != nil || credentials.Username != "user" || credentials.Password != "pa:ss" {
+		t.Errorf("unexpected credentials %+v (%v)", credentials, err)
+	}
+}
+
+func TestRunCredentialHelper(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper test uses a POSIX shell")
+	}
+
+	credentials, err := RunCredentialHelper(`grep -q host=urs.earthdata.nasa.gov && printf 'username=user\npassword=secret\n'`)
+
+	if err != nil || credentials.Username != "user" || credentials.Password != "secret" {
+		t.Errorf("unexpected credentials %+v (%v)", credentials, err)
+	}
+
+	if _, err := RunCredentialHelper("exit 1"); err == nil {
+		t.Error("expected an error for a failed helper")
+	}
+}
@@ -0,0 +1,317 @@
+package srtm
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Suffix of files being downloaded
+const partFileSuffix = ".part"
+
+var ErrCorruptedDemFile = errors.New("downloaded DEM file is corrupted")
+
+// fileClient Client of file:// mirrors. Range requests are supported, so interrupted copies are also resumed
+var fileClient = &http.Client{Transport: http.NewFileTransport(http.Dir("/"))}
+
+// downloadToPartFile Download a file, appending to the part file when a previous download was interrupted.
+// Returns the headers of the response, which may carry the file checksum
+func (d *Downloader) downloadToPartFile(url, partPath, accessToken string) (http.Header, error) {
+	var offset int64
+
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	if offset > 0 {
+		log.Infof("Resuming download of %s from byte %d", filepath.Base(url), offset)
+	}
+
+	resp, err := d.request(url, accessToken, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The part file is already complete
+		return resp.Header, nil
+	default:
+		flags |= os.O_TRUNC
+	}
+
+	if err := os.MkdirAll(filepath.Dir(partPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot create file %s. Cause: %w", partPath, err)
+	}
+
+	_, copyErr := io.Copy(file, resp.Body)
+	closeErr := file.Close()
+
+	if copyErr != nil {
+		return nil, fmt.Errorf("download interrupted. It will be resumed on the next attempt. Cause: %w", copyErr)
+	}
+
+	return resp.Header, closeErr
+}
+
+// request Request a file from the SRTM server or mirror, from a byte offset when offset is positive. Returns the
+// response when its status is 200, 206 or 416. Its body must be closed by the caller
+func (d *Downloader) request(url, accessToken string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if accessToken != "" {
+		req.Header.Add("Authorization", "Bearer "+accessToken)
+	}
+
+	if offset > 0 {
+		req.Header.Add("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	client := d.httpClient()
+
+	if req.URL.Scheme == "file" {
+		client = fileClient
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("File %s request completed. Status: %d", filepath.Base(url), resp.StatusCode)
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		resp.Body = &progressReader{ReadCloser: resp.Body, tracker: d.tracker()}
+		return resp, nil
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("received a %d error during file %s request. Cause %w",
+			resp.StatusCode, url, ErrNonExistentDemFile)
+	}
+
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+	return nil, &httpStatusError{StatusCode: resp.StatusCode, RetryAfter: retryAfter}
+}
+
+// download Run a download with the retry policy, authenticated by an EarthData token when Api is defined. Tokens
+// rejected by the server are replaced before the next attempt and files missing on the server are remembered
+func (d *Downloader) download(filename string, fn func(accessToken string) error) error {
+	var token EarthDataToken
+
+	if d.Api != nil {
+		var err error
+		token, err = d.Api.GenerateToken()
+
+		if err != nil {
+			return fmt.Errorf("cannot generate EarthData API token. Cause %w", err)
+		}
+	}
+
+	err := d.withRetries(filename, func() error {
+		err := fn(token.AccessToken)
+
+		// The token expired or was revoked. The next attempt uses a new one, unless the token was pre-issued
+		var statusErr *httpStatusError
+
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized && d.Api != nil {
+			if tokenErr := d.Api.InvalidateToken(); tokenErr != nil {
+				return fmt.Errorf("%s. Cause: %w", err, tokenErr)
+			}
+
+			if newToken, tokenErr := d.Api.GenerateToken(); tokenErr == nil {
+				token = newToken
+			}
+		}
+
+		return err
+	})
+
+	if errors.Is(err, ErrNonExistentDemFile) {
+		d.nonExistentZipFilesMutex.Lock()
+		(*d.nonExistentZipFiles)[filename] = true
+		d.nonExistentZipFilesMutex.Unlock()
+	}
+
+	return err
+}
+
+// verifyDownload Check the zip structure and the CRC of its entries, then compare the file with the checksum
+// published in the response headers (Content-MD5 or Digest) or in the checksums file, when available
+func (d *Downloader) verifyDownload(path, filename string, headers http.Header) error {
+	if err := verifyZip(path); err != nil {
+		return fmt.Errorf("%w. Cause: %s", ErrCorruptedDemFile, err)
+	}
+
+	expected := d.expectedChecksums(filename, headers)
+
+	if len(expected) == 0 {
+		return nil
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), file); err != nil {
+		return err
+	}
+
+	return checkChecksums(expected, map[string]string{
+		"md5":     hex.EncodeToString(md5Hash.Sum(nil)),
+		"sha-256": hex.EncodeToString(sha256Hash.Sum(nil)),
+	})
+}
+
+// checkChecksums Compare the checksums of a file with the expected checksums, both by algorithm
+func checkChecksums(expected, actual map[string]string) error {
+	for algorithm, checksum := range expected {
+		if actual[algorithm] != checksum {
+			return fmt.Errorf("%w. Expected %s %s but file has %s", ErrCorruptedDemFile, algorithm, checksum,
+				actual[algorithm])
+		}
+	}
+
+	return nil
+}
+
+// expectedChecksums Hex encoded checksums of a file by algorithm (md5 or sha-256)
+func (d *Downloader) expectedChecksums(filename string, headers http.Header) map[string]string {
+	checksums := map[string]string{}
+
+	if contentMd5 := headers.Get("Content-MD5"); contentMd5 != "" {
+		if b, err := base64.StdEncoding.DecodeString(contentMd5); err == nil {
+			checksums["md5"] = hex.EncodeToString(b)
+		}
+	}
+
+	// Digest: sha-256=<base64>,md5=<base64> (RFC 3230)
+	for _, digest := range strings.Split(headers.Get("Digest"), ",") {
+		algorithm, value, ok := strings.Cut(strings.TrimSpace(digest), "=")
+		algorithm = strings.ToLower(algorithm)
+
+		if !ok || (algorithm != "md5" && algorithm != "sha-256") {
+			continue
+		}
+
+		if b, err := base64.StdEncoding.DecodeString(value); err == nil {
+			checksums[algorithm] = hex.EncodeToString(b)
+		}
+	}
+
+	if checksum, ok := d.publishedChecksum(filename); ok {
+		switch len(checksum) {
+		case md5.Size * 2:
+			checksums["md5"] = checksum
+		case sha256.Size * 2:
+			checksums["sha-256"] = checksum
+		}
+	}
+
+	return checksums
+}
+
+// publishedChecksum Find the checksum of a file in ChecksumsFile, which uses the md5sum/sha256sum format
+// (<hex checksum>  <file name>)
+func (d *Downloader) publishedChecksum(filename string) (string, bool) {
+	if d.ChecksumsFile == "" {
+		return "", false
+	}
+
+	file, err := os.Open(d.ChecksumsFile)
+
+	if err != nil {
+		log.Warnf("cannot open checksums file %s. Cause: %s", d.ChecksumsFile, err)
+		return "", false
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == filename {
+			return strings.ToLower(fields[0]), true
+		}
+	}
+
+	return "", false
+}
+
+// verifyZip Read every entry of a zip file. archive/zip checks the CRC-32 of each entry at its end
+func verifyZip(path string) error {
+	r, err := zip.OpenReader(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	for _, f := range r.File {
+		rc, err := f.Open()
+
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+
+		if err != nil {
+			return fmt.Errorf("entry %s: %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Downloader) httpClient() *http.Client {
+	if d.HttpClient != nil {
+		return d.HttpClient
+	}
+
+	return http.DefaultClient
+}
@@ -0,0 +1,211 @@
+package srtm
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestDownloader Downloader of a temporary directory using a server which serves payload for every zip
+// file, honoring Range requests
+func newTestDownloader(t *testing.T, payload []byte, headers map[string]string) (*Downloader, *[]string) {
+	t.Helper()
+
+	var ranges []string
+	var mutex sync.Mutex
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/users/token") {
+			fmt.Fprint(w, `[{"access_token": "token", "expiration_date": "1/1/2100"}]`)
+			return
+		}
+
+		mutex.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mutex.Unlock()
+
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+
+		http.ServeContent(w, r, "file.zip", time.Time{}, bytes.NewReader(payload))
+	}))
+
+	t.Cleanup(s.Close)
+
+	d := &Downloader{
+		BasePath:                 s.URL,
+		Dir:                      t.TempDir(),
+		HttpClient:               http.DefaultClient,
+		Api:                      &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient},
+		nonExistentZipFiles:      &map[string]bool{},
+		nonExistentZipFilesMutex: &sync.Mutex{},
+		downloads:                make(map[string]*sync.Mutex),
+		downloadsMutex:           &sync.Mutex{},
+	}
+
+	return d, &ranges
+}
+
+func TestDownloadResumesPartFile(t *testing.T) {
+	t.Parallel()
+
+	payload, _ := os.ReadFile("testdata/files.zip")
+	d, ranges := newTestDownloader(t, payload, nil)
+
+	filename := "N27E086.SRTMGL1.hgt.zip"
+	os.WriteFile(filepath.Join(d.Dir, filename+partFileSuffix), payload[:50], 0644)
+
+	path, err := d.downloadZippedDemFile(d.BasePath + "/" + filename)
+
+	if err != nil {
+		t.Fatalf("cannot download file. Cause: %s", err)
+	}
+
+	b, _ := os.ReadFile(path)
+
+	if !bytes.Equal(b, payload) {
+		t.Error("resumed file is different from the payload")
+	}
+
+	if len(*ranges) != 1 || (*ranges)[0] != "bytes=50-" {
+		t.Errorf("expected a single request for bytes=50- but received %v", *ranges)
+	}
+
+	if _, err := os.Stat(path + partFileSuffix); err == nil {
+		t.Error("part file was not renamed")
+	}
+}
+
+func TestDownloadRejectsCorruptedZip(t *testing.T) {
+	t.Parallel()
+
+	d, _ := newTestDownloader(t, []byte("PK\x03\x04 truncated"), nil)
+
+	filename := "N27E086.SRTMGL1.hgt.zip"
+	_, err := d.downloadZippedDemFile(d.BasePath + "/" + filename)
+
+	if !errors.Is(err, ErrCorruptedDemFile) {
+		t.Errorf("expected corrupted file error but received %v", err)
+	}
+
+	for _, name := range []string{filename, filename + partFileSuffix} {
+		if _, err := os.Stat(filepath.Join(d.Dir, name)); err == nil {
+			t.Errorf("corrupted file %s was kept", name)
+		}
+	}
+}
+
+func TestDownloadVerifiesChecksums(t *testing.T) {
+	t.Parallel()
+
+	payload, _ := os.ReadFile("testdata/files.zip")
+	sum := md5.Sum(payload)
+	filename := "N27E086.SRTMGL1.hgt.zip"
+
+	d, _ := newTestDownloader(t, payload, map[string]string{
+		"Content-MD5": base64.StdEncoding.EncodeToString(sum[:]),
+	})
+
+	if _, err := d.downloadZippedDemFile(d.BasePath + "/" + filename); err != nil {
+		t.Errorf("expected a valid checksum but received %s", err)
+	}
+
+	d, _ = newTestDownloader(t, payload, nil)
+	d.ChecksumsFile = filepath.Join(d.Dir, "checksums.sha256")
+	os.WriteFile(d.ChecksumsFile, []byte(strings.Repeat("0", 64)+"  "+filename+"\n"), 0644)
+
+	if _, err := d.downloadZippedDemFile(d.BasePath + "/" + filename); !errors.Is(err, ErrCorruptedDemFile) {
+		t.Errorf("expected checksum mismatch but received %v", err)
+	}
+}
+
+func TestDownloadFromFileMirror(t *testing.T) {
+	t.Parallel()
+
+	payload, _ := os.ReadFile("testdata/files.zip")
+	mirror := t.TempDir()
+	filename := "N27E086.SRTMGL1.hgt.zip"
+	os.WriteFile(filepath.Join(mirror, filename), payload, 0644)
+
+	abs, _ := filepath.Abs(mirror)
+	d := &Downloader{BasePath: "file://" + filepath.ToSlash(abs) + "/", Dir: t.TempDir()}
+	d.init()
+
+	// Interrupted copies are resumed as HTTP downloads
+	os.WriteFile(filepath.Join(d.Dir, filename+partFileSuffix), payload[:40], 0644)
+
+	path, err := d.downloadZippedDemFile(d.fileUrl(filename))
+
+	if err != nil {
+		t.Fatalf("cannot copy file from mirror. Cause: %s", err)
+	}
+
+	if b, _ := os.ReadFile(path); !bytes.Equal(b, payload) {
+		t.Error("copied file is different from the mirror file")
+	}
+
+	_, err = d.downloadZippedDemFile(d.fileUrl("N00E000.SRTMGL1.hgt.zip"))
+
+	if !errors.Is(err, ErrNonExistentDemFile) {
+		t.Errorf("expected ErrNonExistentDemFile, got %v", err)
+	}
+}
+
+func TestDownloadFromMirrorWithoutAuthentication(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || strings.Contains(r.URL.Path, "/users/") {
+			http.Error(w, "unexpected authentication", http.StatusBadRequest)
+			return
+		}
+
+		w.Write(testHgtZip("N27E086.hgt"))
+	}))
+
+	defer s.Close()
+
+	d := &Downloader{BasePath: s.URL, Dir: t.TempDir(), HttpClient: http.DefaultClient}
+
+	if _, err := d.DownloadDemFile(27.5, 86.5); err != nil {
+		t.Errorf("cannot download file from mirror. Cause: %s", err)
+	}
+}
+
+func TestOfflineDownloader(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL)
+	}))
+
+	defer s.Close()
+
+	d := &Downloader{BasePath: s.URL, Dir: t.TempDir(), HttpClient: http.DefaultClient, Offline: true,
+		Api: &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient}}
+
+	if _, err := d.DownloadDemFile(27.5, 86.5); !errors.Is(err, ErrOffline) {
+		t.Errorf("expected ErrOffline, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(d.Dir, "N27E086.hgt"), []byte{}, 0644)
+
+	if path, err := d.DownloadDemFile(27.5, 86.5); err != nil || filepath.Base(path) != "N27E086.hgt" {
+		t.Errorf("expected existing file, got %s (%v)", path, err)
+	}
+
+	if _, err := d.DownloadRegion(BboxRegion(86, 27, 87, 28)); !errors.Is(err, ErrOffline) {
+		t.Errorf("expected ErrOffline, got %v", err)
+	}
+}
@@ -6,83 +6,130 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 const defaultEarthDataBaseUrl = "https://urs.earthdata.nasa.gov/api"
 
+// Layout of EarthData tokens expiration dates (e.g.: 08/09/2022)
+const earthDataDateLayout = "1/2/2006"
+
+// Tokens expiring in less than this margin are refreshed, so they do not expire during a download
+const tokenExpirationMargin = time.Hour
+
+// Lifetime assumed for issued tokens whose expiration date cannot be parsed
+const defaultTokenLifetime = 24 * time.Hour
+
+var ErrInvalidToken = errors.New("invalid EarthData token")
+
 type EarthDataToken struct {
 	AccessToken    string `json:"access_token"`
 	ExpirationDate string `json:"expiration_date"`
 }
 
 type EarthdataApi struct {
-	BaseUrl    string
-	Username   string
-	Password   string
+	BaseUrl  string
+	Username string
+	Password string
+	// Token Pre-issued bearer token, used instead of username and password
+	Token string
+	// TokenFile File where the last token is persisted, so it is reused by the next runs. Empty disables it
+	TokenFile  string
 	HttpClient *http.Client
 	tokens     []EarthDataToken
+	token      *EarthDataToken
+	// tokenExpiry Expiration of the cached token
+	tokenExpiry time.Time
+	mutex       sync.Mutex
 }
 
-func (a EarthdataApi) GenerateToken() (EarthDataToken, error) {
+// tokenFile Persisted token of an user, with its expiration
+type tokenFile struct {
+	Username  string         `json:"username"`
+	Token     EarthDataToken `json:"token"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+}
+
+// GenerateToken Return a valid token. Tokens are reused while they are not expired, from memory or from
+// TokenFile. Otherwise, an existing token is recovered from the API, expired tokens are revoked and a new token
+// is issued when there is no valid one
+func (a *EarthdataApi) GenerateToken() (EarthDataToken, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.Token != "" {
+		return EarthDataToken{AccessToken: a.Token}, nil
+	}
+
+	if a.token != nil && isUnexpired(a.tokenExpiry) {
+		return *a.token, nil
+	}
+
+	if token, expiry, ok := a.loadToken(); ok {
+		a.token, a.tokenExpiry = &token, expiry
+		return token, nil
+	}
+
 	if a.BaseUrl == "" {
 		a.BaseUrl = defaultEarthDataBaseUrl
 	}
 
-	tokens, err := a.GetAvailableTokens()
+	_, err := a.GetAvailableTokens()
 
 	if err != nil {
 		log.Warnf("Cannot recover available tokens from EarthData API. Cause: %s", err)
 		return EarthDataToken{}, fmt.Errorf("canoot recover tokens from API. Cause: %w", err)
 	}
 
-	if len(tokens) > 0 {
-		return tokens[0], nil
-	}
-
 	token, err := a.getValidToken()
 
-	if err == nil {
-		return token, nil
-	}
-
-	url := a.BaseUrl + "/users/token"
-
-	req, _ := http.NewRequest("POST", url, nil)
-	req.SetBasicAuth(a.Username, a.Password)
+	if err != nil {
+		a.revokeExpiredTokens()
 
-	resp, err := a.HttpClient.Do(req)
+		token, err = a.issueToken()
 
-	if err != nil {
-		err := fmt.Errorf("cannot issue an EarthData token. Cause: %w", err)
-		log.Errorf(err.Error())
-		return token, err
+		if err != nil {
+			return token, err
+		}
 	}
 
-	if resp.StatusCode != 200 {
-		msg := fmt.Sprintf("received a %d error during EarthData token request", resp.StatusCode)
-		return token, errors.New(msg)
-	}
+	a.token, a.tokenExpiry = &token, tokenExpiry(token)
+	a.saveToken(token, a.tokenExpiry)
 
-	defer resp.Body.Close()
+	return token, nil
+}
 
-	responseData, err := io.ReadAll(resp.Body)
+// InvalidateToken Discard the cached token, after it is rejected by the server. The next GenerateToken call
+// recovers or issues another token. Pre-issued tokens cannot be replaced, so ErrInvalidToken is returned
+func (a *EarthdataApi) InvalidateToken() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 
-	if err != nil {
-		return token, nil
+	if a.Token != "" {
+		return fmt.Errorf("pre-issued token was rejected. Cause: %w", ErrInvalidToken)
 	}
 
-	err = json.Unmarshal(responseData, &token)
+	if a.token != nil {
+		log.Warn("EarthData token was rejected. A new token will be requested")
+	}
 
-	if err != nil {
-		return token, errors.New("cannot parse EarthData token response")
+	a.token = nil
+	a.tokens = nil
+
+	if a.TokenFile != "" {
+		os.Remove(a.TokenFile)
 	}
 
-	return token, nil
+	return nil
 }
 
-func (a EarthdataApi) GetAvailableTokens() ([]EarthDataToken, error) {
+func (a *EarthdataApi) GetAvailableTokens() ([]EarthDataToken, error) {
 	if a.BaseUrl == "" {
 		a.BaseUrl = defaultEarthDataBaseUrl
 	}
@@ -100,12 +147,12 @@ func (a EarthdataApi) GetAvailableTokens() ([]EarthDataToken, error) {
 		return nil, err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("received a %d error during EarthData token request", resp.StatusCode)
 	}
 
-	defer resp.Body.Close()
-
 	responseData, err := io.ReadAll(resp.Body)
 
 	if err != nil {
@@ -124,7 +171,77 @@ func (a EarthdataApi) GetAvailableTokens() ([]EarthDataToken, error) {
 	return tokens, nil
 }
 
-func (a EarthdataApi) getValidToken() (EarthDataToken, error) {
+// issueToken Create a new token. Freshly issued tokens are used even when their expiration date cannot be
+// parsed, for defaultTokenLifetime (see tokenExpiry)
+func (a *EarthdataApi) issueToken() (EarthDataToken, error) {
+	var token EarthDataToken
+
+	url := a.BaseUrl + "/users/token"
+
+	req, _ := http.NewRequest("POST", url, nil)
+	req.SetBasicAuth(a.Username, a.Password)
+
+	resp, err := a.HttpClient.Do(req)
+
+	if err != nil {
+		err := fmt.Errorf("cannot issue an EarthData token. Cause: %w", err)
+		log.Errorf(err.Error())
+		return token, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		msg := fmt.Sprintf("received a %d error during EarthData token request", resp.StatusCode)
+		return token, errors.New(msg)
+	}
+
+	responseData, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return token, fmt.Errorf("cannot read EarthData API response from %s", url)
+	}
+
+	err = json.Unmarshal(responseData, &token)
+
+	if err != nil || token.AccessToken == "" {
+		return token, errors.New("cannot parse EarthData token response")
+	}
+
+	log.Infof("New EarthData token issued. It expires at %s", token.ExpirationDate)
+
+	return token, nil
+}
+
+// revokeExpiredTokens Revoke the expired tokens of the user. EarthData allows only two tokens per user, so
+// expired tokens must be revoked before a new one is issued
+func (a *EarthdataApi) revokeExpiredTokens() {
+	for _, t := range a.tokens {
+		if t.isValid() {
+			continue
+		}
+
+		req, _ := http.NewRequest("POST", a.BaseUrl+"/users/revoke_token?token="+url.QueryEscape(t.AccessToken), nil)
+		req.SetBasicAuth(a.Username, a.Password)
+
+		resp, err := a.HttpClient.Do(req)
+
+		if err != nil {
+			log.Warnf("cannot revoke expired EarthData token. Cause: %s", err)
+			continue
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			log.Warnf("received a %d error during EarthData token revocation", resp.StatusCode)
+		}
+	}
+
+	a.tokens = nil
+}
+
+func (a *EarthdataApi) getValidToken() (EarthDataToken, error) {
 	for _, t := range a.tokens {
 		if t.isValid() {
 			return t, nil
@@ -134,6 +251,87 @@ func (a EarthdataApi) getValidToken() (EarthDataToken, error) {
 	return EarthDataToken{}, errors.New("cannot get a valid token")
 }
 
+// loadToken Read the token persisted by a previous run and its expiration. Tokens of other users and expired
+// tokens are ignored
+func (a *EarthdataApi) loadToken() (EarthDataToken, time.Time, bool) {
+	if a.TokenFile == "" {
+		return EarthDataToken{}, time.Time{}, false
+	}
+
+	b, err := os.ReadFile(a.TokenFile)
+
+	if err != nil {
+		return EarthDataToken{}, time.Time{}, false
+	}
+
+	var f tokenFile
+
+	if err := json.Unmarshal(b, &f); err != nil || f.Username != a.Username || f.Token.AccessToken == "" {
+		return EarthDataToken{}, time.Time{}, false
+	}
+
+	// Files saved without expiration use the expiration date of the token
+	if f.ExpiresAt.IsZero() {
+		f.ExpiresAt, _ = f.Token.Expiration()
+	}
+
+	if !isUnexpired(f.ExpiresAt) {
+		return EarthDataToken{}, time.Time{}, false
+	}
+
+	return f.Token, f.ExpiresAt, true
+}
+
+// saveToken Persist a token and its expiration to TokenFile. The file is only readable by its owner
+func (a *EarthdataApi) saveToken(token EarthDataToken, expiry time.Time) {
+	if a.TokenFile == "" {
+		return
+	}
+
+	b, _ := json.Marshal(tokenFile{Username: a.Username, Token: token, ExpiresAt: expiry})
+
+	err := os.MkdirAll(filepath.Dir(a.TokenFile), 0700)
+
+	if err == nil {
+		err = os.WriteFile(a.TokenFile, b, 0600)
+	}
+
+	if err != nil {
+		log.Warnf("cannot save EarthData token to %s. Cause: %s", a.TokenFile, err)
+	}
+}
+
+// Expiration Parse the expiration date of the token. Tokens expire at the start of the day, in UTC
+func (t EarthDataToken) Expiration() (time.Time, error) {
+	expiration, err := time.Parse(earthDataDateLayout, t.ExpirationDate)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w. Cannot parse expiration date %s", ErrInvalidToken, t.ExpirationDate)
+	}
+
+	return expiration, nil
+}
+
 func (t EarthDataToken) isValid() bool {
-	return true
+	if t.AccessToken == "" {
+		return false
+	}
+
+	expiration, err := t.Expiration()
+
+	return err == nil && isUnexpired(expiration)
+}
+
+// tokenExpiry Expiration of a token, or defaultTokenLifetime from now when its expiration date cannot be parsed
+func tokenExpiry(t EarthDataToken) time.Time {
+	if expiration, err := t.Expiration(); err == nil {
+		return expiration
+	}
+
+	return time.Now().Add(defaultTokenLifetime)
+}
+
+// isUnexpired Check if an expiration is farther than tokenExpirationMargin
+func isUnexpired(expiration time.Time) bool {
+	return time.Now().Add(tokenExpirationMargin).Before(expiration)
 }
@@ -5,8 +5,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var earthdataServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -40,3 +44,184 @@ func TestGenerateToken(t *testing.T) {
 		t.Errorf("error during Earthdata API token generation. Cause: %s", err)
 	}
 }
+
+// newTokenServer EarthData API returning existing tokens and counting the requests by path
+func newTokenServer(t *testing.T, existing []EarthDataToken) (*httptest.Server, map[string]int) {
+	t.Helper()
+
+	var mutex sync.Mutex
+	requests := map[string]int{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		mutex.Unlock()
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /users/tokens":
+			json.NewEncoder(w).Encode(existing)
+		case "POST /users/token":
+			json.NewEncoder(w).Encode(EarthDataToken{AccessToken: "new", ExpirationDate: "1/1/2100"})
+		case "POST /users/revoke_token":
+			if r.URL.Query().Get("token") == "" {
+				http.Error(w, "missing token", http.StatusBadRequest)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s, requests
+}
+
+func TestGenerateTokenIsCached(t *testing.T) {
+	t.Parallel()
+
+	s, requests := newTokenServer(t, []EarthDataToken{{AccessToken: "existing", ExpirationDate: "12/31/2099"}})
+	earthdataApi := &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient}
+
+	for i := 0; i < 3; i++ {
+		token, err := earthdataApi.GenerateToken()
+
+		if err != nil || token.AccessToken != "existing" {
+			t.Fatalf("expected existing token, got %v (%v)", token, err)
+		}
+	}
+
+	if requests["GET /users/tokens"] != 1 || requests["POST /users/token"] != 0 {
+		t.Errorf("expected a single tokens request, got %v", requests)
+	}
+}
+
+func TestGenerateTokenWithoutExpirationDateIsCached(t *testing.T) {
+	t.Parallel()
+
+	var issued int32
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /users/tokens":
+			json.NewEncoder(w).Encode([]EarthDataToken{})
+		case "POST /users/token":
+			atomic.AddInt32(&issued, 1)
+			json.NewEncoder(w).Encode(EarthDataToken{AccessToken: "new", ExpirationDate: "not a date"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	defer s.Close()
+
+	earthdataApi := &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient}
+
+	for i := 0; i < 3; i++ {
+		if token, err := earthdataApi.GenerateToken(); err != nil || token.AccessToken != "new" {
+			t.Fatalf("expected new token, got %v (%v)", token, err)
+		}
+	}
+
+	if issued != 1 {
+		t.Errorf("expected a single token to be issued, got %d", issued)
+	}
+}
+
+func TestGenerateTokenRevokesExpiredTokens(t *testing.T) {
+	t.Parallel()
+
+	s, requests := newTokenServer(t, []EarthDataToken{{AccessToken: "expired", ExpirationDate: "08/09/2022"}})
+	earthdataApi := &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient}
+
+	token, err := earthdataApi.GenerateToken()
+
+	if err != nil || token.AccessToken != "new" {
+		t.Fatalf("expected new token, got %v (%v)", token, err)
+	}
+
+	if requests["POST /users/revoke_token"] != 1 || requests["POST /users/token"] != 1 {
+		t.Errorf("expected the expired token to be revoked and a new one issued, got %v", requests)
+	}
+
+	earthdataApi.InvalidateToken()
+	earthdataApi.GenerateToken()
+
+	if requests["GET /users/tokens"] != 2 {
+		t.Errorf("expected tokens to be requested again after invalidation, got %v", requests)
+	}
+}
+
+func TestGenerateTokenIsPersisted(t *testing.T) {
+	t.Parallel()
+
+	s, requests := newTokenServer(t, nil)
+	tokenFile := filepath.Join(t.TempDir(), "token.json")
+
+	earthdataApi := &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient, Username: "user",
+		TokenFile: tokenFile}
+
+	if _, err := earthdataApi.GenerateToken(); err != nil {
+		t.Fatalf("cannot generate token. Cause: %s", err)
+	}
+
+	// A new run reads the token from the file
+	earthdataApi = &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient, Username: "user",
+		TokenFile: tokenFile}
+
+	token, err := earthdataApi.GenerateToken()
+
+	if err != nil || token.AccessToken != "new" {
+		t.Fatalf("expected persisted token, got %v (%v)", token, err)
+	}
+
+	if requests["POST /users/token"] != 1 || requests["GET /users/tokens"] != 1 {
+		t.Errorf("expected the persisted token to be reused, got %v", requests)
+	}
+
+	// Tokens of other users are ignored
+	earthdataApi = &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient, Username: "other",
+		TokenFile: tokenFile}
+	earthdataApi.GenerateToken()
+
+	if requests["GET /users/tokens"] != 2 {
+		t.Errorf("expected the token of another user to be ignored, got %v", requests)
+	}
+}
+
+func TestPreIssuedToken(t *testing.T) {
+	t.Parallel()
+
+	earthdataApi := &EarthdataApi{BaseUrl: "http://127.0.0.1:0", HttpClient: http.DefaultClient, Token: "bearer"}
+
+	token, err := earthdataApi.GenerateToken()
+
+	if err != nil || token.AccessToken != "bearer" {
+		t.Errorf("expected pre-issued token, got %v (%v)", token, err)
+	}
+}
+
+func TestTokenExpiration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		token EarthDataToken
+		valid bool
+	}{
+		{EarthDataToken{AccessToken: "a", ExpirationDate: "08/09/2022"}, false},
+		{EarthDataToken{AccessToken: "a", ExpirationDate: "1/1/2100"}, true},
+		{EarthDataToken{AccessToken: "a", ExpirationDate: "not a date"}, false},
+		{EarthDataToken{ExpirationDate: "1/1/2100"}, false},
+	}
+
+	for _, test := range tests {
+		if test.token.isValid() != test.valid {
+			t.Errorf("expected %v to be valid: %v", test.token, test.valid)
+		}
+	}
+
+	expiration, _ := EarthDataToken{ExpirationDate: "08/09/2022"}.Expiration()
+
+	if !expiration.Equal(time.Date(2022, 8, 9, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiration %s", expiration)
+	}
+}
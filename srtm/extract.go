@@ -0,0 +1,449 @@
+package srtm
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Storage Format of the HGT files saved in the DEM directory
+type Storage string
+
+const (
+	// Uncompressed HGT files (.hgt), read directly from disk
+	Uncompressed Storage = "hgt"
+	// Gzip HGT files compressed with gzip (.hgt.gz), about 60% smaller
+	Gzip Storage = "gz"
+	// Zip HGT files kept in their zip archive (.hgt.zip), as published by the SRTM server
+	Zip Storage = "zip"
+)
+
+// Suffixes of the HGT files of each storage, in the order they are looked up
+var demFileSuffixes = []string{".hgt", ".hgt.gz", ".hgt.zip"}
+
+var ErrUnsafeZipEntry = errors.New("zip entry escapes the DEM directory")
+
+// ParseStorage Parse a storage name (hgt, gz or zip). An empty name is the uncompressed storage
+func ParseStorage(name string) (Storage, error) {
+	switch s := Storage(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), ".")); s {
+	case "", "hgt":
+		return Uncompressed, nil
+	case Gzip, "gzip", "hgt.gz":
+		return Gzip, nil
+	case Zip, "hgt.zip":
+		return Zip, nil
+	default:
+		return "", fmt.Errorf("unknown DEM storage %s. Use hgt, gz or zip", name)
+	}
+}
+
+// fileName Name of a HGT file in this storage (e.g.: N27E086.hgt is N27E086.hgt.gz with Gzip storage)
+func (s Storage) fileName(hgtName string) string {
+	switch s {
+	case Gzip, Zip:
+		return hgtName + "." + string(s)
+	default:
+		return hgtName
+	}
+}
+
+// fetchDemFile Download a zip file from the SRTM server and save its HGT file in the configured storage.
+// Returns the path of the saved file
+func (d *Downloader) fetchDemFile(filename string) (string, error) {
+	name := hgtFileName(filename)
+
+	unlock := d.lock(name)
+	defer unlock()
+
+	if path, ok := d.localDemFile(name); ok {
+		return path, nil
+	}
+
+	if d.Offline {
+		return "", ErrOffline
+	}
+
+	if d.isZipFileNonExistent(filename) {
+		return "", ErrNonExistentDemFile
+	}
+
+	// Zip files are downloaded to disk first, so interrupted downloads can be resumed
+	if d.Storage == Zip {
+		zipPath, err := d.downloadZippedDemFile(d.fileUrl(filename))
+
+		if err != nil {
+			return "", err
+		}
+
+		return d.installZipFile(zipPath)
+	}
+
+	return d.streamDemFile(filename)
+}
+
+// streamDemFile Download a zip file and extract its HGT file while it is received. The archive is also written
+// to a .part file, so an interrupted download is resumed with an HTTP Range request, extracting the part
+// already received before the rest of the response. The part file is removed once the HGT file is saved
+func (d *Downloader) streamDemFile(filename string) (string, error) {
+	name := hgtFileName(filename)
+	demFilePath := filepath.Join(d.Dir, d.Storage.fileName(name))
+	partPath := filepath.Join(d.Dir, filename) + partFileSuffix
+
+	log.Infof("Downloading file %s from SRTM30m server...", filename)
+
+	start := time.Now()
+
+	err := d.download(filename, func(accessToken string) error {
+		err := d.streamPartFile(filename, partPath, accessToken, func(body io.Reader, headers http.Header) error {
+			return writeDemFile(demFilePath, func(w io.Writer) error {
+				return d.extractStream(body, filename, headers, w)
+			})
+		})
+
+		// Corrupted archives are downloaded again from the start
+		if errors.Is(err, ErrCorruptedDemFile) || errors.Is(err, ErrUnsafeZipEntry) {
+			os.Remove(partPath)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		log.Errorf("cannot download hgt file %s. Cause: %s", filename, err)
+		return "", err
+	}
+
+	if err := os.Remove(partPath); err != nil {
+		log.Warnf("cannot remove part file %s. Cause: %s", partPath, err)
+	}
+
+	log.Infof("File %s downloaded in %s", filename, time.Since(start))
+
+	return demFilePath, nil
+}
+
+// streamPartFile Request a zip file from the end of its part file and call read with the whole archive: the
+// bytes of the part file followed by the response body, which is appended to the part file while it is read
+func (d *Downloader) streamPartFile(filename, partPath, accessToken string,
+	read func(body io.Reader, headers http.Header) error) error {
+	var offset int64
+
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	if offset > 0 {
+		log.Infof("Resuming download of %s from byte %d", filename, offset)
+	}
+
+	resp, err := d.request(d.fileUrl(filename), accessToken, offset)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	flags := os.O_RDWR | os.O_CREATE
+	var body io.Reader = resp.Body
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The part file is already complete
+		body = strings.NewReader("")
+	default:
+		flags |= os.O_TRUNC
+		offset = 0
+	}
+
+	if err := os.MkdirAll(filepath.Dir(partPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+
+	if err != nil {
+		return fmt.Errorf("cannot create file %s. Cause: %w", partPath, err)
+	}
+
+	defer file.Close()
+
+	return read(io.MultiReader(io.NewSectionReader(file, 0, offset), io.TeeReader(body, file)), resp.Header)
+}
+
+// extractStream Extract the HGT file of a zip archive read from a response body, then compare the archive with
+// its published checksums. Errors reading the body are returned as they are, so the download is retried
+func (d *Downloader) extractStream(body io.Reader, filename string, headers http.Header, w io.Writer) error {
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+
+	reader := &bodyReader{r: body}
+	r := bufio.NewReader(io.TeeReader(reader, io.MultiWriter(md5Hash, sha256Hash)))
+
+	_, err := extractZipStream(r, hgtFileName(filename), w)
+
+	if err == nil {
+		_, err = io.Copy(io.Discard, r)
+	}
+
+	if reader.err != nil {
+		return fmt.Errorf("download interrupted. Cause: %w", reader.err)
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrUnsafeZipEntry) {
+			return err
+		}
+
+		return fmt.Errorf("%w. Cause: %s", ErrCorruptedDemFile, err)
+	}
+
+	return checkChecksums(d.expectedChecksums(filename, headers), map[string]string{
+		"md5":     hex.EncodeToString(md5Hash.Sum(nil)),
+		"sha-256": hex.EncodeToString(sha256Hash.Sum(nil)),
+	})
+}
+
+// installZipFile Save the HGT file of a downloaded zip file in the configured storage. The zip file is removed
+// after its HGT file is extracted
+func (d *Downloader) installZipFile(zipPath string) (string, error) {
+	name := hgtFileName(filepath.Base(zipPath))
+	demFilePath := filepath.Join(d.Dir, d.Storage.fileName(name))
+
+	if d.Storage == Zip {
+		if _, err := extractZipFile(zipPath, name, io.Discard); err != nil {
+			return "", fmt.Errorf("cannot read zip file %s. Cause: %w", zipPath, err)
+		}
+
+		if err := os.Rename(zipPath, demFilePath); err != nil {
+			return "", fmt.Errorf("cannot save %s file. cause: %w", demFilePath, err)
+		}
+
+		return demFilePath, nil
+	}
+
+	err := writeDemFile(demFilePath, func(w io.Writer) error {
+		_, err := extractZipFile(zipPath, name, w)
+		return err
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("cannot unzip file %s. Cause %w", zipPath, err)
+	}
+
+	log.Infof("File %s is uncompressed", zipPath)
+
+	if err := os.Remove(zipPath); err != nil {
+		log.Warnf("cannot remove zip file %s. Cause: %s", zipPath, err)
+	}
+
+	return demFilePath, nil
+}
+
+// localDemFile Path of a HGT file in the DEM directory, in any storage
+func (d *Downloader) localDemFile(hgtName string) (string, bool) {
+	for _, suffix := range demFileSuffixes {
+		path := filepath.Join(d.Dir, strings.TrimSuffix(hgtName, ".hgt")+suffix)
+
+		if d.checkIfDemFileExists(path) {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+// extractZipStream Write the HGT member of a zip stream to w. Every entry name is checked and other members are
+// skipped. Returns the size of the HGT file
+func extractZipStream(r *bufio.Reader, member string, w io.Writer) (int64, error) {
+	var size int64
+	found := false
+
+	for {
+		h, err := nextZipEntry(r)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if !isSafeZipEntry(h.name) {
+			return 0, fmt.Errorf("%w. Entry %s", ErrUnsafeZipEntry, h.name)
+		}
+
+		if found || !isZipMember(h.name, member) {
+			if _, err := readZipEntry(r, h, io.Discard); err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		if size, err = readZipEntry(r, h, w); err != nil {
+			return 0, err
+		}
+
+		if err := checkHgtSize(size); err != nil {
+			return 0, err
+		}
+
+		found = true
+	}
+
+	if !found {
+		return 0, fmt.Errorf("zip file does not contain %s", member)
+	}
+
+	return size, nil
+}
+
+// extractZipFile Write the HGT member of a zip file to w. Every entry name is checked and other members are
+// ignored. Returns the size of the HGT file
+func extractZipFile(zipPath, member string, w io.Writer) (int64, error) {
+	r, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer r.Close()
+
+	var entry *zip.File
+
+	for _, f := range r.File {
+		if !isSafeZipEntry(f.Name) {
+			return 0, fmt.Errorf("%w. Entry %s", ErrUnsafeZipEntry, f.Name)
+		}
+
+		if entry == nil && isZipMember(f.Name, member) {
+			entry = f
+		}
+	}
+
+	if entry == nil {
+		return 0, fmt.Errorf("zip file does not contain %s", member)
+	}
+
+	rc, err := entry.Open()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer rc.Close()
+
+	// archive/zip checks the CRC-32 of the entry when it is read to the end
+	size, err := io.Copy(w, rc)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return size, checkHgtSize(size)
+}
+
+// writeDemFile Write a HGT file to a temporary .part file, compressed when path ends with .gz, and move it to
+// path only when write succeeds
+func writeDemFile(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	partPath := path + partFileSuffix
+	file, err := os.Create(partPath)
+
+	if err != nil {
+		return fmt.Errorf("cannot create file %s. Cause: %w", partPath, err)
+	}
+
+	var w io.Writer = file
+	var gz *gzip.Writer
+
+	if strings.HasSuffix(path, ".gz") {
+		gz = gzip.NewWriter(file)
+		w = gz
+	}
+
+	err = write(w)
+
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(partPath)
+		return err
+	}
+
+	return os.Rename(partPath, path)
+}
+
+// isSafeZipEntry Check if a zip entry name is a relative path which stays inside the extraction directory
+func isSafeZipEntry(name string) bool {
+	if name == "" || strings.ContainsAny(name, `\:`) || path.IsAbs(name) {
+		return false
+	}
+
+	for _, element := range strings.Split(name, "/") {
+		if element == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isZipMember Check if a zip entry is the expected HGT file. Zip files of some mirrors have upper case names
+func isZipMember(name, member string) bool {
+	return strings.EqualFold(path.Base(name), member)
+}
+
+// checkHgtSize Check if a size matches the 1 or 3 arc seconds layout
+func checkHgtSize(size int64) error {
+	if size != hgtFileSize && size != hgt3FileSize {
+		return fmt.Errorf("%w. Size is %d bytes, expected %d (1 arc second) or %d (3 arc seconds)",
+			ErrInvalidHgtFile, size, hgtFileSize, hgt3FileSize)
+	}
+
+	return nil
+}
+
+// bodyReader Reader which records the errors of the underlying reader, telling network errors apart from
+// corrupted archives
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+
+	return n, err
+}
@@ -0,0 +1,390 @@
+package srtm
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Elevation of every sample of the test HGT files
+const testElevation = 100
+
+// testHgt 3 arc seconds HGT file with every sample at testElevation
+func testHgt() []byte {
+	b := make([]byte, hgt3FileSize)
+
+	for i := 0; i < len(b); i += 2 {
+		b[i+1] = testElevation
+	}
+
+	return b
+}
+
+// testHgtZip Zip file with a test HGT file for each member name
+func testHgtZip(members ...string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	for _, member := range members {
+		f, _ := w.CreateHeader(&zip.FileHeader{Name: member, Method: zip.Deflate})
+		f.Write(testHgt())
+	}
+
+	w.Close()
+
+	return buf.Bytes()
+}
+
+// newHgtServer Server answering each zip file request with a zip file containing its HGT file
+func newHgtServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testHgtZip(hgtFileName(path.Base(r.URL.Path))))
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestStreamDemFile(t *testing.T) {
+	t.Parallel()
+
+	for _, storage := range []Storage{Uncompressed, Gzip, Zip} {
+		s := newHgtServer(t)
+		d := &Downloader{BasePath: s.URL, Dir: t.TempDir(), HttpClient: http.DefaultClient, Storage: storage}
+
+		path, err := d.DownloadDemFile(27.5, 86.5)
+
+		if err != nil {
+			t.Fatalf("cannot download file with %s storage. Cause: %s", storage, err)
+		}
+
+		if filepath.Base(path) != storage.fileName("N27E086.hgt") {
+			t.Errorf("unexpected file %s with %s storage", path, storage)
+		}
+
+		if err := VerifyHgtFile(path); err != nil {
+			t.Errorf("invalid file with %s storage. Cause: %s", storage, err)
+		}
+
+		entries, _ := os.ReadDir(d.Dir)
+
+		if len(entries) != 1 {
+			t.Errorf("expected only the HGT file in the directory with %s storage, got %d files", storage,
+				len(entries))
+		}
+	}
+}
+
+func TestStreamDemFileResumesInterruptedDownload(t *testing.T) {
+	t.Parallel()
+
+	payload := testHgtZip("N27E086.hgt")
+
+	var ranges []string
+	var mutex sync.Mutex
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mutex.Unlock()
+
+		// The first response is cut in the middle of the archive
+		if first {
+			w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+			w.Write(payload[:len(payload)/2])
+			return
+		}
+
+		http.ServeContent(w, r, "file.zip", time.Time{}, bytes.NewReader(payload))
+	}))
+
+	defer s.Close()
+
+	d := &Downloader{BasePath: s.URL, Dir: t.TempDir(), HttpClient: http.DefaultClient, Storage: Uncompressed,
+		Retry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}}
+
+	path, err := d.DownloadDemFile(27.5, 86.5)
+
+	if err != nil {
+		t.Fatalf("cannot download file. Cause: %s", err)
+	}
+
+	if err := VerifyHgtFile(path); err != nil {
+		t.Errorf("invalid resumed file. Cause: %s", err)
+	}
+
+	if len(ranges) != 2 || ranges[0] != "" || ranges[1] != fmt.Sprintf("bytes=%d-", len(payload)/2) {
+		t.Errorf("expected the second request to resume from byte %d, got ranges %v", len(payload)/2, ranges)
+	}
+
+	if entries, _ := os.ReadDir(d.Dir); len(entries) != 1 {
+		t.Errorf("expected only the HGT file in the directory, got %d files", len(entries))
+	}
+}
+
+func TestStreamDemFileSkipsOtherMembers(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, _ := zw.Create("README.txt")
+	f.Write([]byte("SRTM"))
+
+	// Stored entries must have their sizes in the local header, so they are written raw
+	data := testHgt()
+	f, _ = zw.CreateRaw(&zip.FileHeader{Name: "n27e086.hgt", Method: zip.Store, CRC32: crc32.ChecksumIEEE(data),
+		CompressedSize64: uint64(len(data)), UncompressedSize64: uint64(len(data))})
+	f.Write(data)
+	zw.Close()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+
+	defer s.Close()
+
+	d := &Downloader{BasePath: s.URL, Dir: t.TempDir(), HttpClient: http.DefaultClient}
+
+	if _, err := d.DownloadDemFile(27.5, 86.5); err != nil {
+		t.Fatalf("cannot download file. Cause: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(d.Dir, "README.txt")); err == nil {
+		t.Error("unexpected member extracted")
+	}
+}
+
+func TestStreamDemFileRejectsUnsafeEntries(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"../N27E086.hgt", "/tmp/N27E086.hgt", `..\N27E086.hgt`, "C:N27E086.hgt"} {
+		payload := testHgtZip(name)
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(payload)
+		}))
+
+		parent := t.TempDir()
+		d := &Downloader{BasePath: s.URL, Dir: filepath.Join(parent, "dem"), HttpClient: http.DefaultClient}
+
+		if _, err := d.DownloadDemFile(27.5, 86.5); !errors.Is(err, ErrUnsafeZipEntry) {
+			t.Errorf("expected ErrUnsafeZipEntry for %s, got %v", name, err)
+		}
+
+		if entries, _ := os.ReadDir(parent); len(entries) > 1 {
+			t.Errorf("unexpected files written for %s", name)
+		}
+
+		s.Close()
+	}
+}
+
+func TestStreamDemFileRejectsInvalidArchives(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string][]byte{
+		"missing member": testHgtZip("N00E000.hgt"),
+		"truncated":      testHgtZip("N27E086.hgt")[:200],
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, _ := zw.Create("N27E086.hgt")
+	f.Write([]byte{1, 2, 3})
+	zw.Close()
+
+	tests["invalid size"] = buf.Bytes()
+
+	for name, payload := range tests {
+		payload := payload
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(payload)
+		}))
+
+		d := &Downloader{BasePath: s.URL, Dir: t.TempDir(), HttpClient: http.DefaultClient,
+			Retry: RetryPolicy{MaxAttempts: 1}}
+
+		if _, err := d.DownloadDemFile(27.5, 86.5); !errors.Is(err, ErrCorruptedDemFile) {
+			t.Errorf("expected ErrCorruptedDemFile for %s, got %v", name, err)
+		}
+
+		if entries, _ := os.ReadDir(d.Dir); len(entries) != 0 {
+			t.Errorf("unexpected files left for %s", name)
+		}
+
+		s.Close()
+	}
+}
+
+func TestExtractZipFileRejectsUnsafeEntries(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "N27E086.SRTMGL1.hgt.zip")
+	os.WriteFile(zipPath, testHgtZip("../../N27E086.hgt", "N27E086.hgt"), 0644)
+
+	d := &Downloader{Dir: filepath.Join(dir, "dem")}
+
+	if _, err := d.installZipFile(zipPath); !errors.Is(err, ErrUnsafeZipEntry) {
+		t.Errorf("expected ErrUnsafeZipEntry, got %v", err)
+	}
+
+	os.WriteFile(zipPath, testHgtZip("N27E086.hgt"), 0644)
+
+	path, err := d.installZipFile(zipPath)
+
+	if err != nil || filepath.Base(path) != "N27E086.hgt" {
+		t.Fatalf("cannot extract zip file. Cause: %v", err)
+	}
+
+	if _, err := os.Stat(zipPath); err == nil {
+		t.Error("zip file was not removed")
+	}
+}
+
+func TestCompressedDataDir(t *testing.T) {
+	t.Parallel()
+
+	s := newHgtServer(t)
+	dir := t.TempDir()
+
+	cells := map[Storage][2]float64{Uncompressed: {27.5, 86.5}, Gzip: {27.5, 87.5}, Zip: {28.5, 86.5}}
+
+	for storage, cell := range cells {
+		d := &Downloader{BasePath: s.URL, Dir: dir, HttpClient: http.DefaultClient, Storage: storage}
+
+		if _, err := d.DownloadDemFile(cell[0], cell[1]); err != nil {
+			t.Fatalf("cannot download file. Cause: %s", err)
+		}
+	}
+
+	c, err := OpenCompressedDataDir(dir, 2)
+
+	if err != nil {
+		t.Fatalf("cannot open directory. Cause: %s", err)
+	}
+
+	defer c.Close()
+
+	for storage, cell := range cells {
+		e, res, err := c.ElevationAt(cell[0], cell[1])
+
+		if err != nil || e != testElevation || res != 3 {
+			t.Errorf("unexpected elevation %d (resolution %d) with %s storage. Cause: %v", e, res, storage, err)
+		}
+	}
+
+	if c.lru.Len() != 2 {
+		t.Errorf("expected 2 open files, got %d", c.lru.Len())
+	}
+
+	if _, _, err := c.ElevationAt(0.5, 0.5); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing file, got %v", err)
+	}
+}
+
+func TestCompressedDataDirClosesQuota(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "N27E086.hgt"), testHgt(), 0644)
+
+	c, err := OpenCompressedDataDir(dir, 2)
+
+	if err != nil {
+		t.Fatalf("cannot open directory. Cause: %s", err)
+	}
+
+	c.Quota = NewDiskQuota(dir, 0, nil)
+
+	if _, _, err := c.ElevationAt(27.5, 86.5); err != nil {
+		t.Fatalf("cannot read elevation. Cause: %s", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("cannot close directory. Cause: %s", err)
+	}
+
+	if index := NewDiskQuota(dir, 0, nil).index; index["N27E086.hgt"] == 0 {
+		t.Errorf("expected the access time of the read file to be saved, got %v", index)
+	}
+}
+
+func TestCompressedDataDirElevationsAt(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	b := make([]byte, hgt3FileSize)
+
+	// Elevation of each sample is its column
+	for i := 0; i < len(b); i += 2 {
+		binary.BigEndian.PutUint16(b[i:], uint16(i/2%1201))
+	}
+
+	binary.BigEndian.PutUint16(b[2*(1201*600+1000):], 0x8000)
+	os.WriteFile(filepath.Join(dir, "N27E086.hgt"), b, 0644)
+
+	c, err := OpenCompressedDataDir(dir, 2)
+
+	if err != nil {
+		t.Fatalf("cannot open directory. Cause: %s", err)
+	}
+
+	defer c.Close()
+
+	lat := 27.5
+	lons := []float64{86.1, 86.5, 86.8334, 86.99, 87.2}
+	elevations := []int16{1, 1, 1, 1, 1}
+
+	c.ElevationsAt(lat, lons, elevations)
+
+	for i, lon := range lons {
+		e, _, _ := c.ElevationAt(lat, lon)
+
+		if elevations[i] != e {
+			t.Errorf("expected elevation %d at %f, got %d", e, lon, elevations[i])
+		}
+	}
+
+	if elevations[2] != 0 || elevations[4] != 0 {
+		t.Errorf("expected voids and missing files to be zero, got %v", elevations)
+	}
+}
+
+func TestIsSafeZipEntry(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]bool{
+		"N27E086.hgt":        true,
+		"dir/N27E086.hgt":    true,
+		"../N27E086.hgt":     false,
+		"dir/../../etc/x":    false,
+		"/etc/passwd":        false,
+		`dir\..\N27E086.hgt`: false,
+		"C:/N27E086.hgt":     false,
+		"":                   false,
+	}
+
+	for name, safe := range tests {
+		if isSafeZipEntry(name) != safe {
+			t.Errorf("expected isSafeZipEntry(%q) to be %t", name, safe)
+		}
+	}
+}
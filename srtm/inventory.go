@@ -0,0 +1,319 @@
+package srtm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spatial-go/geoos/geoencoding/geojson"
+)
+
+// Size of HGT files with a 3 arc seconds resolution (SRTM3). 1 arc second files have hgtFileSize bytes
+const hgt3FileSize = 1201 * 1201 * 2
+
+var ErrInvalidHgtFile = errors.New("invalid HGT file")
+
+// DirStatus Content of the DEM directory
+type DirStatus struct {
+	// Expected Number of files of the SRTM bounding boxes collection, or of a region
+	Expected int
+	// Present Expected HGT files found in the directory
+	Present []string
+	// Missing Expected HGT files not found in the directory
+	Missing []string
+	// Orphans Zip files downloaded from the SRTM server whose HGT file was not saved
+	Orphans []string
+	// PartFiles Interrupted downloads, resumed by the next download of the file
+	PartFiles []string
+	// DiskUsage Size of every file in the directory, in bytes
+	DiskUsage int64
+}
+
+// CorruptFile HGT file which failed the verification
+type CorruptFile struct {
+	Name string
+	Err  error
+}
+
+// VerifyReport Result of the verification of the DEM directory
+type VerifyReport struct {
+	Checked   int
+	Corrupted []CorruptFile
+}
+
+// Coverage Fraction of the expected files present in the directory
+func (s *DirStatus) Coverage() float64 {
+	if s.Expected == 0 {
+		return 0
+	}
+
+	return float64(len(s.Present)) / float64(s.Expected)
+}
+
+// Status Compare the DEM directory with the files of the SRTM bounding boxes collection intersecting a region.
+// Every file of the collection is expected when region is nil
+func (d *Downloader) Status(region Region) (*DirStatus, error) {
+	expected, err := d.expectedFiles(region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(d.Dir)
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("cannot read DEM directory %s. Cause: %w", d.Dir, err)
+	}
+
+	status := &DirStatus{Expected: len(expected)}
+	files := map[string]bool{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		if info, err := entry.Info(); err == nil {
+			status.DiskUsage += info.Size()
+		}
+
+		files[entry.Name()] = true
+	}
+
+	present := map[string]bool{}
+
+	for name := range files {
+		if isDemFile(name) {
+			present[demBaseName(name)] = true
+		}
+	}
+
+	for name := range files {
+		switch {
+		case strings.HasSuffix(name, partFileSuffix):
+			status.PartFiles = append(status.PartFiles, name)
+		case strings.HasSuffix(name, ".SRTMGL1.hgt.zip") && !present[demBaseName(name)]:
+			status.Orphans = append(status.Orphans, name)
+		}
+	}
+
+	for _, zipName := range expected {
+		name := hgtFileName(zipName)
+
+		if present[demBaseName(name)] {
+			status.Present = append(status.Present, name)
+		} else {
+			status.Missing = append(status.Missing, name)
+		}
+	}
+
+	sort.Strings(status.PartFiles)
+	sort.Strings(status.Orphans)
+	sort.Strings(status.Missing)
+	sort.Strings(status.Present)
+
+	return status, nil
+}
+
+// Coverage Cells of the SRTM bounding boxes collection intersecting a region, with a "file" property naming
+// their HGT file and a "status" property which is "available" when the file is in the DEM directory, in any
+// storage, or "missing"
+func (d *Downloader) Coverage(region Region) (*geojson.FeatureCollection, error) {
+	cells, err := d.regionCells(region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	collection := geojson.NewFeatureCollection()
+
+	for _, cell := range cells {
+		name := hgtFileName(cell.Properties.MustString("dataFile"))
+		feature := geojson.NewFeature(cell.Geometry)
+		feature.Properties["file"] = name
+		feature.Properties["status"] = "missing"
+
+		if _, ok := d.localDemFile(name); ok {
+			feature.Properties["status"] = "available"
+		}
+
+		collection.Append(feature)
+	}
+
+	return collection, nil
+}
+
+// Verify Read every HGT file of the DEM directory, in any storage, and check its size
+func (d *Downloader) Verify() (*VerifyReport, error) {
+	var paths []string
+
+	for _, suffix := range demFileSuffixes {
+		matches, err := filepath.Glob(filepath.Join(d.Dir, "*"+suffix))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range matches {
+			if isDemFile(filepath.Base(path)) {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	report := &VerifyReport{Checked: len(paths)}
+
+	for _, path := range paths {
+		if err := VerifyHgtFile(path); err != nil {
+			report.Corrupted = append(report.Corrupted, CorruptFile{Name: filepath.Base(path), Err: err})
+		}
+	}
+
+	return report, nil
+}
+
+// Repair Delete corrupted HGT files and download them again, extract or download again orphan zip files and
+// download the files of a region missing in the DEM directory. Missing files are ignored when region is nil
+func (d *Downloader) Repair(region Region) (*DownloadReport, error) {
+	if d.Offline {
+		return nil, ErrOffline
+	}
+
+	verifyReport, err := d.Verify()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty region lists orphan files without loading the SRTM bounding boxes
+	statusRegion := region
+
+	if statusRegion == nil {
+		statusRegion = Region{}
+	}
+
+	status, err := d.Status(statusRegion)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var filenames []string
+
+	for _, corrupt := range verifyReport.Corrupted {
+		log.Warnf("Removing corrupted file %s. Cause: %s", corrupt.Name, corrupt.Err)
+
+		if err := os.Remove(filepath.Join(d.Dir, corrupt.Name)); err != nil {
+			return nil, fmt.Errorf("cannot remove corrupted file %s. Cause: %w", corrupt.Name, err)
+		}
+
+		filenames = append(filenames, zipFileName(corrupt.Name))
+	}
+
+	for _, orphan := range status.Orphans {
+		path := filepath.Join(d.Dir, orphan)
+
+		if _, err := d.installZipFile(path); err == nil {
+			continue
+		}
+
+		log.Warnf("Removing invalid zip file %s", orphan)
+		os.Remove(path)
+
+		filenames = append(filenames, orphan)
+	}
+
+	if region != nil {
+		for _, missing := range status.Missing {
+			filenames = append(filenames, zipFileName(missing))
+		}
+	}
+
+	return d.downloadFiles(filenames), nil
+}
+
+// expectedFiles Zip files of the SRTM bounding boxes collection intersecting a region. A nil region selects
+// every file and an empty region selects none
+func (d *Downloader) expectedFiles(region Region) ([]string, error) {
+	if region != nil {
+		if len(region) == 0 {
+			return nil, nil
+		}
+
+		plan, err := d.PlanDownload(region)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return plan.Files, nil
+	}
+
+	if err := d.loadDatasetBbox(); err != nil {
+		return nil, fmt.Errorf("cannot load SRTM bounding boxes. Cause: %w", err)
+	}
+
+	filenames := make([]string, len(d.datasetBbox.Features))
+
+	for i, feature := range d.datasetBbox.Features {
+		filenames[i] = feature.Properties.MustString("dataFile")
+	}
+
+	return filenames, nil
+}
+
+// VerifyHgtFile Read a HGT file to the end, decompressing it when it is compressed, and check if its size
+// matches the 1 or 3 arc seconds layout
+func VerifyHgtFile(path string) error {
+	r, err := openDemFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w. Cause: %s", ErrInvalidHgtFile, err)
+	}
+
+	defer r.Close()
+
+	n, err := io.Copy(io.Discard, r)
+
+	if err != nil {
+		return fmt.Errorf("%w. Cause: %s", ErrInvalidHgtFile, err)
+	}
+
+	return checkHgtSize(n)
+}
+
+// zipFileName Name of the zip file of a HGT file on the SRTM server (e.g.: N27E086.hgt and N27E086.hgt.gz are
+// N27E086.SRTMGL1.hgt.zip)
+func zipFileName(hgtFileName string) string {
+	return demBaseName(hgtFileName) + ".SRTMGL1.hgt.zip"
+}
+
+// isDemFile Check if a file is a HGT file, in any storage. Zip files downloaded from the SRTM server are not
+func isDemFile(name string) bool {
+	if strings.Contains(name, ".SRTMGL1.") {
+		return false
+	}
+
+	for _, suffix := range demFileSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// demBaseName Name of a HGT file without extensions (e.g.: N27E086.hgt.gz is N27E086)
+func demBaseName(name string) string {
+	base, _, _ := strings.Cut(name, ".")
+	return base
+}
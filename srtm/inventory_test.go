@@ -0,0 +1,147 @@
+package srtm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	d := &Downloader{Dir: t.TempDir(), datasetBbox: testBboxes(t)}
+
+	os.WriteFile(filepath.Join(d.Dir, "N00E000.hgt"), make([]byte, hgt3FileSize), 0644)
+	os.WriteFile(filepath.Join(d.Dir, "N01E001.SRTMGL1.hgt.zip"), []byte{1, 2}, 0644)
+	os.WriteFile(filepath.Join(d.Dir, "N01E000.SRTMGL1.hgt.zip"+partFileSuffix), []byte{1}, 0644)
+
+	status, err := d.Status(nil)
+
+	if err != nil {
+		t.Fatalf("cannot read status. Cause: %s", err)
+	}
+
+	if status.Expected != 4 || len(status.Present) != 1 || len(status.Missing) != 3 || status.Coverage() != 0.25 {
+		t.Errorf("unexpected coverage %+v", status)
+	}
+
+	if len(status.Orphans) != 1 || status.Orphans[0] != "N01E001.SRTMGL1.hgt.zip" {
+		t.Errorf("unexpected orphans %v", status.Orphans)
+	}
+
+	if len(status.PartFiles) != 1 {
+		t.Errorf("unexpected part files %v", status.PartFiles)
+	}
+
+	if status.DiskUsage != hgt3FileSize+3 {
+		t.Errorf("unexpected disk usage %d", status.DiskUsage)
+	}
+
+	status, _ = d.Status(BboxRegion(0.1, 0.1, 0.9, 0.9))
+
+	if status.Expected != 1 || len(status.Missing) != 0 {
+		t.Errorf("unexpected region status %+v", status)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	t.Parallel()
+
+	d := &Downloader{Dir: t.TempDir(), datasetBbox: testBboxes(t)}
+	os.WriteFile(filepath.Join(d.Dir, "N00E001.hgt.gz"), []byte{}, 0644)
+
+	collection, err := d.Coverage(BboxRegion(0.2, 0.2, 1.8, 0.8))
+
+	if err != nil {
+		t.Fatalf("cannot read coverage. Cause: %s", err)
+	}
+
+	statuses := map[string]interface{}{}
+
+	for _, feature := range collection.Features {
+		statuses[feature.Properties.MustString("file")] = feature.Properties["status"]
+	}
+
+	if len(statuses) != 2 || statuses["N00E000.hgt"] != "missing" || statuses["N00E001.hgt"] != "available" {
+		t.Errorf("unexpected coverage %v", statuses)
+	}
+}
+
+func TestVerifyHgtFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	tests := map[string]int{"N00E000.hgt": hgtFileSize, "N00E001.hgt": hgt3FileSize, "N01E000.hgt": 1000}
+
+	for name, size := range tests {
+		os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644)
+	}
+
+	report, err := (&Downloader{Dir: dir}).Verify()
+
+	if err != nil {
+		t.Fatalf("cannot verify files. Cause: %s", err)
+	}
+
+	if report.Checked != 3 || len(report.Corrupted) != 1 || report.Corrupted[0].Name != "N01E000.hgt" {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if !errors.Is(report.Corrupted[0].Err, ErrInvalidHgtFile) {
+		t.Errorf("expected ErrInvalidHgtFile, got %s", report.Corrupted[0].Err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	t.Parallel()
+
+	var requested []string
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/users/token") {
+			fmt.Fprint(w, `[{"access_token": "token", "expiration_date": "1/1/2100"}]`)
+			return
+		}
+
+		requested = append(requested, filepath.Base(r.URL.Path))
+		w.Write(testHgtZip(hgtFileName(filepath.Base(r.URL.Path))))
+	}))
+
+	defer s.Close()
+
+	d := &Downloader{
+		BasePath:       s.URL,
+		Dir:            t.TempDir(),
+		HttpClient:     http.DefaultClient,
+		Api:            &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient},
+		MaxConcurrency: 1,
+		datasetBbox:    testBboxes(t),
+	}
+
+	os.WriteFile(filepath.Join(d.Dir, "N00E000.hgt"), make([]byte, hgtFileSize), 0644)
+	os.WriteFile(filepath.Join(d.Dir, "N00E001.hgt"), make([]byte, 10), 0644)
+
+	report, err := d.Repair(nil)
+
+	if err != nil {
+		t.Fatalf("cannot repair files. Cause: %s", err)
+	}
+
+	if len(report.Downloaded) != 1 || len(requested) != 1 || requested[0] != "N00E001.SRTMGL1.hgt.zip" {
+		t.Errorf("expected only the corrupted file to be downloaded, got %+v and %v", report, requested)
+	}
+
+	// Missing files are downloaded when a region is defined
+	requested = nil
+	d.Repair(BboxRegion(0.1, 1.1, 0.9, 1.9))
+
+	if len(requested) != 1 || requested[0] != "N01E000.SRTMGL1.hgt.zip" {
+		t.Errorf("expected the missing file to be downloaded, got %v", requested)
+	}
+}
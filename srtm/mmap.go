@@ -0,0 +1,290 @@
+package srtm
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/petoc/hgt"
+)
+
+// Default number of HGT files mapped by a MappedDataDir
+const defaultMaxMappedFiles = 64
+
+// MappedDataDir Directory of uncompressed HGT files read through memory maps. At most MaxFiles files are mapped,
+// the least recently used file is unmapped when another one is mapped, once no render is reading it. Safe for
+// concurrent use. Implements heightmap.ElevationSource and heightmap.RowSource
+type MappedDataDir struct {
+	Dir string
+	// MaxFiles Maximum number of mapped files
+	MaxFiles int
+	// Quota Quota of the directory, which records when each file is read and is closed with the directory.
+	// Optional
+	Quota *DiskQuota
+
+	mutex     sync.Mutex
+	files     map[string]*list.Element
+	lru       *list.List
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// ReaderStats Counters of the HGT files read by a MappedDataDir. Hits are reads of files already mapped and
+// misses are reads which had to open a file
+type ReaderStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	OpenFiles int    `json:"openFiles"`
+	MaxFiles  int    `json:"maxFiles"`
+}
+
+// mappedFile HGT file mapped by a MappedDataDir
+type mappedFile struct {
+	// key Name of the file (e.g.: N27E086.hgt)
+	key        string
+	data       []byte
+	samples    int64
+	resolution int
+	touched    int64
+	// refs Reads in progress. Evicted files are unmapped when their last read finishes
+	refs    int
+	evicted bool
+}
+
+// OpenMappedDataDir Open a directory of uncompressed HGT files mapping at most maxFiles files
+func OpenMappedDataDir(dir string, maxFiles int) (*MappedDataDir, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	if maxFiles <= 0 {
+		maxFiles = defaultMaxMappedFiles
+	}
+
+	return &MappedDataDir{Dir: dir, MaxFiles: maxFiles, files: map[string]*list.Element{}, lru: list.New()}, nil
+}
+
+// ElevationAt Read the elevation of a coordinate and the resolution of its file, in arc seconds
+func (m *MappedDataDir) ElevationAt(lat, lon float64) (int16, int, error) {
+	if lat < -56.0 || lat >= 60.0 {
+		return 0, 0, hgt.ErrorOutOfRange
+	}
+
+	file, err := m.acquire(hgtFileName(generateZipDemFileName(lat, lon)))
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer m.release(file)
+
+	e := file.at(file.sampleIndex(lat, lon))
+
+	if e == -32768 {
+		return 0, 0, errors.New("void")
+	}
+
+	return e, file.resolution, nil
+}
+
+// ElevationsAt Read the elevations of the coordinates of a latitude, mapping each file once. Coordinates without
+// data are zero. Implements heightmap.RowSource
+func (m *MappedDataDir) ElevationsAt(lat float64, lons []float64, elevations []int16) {
+	for i := range elevations {
+		elevations[i] = 0
+	}
+
+	if lat < -56.0 || lat >= 60.0 {
+		return
+	}
+
+	for start := 0; start < len(lons); {
+		cell := math.Floor(lons[start])
+		end := start + 1
+
+		for end < len(lons) && math.Floor(lons[end]) == cell {
+			end++
+		}
+
+		file, err := m.acquire(hgtFileName(generateZipDemFileName(lat, lons[start])))
+
+		if err == nil {
+			for i := start; i < end; i++ {
+				if e := file.at(file.sampleIndex(lat, lons[i])); e != -32768 {
+					elevations[i] = e
+				}
+			}
+
+			m.release(file)
+		}
+
+		start = end
+	}
+}
+
+// Stats Hit, miss and eviction counters of the directory
+func (m *MappedDataDir) Stats() ReaderStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return ReaderStats{Hits: m.hits, Misses: m.misses, Evictions: m.evictions, OpenFiles: m.lru.Len(),
+		MaxFiles: m.MaxFiles}
+}
+
+// Release Unmap a file, such as a file evicted by the quota of the directory
+func (m *MappedDataDir) Release(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if element, ok := m.files[name]; ok {
+		m.remove(element)
+	}
+}
+
+// Close Unmap every file and close the quota of the directory. Files being read are unmapped when their reads
+// finish
+func (m *MappedDataDir) Close() error {
+	m.mutex.Lock()
+
+	for _, element := range m.files {
+		m.remove(element)
+	}
+
+	m.mutex.Unlock()
+
+	if m.Quota != nil {
+		return m.Quota.Close()
+	}
+
+	return nil
+}
+
+// acquire Return a mapped file, mapping it and unmapping the least recently used file when it is not mapped.
+// Files must be released after being read
+func (m *MappedDataDir) acquire(name string) (*mappedFile, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if element, ok := m.files[name]; ok {
+		m.hits++
+		m.lru.MoveToFront(element)
+
+		file := element.Value.(*mappedFile)
+		file.refs++
+		m.touch(file)
+
+		return file, nil
+	}
+
+	m.misses++
+
+	file, err := m.load(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for m.lru.Len() >= m.MaxFiles {
+		m.remove(m.lru.Back())
+		m.evictions++
+	}
+
+	m.files[name] = m.lru.PushFront(file)
+	file.refs++
+	m.touch(file)
+
+	return file, nil
+}
+
+// release Finish a read of a file, unmapping it when it was evicted while being read
+func (m *MappedDataDir) release(file *mappedFile) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	file.refs--
+
+	if file.evicted && file.refs == 0 {
+		unmapFile(file.data)
+	}
+}
+
+// load Map the HGT file of a cell
+func (m *MappedDataDir) load(name string) (*mappedFile, error) {
+	f, err := os.Open(filepath.Join(m.Dir, name))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err == nil {
+		err = checkHgtSize(info.Size())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := mapFile(f, int(info.Size()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	file := &mappedFile{key: name, data: data, samples: 3601, resolution: hgt.Resolution1ArcSecond}
+
+	if info.Size() == hgt3FileSize {
+		file.samples = 1201
+		file.resolution = hgt.Resolution3ArcSecond
+	}
+
+	return file, nil
+}
+
+// remove Remove a file from the mapped files, unmapping it unless it is being read
+func (m *MappedDataDir) remove(element *list.Element) {
+	file := element.Value.(*mappedFile)
+
+	m.lru.Remove(element)
+	delete(m.files, file.key)
+	file.evicted = true
+
+	if file.refs == 0 {
+		unmapFile(file.data)
+	}
+}
+
+// touch Record the access to a file in the quota, at most once per second
+func (m *MappedDataDir) touch(file *mappedFile) {
+	if m.Quota == nil {
+		return
+	}
+
+	if now := time.Now().Unix(); file.touched != now {
+		file.touched = now
+		m.Quota.Touch(file.key)
+	}
+}
+
+// sampleIndex Index of the sample of a coordinate. Same layout as github.com/petoc/hgt: rows from north to south
+func (f *mappedFile) sampleIndex(lat, lon float64) int64 {
+	x := int64(math.Floor((lon - math.Floor(lon)) * float64(f.samples)))
+	y := int64(math.Floor((lat - math.Floor(lat)) * float64(f.samples)))
+
+	return x + (f.samples-y-1)*f.samples
+}
+
+// at Big endian sample of an index
+func (f *mappedFile) at(index int64) int16 {
+	return int16(binary.BigEndian.Uint16(f.data[index*2:]))
+}
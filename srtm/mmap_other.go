@@ -0,0 +1,22 @@
+//go:build !unix
+
+package srtm
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile Read a file into memory on systems without memory maps
+func mapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// unmapFile Release a file read by mapFile, which is garbage collected
+func unmapFile(data []byte) {}
@@ -0,0 +1,115 @@
+package srtm
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMappedDataDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"N27E086.hgt", "N27E087.hgt", "N28E086.hgt"} {
+		os.WriteFile(filepath.Join(dir, name), testHgt(), 0644)
+	}
+
+	m, err := OpenMappedDataDir(dir, 2)
+
+	if err != nil {
+		t.Fatalf("cannot open directory. Cause: %s", err)
+	}
+
+	defer m.Close()
+
+	cells := [][2]float64{{27.5, 86.5}, {27.5, 86.6}, {27.5, 87.5}, {28.5, 86.5}}
+
+	for _, cell := range cells {
+		e, res, err := m.ElevationAt(cell[0], cell[1])
+
+		if err != nil || e != testElevation || res != 3 {
+			t.Errorf("unexpected elevation %d (resolution %d) at %v. Cause: %v", e, res, cell, err)
+		}
+	}
+
+	stats := m.Stats()
+
+	if stats.Hits != 1 || stats.Misses != 3 || stats.Evictions != 1 || stats.OpenFiles != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	elevations := make([]int16, 3)
+	m.ElevationsAt(27.5, []float64{86.2, 86.9, 88.5}, elevations)
+
+	if elevations[0] != testElevation || elevations[1] != testElevation || elevations[2] != 0 {
+		t.Errorf("unexpected elevations %v", elevations)
+	}
+
+	if _, _, err := m.ElevationAt(0.5, 0.5); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file, got %v", err)
+	}
+
+	m.Release("N27E086.hgt")
+
+	if stats := m.Stats(); stats.OpenFiles != 1 {
+		t.Errorf("expected a released file to be unmapped, got %d open files", stats.OpenFiles)
+	}
+}
+
+func TestMappedDataDirConcurrentReads(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	names := []string{"N27E086.hgt", "N27E087.hgt", "N27E088.hgt", "N27E089.hgt"}
+
+	for _, name := range names {
+		os.WriteFile(filepath.Join(dir, name), testHgt(), 0644)
+	}
+
+	// Fewer mapped files than files read, so files are evicted while other goroutines read them
+	m, err := OpenMappedDataDir(dir, 1)
+
+	if err != nil {
+		t.Fatalf("cannot open directory. Cause: %s", err)
+	}
+
+	defer m.Close()
+
+	var wg sync.WaitGroup
+
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+
+		go func(g int) {
+			defer wg.Done()
+
+			elevations := make([]int16, 4)
+
+			for i := 0; i < 200; i++ {
+				lon := 86.5 + float64((g+i)%len(names))
+
+				if e, _, err := m.ElevationAt(27.5, lon); err != nil || e != testElevation {
+					t.Errorf("unexpected elevation %d at %f. Cause: %v", e, lon, err)
+					return
+				}
+
+				m.ElevationsAt(27.5, []float64{86.5, 87.5, 88.5, 89.5}, elevations)
+
+				for _, e := range elevations {
+					if e != testElevation {
+						t.Errorf("unexpected elevations %v", elevations)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+
+	if stats := m.Stats(); stats.OpenFiles != 1 || stats.Hits+stats.Misses != 8*200*5 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package srtm
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile Map a file into memory as read only
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// unmapFile Unmap a file mapped by mapFile
+func unmapFile(data []byte) {
+	syscall.Munmap(data)
+}
@@ -0,0 +1,132 @@
+package srtm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// States of prefetch jobs
+const (
+	JobRunning  = "running"
+	JobFinished = "finished"
+)
+
+// Maximum number of prefetch jobs kept by a Downloader. The oldest finished jobs are forgotten first
+const maxPrefetchJobs = 100
+
+var ErrPrefetchJobNotFound = errors.New("prefetch job not found")
+
+// PrefetchJob Download of the DEM files of a region in the background
+type PrefetchJob struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+	// Files Number of DEM files intersecting the region
+	Files int `json:"files"`
+	// Done Number of files downloaded, skipped, missing on the server or failed
+	Done       int             `json:"done"`
+	Report     *DownloadReport `json:"report"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+
+	mutex *sync.Mutex
+}
+
+// prefetchJobs Prefetch jobs of a Downloader, in creation order
+type prefetchJobs struct {
+	mutex sync.Mutex
+	jobs  []*PrefetchJob
+}
+
+// Prefetch Start downloading the DEM files intersecting a region in the background. Returns the job, whose
+// state is available with PrefetchJob until it is forgotten
+func (d *Downloader) Prefetch(region Region) (PrefetchJob, error) {
+	if d.Offline {
+		return PrefetchJob{}, ErrOffline
+	}
+
+	plan, err := d.PlanDownload(region)
+
+	if err != nil {
+		return PrefetchJob{}, err
+	}
+
+	id := make([]byte, 8)
+
+	if _, err := rand.Read(id); err != nil {
+		return PrefetchJob{}, err
+	}
+
+	job := &PrefetchJob{
+		ID:        hex.EncodeToString(id),
+		State:     JobRunning,
+		Files:     len(plan.Files),
+		Report:    &DownloadReport{},
+		CreatedAt: time.Now(),
+		mutex:     &sync.Mutex{},
+	}
+
+	d.jobs.add(job)
+
+	go func() {
+		d.fillReport(plan.Files, job.Report, job.mutex)
+
+		job.mutex.Lock()
+		defer job.mutex.Unlock()
+
+		now := time.Now()
+		job.State = JobFinished
+		job.FinishedAt = &now
+	}()
+
+	return job.snapshot(), nil
+}
+
+// PrefetchJob State of a prefetch job
+func (d *Downloader) PrefetchJob(id string) (PrefetchJob, error) {
+	d.jobs.mutex.Lock()
+	defer d.jobs.mutex.Unlock()
+
+	for _, job := range d.jobs.jobs {
+		if job.ID == id {
+			return job.snapshot(), nil
+		}
+	}
+
+	return PrefetchJob{}, ErrPrefetchJobNotFound
+}
+
+// add Keep a job, forgetting the oldest finished job when there are too many jobs
+func (j *prefetchJobs) add(job *PrefetchJob) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for i := 0; i < len(j.jobs) && len(j.jobs) >= maxPrefetchJobs; {
+		if j.jobs[i].snapshot().State == JobFinished {
+			j.jobs = append(j.jobs[:i], j.jobs[i+1:]...)
+		} else {
+			i++
+		}
+	}
+
+	j.jobs = append(j.jobs, job)
+}
+
+// snapshot Copy of the job, which is not changed by the download
+func (job *PrefetchJob) snapshot() PrefetchJob {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+
+	s := *job
+	s.Report = &DownloadReport{
+		Downloaded: append([]string{}, job.Report.Downloaded...),
+		Skipped:    append([]string{}, job.Report.Skipped...),
+		Missing:    append([]string{}, job.Report.Missing...),
+		Failed:     append([]string{}, job.Report.Failed...),
+	}
+	s.Done = len(s.Report.Downloaded) + len(s.Report.Skipped) + len(s.Report.Missing) + len(s.Report.Failed)
+
+	return s
+}
@@ -0,0 +1,79 @@
+package srtm
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPrefetch(t *testing.T) {
+	t.Parallel()
+
+	s := newHgtServer(t)
+	d := &Downloader{BasePath: s.URL, Dir: t.TempDir(), HttpClient: http.DefaultClient, datasetBbox: testBboxes(t)}
+
+	os.MkdirAll(d.Dir, 0755)
+	os.WriteFile(filepath.Join(d.Dir, "N00E001.hgt"), testHgt(), 0644)
+
+	job, err := d.Prefetch(BboxRegion(0.2, 0.2, 1.8, 0.8))
+
+	if err != nil {
+		t.Fatalf("cannot start prefetch. Cause: %s", err)
+	}
+
+	if job.Files != 2 || job.ID == "" {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+
+	for job.State != JobFinished && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+
+		if job, err = d.PrefetchJob(job.ID); err != nil {
+			t.Fatalf("cannot read job. Cause: %s", err)
+		}
+	}
+
+	if job.State != JobFinished || job.FinishedAt == nil {
+		t.Fatalf("job did not finish: %+v", job)
+	}
+
+	if job.Done != 2 || len(job.Report.Downloaded) != 1 || len(job.Report.Skipped) != 1 {
+		t.Errorf("unexpected report %+v", job.Report)
+	}
+
+	if _, err := d.PrefetchJob("unknown"); !errors.Is(err, ErrPrefetchJobNotFound) {
+		t.Errorf("expected ErrPrefetchJobNotFound, got %v", err)
+	}
+
+	d.Offline = true
+
+	if _, err := d.Prefetch(BboxRegion(0.2, 0.2, 1.8, 0.8)); !errors.Is(err, ErrOffline) {
+		t.Errorf("expected ErrOffline, got %v", err)
+	}
+}
+
+func TestPrefetchJobsLimit(t *testing.T) {
+	t.Parallel()
+
+	var jobs prefetchJobs
+
+	for i := 0; i < maxPrefetchJobs+10; i++ {
+		state := JobFinished
+
+		if i == 0 {
+			state = JobRunning
+		}
+
+		jobs.add(&PrefetchJob{State: state, Report: &DownloadReport{}, mutex: &sync.Mutex{}})
+	}
+
+	if len(jobs.jobs) != maxPrefetchJobs || jobs.jobs[0].State != JobRunning {
+		t.Errorf("expected %d jobs keeping the running job, got %d", maxPrefetchJobs, len(jobs.jobs))
+	}
+}
@@ -0,0 +1,213 @@
+package srtm
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Types of progress events
+const (
+	EventStarted    = "started"
+	EventProgress   = "progress"
+	EventDownloaded = "downloaded"
+	EventSkipped    = "skipped"
+	EventMissing    = "missing"
+	EventFailed     = "failed"
+	EventFinished   = "finished"
+)
+
+// Minimum interval between two byte progress events
+const progressInterval = 250 * time.Millisecond
+
+// Events buffered for each subscriber. Events are dropped when a subscriber does not keep up
+const subscriberBufferSize = 64
+
+// Progress Progress of the current downloads. Counters are reset when downloads start after every previous
+// download finished
+type Progress struct {
+	// FilesTotal Files requested, including files already in the DEM directory
+	FilesTotal int `json:"filesTotal"`
+	// FilesDone Files downloaded, skipped, missing on the server or failed
+	FilesDone   int `json:"filesDone"`
+	FilesFailed int `json:"filesFailed"`
+	// BytesDownloaded Bytes received from the SRTM server
+	BytesDownloaded int64 `json:"bytesDownloaded"`
+	// BytesTotal Estimated number of bytes of the requested files, based on the average zip file size
+	BytesTotal int64 `json:"bytesTotal"`
+	// Rate Average download rate, in bytes per second
+	Rate float64 `json:"rate"`
+	// ETA Estimated time to download the remaining bytes, in seconds
+	ETA       float64   `json:"eta"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// ProgressEvent Change of the progress of the downloads. File and Error are set by file events
+type ProgressEvent struct {
+	Type  string `json:"type"`
+	File  string `json:"file,omitempty"`
+	Error string `json:"error,omitempty"`
+	Progress
+}
+
+// Active Check if there are files being downloaded
+func (p Progress) Active() bool {
+	return p.FilesDone < p.FilesTotal
+}
+
+// progressTracker Progress of the downloads of a Downloader, published to its subscribers
+type progressTracker struct {
+	mutex        sync.Mutex
+	progress     Progress
+	subscribers  map[chan ProgressEvent]bool
+	lastProgress time.Time
+}
+
+// Subscribe Receive the progress events of the downloads. Events are dropped when the channel is full, so slow
+// subscribers never stall the downloads. The returned function cancels the subscription and closes the channel
+func (d *Downloader) Subscribe() (<-chan ProgressEvent, func()) {
+	t := d.tracker()
+	ch := make(chan ProgressEvent, subscriberBufferSize)
+
+	t.mutex.Lock()
+	t.subscribers[ch] = true
+	t.mutex.Unlock()
+
+	var once sync.Once
+
+	return ch, func() {
+		once.Do(func() {
+			t.mutex.Lock()
+			delete(t.subscribers, ch)
+			t.mutex.Unlock()
+
+			close(ch)
+		})
+	}
+}
+
+// Progress Current progress of the downloads
+func (d *Downloader) Progress() Progress {
+	t := d.tracker()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.snapshot()
+}
+
+func (d *Downloader) tracker() *progressTracker {
+	d.progressOnce.Do(func() {
+		d.progress = &progressTracker{subscribers: map[chan ProgressEvent]bool{}}
+	})
+
+	return d.progress
+}
+
+// begin Add files to the current downloads
+func (t *progressTracker) begin(files int) {
+	if files == 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.progress.Active() {
+		t.progress = Progress{StartedAt: time.Now()}
+	}
+
+	t.progress.FilesTotal += files
+	t.progress.BytesTotal += int64(files) * estimatedZipFileSize
+
+	t.publish(ProgressEvent{Type: EventStarted})
+}
+
+// done Record the result of a file. Skipped and missing files are not downloaded, so they are removed from the
+// estimated number of bytes
+func (t *progressTracker) done(eventType, file string, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.progress.FilesDone++
+
+	switch eventType {
+	case EventSkipped, EventMissing:
+		t.progress.BytesTotal -= estimatedZipFileSize
+	case EventFailed:
+		t.progress.FilesFailed++
+	}
+
+	event := ProgressEvent{Type: eventType, File: file}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	t.publish(event)
+
+	if !t.progress.Active() {
+		t.publish(ProgressEvent{Type: EventFinished})
+	}
+}
+
+// add Record bytes received from the server, publishing a progress event at most every progressInterval
+func (t *progressTracker) add(n int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.progress.BytesDownloaded += int64(n)
+
+	// Files are larger than estimated
+	if t.progress.BytesDownloaded > t.progress.BytesTotal {
+		t.progress.BytesTotal = t.progress.BytesDownloaded
+	}
+
+	if time.Since(t.lastProgress) >= progressInterval {
+		t.lastProgress = time.Now()
+		t.publish(ProgressEvent{Type: EventProgress})
+	}
+}
+
+// snapshot Progress with its rate and ETA. Must be called with the mutex locked
+func (t *progressTracker) snapshot() Progress {
+	p := t.progress
+
+	if elapsed := time.Since(p.StartedAt).Seconds(); !p.StartedAt.IsZero() && elapsed > 0 {
+		p.Rate = float64(p.BytesDownloaded) / elapsed
+	}
+
+	if p.Rate > 0 && p.Active() {
+		p.ETA = float64(p.BytesTotal-p.BytesDownloaded) / p.Rate
+	}
+
+	return p
+}
+
+// publish Send an event to every subscriber. Must be called with the mutex locked
+func (t *progressTracker) publish(event ProgressEvent) {
+	event.Progress = t.snapshot()
+
+	for ch := range t.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// progressReader Response body which records the bytes read in the progress of the downloads
+type progressReader struct {
+	io.ReadCloser
+	tracker *progressTracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+
+	if n > 0 {
+		r.tracker.add(n)
+	}
+
+	return n, err
+}
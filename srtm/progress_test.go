@@ -0,0 +1,71 @@
+package srtm
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProgressEvents(t *testing.T) {
+	t.Parallel()
+
+	s := newHgtServer(t)
+	d := &Downloader{BasePath: s.URL, Dir: t.TempDir(), HttpClient: http.DefaultClient}
+
+	os.WriteFile(filepath.Join(d.Dir, "N00E000.hgt"), make([]byte, hgt3FileSize), 0644)
+
+	events, cancel := d.Subscribe()
+	defer cancel()
+
+	d.downloadFiles([]string{"N00E000.SRTMGL1.hgt.zip", "N00E001.SRTMGL1.hgt.zip", "N01E000.SRTMGL1.hgt.zip"})
+
+	counts := map[string]int{}
+	var last ProgressEvent
+
+	timeout := time.After(5 * time.Second)
+
+	for last.Type != EventFinished {
+		select {
+		case last = <-events:
+			counts[last.Type]++
+		case <-timeout:
+			t.Fatalf("finished event not received. Received %v", counts)
+		}
+	}
+
+	if counts[EventStarted] != 1 || counts[EventSkipped] != 1 || counts[EventDownloaded] != 2 {
+		t.Errorf("unexpected events %v", counts)
+	}
+
+	if last.FilesTotal != 3 || last.FilesDone != 3 || last.FilesFailed != 0 || last.BytesDownloaded == 0 {
+		t.Errorf("unexpected progress %+v", last.Progress)
+	}
+
+	if p := d.Progress(); p.Active() || p.ETA != 0 {
+		t.Errorf("expected finished downloads, got %+v", p)
+	}
+}
+
+func TestProgressSubscriberCancel(t *testing.T) {
+	t.Parallel()
+
+	d := &Downloader{}
+	events, cancel := d.Subscribe()
+
+	cancel()
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Error("expected a closed channel")
+	}
+
+	// Publishing without subscribers does not block
+	d.tracker().begin(1)
+	d.tracker().done(EventFailed, "N00E000.SRTMGL1.hgt.zip", nil)
+
+	if p := d.Progress(); p.FilesFailed != 1 || p.Active() {
+		t.Errorf("unexpected progress %+v", p)
+	}
+}
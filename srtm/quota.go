@@ -0,0 +1,240 @@
+package srtm
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spatial-go/geoos/space"
+)
+
+// Name of the index of HGT files access times, stored in the DEM directory
+const accessIndexFile = ".lukla-access.json"
+
+// Files read recently are never evicted, since they may still be being read
+const evictionGracePeriod = time.Minute
+
+// DiskQuota Maximum size of a DEM directory. When a download exceeds it, the least recently used HGT files
+// outside the pinned regions are evicted, in any storage. Access times are kept in a small index stored in the
+// directory, so they survive restarts. Readers of the directory, such as a MappedDataDir or a CompressedDataDir,
+// record their reads through Touch and close evicted files through Release
+type DiskQuota struct {
+	Dir     string
+	MaxSize int64
+	// Pinned Regions whose files are never evicted
+	Pinned Region
+	// Release Called before an evicted file is removed, so the reader of the directory closes it. Optional
+	Release func(name string)
+
+	index        map[string]int64
+	mutex        sync.Mutex
+	enforceMutex sync.Mutex
+}
+
+// NewDiskQuota Create the quota of a directory, loading its access times index
+func NewDiskQuota(dir string, maxSize int64, pinned Region) *DiskQuota {
+	q := &DiskQuota{Dir: dir, MaxSize: maxSize, Pinned: pinned, index: map[string]int64{}}
+
+	if b, err := os.ReadFile(filepath.Join(dir, accessIndexFile)); err == nil {
+		if err := json.Unmarshal(b, &q.index); err != nil {
+			log.Warnf("cannot parse DEM access index. Cause: %s", err)
+		}
+	}
+
+	return q
+}
+
+// Touch Record an access to a file, such as its download or a read
+func (q *DiskQuota) Touch(name string) {
+	q.mutex.Lock()
+	q.index[name] = time.Now().Unix()
+	q.mutex.Unlock()
+}
+
+// Enforce Evict the least recently used HGT files until the directory fits in the quota. Returns the evicted files
+func (q *DiskQuota) Enforce() ([]string, error) {
+	if q.MaxSize <= 0 {
+		return nil, nil
+	}
+
+	q.enforceMutex.Lock()
+	defer q.enforceMutex.Unlock()
+
+	entries, err := os.ReadDir(q.Dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		name       string
+		size       int64
+		lastAccess int64
+	}
+
+	var total int64
+	var candidates []candidate
+
+	recent := time.Now().Add(-evictionGracePeriod).Unix()
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+
+		if err != nil || entry.IsDir() {
+			continue
+		}
+
+		total += info.Size()
+
+		if !isDemFile(entry.Name()) || q.isPinned(entry.Name()) {
+			continue
+		}
+
+		lastAccess := q.lastAccess(entry.Name(), info.ModTime().Unix())
+
+		if lastAccess < recent {
+			candidates = append(candidates, candidate{name: entry.Name(), size: info.Size(), lastAccess: lastAccess})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastAccess < candidates[j].lastAccess
+	})
+
+	var evicted []string
+
+	for _, c := range candidates {
+		if total <= q.MaxSize {
+			break
+		}
+
+		if err := q.evict(c.name); err != nil {
+			log.Warnf("cannot evict DEM file %s. Cause: %s", c.name, err)
+			continue
+		}
+
+		total -= c.size
+		evicted = append(evicted, c.name)
+	}
+
+	if len(evicted) > 0 {
+		log.Infof("%d DEM file(s) evicted to keep %s under %d bytes", len(evicted), q.Dir, q.MaxSize)
+	}
+
+	if total > q.MaxSize {
+		log.Warnf("DEM directory %s uses %d bytes, more than its quota of %d bytes. Remaining files are pinned "+
+			"or in use", q.Dir, total, q.MaxSize)
+	}
+
+	return evicted, q.saveIndex()
+}
+
+// Close Save the access times index
+func (q *DiskQuota) Close() error {
+	return q.saveIndex()
+}
+
+// evict Release a file from the reader of the directory and remove it
+func (q *DiskQuota) evict(name string) error {
+	if q.Release != nil {
+		q.Release(name)
+	}
+
+	q.mutex.Lock()
+	delete(q.index, name)
+	q.mutex.Unlock()
+
+	return os.Remove(filepath.Join(q.Dir, name))
+}
+
+// lastAccess Last access time of a file. Files never read are as old as their modification time
+func (q *DiskQuota) lastAccess(name string, modTime int64) int64 {
+	lastAccess := modTime
+
+	q.mutex.Lock()
+
+	if t, ok := q.index[name]; ok && t > lastAccess {
+		lastAccess = t
+	}
+
+	q.mutex.Unlock()
+
+	return lastAccess
+}
+
+// isPinned Check if the cell of a HGT file intersects a pinned region
+func (q *DiskQuota) isPinned(name string) bool {
+	if len(q.Pinned) == 0 {
+		return false
+	}
+
+	lat, lon, ok := parseHgtFileName(name)
+
+	if !ok {
+		return false
+	}
+
+	cell := space.Bound{
+		Min: space.Point{lon + bboxMargin, lat + bboxMargin},
+		Max: space.Point{lon + 1 - bboxMargin, lat + 1 - bboxMargin},
+	}
+
+	pinned, err := q.Pinned.Intersects(cell.ToPolygon())
+
+	return err == nil && pinned
+}
+
+func (q *DiskQuota) saveIndex() error {
+	q.mutex.Lock()
+
+	index := make(map[string]int64, len(q.index))
+
+	for name, t := range q.index {
+		index[name] = t
+	}
+
+	q.mutex.Unlock()
+
+	b, err := json.Marshal(index)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(q.Dir, accessIndexFile), b, 0644)
+}
+
+// parseHgtFileName Latitude and longitude of the south west corner of a HGT file (e.g.: N27E086.hgt is 27, 86)
+func parseHgtFileName(name string) (float64, float64, bool) {
+	if len(name) < 7 {
+		return 0, 0, false
+	}
+
+	lat, latErr := strconv.Atoi(name[1:3])
+	lon, lonErr := strconv.Atoi(name[4:7])
+
+	if latErr != nil || lonErr != nil {
+		return 0, 0, false
+	}
+
+	switch {
+	case name[0] == 'S' || name[0] == 's':
+		lat = -lat
+	case name[0] != 'N' && name[0] != 'n':
+		return 0, 0, false
+	}
+
+	switch {
+	case name[3] == 'W' || name[3] == 'w':
+		lon = -lon
+	case name[3] != 'E' && name[3] != 'e':
+		return 0, 0, false
+	}
+
+	return float64(lat), float64(lon), true
+}
@@ -0,0 +1,115 @@
+package srtm
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestQuota Directory with 3 arc seconds HGT files last accessed in the given order, from the oldest
+func newTestQuota(t *testing.T, names []string, maxFiles int, pinned Region) *DiskQuota {
+	t.Helper()
+
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, make([]byte, hgt3FileSize), 0644)
+		os.Chtimes(path, old, old.Add(time.Duration(i)*time.Second))
+	}
+
+	return NewDiskQuota(dir, int64(maxFiles*hgt3FileSize), pinned)
+}
+
+func TestDiskQuotaEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	q := newTestQuota(t, []string{"N00E000.hgt", "N00E001.hgt", "N00E002.hgt", "N00E003.hgt"}, 2, nil)
+
+	// Accessing the oldest file makes it the most recently used
+	q.index["N00E000.hgt"] = time.Now().Add(-2 * time.Minute).Unix()
+
+	evicted, err := q.Enforce()
+
+	if err != nil {
+		t.Fatalf("cannot enforce quota. Cause: %s", err)
+	}
+
+	if strings.Join(evicted, ",") != "N00E001.hgt,N00E002.hgt" {
+		t.Errorf("unexpected evicted files %v", evicted)
+	}
+
+	remaining, _ := filepath.Glob(filepath.Join(q.Dir, "*.hgt"))
+	sort.Strings(remaining)
+
+	if len(remaining) != 2 || filepath.Base(remaining[0]) != "N00E000.hgt" {
+		t.Errorf("unexpected remaining files %v", remaining)
+	}
+
+	// The index is persisted
+	if index := NewDiskQuota(q.Dir, q.MaxSize, nil).index; index["N00E000.hgt"] != q.index["N00E000.hgt"] {
+		t.Errorf("access index was not persisted: %v", index)
+	}
+}
+
+func TestDiskQuotaKeepsPinnedAndRecentFiles(t *testing.T) {
+	t.Parallel()
+
+	q := newTestQuota(t, []string{"N27E086.hgt", "N00E001.hgt", "N00E002.hgt"}, 1,
+		BboxRegion(86.2, 27.2, 86.8, 27.8))
+
+	q.Touch("N00E001.hgt")
+
+	evicted, _ := q.Enforce()
+
+	if strings.Join(evicted, ",") != "N00E002.hgt" {
+		t.Errorf("expected only the unpinned and not recently used file to be evicted, got %v", evicted)
+	}
+}
+
+func TestDiskQuotaReleasesEvictedFiles(t *testing.T) {
+	t.Parallel()
+
+	q := newTestQuota(t, []string{"N00E000.hgt", "N00E001.hgt"}, 1, nil)
+
+	var released []string
+	q.Release = func(name string) {
+		released = append(released, name)
+	}
+
+	evicted, _ := q.Enforce()
+
+	if len(evicted) != 1 || evicted[0] != "N00E000.hgt" {
+		t.Fatalf("unexpected evicted files %v", evicted)
+	}
+
+	if strings.Join(released, ",") != "N00E000.hgt" {
+		t.Errorf("expected the evicted file to be released, got %v", released)
+	}
+
+	if _, err := os.Stat(filepath.Join(q.Dir, "N00E000.hgt")); !os.IsNotExist(err) {
+		t.Errorf("expected evicted file to be removed, got %v", err)
+	}
+}
+
+func TestParseHgtFileName(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string][2]float64{"N27E086.hgt": {27, 86}, "S09W078.hgt": {-9, -78}}
+
+	for name, expected := range tests {
+		lat, lon, ok := parseHgtFileName(name)
+
+		if !ok || lat != expected[0] || lon != expected[1] {
+			t.Errorf("expected %v for %s, got %f, %f", expected, name, lat, lon)
+		}
+	}
+
+	if _, _, ok := parseHgtFileName("X27E086.hgt"); ok {
+		t.Error("expected invalid name")
+	}
+}
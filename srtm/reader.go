@@ -0,0 +1,381 @@
+package srtm
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/petoc/hgt"
+)
+
+// Default number of HGT files kept open by a CompressedDataDir. Compressed files use up to 25 MB of memory each
+const defaultMaxOpenFiles = 16
+
+// CompressedDataDir Directory of HGT files stored uncompressed (.hgt) or compressed (.hgt.gz or .hgt.zip), as
+// saved by a Downloader with any Storage. Compressed files are decompressed in memory when they are first read.
+// Implements heightmap.ElevationSource
+type CompressedDataDir struct {
+	Dir string
+	// MaxFiles Maximum number of open files. The least recently used file is closed when another one is opened
+	MaxFiles int
+	// Quota Quota of the directory, which records when each file is read and is closed with the directory.
+	// Optional
+	Quota *DiskQuota
+
+	mutex sync.Mutex
+	files map[string]*list.Element
+	lru   *list.List
+}
+
+// demTile HGT file opened by a CompressedDataDir
+type demTile struct {
+	// key Name of the uncompressed file (e.g.: N27E086.hgt)
+	key string
+	// name Name of the file in the directory (e.g.: N27E086.hgt.gz)
+	name       string
+	data       io.ReaderAt
+	closer     io.Closer
+	samples    int64
+	resolution int
+	touched    int64
+}
+
+// OpenCompressedDataDir Open a directory of HGT files in any storage
+func OpenCompressedDataDir(dir string, maxFiles int) (*CompressedDataDir, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	if maxFiles <= 0 {
+		maxFiles = defaultMaxOpenFiles
+	}
+
+	return &CompressedDataDir{Dir: dir, MaxFiles: maxFiles, files: map[string]*list.Element{}, lru: list.New()}, nil
+}
+
+// ElevationAt Read the elevation of a coordinate and the resolution of its file, in arc seconds
+func (c *CompressedDataDir) ElevationAt(lat, lon float64) (int16, int, error) {
+	if lat < -56.0 || lat >= 60.0 {
+		return 0, 0, hgt.ErrorOutOfRange
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	tile, err := c.open(hgtFileName(generateZipDemFileName(lat, lon)))
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Same layout as github.com/petoc/hgt: rows from north to south, big endian samples
+	x := int64(math.Floor((lon - math.Floor(lon)) * float64(tile.samples)))
+	y := int64(math.Floor((lat - math.Floor(lat)) * float64(tile.samples)))
+
+	b := make([]byte, 2)
+
+	if _, err := tile.data.ReadAt(b, (x+(tile.samples-y-1)*tile.samples)*2); err != nil {
+		return 0, 0, err
+	}
+
+	e := int16(binary.BigEndian.Uint16(b))
+
+	if e == -32768 {
+		return 0, 0, errors.New("void")
+	}
+
+	return e, tile.resolution, nil
+}
+
+// ElevationsAt Read the elevations of the coordinates of a latitude, reading the samples of each file at once.
+// Coordinates without data are zero. Implements heightmap.RowSource
+func (c *CompressedDataDir) ElevationsAt(lat float64, lons []float64, elevations []int16) {
+	for i := range elevations {
+		elevations[i] = 0
+	}
+
+	if lat < -56.0 || lat >= 60.0 {
+		return
+	}
+
+	for start := 0; start < len(lons); {
+		cell := math.Floor(lons[start])
+		end := start + 1
+
+		for end < len(lons) && math.Floor(lons[end]) == cell {
+			end++
+		}
+
+		c.readRow(lat, lons[start:end], elevations[start:end])
+		start = end
+	}
+}
+
+// readRow Read the elevations of coordinates of a latitude inside the same file with a single read
+func (c *CompressedDataDir) readRow(lat float64, lons []float64, elevations []int16) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	tile, err := c.open(hgtFileName(generateZipDemFileName(lat, lons[0])))
+
+	if err != nil {
+		return
+	}
+
+	y := int64(math.Floor((lat - math.Floor(lat)) * float64(tile.samples)))
+	xs := make([]int64, len(lons))
+	minX, maxX := tile.samples, int64(0)
+
+	for i, lon := range lons {
+		xs[i] = int64(math.Floor((lon - math.Floor(lon)) * float64(tile.samples)))
+
+		if xs[i] < minX {
+			minX = xs[i]
+		}
+
+		if xs[i] > maxX {
+			maxX = xs[i]
+		}
+	}
+
+	b := make([]byte, (maxX-minX+1)*2)
+
+	if _, err := tile.data.ReadAt(b, (minX+(tile.samples-y-1)*tile.samples)*2); err != nil {
+		return
+	}
+
+	for i, x := range xs {
+		if e := int16(binary.BigEndian.Uint16(b[(x-minX)*2:])); e != -32768 {
+			elevations[i] = e
+		}
+	}
+}
+
+// Release Close a file, such as a file evicted by the quota of the directory
+func (c *CompressedDataDir) Release(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, element := range c.files {
+		if element.Value.(*demTile).name == name {
+			c.remove(element)
+		}
+	}
+}
+
+// Close Close every open file and the quota of the directory
+func (c *CompressedDataDir) Close() error {
+	c.mutex.Lock()
+
+	for _, element := range c.files {
+		c.remove(element)
+	}
+
+	c.mutex.Unlock()
+
+	if c.Quota != nil {
+		return c.Quota.Close()
+	}
+
+	return nil
+}
+
+// open Return an open HGT file, opening it and closing the least recently used file when it is not open
+func (c *CompressedDataDir) open(hgtName string) (*demTile, error) {
+	if element, ok := c.files[hgtName]; ok {
+		c.lru.MoveToFront(element)
+		tile := element.Value.(*demTile)
+		c.touch(tile)
+
+		return tile, nil
+	}
+
+	tile, err := c.load(hgtName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for c.lru.Len() >= c.MaxFiles {
+		c.remove(c.lru.Back())
+	}
+
+	c.files[hgtName] = c.lru.PushFront(tile)
+	c.touch(tile)
+
+	return tile, nil
+}
+
+// load Open the HGT file of a cell in the first storage found in the directory
+func (c *CompressedDataDir) load(hgtName string) (*demTile, error) {
+	base := strings.TrimSuffix(hgtName, ".hgt")
+
+	for _, suffix := range demFileSuffixes {
+		path := filepath.Join(c.Dir, base+suffix)
+
+		if suffix == ".hgt" {
+			file, err := os.Open(path)
+
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			info, err := file.Stat()
+
+			if err == nil {
+				err = checkHgtSize(info.Size())
+			}
+
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+
+			return newDemTile(hgtName, base+suffix, file, file, info.Size()), nil
+		}
+
+		r, err := openDemFile(path)
+
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(r)
+		r.Close()
+
+		if err == nil {
+			err = checkHgtSize(int64(len(data)))
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot read HGT file %s. Cause: %w", path, err)
+		}
+
+		return newDemTile(hgtName, base+suffix, bytes.NewReader(data), nil, int64(len(data))), nil
+	}
+
+	return nil, &os.PathError{Op: "open", Path: filepath.Join(c.Dir, hgtName), Err: os.ErrNotExist}
+}
+
+// remove Close a file and remove it from the open files
+func (c *CompressedDataDir) remove(element *list.Element) {
+	tile := element.Value.(*demTile)
+
+	if tile.closer != nil {
+		tile.closer.Close()
+	}
+
+	c.lru.Remove(element)
+	delete(c.files, tile.key)
+}
+
+// touch Record the access to a file in the quota, at most once per second
+func (c *CompressedDataDir) touch(tile *demTile) {
+	if c.Quota == nil {
+		return
+	}
+
+	if now := time.Now().Unix(); tile.touched != now {
+		tile.touched = now
+		c.Quota.Touch(tile.name)
+	}
+}
+
+func newDemTile(key, name string, data io.ReaderAt, closer io.Closer, size int64) *demTile {
+	tile := &demTile{key: key, name: name, data: data, closer: closer, samples: 3601,
+		resolution: hgt.Resolution1ArcSecond}
+
+	if size == hgt3FileSize {
+		tile.samples = 1201
+		tile.resolution = hgt.Resolution3ArcSecond
+	}
+
+	return tile
+}
+
+// openDemFile Open a HGT file in any storage, decompressing it while it is read
+func openDemFile(path string) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		file, err := os.Open(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := gzip.NewReader(file)
+
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		return &demFileReader{Reader: r, closers: []io.Closer{r, file}}, nil
+	case strings.HasSuffix(path, ".zip"):
+		z, err := zip.OpenReader(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		member := strings.TrimSuffix(filepath.Base(path), ".zip")
+
+		for _, f := range z.File {
+			if !isSafeZipEntry(f.Name) || !isZipMember(f.Name, member) {
+				continue
+			}
+
+			r, err := f.Open()
+
+			if err != nil {
+				z.Close()
+				return nil, err
+			}
+
+			return &demFileReader{Reader: r, closers: []io.Closer{r, z}}, nil
+		}
+
+		z.Close()
+
+		return nil, fmt.Errorf("zip file %s does not contain %s", path, member)
+	default:
+		return os.Open(path)
+	}
+}
+
+// demFileReader Reader of a compressed HGT file, which closes the decompressor and the file
+type demFileReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *demFileReader) Close() error {
+	var err error
+
+	for _, c := range r.closers {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
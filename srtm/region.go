@@ -0,0 +1,355 @@
+package srtm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spatial-go/geoos/geoencoding/geojson"
+	"github.com/spatial-go/geoos/planar"
+	"github.com/spatial-go/geoos/space"
+)
+
+// Approximate size of SRTMGL1 files. Zip sizes vary with the relief, so download sizes are estimates
+const (
+	estimatedZipFileSize = 12 * 1024 * 1024
+	hgtFileSize          = 3601 * 3601 * 2
+)
+
+// Properties of country features matched by LoadCountryRegion (Natural Earth and most country boundaries
+// datasets use some of them)
+var countryProperties = []string{"ADMIN", "NAME", "NAME_LONG", "ISO_A2", "ISO_A3", "name", "admin", "iso_a2",
+	"iso_a3", "ISO3166-1-Alpha-2", "ISO3166-1-Alpha-3"}
+
+// Inset of the SRTM bounding boxes when they are intersected with regions. Bounding boxes extend 1 arc second
+// over the neighbouring cells, so regions ending on a degree line would also select the neighbouring files
+const bboxMargin = 2.0 / 3600
+
+var ErrEmptyRegion = errors.New("region has no geometries")
+
+// Region Area of interest made of one or more geometries
+type Region []space.Geometry
+
+// DownloadPlan DEM files intersecting a region
+type DownloadPlan struct {
+	// Files Names of the zip files on the SRTM server
+	Files []string
+	// Existing Files already in the DEM directory, which will be skipped
+	Existing []string
+	// Storage Format of the HGT files saved in the DEM directory
+	Storage Storage
+}
+
+// DownloadReport Result of a region download
+type DownloadReport struct {
+	Downloaded []string `json:"downloaded"`
+	Skipped    []string `json:"skipped"`
+	// Missing Files listed in the SRTM bounding boxes but not found on the server
+	Missing []string `json:"missing"`
+	Failed  []string `json:"failed"`
+}
+
+// BboxRegion Region of a bounding box in degrees
+func BboxRegion(west, south, east, north float64) Region {
+	return Region{space.Bound{Min: space.Point{west, south}, Max: space.Point{east, north}}.ToPolygon()}
+}
+
+// LoadGeoJSONRegion Read a region from a GeoJSON file containing a feature collection, a feature or a geometry
+func LoadGeoJSONRegion(path string) (Region, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read GeoJSON file %s. Cause: %w", path, err)
+	}
+
+	region, err := ParseGeoJSONRegion(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read region from %s. Cause: %w", path, err)
+	}
+
+	return region, nil
+}
+
+// ParseGeoJSONRegion Parse a region from a GeoJSON feature collection, feature or geometry
+func ParseGeoJSONRegion(data []byte) (Region, error) {
+	collection, err := parseFeatures(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var region Region
+
+	for _, feature := range collection.Features {
+		if feature.Geometry.Geometry() != nil {
+			region = append(region, feature.Geometry.Geometry())
+		}
+	}
+
+	if len(region) == 0 {
+		return nil, ErrEmptyRegion
+	}
+
+	return region, nil
+}
+
+// LoadCountryRegion Read the polygons of countries from a GeoJSON file of country boundaries (e.g.: Natural
+// Earth admin 0 countries). Countries are matched by name or ISO code, ignoring case
+func LoadCountryRegion(path string, countries []string) (Region, error) {
+	collection, err := readFeatures(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var region Region
+
+	for _, country := range countries {
+		found := false
+
+		for _, feature := range collection.Features {
+			if feature.Geometry.Geometry() != nil && isCountry(feature, country) {
+				region = append(region, feature.Geometry.Geometry())
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("country %s not found in %s", country, path)
+		}
+	}
+
+	if len(region) == 0 {
+		return nil, fmt.Errorf("cannot read region from %s. Cause: %w", path, ErrEmptyRegion)
+	}
+
+	return region, nil
+}
+
+func isCountry(feature *geojson.Feature, country string) bool {
+	for _, property := range countryProperties {
+		if name, ok := feature.Properties[property].(string); ok && strings.EqualFold(name, country) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readFeatures(path string) (*geojson.FeatureCollection, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read GeoJSON file %s. Cause: %w", path, err)
+	}
+
+	collection, err := parseFeatures(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse GeoJSON file %s. Cause: %w", path, err)
+	}
+
+	return collection, nil
+}
+
+func parseFeatures(data []byte) (*geojson.FeatureCollection, error) {
+	if collection, err := geojson.UnmarshalFeatureCollection(data); err == nil && len(collection.Features) > 0 {
+		return collection, nil
+	}
+
+	if feature, err := geojson.UnmarshalFeature(data); err == nil && feature.Geometry.Geometry() != nil {
+		return &geojson.FeatureCollection{Features: []*geojson.Feature{feature}}, nil
+	}
+
+	geometry, err := geojson.UnmarshalGeometry(data)
+
+	if err != nil || geometry.Geometry() == nil {
+		return nil, ErrEmptyRegion
+	}
+
+	return &geojson.FeatureCollection{Features: []*geojson.Feature{geojson.NewFeature(*geometry)}}, nil
+}
+
+// Intersects Check if a geometry intersects any geometry of the region
+func (r Region) Intersects(g space.Geometry) (bool, error) {
+	strategy := planar.NormalStrategy()
+	bound := g.Bound()
+
+	for _, geometry := range r {
+		if !geometry.Bound().IntersectsBound(bound) {
+			continue
+		}
+
+		intersects, err := strategy.Intersects(geometry, g)
+
+		if err != nil {
+			return false, err
+		}
+
+		if intersects {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// PlanDownload List the DEM files of the SRTM bounding boxes collection intersecting a region
+func (d *Downloader) PlanDownload(region Region) (*DownloadPlan, error) {
+	cells, err := d.regionCells(region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &DownloadPlan{Storage: d.Storage}
+
+	for _, feature := range cells {
+		filename := feature.Properties.MustString("dataFile")
+		plan.Files = append(plan.Files, filename)
+
+		if _, ok := d.localDemFile(hgtFileName(filename)); ok {
+			plan.Existing = append(plan.Existing, filename)
+		}
+	}
+
+	return plan, nil
+}
+
+// regionCells Features of the SRTM bounding boxes collection intersecting a region
+func (d *Downloader) regionCells(region Region) ([]*geojson.Feature, error) {
+	if len(region) == 0 {
+		return nil, ErrEmptyRegion
+	}
+
+	if err := d.loadDatasetBbox(); err != nil {
+		return nil, fmt.Errorf("cannot load SRTM bounding boxes. Cause: %w", err)
+	}
+
+	var cells []*geojson.Feature
+
+	for _, feature := range d.datasetBbox.Features {
+		b := feature.Geometry.Geometry().Bound()
+		cell := space.Bound{
+			Min: space.Point{b.Min[0] + bboxMargin, b.Min[1] + bboxMargin},
+			Max: space.Point{b.Max[0] - bboxMargin, b.Max[1] - bboxMargin},
+		}
+
+		intersects, err := region.Intersects(cell.ToPolygon())
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot intersect region with SRTM bounding boxes. Cause: %w", err)
+		}
+
+		if intersects {
+			cells = append(cells, feature)
+		}
+	}
+
+	return cells, nil
+}
+
+// EstimatedDownloadSize Approximate number of bytes to be downloaded
+func (p *DownloadPlan) EstimatedDownloadSize() int64 {
+	return int64(len(p.Files)-len(p.Existing)) * estimatedZipFileSize
+}
+
+// EstimatedDiskSize Number of bytes of the files to be downloaded once saved in the DEM directory. Compressed
+// files are about as large as the downloaded zip files
+func (p *DownloadPlan) EstimatedDiskSize() int64 {
+	if p.Storage == Gzip || p.Storage == Zip {
+		return p.EstimatedDownloadSize()
+	}
+
+	return int64(len(p.Files)-len(p.Existing)) * hgtFileSize
+}
+
+// DownloadRegion Download and uncompress every DEM file intersecting a region
+func (d *Downloader) DownloadRegion(region Region) (*DownloadReport, error) {
+	if d.Offline {
+		return nil, ErrOffline
+	}
+
+	plan, err := d.PlanDownload(region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return d.downloadFiles(plan.Files), nil
+}
+
+// downloadFiles Download zip files and save their HGT files, in chunks of 100 files. Files already in the DEM
+// directory are skipped
+func (d *Downloader) downloadFiles(filenames []string) *DownloadReport {
+	report := &DownloadReport{}
+	d.fillReport(filenames, report, &sync.Mutex{})
+
+	return report
+}
+
+// fillReport Download zip files, adding each file to a report as soon as it is processed. The mutex guards the
+// report, which may be read while the files are downloaded
+func (d *Downloader) fillReport(filenames []string, report *DownloadReport, mutex *sync.Mutex) {
+	d.init()
+
+	t := d.tracker()
+	t.begin(len(filenames))
+
+	add := func(list *[]string, eventType, filename string, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		*list = append(*list, filename)
+
+		done := len(report.Downloaded) + len(report.Skipped) + len(report.Missing) + len(report.Failed)
+		log.Infof("%d / %d file(s) processed", done, len(filenames))
+
+		t.done(eventType, filename, err)
+	}
+
+	for _, chunk := range partitionSlice(filenames, 100) {
+		var wg sync.WaitGroup
+
+		for _, filename := range chunk {
+			if _, ok := d.localDemFile(hgtFileName(filename)); ok {
+				add(&report.Skipped, EventSkipped, filename, nil)
+				continue
+			}
+
+			wg.Add(1)
+
+			go func(filename string) {
+				defer wg.Done()
+
+				path, err := d.fetchDemFile(filename)
+
+				if errors.Is(err, ErrNonExistentDemFile) {
+					add(&report.Missing, EventMissing, filename, nil)
+					return
+				}
+
+				if err != nil {
+					log.Errorf("cannot download HGT file %s. Cause %s", filename, err)
+					add(&report.Failed, EventFailed, filename, err)
+					return
+				}
+
+				d.enforceQuota(filepath.Base(path))
+				add(&report.Downloaded, EventDownloaded, filename, nil)
+			}(filename)
+		}
+
+		wg.Wait()
+	}
+}
+
+// hgtFileName Name of the uncompressed file of a zip file (e.g.: N27E086.SRTMGL1.hgt.zip is N27E086.hgt)
+func hgtFileName(zipFileName string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(zipFileName, ".zip", ""), ".SRTMGL1", "")
+}
@@ -0,0 +1,168 @@
+package srtm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/spatial-go/geoos/geoencoding/geojson"
+)
+
+// testBboxes SRTM bounding boxes collection of the cells between 0 and 2 degrees of latitude and longitude
+func testBboxes(t *testing.T) *geojson.FeatureCollection {
+	t.Helper()
+
+	var features []string
+
+	for lat := 0; lat < 2; lat++ {
+		for lon := 0; lon < 2; lon++ {
+			features = append(features, fmt.Sprintf(`{"type":"Feature","geometry":{"type":"Polygon",`+
+				`"coordinates":[[[%[2]d,%[1]d],[%[4]d,%[1]d],[%[4]d,%[3]d],[%[2]d,%[3]d],[%[2]d,%[1]d]]]},`+
+				`"properties":{"dataFile":"%[5]s"}}`, lat, lon, lat+1, lon+1,
+				generateZipDemFileName(float64(lat), float64(lon))))
+		}
+	}
+
+	collection, err := geojson.UnmarshalFeatureCollection([]byte(
+		`{"type":"FeatureCollection","features":[` + strings.Join(features, ",") + `]}`))
+
+	if err != nil {
+		t.Fatalf("cannot parse bounding boxes. Cause: %s", err)
+	}
+
+	return collection
+}
+
+func TestPlanDownloadBbox(t *testing.T) {
+	t.Parallel()
+
+	d := &Downloader{Dir: t.TempDir(), datasetBbox: testBboxes(t)}
+	os.WriteFile(filepath.Join(d.Dir, "N00E001.hgt"), []byte{}, 0644)
+
+	plan, err := d.PlanDownload(BboxRegion(0.5, 0.2, 1.5, 0.8))
+
+	if err != nil {
+		t.Fatalf("cannot plan download. Cause: %s", err)
+	}
+
+	sort.Strings(plan.Files)
+
+	if strings.Join(plan.Files, ",") != "N00E000.SRTMGL1.hgt.zip,N00E001.SRTMGL1.hgt.zip" {
+		t.Errorf("unexpected files %v", plan.Files)
+	}
+
+	if len(plan.Existing) != 1 || plan.Existing[0] != "N00E001.SRTMGL1.hgt.zip" {
+		t.Errorf("unexpected existing files %v", plan.Existing)
+	}
+
+	if plan.EstimatedDownloadSize() != estimatedZipFileSize || plan.EstimatedDiskSize() != hgtFileSize {
+		t.Errorf("unexpected estimated sizes %d and %d", plan.EstimatedDownloadSize(), plan.EstimatedDiskSize())
+	}
+}
+
+func TestPlanDownloadGeoJSON(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "region.geojson")
+
+	// Triangle crossing the cells (0, 0), (0, 1) and (1, 1), but not (1, 0)
+	os.WriteFile(path, []byte(`{"type":"Feature","properties":{},"geometry":{"type":"Polygon",`+
+		`"coordinates":[[[0.2,0.2],[1.8,0.2],[1.8,1.6],[0.2,0.2]]]}}`), 0644)
+
+	region, err := LoadGeoJSONRegion(path)
+
+	if err != nil {
+		t.Fatalf("cannot load region. Cause: %s", err)
+	}
+
+	d := &Downloader{Dir: t.TempDir(), datasetBbox: testBboxes(t)}
+	plan, err := d.PlanDownload(region)
+
+	if err != nil {
+		t.Fatalf("cannot plan download. Cause: %s", err)
+	}
+
+	sort.Strings(plan.Files)
+
+	expected := "N00E000.SRTMGL1.hgt.zip,N00E001.SRTMGL1.hgt.zip,N01E001.SRTMGL1.hgt.zip"
+
+	if strings.Join(plan.Files, ",") != expected {
+		t.Errorf("expected %s, got %v", expected, plan.Files)
+	}
+}
+
+func TestLoadCountryRegion(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "countries.geojson")
+
+	os.WriteFile(path, []byte(`{"type":"FeatureCollection","features":[`+
+		`{"type":"Feature","properties":{"ADMIN":"Nepal","ISO_A3":"NPL"},"geometry":{"type":"Polygon",`+
+		`"coordinates":[[[80,26],[88,26],[88,30],[80,30],[80,26]]]}},`+
+		`{"type":"Feature","properties":{"ADMIN":"Bhutan","ISO_A3":"BTN"},"geometry":{"type":"Polygon",`+
+		`"coordinates":[[[88,26],[92,26],[92,28],[88,28],[88,26]]]}}]}`), 0644)
+
+	region, err := LoadCountryRegion(path, []string{"npl"})
+
+	if err != nil {
+		t.Fatalf("cannot load country. Cause: %s", err)
+	}
+
+	if len(region) != 1 || region[0].Bound().Max[0] != 88 {
+		t.Errorf("expected the polygon of Nepal, got %v", region)
+	}
+
+	if _, err := LoadCountryRegion(path, []string{"Atlantis"}); err == nil {
+		t.Error("expected an error for an unknown country")
+	}
+}
+
+func TestDownloadRegionReport(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/users/token") {
+			fmt.Fprint(w, `[{"access_token": "token", "expiration_date": "1/1/2100"}]`)
+			return
+		}
+
+		if strings.Contains(r.URL.Path, "N01E000") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write(testHgtZip(hgtFileName(filepath.Base(r.URL.Path))))
+	}))
+
+	defer s.Close()
+
+	d := &Downloader{
+		BasePath:    s.URL,
+		Dir:         t.TempDir(),
+		HttpClient:  http.DefaultClient,
+		Api:         &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient},
+		datasetBbox: testBboxes(t),
+	}
+
+	os.WriteFile(filepath.Join(d.Dir, "N00E001.hgt"), []byte{}, 0644)
+
+	report, err := d.DownloadRegion(BboxRegion(0.1, 0.1, 1.9, 1.9))
+
+	if err != nil {
+		t.Fatalf("cannot download region. Cause: %s", err)
+	}
+
+	if len(report.Downloaded) != 2 || len(report.Skipped) != 1 || len(report.Missing) != 1 ||
+		len(report.Failed) != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if len(report.Missing) == 1 && report.Missing[0] != "N01E000.SRTMGL1.hgt.zip" {
+		t.Errorf("unexpected missing file %s", report.Missing[0])
+	}
+}
@@ -0,0 +1,201 @@
+package srtm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Default limits of the requests made to the SRTM server
+const (
+	defaultMaxAttempts    = 4
+	defaultBaseDelay      = time.Second
+	defaultMaxDelay       = 30 * time.Second
+	defaultMaxConcurrency = 4
+)
+
+// RetryPolicy How failed downloads are retried. Delays grow exponentially from BaseDelay up to MaxDelay
+// with random jitter, unless the server asks for a specific delay with a Retry-After header
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// httpStatusError Unexpected status code received from the SRTM server
+type httpStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("received a %d error during request", e.StatusCode)
+}
+
+// tokenBucket Rate limiter allowing bursts of up to burst requests and rate requests per second on average
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait Block until a request is allowed
+func (b *tokenBucket) Wait() {
+	b.mutex.Lock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+
+	var wait time.Duration
+
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+
+	b.mutex.Unlock()
+
+	time.Sleep(wait)
+}
+
+// withRetries Call download until it succeeds, fails with a permanent error or the attempts are exhausted
+func (d *Downloader) withRetries(name string, download func() error) error {
+	policy := d.retryPolicy()
+
+	var err error
+
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		d.acquireSlot()
+		err = download()
+		d.releaseSlot()
+
+		if err == nil || !isRetryable(err) || attempt == policy.MaxAttempts {
+			break
+		}
+
+		delay := policy.delay(attempt, err)
+
+		log.Warnf("Attempt %d/%d to download %s failed. Retrying in %s. Cause: %s", attempt, policy.MaxAttempts,
+			name, delay, err)
+
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
+// acquireSlot Wait for the rate limit and for a free slot of the maximum concurrency
+func (d *Downloader) acquireSlot() {
+	d.initLimits()
+
+	if d.limiter != nil {
+		d.limiter.Wait()
+	}
+
+	d.slots <- struct{}{}
+}
+
+func (d *Downloader) releaseSlot() {
+	<-d.slots
+}
+
+func (d *Downloader) initLimits() {
+	d.limitsOnce.Do(func() {
+		concurrency := d.MaxConcurrency
+
+		if concurrency <= 0 {
+			concurrency = defaultMaxConcurrency
+		}
+
+		d.slots = make(chan struct{}, concurrency)
+
+		if d.RateLimit > 0 {
+			d.limiter = newTokenBucket(d.RateLimit, concurrency)
+		}
+	})
+}
+
+func (d *Downloader) retryPolicy() RetryPolicy {
+	policy := d.Retry
+
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = defaultBaseDelay
+	}
+
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = defaultMaxDelay
+	}
+
+	return policy
+}
+
+// delay Delay before the next attempt. Retry-After is honored as long as it does not exceed MaxDelay
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	var statusErr *httpStatusError
+
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return time.Duration(math.Min(float64(statusErr.RetryAfter), float64(p.MaxDelay)))
+	}
+
+	backoff := math.Min(float64(p.BaseDelay)*math.Exp2(float64(attempt-1)), float64(p.MaxDelay))
+
+	// Equal jitter: half of the delay is fixed and the other half is random
+	return time.Duration(backoff/2 + rand.Float64()*backoff/2)
+}
+
+// isRetryable Check if an error is transient. Missing files and client errors are permanent, except for
+// request timeouts, rate limiting and expired tokens
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrNonExistentDemFile) || errors.Is(err, ErrCorruptedDemFile) ||
+		errors.Is(err, ErrUnsafeZipEntry) || errors.Is(err, ErrInvalidToken) {
+		return false
+	}
+
+	var statusErr *httpStatusError
+
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode == http.StatusRequestTimeout || statusErr.StatusCode == http.StatusUnauthorized
+	}
+
+	return true
+}
+
+// parseRetryAfter Parse a Retry-After header, expressed in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
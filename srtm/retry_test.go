@@ -0,0 +1,191 @@
+package srtm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyDownloader Downloader whose server answers with the status codes of responses, in order, and then
+// serves the test zip file
+func newFlakyDownloader(t *testing.T, responses []int, handler func()) (*Downloader, *int32) {
+	t.Helper()
+
+	payload, _ := os.ReadFile("testdata/files.zip")
+	var requests int32
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/users/token") {
+			fmt.Fprint(w, `[{"access_token": "token", "expiration_date": "1/1/2100"}]`)
+			return
+		}
+
+		n := int(atomic.AddInt32(&requests, 1))
+
+		if handler != nil {
+			handler()
+		}
+
+		if n <= len(responses) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(responses[n-1])
+			return
+		}
+
+		w.Write(payload)
+	}))
+
+	t.Cleanup(s.Close)
+
+	d := &Downloader{
+		BasePath:                 s.URL,
+		Dir:                      t.TempDir(),
+		HttpClient:               http.DefaultClient,
+		Api:                      &EarthdataApi{BaseUrl: s.URL, HttpClient: http.DefaultClient},
+		Retry:                    RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+		nonExistentZipFiles:      &map[string]bool{},
+		nonExistentZipFilesMutex: &sync.Mutex{},
+		downloads:                make(map[string]*sync.Mutex),
+		downloadsMutex:           &sync.Mutex{},
+	}
+
+	return d, &requests
+}
+
+func TestDownloadRetriesTransientErrors(t *testing.T) {
+	t.Parallel()
+
+	d, requests := newFlakyDownloader(t, []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, nil)
+
+	_, err := d.downloadZippedDemFile(d.BasePath + "/N27E086.SRTMGL1.hgt.zip")
+
+	if err != nil {
+		t.Errorf("expected success after retries but received %s", err)
+	}
+
+	if *requests != 3 {
+		t.Errorf("expected 3 requests but received %d", *requests)
+	}
+}
+
+func TestDownloadGivesUpAfterMaxAttempts(t *testing.T) {
+	t.Parallel()
+
+	d, requests := newFlakyDownloader(t, []int{500, 502, 503, 504}, nil)
+
+	_, err := d.downloadZippedDemFile(d.BasePath + "/N27E086.SRTMGL1.hgt.zip")
+
+	var statusErr *httpStatusError
+
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 503 {
+		t.Errorf("expected the last 503 error but received %v", err)
+	}
+
+	if *requests != 3 {
+		t.Errorf("expected 3 requests but received %d", *requests)
+	}
+}
+
+func TestDownloadDoesNotRetryMissingFiles(t *testing.T) {
+	t.Parallel()
+
+	d, requests := newFlakyDownloader(t, []int{http.StatusNotFound}, nil)
+
+	_, err := d.downloadZippedDemFile(d.BasePath + "/N00E000.SRTMGL1.hgt.zip")
+
+	if !errors.Is(err, ErrNonExistentDemFile) || *requests != 1 {
+		t.Errorf("expected a single request failing with %s but received %d requests and %v",
+			ErrNonExistentDemFile, *requests, err)
+	}
+}
+
+func TestDownloadDoesNotRetryRejectedPreIssuedToken(t *testing.T) {
+	t.Parallel()
+
+	d, requests := newFlakyDownloader(t, []int{http.StatusUnauthorized, http.StatusUnauthorized}, nil)
+	d.Api.Token = "bearer"
+
+	_, err := d.downloadZippedDemFile(d.BasePath + "/N27E086.SRTMGL1.hgt.zip")
+
+	if !errors.Is(err, ErrInvalidToken) || *requests != 1 {
+		t.Errorf("expected a single request failing with %s but received %d requests and %v", ErrInvalidToken,
+			*requests, err)
+	}
+}
+
+func TestDownloadMaxConcurrency(t *testing.T) {
+	t.Parallel()
+
+	var inFlight, maxInFlight int32
+
+	d, _ := newFlakyDownloader(t, nil, func() {
+		n := atomic.AddInt32(&inFlight, 1)
+
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	})
+
+	d.MaxConcurrency = 2
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			d.downloadZippedDemFile(fmt.Sprintf("%s/N%02dE000.SRTMGL1.hgt.zip", d.BasePath, i))
+		}(i)
+	}
+
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Errorf("expected at most 2 simultaneous requests but received %d", maxInFlight)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	t.Parallel()
+
+	bucket := newTokenBucket(50, 1)
+	start := time.Now()
+
+	for i := 0; i < 6; i++ {
+		bucket.Wait()
+	}
+
+	// The first request uses the burst and the next 5 wait 20 ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected requests to be spread over 100 ms but took %s", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	if d := parseRetryAfter("120"); d != 2*time.Minute {
+		t.Errorf("expected 2m but received %s", d)
+	}
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+
+	if d := parseRetryAfter(date); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expected about 1h but received %s", d)
+	}
+}
@@ -1,7 +1,6 @@
 package srtm
 
 import (
-	"archive/zip"
 	"errors"
 	"fmt"
 	"io"
@@ -25,6 +24,8 @@ var ErrNonExistentDemFile = errors.New("cannot locate DEM file on remote reposit
 
 var ErrTileNotInsideSrtmCoverage = errors.New("tile is not inside SRTM coverage")
 
+var ErrOffline = errors.New("SRTM downloader is offline")
+
 // SRTM30 dataset base url
 var defaultSRTMServerURL = "https://e4ftl01.cr.usgs.gov/MEASURES/SRTMGL1.003/2000.02.11/"
 
@@ -32,106 +33,128 @@ var defaultSRTMServerURL = "https://e4ftl01.cr.usgs.gov/MEASURES/SRTMGL1.003/200
 var filePathSep = strings.ReplaceAll(strconv.QuoteRune(os.PathSeparator), "'", "")
 
 type Downloader struct {
-	BasePath                 string
-	Dir                      string
-	HttpClient               *http.Client
-	Api                      *EarthdataApi
+	// BasePath URL of the SRTM30m dataset. May be a mirror on a plain HTTP server or a file:// directory
+	BasePath   string
+	Dir        string
+	HttpClient *http.Client
+	// Api EarthData API used to authenticate downloads. Nil when BasePath is a mirror without authentication
+	Api *EarthdataApi
+	// Offline Never access the network. Files missing in Dir are treated as voids
+	Offline bool
+	// Quota Maximum size of Dir. Nil when Dir grows without limit
+	Quota *DiskQuota
+	// Storage Format of the HGT files saved in Dir. Default is Uncompressed
+	Storage Storage
+	// ChecksumsFile Optional md5sum or sha256sum file with the published checksums of the zip files
+	ChecksumsFile string
+	// Retry Retry policy of failed downloads
+	Retry RetryPolicy
+	// RateLimit Maximum average number of download requests per second. Zero disables the limit
+	RateLimit float64
+	// MaxConcurrency Maximum number of simultaneous download requests. Default is 4
+	MaxConcurrency           int
 	datasetBbox              *geojson.FeatureCollection
 	nonExistentZipFiles      *map[string]bool
 	nonExistentZipFilesMutex *sync.Mutex
 	downloads                map[string]*sync.Mutex
 	downloadsMutex           *sync.Mutex
+	limitsOnce               sync.Once
+	progressOnce             sync.Once
+	progress                 *progressTracker
+	jobs                     prefetchJobs
+	limiter                  *tokenBucket
+	slots                    chan struct{}
 }
 
+// DownloadDemFile Download the HGT file containing a coordinate, unless it is already in Dir. Returns its path
 func (d *Downloader) DownloadDemFile(pLat, pLon float64) (string, error) {
-	if d.nonExistentZipFiles == nil {
-		d.nonExistentZipFiles = &map[string]bool{}
-		d.nonExistentZipFilesMutex = &sync.Mutex{}
-	}
+	d.init()
 
-	if d.downloads == nil {
-		d.downloads = make(map[string]*sync.Mutex)
-		d.downloadsMutex = &sync.Mutex{}
+	filename := generateZipDemFileName(pLat, pLon)
+
+	if path, ok := d.localDemFile(hgtFileName(filename)); ok {
+		return path, nil
 	}
 
-	filename := generateZipDemFileName(pLat, pLon)
-	zipFilepath := d.Dir + filePathSep + filename
+	if d.Offline {
+		return "", ErrOffline
+	}
 
-	demFilePath := strings.ReplaceAll(zipFilepath, ".zip", "")
-	demFilePath = strings.ReplaceAll(demFilePath, ".SRTMGL1", "")
+	t := d.tracker()
+	t.begin(1)
 
-	if !d.checkIfDemFileExists(demFilePath) {
-		zipPath, _, err := d.downloadZippedDemFileWithCoordinates(pLat, pLon)
+	path, err := d.fetchDemFile(filename)
 
-		if err != nil {
-			return "", fmt.Errorf("cannot download HGT file for coordinates %f, %f. "+
-				"Cause %w", pLat, pLon, err)
-		}
+	switch {
+	case errors.Is(err, ErrNonExistentDemFile):
+		t.done(EventMissing, filename, nil)
+	case err != nil:
+		t.done(EventFailed, filename, err)
+	default:
+		t.done(EventDownloaded, filename, nil)
+	}
 
-		return d.unzipDemFile(zipPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot download HGT file for coordinates %f, %f. "+
+			"Cause %w", pLat, pLon, err)
 	}
 
-	return demFilePath, nil
+	d.enforceQuota(filepath.Base(path))
+
+	return path, nil
 }
 
-func (d *Downloader) DownloadAllDemFiles() error {
-	if d.BasePath == "" {
-		d.BasePath = defaultSRTMServerURL
+// enforceQuota Record the download of a HGT file and evict other files when the DEM directory exceeds its quota
+func (d *Downloader) enforceQuota(name string) {
+	if d.Quota == nil {
+		return
 	}
 
-	if d.nonExistentZipFiles == nil {
-		d.nonExistentZipFiles = &map[string]bool{}
-		d.nonExistentZipFilesMutex = &sync.Mutex{}
+	d.Quota.Touch(name)
+
+	if _, err := d.Quota.Enforce(); err != nil {
+		log.Warnf("cannot enforce DEM directory quota. Cause: %s", err)
 	}
+}
 
-	if d.downloads == nil {
-		d.downloads = make(map[string]*sync.Mutex)
-		d.downloadsMutex = &sync.Mutex{}
+// DownloadAllDemFiles Download every file of the SRTM30m dataset
+func (d *Downloader) DownloadAllDemFiles() (*DownloadReport, error) {
+	if d.Offline {
+		return nil, ErrOffline
 	}
 
 	err := d.loadDatasetBbox()
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	chunks := partitionSlice(d.datasetBbox.Features, 100)
-
-	for _, chunk := range chunks {
-		var c int64
-		var wg sync.WaitGroup
-
-		for _, feature := range chunk {
-			wg.Add(1)
-
-			go func(feature *geojson.Feature) {
-				filename := feature.Properties.MustString("dataFile")
-				url := d.BasePath + "/" + filename
-				path, _, err := d.downloadZippedDemFile(url)
+	filenames := make([]string, len(d.datasetBbox.Features))
 
-				if err != nil {
-					log.Errorf("cannot download HGT file %s. Cause %s", url, err)
-				}
-
-				_, err = d.unzipDemFile(path)
-
-				if err != nil {
-					log.Errorf("cannot unzip file %s. Cause %s", url, err)
-				}
+	for i, feature := range d.datasetBbox.Features {
+		filenames[i] = feature.Properties.MustString("dataFile")
+	}
 
-				c++
+	return d.downloadFiles(filenames), nil
+}
 
-				log.Infof("%d / %d file(s) downloaded", c, len(d.datasetBbox.Features))
-			}(feature)
-		}
+func (d *Downloader) init() {
+	if d.BasePath == "" {
+		d.BasePath = defaultSRTMServerURL
+	}
 
-		wg.Wait()
+	if d.nonExistentZipFiles == nil {
+		d.nonExistentZipFiles = &map[string]bool{}
+		d.nonExistentZipFilesMutex = &sync.Mutex{}
 	}
 
-	return nil
+	if d.downloads == nil {
+		d.downloads = make(map[string]*sync.Mutex)
+		d.downloadsMutex = &sync.Mutex{}
+	}
 }
 
-func (d *Downloader) downloadZippedDemFileWithCoordinates(lat, lon float64) (string, []byte, error) {
+func (d *Downloader) downloadZippedDemFileWithCoordinates(lat, lon float64) (string, error) {
 	if d.BasePath == "" {
 		d.BasePath = defaultSRTMServerURL
 	}
@@ -139,121 +162,71 @@ func (d *Downloader) downloadZippedDemFileWithCoordinates(lat, lon float64) (str
 	filename := generateZipDemFileName(lat, lon)
 
 	if d.isZipFileNonExistent(filename) {
-		return "", nil, ErrNonExistentDemFile
+		return "", ErrNonExistentDemFile
 	}
 
-	url := d.BasePath + "/" + filename
-
-	return d.downloadZippedDemFile(url)
+	return d.downloadZippedDemFile(d.fileUrl(filename))
 }
 
-func (d *Downloader) downloadZippedDemFile(url string) (string, []byte, error) {
+// downloadZippedDemFile Stream a zip file to a temporary .part file, resuming a previous interrupted download
+// with an HTTP Range request. The file is moved into Dir only after its integrity is verified
+func (d *Downloader) downloadZippedDemFile(url string) (string, error) {
 	filename := filepath.Base(url)
 
-	d.downloadsMutex.Lock()
-	mutex, ok := d.downloads[filename]
-
-	if !ok {
-		mutex = &sync.Mutex{}
-		d.downloads[filename] = mutex
-	}
-
-	d.downloadsMutex.Unlock()
-
-	mutex.Lock()
+	unlock := d.lock(filename)
+	defer unlock()
 
 	demFilepath := d.Dir + filePathSep + filename
 
 	if d.checkIfDemFileExists(demFilepath) {
-		b, err := os.ReadFile(demFilepath)
-
-		if err != nil {
-			return "", nil, fmt.Errorf("cannot read %s file. cause: %w", demFilepath, err)
-		}
-
-		return demFilepath, b, nil
+		return demFilepath, nil
 	}
 
-	token, err := d.Api.GenerateToken()
-
-	if err != nil {
-		return "", nil, fmt.Errorf("cannot generate EarthData API token. Cause %w", err)
+	if d.Offline {
+		return "", ErrOffline
 	}
 
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("Authorization", "Bearer "+token.AccessToken)
+	partPath := demFilepath + partFileSuffix
 
 	log.Infof("Downloading file %s from SRTM30m server...", filename)
 
 	start := time.Now()
 
-	resp, err := client.Do(req)
-
-	if err != nil {
-		err := fmt.Errorf("cannot download hgt file %s. Cause: %w", filename, err)
-		log.Errorf(err.Error())
-		mutex.Unlock()
-		return "", nil, err
-	}
+	var headers http.Header
 
-	log.Infof("File %s request completed. Status: %d", filename, resp.StatusCode)
-
-	if resp.StatusCode != 200 {
-		mutex.Unlock()
-
-		if resp.StatusCode == 404 {
-			d.nonExistentZipFilesMutex.Lock()
-			(*d.nonExistentZipFiles)[filename] = true
-			d.nonExistentZipFilesMutex.Unlock()
+	err := d.download(filename, func(accessToken string) error {
+		var err error
+		headers, err = d.downloadToPartFile(url, partPath, accessToken)
+		return err
+	})
 
-			err := fmt.Errorf("received a %d error during file %s request. Cause %w",
-				resp.StatusCode, url, ErrNonExistentDemFile)
-			return "", nil, err
-		}
+	if err != nil {
+		log.Errorf("cannot download hgt file %s. Cause: %s", filename, err)
 
-		msg := fmt.Sprintf("received a %d error during request", resp.StatusCode)
-		return "", nil, errors.New(msg)
+		return "", err
 	}
 
-	defer resp.Body.Close()
-
-	b, err := io.ReadAll(resp.Body)
+	err = d.verifyDownload(partPath, filename, headers)
 
 	if err != nil {
-		mutex.Unlock()
-		return "", nil, fmt.Errorf("cannot download file %s. cause: %w", url, err)
+		os.Remove(partPath)
+		return "", fmt.Errorf("cannot verify file %s. Cause: %w", filename, err)
 	}
 
-	err = d.saveZipHgtFile(demFilepath, b)
+	err = os.Rename(partPath, demFilepath)
 
 	if err != nil {
-		mutex.Unlock()
-		return "", nil, fmt.Errorf("cannot save %s file. cause: %w", demFilepath, err)
+		return "", fmt.Errorf("cannot save %s file. cause: %w", demFilepath, err)
 	}
 
-	duration := time.Since(start)
-
-	log.Infof("File %s downloaded in %s", filename, duration)
+	log.Infof("File %s downloaded in %s", filename, time.Since(start))
 
-	mutex.Unlock()
-	return demFilepath, b, nil
+	return demFilepath, nil
 }
 
-func (d *Downloader) saveZipHgtFile(path string, bytes []byte) error {
-	if d.checkIfDemFileExists(path) {
-		return nil
-	}
-
-	err := os.WriteFile(path, bytes, 0644)
-
-	if err != nil {
-		return fmt.Errorf("cannot save HGT file %s. cause: %w", path, err)
-	}
-
-	log.Infof("Zip file saved on %s", path)
-
-	return nil
+// fileUrl URL of a zip file on the SRTM server or mirror
+func (d *Downloader) fileUrl(filename string) string {
+	return strings.TrimSuffix(d.BasePath, "/") + "/" + filename
 }
 
 func (d *Downloader) checkIfDemFileExists(path string) bool {
@@ -264,74 +237,21 @@ func (d *Downloader) checkIfDemFileExists(path string) bool {
 	return false
 }
 
-func (d *Downloader) unzipDemFile(path string) (string, error) {
-	if d.checkIfDemFileExists(strings.ReplaceAll(path, ".zip", "")) {
-		return path, nil
-	}
-
-	files, err := d.unzip(path, d.Dir)
-
-	if err != nil {
-		return "", fmt.Errorf("cannot unzip file %s. Cause %w", path, err)
-	}
-
-	if len(files) < 1 {
-		return "", fmt.Errorf("cannot uncompress file %s", path)
-	}
-
-	log.Infof("File %s is uncompressed", path)
-
-	err = os.Remove(path)
-	if err != nil {
-		log.Warnf("cannot remove zip file %s. Cause: %s", path, err)
-	}
-
-	return files[0], nil
-}
-
-func (d *Downloader) unzip(zipFile string, destFolder string) ([]string, error) {
-	var files []string
+// lock Lock the download of a file, so concurrent requests of a file download it only once
+func (d *Downloader) lock(filename string) func() {
+	d.downloadsMutex.Lock()
+	mutex, ok := d.downloads[filename]
 
-	r, err := zip.OpenReader(zipFile)
-	if err != nil {
-		return nil, err
+	if !ok {
+		mutex = &sync.Mutex{}
+		d.downloads[filename] = mutex
 	}
-	defer r.Close()
 
-	if err := os.MkdirAll(destFolder, 0755); err != nil {
-		return nil, err
-	}
+	d.downloadsMutex.Unlock()
 
-	for _, f := range r.File {
-		rc, err := f.Open()
-		if err != nil {
-			return nil, err
-		}
-		defer rc.Close()
-
-		path := filepath.Join(destFolder, f.Name)
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(path, f.Mode())
-		} else {
-			if err := os.MkdirAll(filepath.Dir(path), f.Mode()); err != nil {
-				return nil, err
-			}
-
-			outFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-			if err != nil {
-				return nil, err
-			}
-			defer outFile.Close()
-
-			files = append(files, outFile.Name())
-
-			if _, err := io.Copy(outFile, rc); err != nil {
-				return nil, err
-			}
-		}
-	}
+	mutex.Lock()
 
-	return files, nil
+	return mutex.Unlock
 }
 
 func (d *Downloader) isPointInsideDataSet(lon, lat float64) (bool, error) {
@@ -414,11 +334,11 @@ func pad(str string, length int, pad string) string {
 }
 
 // PartitionSlice partitions a slice into chunks of the given size.
-func partitionSlice(slice []*geojson.Feature, chunkSize int) [][]*geojson.Feature {
+func partitionSlice[T any](slice []T, chunkSize int) [][]T {
 	if chunkSize <= 0 {
 		return nil
 	}
-	var chunks [][]*geojson.Feature
+	var chunks [][]T
 	for chunkSize < len(slice) {
 		slice, chunks = slice[chunkSize:], append(chunks, slice[0:chunkSize:chunkSize])
 	}
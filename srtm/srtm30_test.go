@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
 	"strings"
 	"sync"
 	"testing"
@@ -40,13 +41,7 @@ var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *
 		http.Error(w, "Not found", http.StatusNotFound)
 	}
 
-	b, err := os.ReadFile("testdata/files.zip")
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-	}
-
-	w.Write(b)
+	w.Write(testHgtZip(hgtFileName(path.Base(r.URL.Path))))
 }))
 
 // TODO This is test is flaky. It's possible to notice that when you run the entire test suite
@@ -111,21 +106,16 @@ func TestDownloadZippedDemFileWithCoordinates(t *testing.T) {
 		downloadsMutex:           &sync.Mutex{},
 	}
 
-	path, b, err := d.downloadZippedDemFileWithCoordinates(27.687619, 86.731679)
-
-	os.Remove(path)
+	path, err := d.downloadZippedDemFileWithCoordinates(27.687619, 86.731679)
 
 	if err != nil {
 		t.Errorf("error during hgt file download. cause: %s", err)
 	}
 
-	payload, err := os.ReadFile("testdata/files.zip")
-
-	if err != nil {
-		t.Errorf("cannot open test zip file. Cause: %s", err)
-	}
+	b, _ := os.ReadFile(path)
+	os.Remove(path)
 
-	if !bytes.Equal(b, payload) {
+	if !bytes.Equal(b, testHgtZip("N27E086.hgt")) {
 		t.Errorf("returned bytes are different of payload bytes")
 	}
 }
@@ -146,25 +136,9 @@ func TestDownloadZipFile404(t *testing.T) {
 		downloadsMutex:           &sync.Mutex{},
 	}
 
-	_, _, err := d.downloadZippedDemFileWithCoordinates(0.0, 0.0)
+	_, err := d.downloadZippedDemFileWithCoordinates(0.0, 0.0)
 
 	if err != nil && !errors.Is(errors.Unwrap(err), ErrNonExistentDemFile) {
 		t.Errorf("expected %s error but received: %s", ErrNonExistentDemFile, errors.Unwrap(err))
 	}
 }
-
-func TestUnzip(t *testing.T) {
-	t.Parallel()
-
-	d := Downloader{}
-
-	files, err := d.unzip("testdata/files.zip", "testdata")
-
-	for _, f := range files {
-		os.Remove(f)
-	}
-
-	if err != nil {
-		t.Errorf("cannot unzip test file. Cause: %s", err)
-	}
-}
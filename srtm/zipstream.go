@@ -0,0 +1,184 @@
+package srtm
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	zipLocalHeaderSignature    = 0x04034b50
+	zipCentralHeaderSignature  = 0x02014b50
+	zipEndSignature            = 0x06054b50
+	zipDataDescriptorSignature = 0x08074b50
+	zip64ExtraId               = 0x0001
+	zipDataDescriptorFlag      = 0x8
+)
+
+// zipEntryHeader Local file header of a zip entry
+type zipEntryHeader struct {
+	name           string
+	flags          uint16
+	method         uint16
+	crc32          uint32
+	compressedSize uint64
+	size           uint64
+	zip64          bool
+}
+
+// nextZipEntry Read the local file header of the next entry of a zip stream. Returns io.EOF at the central
+// directory, which follows the last entry
+func nextZipEntry(r *bufio.Reader) (*zipEntryHeader, error) {
+	var b [30]byte
+
+	if _, err := io.ReadFull(r, b[:4]); err != nil {
+		return nil, err
+	}
+
+	switch binary.LittleEndian.Uint32(b[:4]) {
+	case zipLocalHeaderSignature:
+	case zipCentralHeaderSignature, zipEndSignature:
+		return nil, io.EOF
+	default:
+		return nil, errors.New("invalid zip local file header")
+	}
+
+	if _, err := io.ReadFull(r, b[4:]); err != nil {
+		return nil, err
+	}
+
+	h := &zipEntryHeader{
+		flags:          binary.LittleEndian.Uint16(b[6:]),
+		method:         binary.LittleEndian.Uint16(b[8:]),
+		crc32:          binary.LittleEndian.Uint32(b[14:]),
+		compressedSize: uint64(binary.LittleEndian.Uint32(b[18:])),
+		size:           uint64(binary.LittleEndian.Uint32(b[22:])),
+	}
+
+	name := make([]byte, binary.LittleEndian.Uint16(b[26:]))
+	extra := make([]byte, binary.LittleEndian.Uint16(b[28:]))
+
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(r, extra); err != nil {
+		return nil, err
+	}
+
+	h.name = string(name)
+
+	// Zip64 entries store their sizes in an extra field, uncompressed size first
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+
+		if size > len(extra)-4 {
+			break
+		}
+
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+
+		if id != zip64ExtraId {
+			continue
+		}
+
+		h.zip64 = true
+
+		if h.size == 0xFFFFFFFF && len(field) >= 8 {
+			h.size = binary.LittleEndian.Uint64(field)
+			field = field[8:]
+		}
+
+		if h.compressedSize == 0xFFFFFFFF && len(field) >= 8 {
+			h.compressedSize = binary.LittleEndian.Uint64(field)
+		}
+	}
+
+	return h, nil
+}
+
+// readZipEntry Decompress the data of an entry to w, checking its size and CRC-32. Returns the number of bytes
+// written
+func readZipEntry(r *bufio.Reader, h *zipEntryHeader, w io.Writer) (int64, error) {
+	hasDescriptor := h.flags&zipDataDescriptorFlag != 0
+
+	var data io.Reader
+
+	switch h.method {
+	case zip.Store:
+		if hasDescriptor {
+			return 0, fmt.Errorf("entry %s is stored without its size", h.name)
+		}
+
+		data = io.LimitReader(r, int64(h.compressedSize))
+	case zip.Deflate:
+		// bufio.Reader is an io.ByteReader, so flate does not read beyond the end of the entry
+		fr := flate.NewReader(r)
+		defer fr.Close()
+
+		data = fr
+	default:
+		return 0, fmt.Errorf("entry %s uses the unsupported compression method %d", h.name, h.method)
+	}
+
+	crc := crc32.NewIEEE()
+	n, err := io.Copy(io.MultiWriter(w, crc), data)
+
+	if err != nil {
+		return n, err
+	}
+
+	if hasDescriptor {
+		if err := readZipDataDescriptor(r, h); err != nil {
+			return n, err
+		}
+	}
+
+	if uint64(n) != h.size {
+		return n, fmt.Errorf("entry %s has %d bytes, expected %d", h.name, n, h.size)
+	}
+
+	if crc.Sum32() != h.crc32 {
+		return n, fmt.Errorf("entry %s has an invalid CRC-32", h.name)
+	}
+
+	return n, nil
+}
+
+// readZipDataDescriptor Read the CRC-32 and sizes written after the data of an entry. The signature is optional
+func readZipDataDescriptor(r *bufio.Reader, h *zipEntryHeader) error {
+	sizeLength := 4
+
+	if h.zip64 {
+		sizeLength = 8
+	}
+
+	if b, err := r.Peek(4); err == nil && binary.LittleEndian.Uint32(b) == zipDataDescriptorSignature {
+		r.Discard(4)
+	}
+
+	b := make([]byte, 4+2*sizeLength)
+
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+
+	h.crc32 = binary.LittleEndian.Uint32(b)
+
+	if h.zip64 {
+		h.compressedSize = binary.LittleEndian.Uint64(b[4:])
+		h.size = binary.LittleEndian.Uint64(b[12:])
+	} else {
+		h.compressedSize = uint64(binary.LittleEndian.Uint32(b[4:]))
+		h.size = uint64(binary.LittleEndian.Uint32(b[8:]))
+	}
+
+	return nil
+}